@@ -0,0 +1,226 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// AdoptReport describes the result of AdoptLegacy.
+type AdoptReport struct {
+	Shards     int // shard directories with a manifest
+	Objects    int // objects which were checksummed
+	Backfilled int // objects whose digest was recorded
+}
+
+// Legacy reports whether the store was created by a version of this package
+// without checksum manifests (see Verify), and has not been adopted yet.
+// Such stores are detected by New, as they contain objects, but no manifest
+// directory. They work as before, see AdoptLegacy for upgrading them.
+func (s *SOS) Legacy() bool {
+	return s.legacy.Load()
+}
+
+// AdoptLegacy upgrades a legacy store in place: it writes the checksum
+// manifests of all shard directories, like the first Verify. If backfill is
+// true, the digest of each object without one is recorded in its object file
+// as well, as if it was stored with WithDigests, which the store must have
+// been created with.
+//
+// The store is processed shard by shard, and remains fully usable. The
+// progress is kept in the manifests, so an adoption which is interrupted by
+// cancelling ctx, or by a crash, continues where it stopped when it is called
+// again. It can be run in the background, e.g. in a goroutine. Afterwards,
+// Legacy reports false, also for stores opened later.
+//
+// A backfilled object file is rewritten, keeping its modification time. It
+// is replaced like in CompareAndSwap, but a plain Store of the same key may
+// cause readers to find the key missing for a moment.
+func (s *SOS) AdoptLegacy(ctx context.Context, backfill bool) (report AdoptReport, err error) {
+	defer s.wraperr(&err, "AdoptLegacy", "")
+
+	if backfill && !s.digests {
+		return report, fmt.Errorf("backfilling digests requires WithDigests")
+	}
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	shards, dirs, err := s.shardlistings()
+	if err != nil {
+		return report, err
+	}
+
+	var vr VerifyReport
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		entries := shards[dir]
+		if backfill {
+			for _, e := range entries {
+				done, err := s.backfilldigest(dir + e.name)
+				if err != nil {
+					return report, err
+				}
+				if done {
+					report.Backfilled++
+				}
+			}
+		}
+		if err := s.verifyshard(dir, entries, false, make(map[string]bool), &vr); err != nil {
+			return report, err
+		}
+	}
+	report.Shards, report.Objects = vr.Shards, vr.Objects
+
+	// an empty store has no manifests, but is adopted as well
+	if err := s.mkdirall(filepath.Join(s.base, dirManifests)); err != nil {
+		return report, err
+	}
+	s.legacy.Store(false)
+	return report, nil
+}
+
+// detectlegacy reports whether the store holds objects, but has no manifest
+// directory. Otherwise, the manifest directory is created, so a new store is
+// never taken for a legacy one.
+func (s *SOS) detectlegacy() (bool, error) {
+	if _, err := os.Stat(filepath.Join(s.base, dirManifests)); !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	entries, err := os.ReadDir(s.base)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if !isreserved(e.Name()) {
+			// another process may have created the store in the meantime
+			_, err := os.Stat(filepath.Join(s.base, dirManifests))
+			if errors.Is(err, fs.ErrNotExist) {
+				return true, nil
+			}
+			return false, err
+		}
+	}
+	return false, s.mkdirall(filepath.Join(s.base, dirManifests))
+}
+
+// backfilldigest records the digest of the plain value in the object file at
+// the relative path rel, unless it has one already. It returns whether the
+// object file was rewritten.
+func (s *SOS) backfilldigest(rel string) (bool, error) {
+	if err := s.beginmodify(); err != nil {
+		return false, err
+	}
+	defer s.endmodify()
+
+	hs := s.relhash(rel)
+	unlock, err := s.lockhash(hs)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	filename := filepath.Join(s.base, filepath.FromSlash(rel))
+	fh, err := s.openfile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil // deleted in the meantime
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return false, err
+	}
+	h, rd, err := s.decodeheader(fh)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil // expired
+	}
+	if err != nil {
+		return false, err
+	}
+	if h != nil && h.fields[tagParts] != nil {
+		return false, nil
+	}
+	if _, ok := headerdigest(h); ok {
+		return false, nil
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, rd)
+	if err != nil {
+		return false, err
+	}
+
+	// copy the encoded value as it is, with the digest added to the header
+	if _, err := fh.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	br := bufio.NewReader(fh)
+	if h, err = readheader(br); err != nil {
+		return false, err
+	}
+	if h == nil {
+		h = &header{fields: make(map[byte][]byte)}
+	}
+	h.fields[tagDigest] = binary.BigEndian.AppendUint64(hash.Sum(nil), uint64(n))
+
+	tmpname := s.tmpfilename()
+	defer os.Remove(tmpname)
+	if err := s.rewritefile(tmpname, h, br); err != nil {
+		return false, err
+	}
+	if err := os.Chtimes(tmpname, fi.ModTime(), fi.ModTime()); err != nil {
+		return false, err
+	}
+
+	// replace the object file only if it was not changed in the meantime
+	replaced := false
+	err = s.change(hs, true, func() error {
+		taken := s.tmpfilename()
+		if err := os.Rename(filename, taken); err != nil {
+			return err
+		}
+		defer os.Remove(taken)
+
+		moved, err := os.Stat(taken)
+		if err != nil {
+			return err
+		}
+		source := taken
+		if os.SameFile(fi, moved) {
+			source = tmpname
+		}
+		// a value stored in the meantime is newer, so it is kept
+		err = os.Link(source, filename)
+		if errors.Is(err, fs.ErrExist) {
+			return nil
+		}
+		replaced = err == nil && source == tmpname
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return replaced, err
+}
@@ -0,0 +1,102 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// legacyStore creates a store with some objects and without manifests, like
+// a store of an older version, and opens it again with the given options.
+func legacyStore(t *testing.T, opts ...Option) *SOS {
+	t.Helper()
+
+	old := NewTemp(t)
+	if old.Legacy() {
+		t.Errorf("A new store is reported as legacy store")
+	}
+	for i := 0; i < 20; i++ {
+		old.StoreString(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	old.Close()
+	os.RemoveAll(filepath.Join(old.base, dirManifests))
+
+	s, err := New(old.base, opts...)
+	if err != nil {
+		t.Fatalf("Opening the store failed: %v", err)
+	}
+	return s
+}
+
+// Test adopting a legacy store with backfilling of digests
+func TestAdoptLegacy(t *testing.T) {
+	s := legacyStore(t, WithDigests())
+	if !s.Legacy() {
+		t.Fatalf("The store is not detected as legacy store")
+	}
+	mtime := func() int64 {
+		info, _ := s.Stat("key1")
+		return info.ModTime.UnixNano()
+	}
+	before := mtime()
+
+	report, err := s.AdoptLegacy(context.Background(), true)
+	if err != nil {
+		t.Fatalf("AdoptLegacy failed: %v", err)
+	}
+	if report.Objects != 20 || report.Backfilled != 20 || s.Legacy() {
+		t.Errorf("Got report %+v, legacy %v, expected 20 adopted objects", report, s.Legacy())
+	}
+
+	obj, err := s.GetObject("key1")
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	obj.Close()
+	if expected := sha256.Sum256([]byte("value1")); !obj.HasDigest || obj.Digest.SHA256 != expected || obj.Digest.Size != 6 {
+		t.Errorf("Got digest %s/%d, expected %x/%d", obj.Digest, obj.Digest.Size, expected, 6)
+	}
+	if obj, _ := s.GetString("key1"); obj != "value1" {
+		t.Errorf("Got %s from store, expected %s", obj, "value1")
+	}
+	if after := mtime(); after != before {
+		t.Errorf("Backfilling changed the modification time")
+	}
+
+	// the manifests are complete, so Verify reads nothing
+	if vr, _ := s.Verify(false); vr.Scanned != 0 {
+		t.Errorf("Verify scanned %d shards after the adoption, expected none", vr.Scanned)
+	}
+
+	s.Close()
+	if s, _ := New(s.base); s.Legacy() {
+		t.Errorf("An adopted store is reported as legacy store")
+	}
+}
+
+// Test that an interrupted adoption is resumed
+func TestAdoptLegacyCancel(t *testing.T) {
+	s := legacyStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.AdoptLegacy(ctx, false); !errors.Is(err, context.Canceled) || !s.Legacy() {
+		t.Errorf("Got %v from a cancelled adoption, expected context.Canceled", err)
+	}
+
+	if _, err := s.AdoptLegacy(context.Background(), true); err == nil {
+		t.Errorf("Backfilling succeeded without WithDigests")
+	}
+	if report, err := s.AdoptLegacy(context.Background(), false); err != nil || report.Objects != 20 {
+		t.Errorf("Got report %+v, %v, expected 20 adopted objects", report, err)
+	}
+}
@@ -0,0 +1,171 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Append appends data to the value of a key. If the key does not exist, it
+// is created with data as value.
+func (s *SOS) Append(key string, data []byte) error {
+	return s.AppendFrom(key, bytes.NewReader(data))
+}
+
+// AppendFrom appends the data read from an io.Reader to the value of a key,
+// like Append.
+//
+// The object is never modified in place. The extended value is written to a
+// temporary file, which then replaces the object atomically, so readers see
+// either the old or the extended value, but never a torn one. The extended
+// value is written first, and then replaces the object under a lock file
+// (see CompareAndSwap), if the object was not replaced in the meantime.
+// Otherwise it is written again, so no data of concurrent appends is lost. The time to live (see StoreWithTTL) and the metadata (see
+// StoreWithMeta) of an object are kept.
+func (s *SOS) AppendFrom(key string, rd io.Reader) (err error) {
+	o := s.startop(context.Background(), "Append", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Append", key)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return err
+		}
+	}
+
+	// the data is spooled, so the extended value can be written again if
+	// the object is replaced while it is written
+	spoolname := s.tmpfilename()
+	defer os.Remove(spoolname)
+	n, err := s.spool(spoolname, rd)
+	if err != nil {
+		return err
+	}
+
+	for {
+		err = s.appendonce(key, spoolname)
+		if !errors.Is(err, errReplaced) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	o.info.Bytes = n
+	s.usage("Append", key, n)
+	s.notify("Append", key, n)
+	return nil
+}
+
+// spool copies the data read from rd to the file filename, and returns its
+// size.
+func (s *SOS) spool(filename string, rd io.Reader) (int64, error) {
+	wr, err := s.createfile(filename)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(wr, rd)
+	if cerr := wr.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// appendonce writes the current value of the key, followed by the data in
+// the file spoolname, to a temporary file, and replaces the object with it.
+// The temporary file, and its chunks, are written before the modification
+// is registered and the lock of the key is taken. If the object was replaced
+// in the meantime, errReplaced is returned.
+func (s *SOS) appendonce(key, spoolname string) error {
+	dirname, filename := s.getpath(key)
+	var value io.Reader = bytes.NewReader(nil)
+	var fields map[byte][]byte
+	current, err := os.Open(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if current != nil {
+		defer current.Close()
+		h, crd, err := s.decodeheader(current)
+		if errors.Is(err, ErrNotFound) {
+			// expired, so it is replaced like a missing object
+			h, crd, err = nil, bytes.NewReader(nil), nil
+		}
+		if err != nil {
+			return err
+		}
+		if h != nil && h.fields[tagParts] != nil {
+			return errParts
+		}
+		if h != nil {
+			// keep the time to live and the metadata
+			for _, tag := range []byte{tagExpires, tagMeta} {
+				if data := h.fields[tag]; data != nil {
+					if fields == nil {
+						fields = make(map[byte][]byte)
+					}
+					fields[tag] = data
+				}
+			}
+		}
+		value = crd
+	}
+
+	data, err := os.Open(spoolname)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	tmpname, _, err := s.writetmpenc(io.MultiReader(value, data), -1, func(w io.Writer, rd io.Reader) error {
+		return s.encodefields(w, rd, fields)
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpname)
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockkey(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.change(s.keyhash(key), true, func() error {
+		var err error
+		same := false
+		if current == nil {
+			_, err = os.Stat(filename)
+			if errors.Is(err, fs.ErrNotExist) {
+				same, err = true, nil
+			}
+		} else {
+			same, err = samefile(current, filename)
+		}
+		if err != nil {
+			return err
+		}
+		if !same {
+			return errReplaced
+		}
+		return s.commitfile(tmpname, dirname, filename)
+	})
+}
@@ -0,0 +1,125 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test appending to new and existing values
+func TestAppend(t *testing.T) {
+	s := NewTemp(t)
+
+	if err := s.Append("log", []byte("one\n")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := s.AppendFrom("log", strings.NewReader("two\n")); err != nil {
+		t.Fatalf("AppendFrom failed: %v", err)
+	}
+	if obj, _ := s.GetString("log"); obj != "one\ntwo\n" {
+		t.Errorf("Got %q from store, expected %q", obj, "one\ntwo\n")
+	}
+}
+
+// Test that concurrent appends lose no data
+func TestAppendConcurrent(t *testing.T) {
+	s := NewTemp(t)
+
+	const workers = 8
+	const appends = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < appends; j++ {
+				if err := s.Append("log", []byte("x")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	obj, _ := s.GetString("log")
+	if len(obj) != workers*appends {
+		t.Errorf("Got a value of %d bytes, expected %d", len(obj), workers*appends)
+	}
+}
+
+// Test that appending keeps the time to live
+func TestAppendTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+
+	s.StoreWithTTL("log", []byte("one\n"), time.Minute)
+	s.Append("log", []byte("two\n"))
+	if obj, _ := s.GetString("log"); obj != "one\ntwo\n" {
+		t.Errorf("Got %q from store, expected %q", obj, "one\ntwo\n")
+	}
+
+	clock.Advance(time.Hour)
+	if _, err := s.GetString("log"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for an expired key, expected ErrNotFound", err)
+	}
+	s.Append("log", []byte("three\n"))
+	if obj, _ := s.GetString("log"); obj != "three\n" {
+		t.Errorf("Got %q from store, expected %q", obj, "three\n")
+	}
+}
+
+// Test that appends to a chunked store do not deadlock with Freeze
+func TestAppendFreeze(t *testing.T) {
+	s := NewTemp(t, WithChunking())
+	s.Store("log", make([]byte, chunkMax)) // appends make it chunked
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 20; i++ {
+			if err := s.Append("log", []byte(strings.Repeat("x", 1000))); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		frozen := make(chan error)
+		go func() {
+			frozen <- s.Freeze()
+		}()
+		select {
+		case err := <-frozen:
+			if err != nil {
+				t.Fatalf("Freeze failed: %v", err)
+			}
+		case <-timeout:
+			t.Fatalf("Freeze did not return while appending")
+		}
+		s.Thaw()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+			if obj, _ := s.GetString("log"); len(obj) != chunkMax+20000 {
+				t.Errorf("Got a value of %d bytes, expected %d", len(obj), chunkMax+20000)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("Append did not return while freezing")
+		default:
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoSpace is returned by the Store operations of a Balancer, if no store
+// has more free space than its reserve.
+var ErrNoSpace = errors.New("no store with free space")
+
+// BalancerMember is a store of a Balancer, together with its capacity.
+type BalancerMember struct {
+	Store   *SOS
+	Reserve uint64 // free bytes to keep, below which no new keys are placed
+}
+
+// Balancer distributes objects over several stores, e.g. on different disks,
+// so the capacity can be extended gradually by adding stores. A new key is
+// placed on the store with the most free space (see FreeSpace), minus its
+// reserve. Afterwards, the key sticks to this store: Store, Get and Delete
+// operations on the key always go there.
+//
+// The assignment of the keys to the stores is kept in a mapping file, which
+// identifies the stores by their base directories. So, stores may be added,
+// or their order may be changed, but their directories must stay the same.
+// Keys without an assignment, e.g. objects stored before the Balancer was
+// used, are looked up in all stores in order, like in a Union.
+//
+// A Balancer is safe for concurrent use, but the mapping file must not be
+// shared by several Balancers at the same time.
+type Balancer struct {
+	members []BalancerMember
+	byBase  map[string]*SOS
+	free    func(s *SOS) (uint64, error) // free space, replaced in tests
+
+	mu      sync.Mutex
+	mapping map[string]string // base directory by key
+	file    *os.File          // mapping file, opened for appending
+}
+
+// NewBalancer creates a Balancer for the given stores. The mapping file is
+// created if it does not exist. It is compacted on every start, as it grows
+// with each new and deleted key.
+func NewBalancer(mapfile string, members ...BalancerMember) (*Balancer, error) {
+	if len(members) == 0 {
+		return nil, &Error{Op: "NewBalancer", Path: mapfile, Err: fmt.Errorf("no stores to balance")}
+	}
+
+	b := &Balancer{
+		members: members,
+		byBase:  make(map[string]*SOS),
+		free:    (*SOS).FreeSpace,
+		mapping: make(map[string]string),
+	}
+	for _, m := range members {
+		b.byBase[m.Store.base] = m.Store
+	}
+
+	if err := b.load(mapfile); err != nil {
+		return nil, &Error{Op: "NewBalancer", Path: mapfile, Err: err}
+	}
+	return b, nil
+}
+
+// Close closes the mapping file. The stores are not closed.
+func (b *Balancer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.file.Close()
+}
+
+// Store stores a key/value pair, given as string and byte slice, in the
+// store of the key.
+func (b *Balancer) Store(key string, value []byte) error {
+	s, err := b.place(key)
+	if err != nil {
+		return err
+	}
+	return s.Store(key, value)
+}
+
+// StoreString stores a key/value pair, given as strings, in the store of the
+// key.
+func (b *Balancer) StoreString(key, value string) error {
+	s, err := b.place(key)
+	if err != nil {
+		return err
+	}
+	return s.StoreString(key, value)
+}
+
+// StoreFrom stores a value, which is read from an io.Reader, under the given
+// key in the store of the key.
+func (b *Balancer) StoreFrom(key string, rd io.Reader) error {
+	s, err := b.place(key)
+	if err != nil {
+		return err
+	}
+	return s.StoreFrom(key, rd)
+}
+
+// Get fetches an object from the store of the key, and returns it as byte
+// slice.
+func (b *Balancer) Get(key string) ([]byte, error) {
+	return b.Locate(key).Get(key)
+}
+
+// GetString fetches an object from the store of the key, and returns it as a
+// string.
+func (b *Balancer) GetString(key string) (string, error) {
+	return b.Locate(key).GetString(key)
+}
+
+// GetTo fetches an object from the store of the key, and copies it into an
+// io.Writer.
+func (b *Balancer) GetTo(key string, wr io.Writer) error {
+	return b.Locate(key).GetTo(key, wr)
+}
+
+// Delete removes an object from the store of the key. The assignment of the
+// key is removed as well, so a later Store places the key anew.
+func (b *Balancer) Delete(key string) error {
+	s := b.Locate(key)
+	if err := s.Delete(key); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.mapping[key]; !ok {
+		return nil
+	}
+	if err := b.record(key, ""); err != nil {
+		return &Error{Op: "Delete", Key: key, Path: b.file.Name(), Err: err}
+	}
+	return nil
+}
+
+// Locate returns the store which holds the key, or which a Store of the key
+// would use if it is assigned already. If the key is unknown, the first store
+// is returned, so a Get reports ErrNotFound from there.
+func (b *Balancer) Locate(key string) *SOS {
+	b.mu.Lock()
+	base, ok := b.mapping[key]
+	b.mu.Unlock()
+	if s := b.byBase[base]; ok && s != nil {
+		return s
+	}
+
+	for _, m := range b.members {
+		if ok, _ := m.Store.Exists(key); ok {
+			return m.Store
+		}
+	}
+	return b.members[0].Store
+}
+
+// place returns the store for a Store of the key. A new key is assigned to
+// the store with the most free space.
+func (b *Balancer) place(key string) (*SOS, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s := b.byBase[b.mapping[key]]; s != nil {
+		return s, nil
+	}
+	for _, m := range b.members {
+		if ok, _ := m.Store.Exists(key); ok {
+			return m.Store, nil // stored before the Balancer was used
+		}
+	}
+
+	var (
+		best *SOS
+		most uint64
+	)
+	for _, m := range b.members {
+		free, err := b.free(m.Store)
+		if err != nil {
+			return nil, err
+		}
+		if free > m.Reserve && free-m.Reserve > most {
+			best, most = m.Store, free-m.Reserve
+		}
+	}
+	if best == nil {
+		return nil, &Error{Op: "Store", Key: key, Err: ErrNoSpace}
+	}
+
+	if err := b.record(key, best.base); err != nil {
+		return nil, &Error{Op: "Store", Key: key, Path: b.file.Name(), Err: err}
+	}
+	return best, nil
+}
+
+// record appends the assignment of a key to the mapping file, and updates
+// the mapping. An empty base directory removes the assignment. b.mu must be
+// held.
+func (b *Balancer) record(key, base string) error {
+	if _, err := fmt.Fprintf(b.file, "%s %s\n", strconv.Quote(base), strconv.Quote(key)); err != nil {
+		return err
+	}
+	if base == "" {
+		delete(b.mapping, key)
+	} else {
+		b.mapping[key] = base
+	}
+	return nil
+}
+
+// load reads the mapping file, writes it anew without the removed
+// assignments, and opens it for appending.
+func (b *Balancer) load(mapfile string) error {
+	fh, err := os.Open(mapfile)
+	if err == nil {
+		sc := bufio.NewScanner(fh)
+		for err == nil && sc.Scan() {
+			var base, key string
+			if err = unquotepair(sc.Text(), &base, &key); err != nil {
+				break
+			}
+			if base == "" {
+				delete(b.mapping, key)
+			} else {
+				b.mapping[key] = base
+			}
+		}
+		if err == nil {
+			err = sc.Err()
+		}
+		_ = fh.Close()
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	tmpname := mapfile + ".tmp"
+	out, err := os.Create(tmpname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	for key, base := range b.mapping {
+		fmt.Fprintf(w, "%s %s\n", strconv.Quote(base), strconv.Quote(key))
+	}
+	err = w.Flush()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpname, mapfile)
+	}
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+
+	b.file, err = os.OpenFile(mapfile, os.O_WRONLY|os.O_APPEND, 0o644)
+	return err
+}
+
+// unquotepair parses a line of two quoted strings, separated by a space.
+func unquotepair(line string, first, second *string) error {
+	q1, err := strconv.QuotedPrefix(line)
+	rest := strings.TrimPrefix(line[len(q1):], " ")
+	if err == nil && len(rest) < len(line)-len(q1) {
+		*first, _ = strconv.Unquote(q1)
+		*second, err = strconv.Unquote(rest)
+	} else if err == nil {
+		err = strconv.ErrSyntax
+	}
+	if err != nil {
+		return fmt.Errorf("%w: mapping file line %q", ErrCorrupt, line)
+	}
+	return nil
+}
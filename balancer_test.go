@@ -0,0 +1,68 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Test placing keys on the store with the most free space
+func TestBalancer(t *testing.T) {
+	small, large := NewTemp(t), NewTemp(t)
+	small.StoreString("old", "stored before balancing")
+
+	mapfile := filepath.Join(t.TempDir(), "mapping")
+	members := []BalancerMember{{Store: small}, {Store: large, Reserve: 100}}
+	b, err := NewBalancer(mapfile, members...)
+	if err != nil {
+		t.Fatalf("Error creating balancer: %v", err)
+	}
+	free := map[*SOS]uint64{small: 500, large: 1000}
+	b.free = func(s *SOS) (uint64, error) { return free[s], nil }
+
+	b.StoreString("a", "value a")
+	free[large] = 550 // 450 above the reserve
+	b.StoreString("b", "value b")
+	b.StoreString("old", "updated")
+	b.StoreString("a", "new value a") // sticks to the large store
+
+	for key, s := range map[string]*SOS{"a": large, "b": small, "old": small} {
+		if b.Locate(key) != s {
+			t.Errorf("Key %s is on the wrong store", key)
+		}
+		if ok, _ := s.Exists(key); !ok {
+			t.Errorf("Key %s is missing on its store", key)
+		}
+	}
+	if v, err := b.GetString("a"); err != nil || v != "new value a" {
+		t.Errorf("Got %q (%v) from balancer, expected %q", v, err, "new value a")
+	}
+
+	free[small], free[large] = 0, 100
+	if err := b.StoreString("c", "value c"); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("Got %v when all stores are full, expected ErrNoSpace", err)
+	}
+	b.Close()
+
+	// the assignments survive a restart, deleted keys are placed anew
+	b, _ = NewBalancer(mapfile, members[1], members[0])
+	defer b.Close()
+	if b.Locate("a") != large || b.Locate("b") != small {
+		t.Errorf("Assignments were not restored from the mapping file")
+	}
+	b.Delete("a")
+	free[small], free[large] = 2000, 100
+	b.free = func(s *SOS) (uint64, error) { return free[s], nil }
+	b.StoreString("a", "moved")
+	if b.Locate("a") != small {
+		t.Errorf("Deleted key was not placed anew")
+	}
+	if _, err := b.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for missing key, expected ErrNotFound", err)
+	}
+}
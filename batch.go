@@ -0,0 +1,89 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"runtime"
+	"sync"
+)
+
+// StoreBatch stores several key/value pairs, by several goroutines
+// concurrently. It returns the errors of the failed keys, or nil if all
+// values were stored. Each value is stored like with Store, so a failed key
+// does not affect the others.
+func (s *SOS) StoreBatch(values map[string][]byte) map[string]error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	return batch(keys, func(key string) error {
+		return s.Store(key, values[key])
+	})
+}
+
+// GetBatch fetches the values of several keys, by several goroutines
+// concurrently. It returns the values which were found, and the errors of
+// the failed keys, or nil if all values were fetched. Missing keys are
+// reported with ErrNotFound.
+func (s *SOS) GetBatch(keys []string) (map[string][]byte, map[string]error) {
+	var mu sync.Mutex
+	values := make(map[string][]byte, len(keys))
+	errs := batch(keys, func(key string) error {
+		value, err := s.Get(key)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		values[key] = value
+		mu.Unlock()
+		return nil
+	})
+	return values, errs
+}
+
+// DeleteBatch removes several keys, by several goroutines concurrently. It
+// returns the errors of the failed keys, or nil if all keys were removed.
+// Missing keys are reported with ErrNotFound.
+func (s *SOS) DeleteBatch(keys []string) map[string]error {
+	return batch(keys, s.Delete)
+}
+
+// batch calls fn for each key by a bounded number of goroutines, and collects
+// the errors by key.
+func batch(keys []string, fn func(key string) error) map[string]error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs map[string]error
+	)
+	work := make(chan string)
+
+	workers := min(runtime.NumCPU(), len(keys))
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				if err := fn(key); err != nil {
+					mu.Lock()
+					if errs == nil {
+						errs = make(map[string]error)
+					}
+					errs[key] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		work <- key
+	}
+	close(work)
+	wg.Wait()
+
+	return errs
+}
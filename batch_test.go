@@ -0,0 +1,50 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Test storing, getting and deleting many objects at once
+func TestBatch(t *testing.T) {
+	s := NewTemp(t)
+
+	values := make(map[string][]byte)
+	var keys []string
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		values[key] = []byte(fmt.Sprintf("value%d", i))
+		keys = append(keys, key)
+	}
+
+	if errs := s.StoreBatch(values); errs != nil {
+		t.Fatalf("StoreBatch failed: %v", errs)
+	}
+
+	got, errs := s.GetBatch(append(keys, "missing"))
+	if len(errs) != 1 || !errors.Is(errs["missing"], ErrNotFound) {
+		t.Errorf("Got errors %v, expected ErrNotFound for the missing key", errs)
+	}
+	if len(got) != len(values) {
+		t.Errorf("Got %d values, expected %d", len(got), len(values))
+	}
+	for key, value := range values {
+		if string(got[key]) != string(value) {
+			t.Errorf("Got %s from store, expected %s", got[key], value)
+		}
+	}
+
+	if errs := s.DeleteBatch(keys[:50]); errs != nil {
+		t.Errorf("DeleteBatch failed: %v", errs)
+	}
+	errs = s.DeleteBatch(keys)
+	if len(errs) != 50 || !errors.Is(errs[keys[0]], ErrNotFound) || errs[keys[50]] != nil {
+		t.Errorf("Got %d errors from second DeleteBatch, expected 50", len(errs))
+	}
+}
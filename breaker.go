@@ -0,0 +1,144 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker of a store.
+type BreakerState int
+
+const (
+	// BreakerClosed is the normal state, all operations are executed.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means that too many I/O errors occurred. All operations
+	// fail with ErrStoreUnhealthy.
+	BreakerOpen
+	// BreakerHalfOpen means that the cooldown has passed. A single probe
+	// operation is executed, while the others still fail. If the probe does
+	// not fail with an I/O error, the breaker closes, otherwise it opens
+	// again.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (b BreakerState) String() string {
+	switch b {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// WithCircuitBreaker isolates the store from a failing disk. If n operations
+// fail with an I/O error (EIO) within the time window, the breaker opens,
+// and all operations fail fast with ErrStoreUnhealthy instead of hanging on
+// the disk. After the cooldown, the breaker lets a single probe operation
+// through (half-open), and closes again if it succeeds.
+//
+// If onChange is not nil, it is called on each state change. It must not
+// call methods of the store.
+func WithCircuitBreaker(n int, window, cooldown time.Duration, onChange func(BreakerState)) Option {
+	return func(s *SOS) {
+		s.breaker = &breaker{
+			threshold: n,
+			window:    window,
+			cooldown:  cooldown,
+			onChange:  onChange,
+		}
+	}
+}
+
+// BreakerState returns the current state of the circuit breaker. Without a
+// circuit breaker, it is always BreakerClosed.
+func (s *SOS) BreakerState() BreakerState {
+	if s.breaker == nil {
+		return BreakerClosed
+	}
+	s.breaker.mu.Lock()
+	defer s.breaker.mu.Unlock()
+	return s.breaker.state
+}
+
+// breaker counts I/O errors and decides whether operations are allowed.
+type breaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	onChange  func(BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures []time.Time // times of the recent I/O errors
+	since    time.Time   // start of the open state, or of the probe
+}
+
+// allow returns ErrStoreUnhealthy if an operation must fail fast.
+func (b *breaker) allow(now time.Time) error {
+	b.mu.Lock()
+	if b.state == BreakerClosed {
+		b.mu.Unlock()
+		return nil
+	}
+	if now.Sub(b.since) < b.cooldown {
+		b.mu.Unlock()
+		return ErrStoreUnhealthy
+	}
+
+	// the cooldown has passed, so let this operation through as a probe. A
+	// probe which did not report back within another cooldown is replaced
+	// by a new one.
+	old := b.state
+	b.state, b.since = BreakerHalfOpen, now
+	b.mu.Unlock()
+
+	if old != BreakerHalfOpen && b.onChange != nil {
+		b.onChange(BreakerHalfOpen)
+	}
+	return nil
+}
+
+// record counts the result of an operation.
+func (b *breaker) record(now time.Time, err error) {
+	if errors.Is(err, ErrStoreUnhealthy) {
+		return
+	}
+	eio := errors.Is(err, syscall.EIO)
+
+	b.mu.Lock()
+	old := b.state
+	switch {
+	case b.state == BreakerHalfOpen && eio:
+		b.state, b.since = BreakerOpen, now
+	case b.state == BreakerHalfOpen:
+		b.state, b.failures = BreakerClosed, nil
+	case b.state == BreakerClosed && eio:
+		recent := b.failures[:0]
+		for _, t := range b.failures {
+			if now.Sub(t) < b.window {
+				recent = append(recent, t)
+			}
+		}
+		b.failures = append(recent, now)
+		if len(b.failures) >= b.threshold {
+			b.state, b.since, b.failures = BreakerOpen, now, nil
+		}
+	}
+	state := b.state
+	b.mu.Unlock()
+
+	if state != old && b.onChange != nil {
+		b.onChange(state)
+	}
+}
@@ -0,0 +1,76 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Test that I/O errors open the circuit breaker, and a probe closes it
+func TestCircuitBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	failing := true
+	var states []BreakerState
+
+	s := NewTemp(t, WithClock(clock),
+		WithWriteTransform(FlagUser, xorWrite),
+		WithReadTransform(FlagUser, func(r io.Reader) (io.Reader, error) {
+			if failing {
+				return nil, syscall.EIO
+			}
+			return xorRead(r)
+		}),
+		WithCircuitBreaker(3, time.Minute, 10*time.Second, func(state BreakerState) {
+			states = append(states, state)
+		}))
+	s.StoreString("key", "value")
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Get("key"); !errors.Is(err, syscall.EIO) {
+			t.Fatalf("Got error %v, expected %v", err, syscall.EIO)
+		}
+	}
+	if s.BreakerState() != BreakerOpen {
+		t.Fatalf("Got breaker state %v after 3 I/O errors, expected %v", s.BreakerState(), BreakerOpen)
+	}
+	if err := s.StoreString("other", "value"); !errors.Is(err, ErrStoreUnhealthy) {
+		t.Errorf("Got error %v on an unhealthy store, expected %v", err, ErrStoreUnhealthy)
+	}
+
+	// a failing probe opens the breaker again
+	clock.Advance(11 * time.Second)
+	if _, err := s.Get("key"); !errors.Is(err, syscall.EIO) {
+		t.Errorf("Got error %v from the probe, expected %v", err, syscall.EIO)
+	}
+	if _, err := s.Get("key"); !errors.Is(err, ErrStoreUnhealthy) {
+		t.Errorf("Got error %v after a failed probe, expected %v", err, ErrStoreUnhealthy)
+	}
+
+	// a successful probe closes it
+	failing = false
+	clock.Advance(11 * time.Second)
+	if obj, err := s.GetString("key"); obj != "value" || err != nil {
+		t.Errorf("Got %s with error %v from the probe, expected %s", obj, err, "value")
+	}
+	if s.BreakerState() != BreakerClosed {
+		t.Errorf("Got breaker state %v after a successful probe, expected %v", s.BreakerState(), BreakerClosed)
+	}
+
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(states) != len(want) {
+		t.Fatalf("Got state changes %v, expected %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("Got state changes %v, expected %v", states, want)
+			break
+		}
+	}
+}
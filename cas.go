@@ -0,0 +1,302 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// StoreIfAbsent stores a key/value pair, unless the key exists already. It
+// returns whether the value was stored. The check is atomic, even with
+// concurrent writers on a shared file system, as the object file is created
+// by a hard link, which fails if the file exists. Like CompareAndSwap, it
+// holds the lock of the key, so it never interleaves with a swap or an
+// append. An expired object (see StoreWithTTL) counts as absent, and is
+// replaced.
+func (s *SOS) StoreIfAbsent(key string, value []byte) (stored bool, err error) {
+	o := s.startop(context.Background(), "Store", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Store", key)
+
+	if err := s.begin(); err != nil {
+		return false, err
+	}
+	defer s.end()
+
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return false, err
+		}
+	}
+
+	tmpname, n, err := s.writetmp(bytes.NewReader(value))
+	if err != nil {
+		return false, err
+	}
+
+	if err := s.beginmodify(); err != nil {
+		_ = os.Remove(tmpname)
+		return false, err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockkey(key)
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return false, err
+	}
+	defer unlock()
+
+	dirname, filename := s.getpath(key)
+	err = s.change(s.keyhash(key), true, func() error {
+		return s.commitnew(tmpname, dirname, filename)
+	})
+	if errors.Is(err, ErrExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	o.info.Bytes = n
+	s.usage("Store", key, n)
+	s.notify("Store", key, n)
+	return true, nil
+}
+
+// CompareAndSwap stores the value newValue under the key, if the key holds
+// the value oldValue. It returns whether the value was swapped. If the key
+// does not exist, false is returned.
+//
+// The swap is atomic among concurrent StoreIfAbsent, CompareAndSwap and
+// Append operations on the key, even on a shared file system, as they hold a
+// lock file while they check and replace the value. Readers see either the
+// old or the new value. Plain Store and Delete operations do not take the
+// lock, so they may interleave with a swap.
+func (s *SOS) CompareAndSwap(key string, oldValue, newValue []byte) (swapped bool, err error) {
+	o := s.startop(context.Background(), "Store", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Store", key)
+
+	if err := s.begin(); err != nil {
+		return false, err
+	}
+	defer s.end()
+
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return false, err
+		}
+	}
+
+	tmpname, n, err := s.writetmp(bytes.NewReader(newValue))
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpname)
+
+	if err := s.beginmodify(); err != nil {
+		return false, err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockkey(key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	dirname, filename := s.getpath(key)
+	equal, err := s.filevalueis(filename, oldValue)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil || !equal {
+		return false, err
+	}
+
+	err = s.change(s.keyhash(key), true, func() error {
+		return s.commitfile(tmpname, dirname, filename)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	o.info.Bytes = n
+	s.usage("Store", key, n)
+	s.notify("Store", key, n)
+	return true, nil
+}
+
+// StoreFromIf stores a value, which is read from an io.Reader, with the
+// given metadata (see StoreFromMeta), if cond accepts the current object. It
+// returns whether the value was stored. cond is called with the current
+// object, or with nil if the key does not exist or has expired, and must not
+// close it.
+//
+// Like CompareAndSwap, it holds the lock of the key while it calls cond and
+// replaces the value, so the check is atomic among the conditional
+// operations on the key. The value is written to a temporary file before the
+// lock is taken, so a slow reader does not hold it.
+func (s *SOS) StoreFromIf(key string, rd io.Reader, meta Meta, cond func(obj *Object) bool) (stored bool, err error) {
+	o := s.startop(context.Background(), "Store", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Store", key)
+
+	data, err := marshalmeta(meta)
+	if err != nil {
+		return false, err
+	}
+	var fields map[byte][]byte
+	if data != nil {
+		fields = map[byte][]byte{tagMeta: data}
+	}
+
+	if err := s.begin(); err != nil {
+		return false, err
+	}
+	defer s.end()
+
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return false, err
+		}
+	}
+
+	tmpname, n, err := s.writetmpenc(rd, -1, func(w io.Writer, rd io.Reader) error {
+		return s.encodefields(w, rd, fields)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpname)
+
+	if err := s.beginmodify(); err != nil {
+		return false, err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockkey(key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if ok, err := s.checkcurrent(key, cond); err != nil || !ok {
+		return false, err
+	}
+	dirname, filename := s.getpath(key)
+	err = s.change(s.keyhash(key), true, func() error {
+		return s.commitfile(tmpname, dirname, filename)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	o.info.Bytes = n
+	s.usage("Store", key, n)
+	s.notify("Store", key, n)
+	return true, nil
+}
+
+// DeleteIf deletes an object, if cond accepts it. It returns whether the
+// object was deleted. If the key does not exist, ErrNotFound is returned.
+// cond is called with the current object, which it must not close, under
+// the lock of the key, like in StoreFromIf.
+func (s *SOS) DeleteIf(key string, cond func(obj *Object) bool) (deleted bool, err error) {
+	o := s.startop(context.Background(), "Delete", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Delete", key)
+
+	if err := s.begin(); err != nil {
+		return false, err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return false, err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockkey(key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	exists := false
+	ok, err := s.checkcurrent(key, func(obj *Object) bool {
+		exists = obj != nil
+		return exists && cond(obj)
+	})
+	if err == nil && !exists {
+		err = ErrNotFound
+	}
+	if err != nil || !ok {
+		return false, err
+	}
+
+	hs := s.keyhash(key)
+	_, filename := s.hashpath(hs)
+	err = s.change(hs, true, func() error {
+		return os.Remove(filename)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if s.keyIndex {
+		s.removeindex(key)
+	}
+	s.usage("Delete", key, 0)
+	s.notify("Delete", key, 0)
+	return true, nil
+}
+
+// checkcurrent opens the current object of a key, or nil if it does not
+// exist, and reports whether cond accepts it.
+func (s *SOS) checkcurrent(key string, cond func(obj *Object) bool) (bool, error) {
+	obj, err := s.GetObject(key)
+	if errors.Is(err, ErrNotFound) {
+		return cond(nil), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer obj.Close()
+	return cond(obj), nil
+}
+
+// filevalueis reports whether the object file holds the given value. Expired
+// objects hold no value.
+func (s *SOS) filevalueis(filename string, value []byte) (bool, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+
+	rd, err := s.decode(fh)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cw := &compareWriter{want: value}
+	if _, err := io.Copy(cw, rd); err != nil {
+		return false, err
+	}
+	return !cw.differs && cw.off == len(value), nil
+}
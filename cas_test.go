@@ -0,0 +1,114 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Test that only the first of several writers stores a value
+func TestStoreIfAbsent(t *testing.T) {
+	s := NewTemp(t)
+
+	if ok, err := s.StoreIfAbsent("key", []byte("first")); !ok || err != nil {
+		t.Fatalf("Got %v and error %v for a new key, expected true", ok, err)
+	}
+	if ok, err := s.StoreIfAbsent("key", []byte("second")); ok || err != nil {
+		t.Errorf("Got %v and error %v for an existing key, expected false", ok, err)
+	}
+	if obj, _ := s.GetString("key"); obj != "first" {
+		t.Errorf("Got %s from store, expected %s", obj, "first")
+	}
+}
+
+// Test conditional updates, and a counter incremented concurrently
+func TestCompareAndSwap(t *testing.T) {
+	s := NewTemp(t)
+
+	if ok, err := s.CompareAndSwap("counter", []byte("0"), []byte("1")); ok || err != nil {
+		t.Errorf("Got %v and error %v for a missing key, expected false", ok, err)
+	}
+
+	s.StoreString("counter", "0")
+	if ok, _ := s.CompareAndSwap("counter", []byte("5"), []byte("6")); ok {
+		t.Errorf("Swapped a value which did not match")
+	}
+	if obj, _ := s.GetString("counter"); obj != "0" {
+		t.Errorf("Got %s from store, expected %s", obj, "0")
+	}
+
+	const workers = 8
+	const increments = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; {
+				v, err := s.Get("counter")
+				if errors.Is(err, ErrNotFound) {
+					continue // taken by a concurrent swap
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n, _ := strconv.Atoi(string(v))
+				ok, err := s.CompareAndSwap("counter", v, []byte(strconv.Itoa(n+1)))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok {
+					j++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := strconv.Itoa(workers * increments)
+	if obj, _ := s.GetString("counter"); obj != expected {
+		t.Errorf("Got %s from store, expected %s", obj, expected)
+	}
+}
+
+// Test conditional stores and deletes
+func TestStoreFromIf(t *testing.T) {
+	s := NewTemp(t)
+	absent := func(obj *Object) bool { return obj == nil }
+	fresh := func(obj *Object) bool { return obj.Meta.ContentType == "text/plain" }
+
+	if stored, err := s.StoreFromIf("key", strings.NewReader("value"), Meta{ContentType: "text/plain"}, absent); !stored || err != nil {
+		t.Errorf("Got %v (%v) from StoreFromIf of a new key, expected true", stored, err)
+	}
+	if stored, err := s.StoreFromIf("key", strings.NewReader("other"), Meta{}, absent); stored || err != nil {
+		t.Errorf("Got %v (%v) from StoreFromIf of an existing key, expected false", stored, err)
+	}
+	if meta, _ := s.GetMeta("key"); meta.ContentType != "text/plain" {
+		t.Errorf("Got content type %q, expected %q", meta.ContentType, "text/plain")
+	}
+
+	if stored, err := s.StoreFromIf("key", strings.NewReader("new"), Meta{}, fresh); !stored || err != nil {
+		t.Errorf("Got %v (%v) from StoreFromIf, expected true", stored, err)
+	}
+	if deleted, err := s.DeleteIf("key", fresh); deleted || err != nil {
+		t.Errorf("Got %v (%v) from DeleteIf of a changed object, expected false", deleted, err)
+	}
+	if obj, _ := s.GetString("key"); obj != "new" {
+		t.Errorf("Got %s from store, expected %s", obj, "new")
+	}
+	if deleted, err := s.DeleteIf("key", func(*Object) bool { return true }); !deleted || err != nil {
+		t.Errorf("Got %v (%v) from DeleteIf, expected true", deleted, err)
+	}
+	if _, err := s.DeleteIf("key", func(*Object) bool { return true }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v from DeleteIf of a missing key, expected ErrNotFound", err)
+	}
+}
@@ -0,0 +1,57 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"errors"
+)
+
+// StoreIfChanged stores a key/value pair like Store, unless the key already
+// holds the same value. In that case, the object is neither rewritten nor
+// touched, so its modification time is kept. It returns whether the value
+// was stored.
+//
+// The stored value is read and compared before the new value is written, so
+// this saves disk writes for values which rarely change, e.g. for periodic
+// jobs which write the current state. The comparison and the write are not
+// atomic: a concurrent Store of the same key may be overwritten, or may
+// remain although the value differs.
+func (s *SOS) StoreIfChanged(key string, value []byte) (bool, error) {
+	cw := &compareWriter{want: value}
+	err := s.GetTo(key, cw)
+	if err == nil && !cw.differs && cw.off == len(value) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, errParts) {
+		return false, err
+	}
+
+	if err := s.Store(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// compareWriter compares the data written to it with an expected value.
+// After the first difference, the remaining data is discarded.
+type compareWriter struct {
+	want    []byte
+	off     int
+	differs bool
+}
+
+func (w *compareWriter) Write(p []byte) (int, error) {
+	if w.differs {
+		return len(p), nil
+	}
+	if len(p) > len(w.want)-w.off || !bytes.Equal(p, w.want[w.off:w.off+len(p)]) {
+		w.differs = true
+		return len(p), nil
+	}
+	w.off += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,50 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that unchanged values are not rewritten
+func TestStoreIfChanged(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+
+	tests := []struct {
+		value   string
+		changed bool
+	}{
+		{"hello", true},
+		{"hello", false},
+		{"hello world", true},
+		{"hello", true},
+		{"jello", true},
+		{"", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		clock.Advance(time.Minute)
+		before, _ := s.Stat("key")
+
+		changed, err := s.StoreIfChanged("key", []byte(tt.value))
+		if err != nil {
+			t.Fatalf("StoreIfChanged(%q) failed: %v", tt.value, err)
+		}
+		if changed != tt.changed {
+			t.Errorf("Got changed=%v for %q, expected %v", changed, tt.value, tt.changed)
+		}
+		if obj, _ := s.GetString("key"); obj != tt.value {
+			t.Errorf("Got %s from store, expected %s", obj, tt.value)
+		}
+
+		after, _ := s.Stat("key")
+		if !changed && !after.ModTime.Equal(before.ModTime) {
+			t.Errorf("Modification time of unchanged value %q was updated", tt.value)
+		}
+	}
+}
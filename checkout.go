@@ -0,0 +1,412 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// checkoutManifest is the file in a checkout directory, which lists the
+// checked out keys and the checksums of their values.
+const checkoutManifest = ".sos-checkout"
+
+// CheckoutReport describes the result of a CheckoutTo or SyncCheckout
+// operation.
+type CheckoutReport struct {
+	Linked    int // files which are hard links of object files
+	Copied    int // files which hold a copy of the value
+	Unchanged int // files which were up to date, see SyncCheckout
+	Removed   int // files of deleted objects, see SyncCheckout
+}
+
+// CheckoutTo materializes the objects of the given keys as files in the
+// directory dir, e.g. to deploy a set of static files. The file names are the
+// keys, and the slashes in keys form subdirectories, which are created as
+// needed. So, the key "static/css/main.css" becomes the file
+// dir/static/css/main.css. Existing files are replaced atomically.
+//
+// Objects which are stored as plain values become hard links of the object
+// files, so a checkout takes neither time nor space for the values. This
+// requires dir to be on the same file system as the store. The linked files
+// share their inode with the store, so they must not be modified in place.
+// Objects with a header (e.g. metadata, TTL, digest or a transform) cannot be
+// linked, and their values are copied instead. This is also done if dir is on
+// another file system. The modification times of the objects are preserved.
+//
+// The checked out keys are recorded in the file .sos-checkout in dir, for
+// SyncCheckout. The keys must be valid file names (see fs.ValidPath). The
+// checkout stops at the first error, and the files checked out so far are
+// left in place.
+func (s *SOS) CheckoutTo(dir string, keys []string) (report CheckoutReport, err error) {
+	defer s.wraperr(&err, "CheckoutTo", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	for _, key := range keys {
+		if err := checkoutkey(key); err != nil {
+			return report, &Error{Op: "CheckoutTo", Key: key, Path: dir, Err: err}
+		}
+	}
+
+	sums, err := readcheckout(dir)
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if werr := writecheckout(dir, sums); err == nil {
+			err = werr
+		}
+	}()
+
+	for _, key := range keys {
+		linked, sum, err := s.checkout(dir, key)
+		if err != nil {
+			return report, err
+		}
+		sums[key] = sum
+		if linked {
+			report.Linked++
+		} else {
+			report.Copied++
+		}
+	}
+	return report, nil
+}
+
+// SyncCheckout updates the checkout in the directory dir to match the
+// objects in the key index (see WithKeyIndex), so repeated deploys only touch
+// the files which changed. New objects are checked out like by CheckoutTo,
+// and changed objects replace their files. The files of deleted objects are
+// removed, together with the directories which become empty. A checkout
+// directory which does not exist yet is created.
+//
+// A file is unchanged, if it is still a hard link of the object file, or if
+// the SHA256 checksums of its content and of the value match. The checksum of
+// a value is taken from its digest, if the store records it (see
+// WithDigests). The checksums of the checked out files are recorded in the
+// file .sos-checkout in dir. Only files recorded there are removed, so other
+// files in dir are left alone.
+//
+// The checkout directory must not be modified concurrently, neither by
+// CheckoutTo nor by another SyncCheckout.
+func (s *SOS) SyncCheckout(dir string) (report CheckoutReport, err error) {
+	defer s.wraperr(&err, "SyncCheckout", "")
+
+	keys, err := s.List("")
+	if err != nil {
+		return report, err
+	}
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	sums, err := readcheckout(dir)
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if werr := writecheckout(dir, sums); err == nil {
+			err = werr
+		}
+	}()
+
+	current := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if checkoutkey(key) != nil {
+			continue // not representable as a file
+		}
+
+		result, sum, err := s.synccheckout(dir, key, sums[key])
+		if errors.Is(err, ErrNotFound) {
+			continue // deleted in the meantime
+		}
+		if err != nil {
+			return report, err
+		}
+		current[key] = true
+		sums[key] = sum
+		switch result {
+		case checkoutLinked:
+			report.Linked++
+		case checkoutCopied:
+			report.Copied++
+		default:
+			report.Unchanged++
+		}
+	}
+
+	for key := range sums {
+		if current[key] {
+			continue
+		}
+		if err := removecheckout(dir, key); err != nil {
+			return report, &Error{Op: "SyncCheckout", Key: key, Path: dir, Err: err}
+		}
+		delete(sums, key)
+		report.Removed++
+	}
+	return report, nil
+}
+
+// checkoutResult tells what synccheckout did with a file.
+type checkoutResult int
+
+const (
+	checkoutUnchanged checkoutResult = iota
+	checkoutLinked
+	checkoutCopied
+)
+
+// checkoutkey returns an error if key cannot be checked out as a file.
+func checkoutkey(key string) error {
+	if !fs.ValidPath(key) || key == "." || key == checkoutManifest {
+		return fs.ErrInvalid
+	}
+	return nil
+}
+
+// checkout materializes the object of a single key below dir. It reports
+// whether the file was linked or copied, and returns the checksum of the
+// value, or "-" if it is not known.
+func (s *SOS) checkout(dir, key string) (linked bool, sum string, err error) {
+	defer s.wraperr(&err, "CheckoutTo", key)
+
+	fh, err := s.open(key)
+	if err != nil {
+		return false, "", err
+	}
+	defer fh.Close()
+
+	return s.checkoutfile(fh, checkouttarget(dir, key))
+}
+
+// synccheckout brings the file of a single key below dir up to date. The
+// recorded checksum of the file is sum. It returns the checksum of the value,
+// or "-" if it is not known.
+func (s *SOS) synccheckout(dir, key, sum string) (result checkoutResult, _ string, err error) {
+	defer s.wraperr(&err, "SyncCheckout", key)
+
+	fh, err := s.open(key)
+	if err != nil {
+		return 0, "", err
+	}
+	defer fh.Close()
+
+	target := checkouttarget(dir, key)
+	vsum := "-"
+	if fi, err := os.Stat(target); err == nil && fi.Mode().IsRegular() {
+		ofi, err := fh.Stat()
+		if err != nil {
+			return 0, "", err
+		}
+		if os.SameFile(fi, ofi) {
+			if sum == "" {
+				sum = "-"
+			}
+			return checkoutUnchanged, sum, nil
+		}
+
+		if vsum, err = s.valuesum(fh); err != nil {
+			return 0, "", err
+		}
+		if sum == "" || sum == "-" {
+			if sum, _, err = filesum(target); err != nil {
+				return 0, "", err
+			}
+		}
+		if vsum == sum {
+			return checkoutUnchanged, sum, nil
+		}
+		if _, err := fh.Seek(0, io.SeekStart); err != nil {
+			return 0, "", err
+		}
+	}
+
+	linked, sum, err := s.checkoutfile(fh, target)
+	if err != nil {
+		return 0, "", err
+	}
+	if sum == "-" {
+		sum = vsum
+	}
+	if linked {
+		return checkoutLinked, sum, nil
+	}
+	return checkoutCopied, sum, nil
+}
+
+// checkouttarget returns the name of the file of key in the checkout
+// directory dir.
+func checkouttarget(dir, key string) string {
+	return filepath.Join(dir, filepath.FromSlash(key))
+}
+
+// checkoutfile materializes the object file fh as the file target. It
+// reports whether the file was linked or copied, and returns the checksum of
+// the value, or "-" if it is not known.
+func (s *SOS) checkoutfile(fh *linkedFile, target string) (linked bool, sum string, err error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o777); err != nil {
+		return false, "", err
+	}
+	tmpname := filepath.Join(filepath.Dir(target),
+		fmt.Sprintf(".%s.checkout-%s", filepath.Base(target), s.instanceID))
+	_ = os.Remove(tmpname) // left over from an aborted checkout
+
+	h, rd, err := s.decodeheader(fh)
+	if err == nil && h != nil && h.fields[tagParts] != nil {
+		err = errParts
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	sum = "-"
+	if d, ok := headerdigest(h); ok {
+		sum = hex.EncodeToString(d.SHA256[:])
+	}
+	if h == nil {
+		err = os.Link(fh.tmpname, tmpname)
+		linked = err == nil
+		if errors.Is(err, syscall.EXDEV) {
+			err = nil
+		}
+	}
+	if err == nil && !linked {
+		sum, err = s.checkoutcopy(fh, rd, tmpname)
+	}
+	if err == nil {
+		err = os.Rename(tmpname, target)
+	}
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return false, "", err
+	}
+	return linked, sum, nil
+}
+
+// checkoutcopy writes the value read from rd into the file tmpname, with the
+// modification time of the object file fh. It returns the checksum of the
+// value.
+func (s *SOS) checkoutcopy(fh *linkedFile, rd io.Reader, tmpname string) (string, error) {
+	fi, err := fh.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.OpenFile(tmpname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, s.fileMode)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), rd)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), os.Chtimes(tmpname, fi.ModTime(), fi.ModTime())
+}
+
+// valuesum returns the checksum of the value in the object file fh, from its
+// digest or by reading the value.
+func (s *SOS) valuesum(fh *linkedFile) (string, error) {
+	h, rd, err := s.decodeheader(fh)
+	if err == nil && h != nil && h.fields[tagParts] != nil {
+		err = errParts
+	}
+	if err != nil {
+		return "", err
+	}
+	if d, ok := headerdigest(h); ok {
+		return hex.EncodeToString(d.SHA256[:]), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// removecheckout removes the file of key from the checkout directory dir,
+// and the directories which become empty.
+func removecheckout(dir, key string) error {
+	target := checkouttarget(dir, key)
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for d := filepath.Dir(target); d != filepath.Clean(dir); d = filepath.Dir(d) {
+		if os.Remove(d) != nil {
+			break // not empty
+		}
+	}
+	return nil
+}
+
+// readcheckout reads the manifest of the checkout directory dir. It maps the
+// keys to the checksums of their files. A missing manifest is empty.
+func readcheckout(dir string) (map[string]string, error) {
+	sums := make(map[string]string)
+	fh, err := os.Open(filepath.Join(dir, checkoutManifest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	sc := bufio.NewScanner(fh)
+	for sc.Scan() {
+		sum, quoted, ok := strings.Cut(sc.Text(), " ")
+		key, err := strconv.Unquote(quoted)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%w: checkout manifest line %q", ErrCorrupt, sc.Text())
+		}
+		sums[key] = sum
+	}
+	return sums, sc.Err()
+}
+
+// writecheckout replaces the manifest of the checkout directory dir.
+func writecheckout(dir string, sums map[string]string) error {
+	keys := make([]string, 0, len(sums))
+	for key := range sums {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s %s\n", sums[key], strconv.Quote(key))
+	}
+
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, checkoutManifest)
+	if err := os.WriteFile(name+".tmp", []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
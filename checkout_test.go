@@ -0,0 +1,125 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test checking out objects as hard links
+func TestCheckoutTo(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("index.html", "<h1>hello</h1>")
+	s.StoreString("static/css/main.css", "body {}")
+	s.StoreWithTTL("static/app.js", []byte("alert(1)"), time.Hour)
+
+	dir := filepath.Join(t.TempDir(), "www")
+	report, err := s.CheckoutTo(dir, []string{"index.html", "static/css/main.css", "static/app.js"})
+	if err != nil {
+		t.Fatalf("Error in CheckoutTo: %v", err)
+	}
+	if report.Linked != 2 || report.Copied != 1 {
+		t.Errorf("Got %+v from CheckoutTo, expected 2 linked and 1 copied", report)
+	}
+
+	for name, value := range map[string]string{
+		"index.html":          "<h1>hello</h1>",
+		"static/css/main.css": "body {}",
+		"static/app.js":       "alert(1)",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != value {
+			t.Errorf("Got %q (%v) from file %s, expected %q", data, err, name, value)
+		}
+	}
+
+	_, filename := s.getpath("index.html")
+	ofi, _ := os.Stat(filename)
+	fi, _ := os.Stat(filepath.Join(dir, "index.html"))
+	if !os.SameFile(ofi, fi) {
+		t.Errorf("Checked out file is not a hard link of the object file")
+	}
+
+	// a new checkout replaces the files, without leaving temporary files
+	s.StoreString("index.html", "<h1>new</h1>")
+	if _, err := s.CheckoutTo(dir, []string{"index.html"}); err != nil {
+		t.Fatalf("Error in CheckoutTo: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "index.html"))
+	if string(data) != "<h1>new</h1>" {
+		t.Errorf("Got %q from replaced file, expected %q", data, "<h1>new</h1>")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("Got %d entries in checkout directory, expected 3", len(entries))
+	}
+}
+
+// Test checking out missing objects and invalid keys
+func TestCheckoutToErrors(t *testing.T) {
+	s := NewTemp(t)
+	dir := t.TempDir()
+
+	if _, err := s.CheckoutTo(dir, []string{"missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for missing object, expected ErrNotFound", err)
+	}
+	for _, key := range []string{"../escape", "/abs", "a//b", ".", ".sos-checkout"} {
+		if _, err := s.CheckoutTo(dir, []string{key}); err == nil {
+			t.Errorf("Got no error for invalid key %q", key)
+		}
+	}
+}
+
+// Test updating a checkout
+func TestSyncCheckout(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex())
+	s.StoreString("index.html", "<h1>hello</h1>")
+	s.StoreString("static/css/main.css", "body {}")
+	s.StoreWithTTL("static/app.js", []byte("alert(1)"), time.Hour)
+
+	dir := filepath.Join(t.TempDir(), "www")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "local.txt"), []byte("not from the store"), 0o644)
+
+	report, err := s.SyncCheckout(dir)
+	if err != nil {
+		t.Fatalf("Error in SyncCheckout: %v", err)
+	}
+	if report != (CheckoutReport{Linked: 2, Copied: 1}) {
+		t.Errorf("Got %+v from first SyncCheckout, expected 2 linked and 1 copied", report)
+	}
+
+	// nothing changed
+	report, err = s.SyncCheckout(dir)
+	if err != nil || report != (CheckoutReport{Unchanged: 3}) {
+		t.Errorf("Got %+v (%v) from unchanged SyncCheckout, expected 3 unchanged", report, err)
+	}
+
+	// same value stored again, a changed value, a new and a deleted object
+	s.StoreWithTTL("static/app.js", []byte("alert(1)"), time.Hour)
+	s.StoreString("index.html", "<h1>new</h1>")
+	s.StoreString("robots.txt", "")
+	s.Delete("static/css/main.css")
+
+	report, err = s.SyncCheckout(dir)
+	if err != nil || report != (CheckoutReport{Linked: 2, Unchanged: 1, Removed: 1}) {
+		t.Errorf("Got %+v (%v) from SyncCheckout, expected 2 linked, 1 unchanged and 1 removed", report, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "index.html"))
+	if string(data) != "<h1>new</h1>" {
+		t.Errorf("Got %q from changed file, expected %q", data, "<h1>new</h1>")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "static/css")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Empty directory of removed file was not removed (%v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "local.txt")); err != nil {
+		t.Errorf("File not from the store was removed (%v)", err)
+	}
+}
@@ -0,0 +1,474 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Chunk sizes of content defined chunking. A chunk boundary is found where
+// the rolling hash of the last bytes matches a mask, so the boundaries move
+// with the content when bytes are inserted or removed.
+const (
+	chunkMin  = 256 << 10 // minimum chunk size
+	chunkMax  = 4 << 20   // maximum chunk size
+	chunkBits = 20        // average chunk size is about chunkMin + 1 MiB
+	chunkMask = (1<<chunkBits - 1) << (64 - chunkBits)
+
+	chunkWindow = 4 // chunks read ahead concurrently by GetTo
+)
+
+// gearTable holds the random values of the rolling (gear) hash. It is
+// derived from a fixed seed, as the chunk boundaries must never change.
+var gearTable = func() (t [256]uint64) {
+	x := uint64(0x534f5343484e4b53) // "SOSCHNKS"
+	for i := range t {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// WithChunking stores large values as a sequence of content defined chunks.
+// Each chunk is stored once, addressed by its content, and the object file
+// holds a manifest of the chunks of the value. So, large values which are
+// mostly identical (e.g. VM images or database dumps) share most of their
+// storage. Values which fit into a single chunk are stored as usual.
+//
+// Chunks are not removed when an object is deleted or overwritten; use
+// PruneChunks to remove the chunks which are no longer referenced. Exports,
+// CopyTo, Sync and Mirror transfer the chunks of the objects along with
+// them, and ImportTar and Restore verify the chunks before they are stored.
+func WithChunking() Option {
+	return func(s *SOS) {
+		s.chunking = true
+	}
+}
+
+// PruneChunks removes all chunks which are not referenced by any object, and
+// which have not been written or reused within the grace period. The grace
+// period protects the chunks of Store operations which are still running.
+// It returns the number of removed chunks.
+func (s *SOS) PruneChunks(grace time.Duration) (n int, err error) {
+	defer s.wraperr(&err, "PruneChunks", "")
+
+	if err := s.begin(); err != nil {
+		return 0, err
+	}
+	defer s.end()
+
+	used := make(map[string]bool)
+	err = s.walk(func(rel string, fi fs.FileInfo) error {
+		return s.chunkrefs(filepath.Join(s.base, filepath.FromSlash(rel)), used)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.beginmodify(); err != nil {
+		return 0, err
+	}
+	defer s.endmodify()
+
+	limit := s.clock.Now().Add(-grace)
+	chunkdir := filepath.Join(s.base, dirChunks)
+	err = filepath.WalkDir(chunkdir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(chunkdir, name)
+		if used[strings.ReplaceAll(filepath.ToSlash(rel), "/", "")] {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || fi.ModTime().After(limit) {
+			return nil
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// encodechunked writes the value read from rd as chunks, and the chunk
+// manifest to the object file w. Each line of the manifest holds the hex
+// encoded SHA-256 hash and the size of a chunk.
+func (s *SOS) encodechunked(w io.Writer, rd io.Reader, fields map[byte][]byte) error {
+	c := &chunker{r: rd, buf: make([]byte, chunkMax)}
+	chunk, err := c.next()
+	if err != nil {
+		return err
+	}
+	if c.done() {
+		return s.encodevalue(w, bytes.NewReader(chunk), fields)
+	}
+
+	h := header{flags: flagChunked, fields: fields}
+	if _, err := w.Write(h.marshal()); err != nil {
+		return err
+	}
+	for len(chunk) > 0 {
+		sum, err := s.writechunk(chunk)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n", sum, len(chunk)); err != nil {
+			return err
+		}
+		if chunk, err = c.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writechunk stores a chunk, unless it exists already, and returns its hex
+// encoded hash.
+func (s *SOS) writechunk(chunk []byte) (string, error) {
+	h := sha256.Sum256(chunk)
+	sum := hex.EncodeToString(h[:])
+	_, filename := s.chunkpath(sum)
+
+	// an existing chunk is reused. Its modification time is updated, so it
+	// is not pruned while this Store is running.
+	now := s.clock.Now()
+	if err := os.Chtimes(filename, now, now); err == nil {
+		return sum, nil
+	}
+
+	tmpname := s.tmpfilename()
+	wr, err := s.createfile(tmpname)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpname)
+
+	err = s.encodevalue(wr, bytes.NewReader(chunk), nil)
+	if err == nil {
+		err = s.syncfile(wr)
+	}
+	if cerr := wr.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.linkchunk(tmpname, sum); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// linkchunk stores the chunk file tmpname under its hash, unless the chunk
+// exists already. tmpname is left in place.
+func (s *SOS) linkchunk(tmpname, sum string) error {
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	// link instead of rename, so a chunk written concurrently is kept
+	dirname, filename := s.chunkpath(sum)
+	err := s.retrydir(dirname, func() error {
+		return os.Link(tmpname, filename)
+	})
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.syncentry(dirname)
+}
+
+// checkchunk verifies that the chunk file filename holds the chunk with the
+// given hash, before it is stored from an untrusted source, as a wrong chunk
+// would corrupt all values which share it.
+func (s *SOS) checkchunk(filename, sum string) error {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	h := sha256.New()
+	rd, err := s.decode(fh)
+	if err == nil {
+		_, err = io.Copy(h, rd)
+	}
+	if err != nil && !errors.Is(err, ErrCorrupt) {
+		err = fmt.Errorf("%w: chunk %s: %v", ErrCorrupt, sum, err)
+	}
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		return fmt.Errorf("%w: chunk %s", ErrCorrupt, sum)
+	}
+	return nil
+}
+
+// chunkpath returns the directory and file name of a chunk, given its hex
+// encoded hash.
+func (s *SOS) chunkpath(sum string) (dirname, filename string) {
+	dirname = s.base + "/" + dirChunks + "/" + sum[0:2] + "/" + sum[2:4]
+	filename = dirname + "/" + sum[4:]
+	return
+}
+
+// chunkname returns the slash separated path of a chunk file relative to the
+// base directory, which names it in exported tar streams.
+func chunkname(sum string) string {
+	return dirChunks + "/" + sum[0:2] + "/" + sum[2:4] + "/" + sum[4:]
+}
+
+// chunksum returns the hash of the chunk file at the relative path rel, if
+// rel is a valid chunk name.
+func chunksum(rel string) (string, bool) {
+	sum := strings.ReplaceAll(strings.TrimPrefix(rel, dirChunks+"/"), "/", "")
+	b, err := hex.DecodeString(sum)
+	if err != nil || len(b) != sha256.Size || hex.EncodeToString(b) != sum || chunkname(sum) != rel {
+		return "", false
+	}
+	return sum, true
+}
+
+// chunkrefs adds the chunks referenced by an object file to used.
+func (s *SOS) chunkrefs(filename string, used map[string]bool) error {
+	fh, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	br := bufio.NewReader(fh)
+	h, err := readheader(br)
+	if err != nil || h == nil || h.flags != flagChunked {
+		return err
+	}
+	for {
+		sum, _, err := readmanifest(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		used[sum] = true
+	}
+}
+
+// readmanifest reads the next line of a chunk manifest.
+func readmanifest(br *bufio.Reader) (sum string, size int64, err error) {
+	line, err := br.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", 0, io.EOF
+	}
+	if _, err := fmt.Sscanf(line, "%64s %d\n", &sum, &size); err != nil || len(sum) != 64 {
+		return "", 0, fmt.Errorf("%w: chunk manifest", ErrCorrupt)
+	}
+	return sum, size, nil
+}
+
+// chunkreader returns a reader for the value of a chunked object, given the
+// reader of its manifest.
+func (s *SOS) chunkreader(manifest *bufio.Reader) io.Reader {
+	return &chunkedReader{s: s, manifest: manifest}
+}
+
+// chunkedReader reads the chunks of a value one after another. Each chunk
+// is read completely and verified, before it is passed on.
+type chunkedReader struct {
+	s        *SOS
+	manifest *bufio.Reader
+	cur      *bytes.Reader // rest of the current chunk
+}
+
+// Read reads from the current chunk, and moves on to the next chunk at its
+// end.
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for r.cur == nil || r.cur.Len() == 0 {
+		sum, size, err := readmanifest(r.manifest)
+		if err != nil {
+			return 0, err
+		}
+		data, err := r.s.readchunk(sum, size)
+		if err != nil {
+			return 0, err
+		}
+		r.cur = bytes.NewReader(data)
+	}
+	return r.cur.Read(p)
+}
+
+// WriteTo writes the rest of the value to w. The following chunks are read
+// concurrently, up to chunkWindow chunks ahead of w, which speeds up reading
+// from storage with high latency. It is used by io.Copy, e.g. in GetTo.
+func (r *chunkedReader) WriteTo(w io.Writer) (total int64, err error) {
+	// finish the chunk which is partially read
+	if r.cur != nil {
+		total, err = r.cur.WriteTo(w)
+		r.cur = nil
+		if err != nil {
+			return total, err
+		}
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	pending := make(chan chan result, chunkWindow)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(pending)
+		for {
+			sum, size, err := readmanifest(r.manifest)
+			if err == io.EOF {
+				return
+			}
+			ch := make(chan result, 1)
+			select {
+			case pending <- ch:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				ch <- result{err: err}
+				return
+			}
+			go func() {
+				data, err := r.s.readchunk(sum, size)
+				ch <- result{data, err}
+			}()
+		}
+	}()
+
+	for ch := range pending {
+		res := <-ch
+		if err = res.err; err != nil {
+			break
+		}
+		var n int
+		n, err = w.Write(res.data)
+		total += int64(n)
+		if err != nil {
+			break
+		}
+	}
+
+	// on errors, stop reading ahead
+	close(stop)
+	for range pending {
+	}
+	return total, err
+}
+
+// readchunk reads a chunk completely, and verifies its size and hash.
+func (s *SOS) readchunk(sum string, size int64) ([]byte, error) {
+	_, filename := s.chunkpath(sum)
+	fh, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	rd, err := s.decode(fh)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(rd, data); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, fmt.Errorf("%w: chunk %s", ErrCorrupt, sum)
+		}
+		return nil, err
+	}
+
+	h := sha256.Sum256(data)
+	if n, _ := rd.Read(make([]byte, 1)); n > 0 || hex.EncodeToString(h[:]) != sum {
+		return nil, fmt.Errorf("%w: chunk %s", ErrCorrupt, sum)
+	}
+	return data, nil
+}
+
+// chunker splits a stream into content defined chunks.
+type chunker struct {
+	r          io.Reader
+	buf        []byte // buffer of chunkMax bytes
+	start, end int    // bytes in buf which belong to the following chunks
+	eof        bool   // r is exhausted
+}
+
+// next returns the next chunk, or an empty chunk at the end of the stream.
+// The chunk is valid until the following call of next.
+func (c *chunker) next() ([]byte, error) {
+	// move the rest of the previous read to the start of the buffer, and
+	// fill it up
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	if !c.eof {
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+		c.end += n
+	}
+
+	c.start = chunkboundary(c.buf[:c.end])
+	return c.buf[:c.start], nil
+}
+
+// done reports whether all chunks have been returned.
+func (c *chunker) done() bool {
+	return c.eof && c.start == c.end
+}
+
+// chunkboundary returns the length of the first chunk of data.
+func chunkboundary(data []byte) int {
+	if len(data) <= chunkMin {
+		return len(data)
+	}
+	var h uint64
+	for i := chunkMin; i < len(data); i++ {
+		h = h<<1 + gearTable[data[i]]
+		if h&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,246 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countChunks returns the number of chunk files in a store.
+func countChunks(s *SOS) int {
+	n := 0
+	filepath.WalkDir(filepath.Join(s.base, dirChunks), func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// Test that similar large values share their chunks
+func TestChunking(t *testing.T) {
+	s := NewTemp(t, WithChunking())
+
+	value1 := make([]byte, 12<<20)
+	rand.New(rand.NewSource(1)).Read(value1)
+	value2 := bytes.Clone(value1)
+	copy(value2[5<<20:], "a small change in the middle")
+
+	s.Store("value1", value1)
+	n1 := countChunks(s)
+	if n1 < 2 {
+		t.Fatalf("Got %d chunks for a large value, expected several", n1)
+	}
+	s.Store("value2", value2)
+	if n2 := countChunks(s); n2 > n1+2 {
+		t.Errorf("Got %d chunks for two similar values, expected at most %d", n2, n1+2)
+	}
+
+	if obj, _ := s.Get("value1"); !bytes.Equal(obj, value1) {
+		t.Errorf("Got a different value1 from store")
+	}
+	if obj, _ := s.Get("value2"); !bytes.Equal(obj, value2) {
+		t.Errorf("Got a different value2 from store")
+	}
+
+	// small values are stored as they are
+	s.StoreString("small", "value")
+	_, filename := s.getpath("small")
+	if data, _ := os.ReadFile(filename); string(data) != "value" {
+		t.Errorf("Got object file %q for a small value, expected %q", data, "value")
+	}
+
+	// chunks are removed when they are no longer referenced
+	s.Delete("value1")
+	if n, err := s.PruneChunks(0); err != nil || n > 2 {
+		t.Errorf("PruneChunks removed %d chunks with error %v, expected at most 2", n, err)
+	}
+	if obj, _ := s.Get("value2"); !bytes.Equal(obj, value2) {
+		t.Errorf("Got a different value2 from store after PruneChunks")
+	}
+	s.Delete("value2")
+	s.PruneChunks(0)
+	if n := countChunks(s); n != 0 {
+		t.Errorf("Got %d chunks after deleting all values, expected 0", n)
+	}
+}
+
+// cuts returns the end offsets of all chunks of data.
+func cuts(data []byte) map[int]bool {
+	ends := make(map[int]bool)
+	for pos := 0; pos < len(data); {
+		pos += chunkboundary(data[pos:])
+		ends[pos] = true
+	}
+	return ends
+}
+
+// Test that chunk boundaries follow the content, when bytes are inserted
+func TestChunkBoundary(t *testing.T) {
+	data := make([]byte, 12<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	prefix := []byte("inserted at the start")
+
+	original := cuts(data)
+	shifted := cuts(append(prefix, data...))
+
+	same := 0
+	for end := range shifted {
+		if original[end-len(prefix)] {
+			same++
+		}
+	}
+	if same < len(original)-2 {
+		t.Errorf("Got %d of %d chunk boundaries after an insertion, expected most of them", same, len(original))
+	}
+}
+
+// failWriter fails after a number of bytes have been written.
+type failWriter struct {
+	n int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, os.ErrClosed
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+// Test reading chunked values with concurrent reads of the chunks
+func TestChunkedGetTo(t *testing.T) {
+	s := NewTemp(t, WithChunking())
+
+	value := make([]byte, 20<<20)
+	rand.New(rand.NewSource(3)).Read(value)
+	s.Store("value", value)
+
+	buf := new(bytes.Buffer)
+	if err := s.GetTo("value", buf); err != nil {
+		t.Fatalf("GetTo failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), value) {
+		t.Errorf("Got a different value from GetTo")
+	}
+
+	// a failing writer stops the reads
+	if err := s.GetTo("value", &failWriter{n: chunkMax}); err == nil {
+		t.Errorf("GetTo to a failing writer succeeded, expected an error")
+	}
+
+	// corrupt chunks are detected
+	corruptChunks(s)
+	if err := s.GetTo("value", io.Discard); err == nil {
+		t.Errorf("GetTo of corrupt chunks succeeded, expected an error")
+	}
+}
+
+// corruptChunks overwrites all chunk files of a store.
+func corruptChunks(s *SOS) {
+	filepath.WalkDir(filepath.Join(s.base, dirChunks), func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			os.WriteFile(name, []byte("corrupt"), 0o600)
+		}
+		return nil
+	})
+}
+
+// Test that streaming reads verify the chunks
+func TestChunkedReader(t *testing.T) {
+	s := NewTemp(t, WithChunking())
+
+	value := make([]byte, 12<<20)
+	rand.New(rand.NewSource(4)).Read(value)
+	s.Store("value", value)
+
+	rd, err := s.GetReader("value")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	data, err := io.ReadAll(rd)
+	rd.Close()
+	if err != nil || !bytes.Equal(data, value) {
+		t.Errorf("Got a different value from GetReader (%v)", err)
+	}
+
+	corruptChunks(s)
+	rd, err = s.GetReader("value")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	defer rd.Close()
+	if _, err := io.ReadAll(rd); err == nil {
+		t.Errorf("Reading corrupt chunks succeeded, expected an error")
+	}
+}
+
+// Test that exports and copies carry the chunks of the objects
+func TestChunkedTransfer(t *testing.T) {
+	src := NewTemp(t, WithChunking())
+	value := make([]byte, 12<<20)
+	rand.New(rand.NewSource(5)).Read(value)
+	src.Store("value", value)
+
+	export := new(bytes.Buffer)
+	if err := src.ExportTar(export); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+
+	check := func(name string, dst *SOS) {
+		t.Helper()
+		if n := countChunks(dst); n != countChunks(src) {
+			t.Errorf("Got %d chunks after %s, expected %d", n, name, countChunks(src))
+		}
+		if obj, err := dst.Get("value"); err != nil || !bytes.Equal(obj, value) {
+			t.Errorf("Got a different value after %s (%v)", name, err)
+		}
+	}
+
+	restored := NewTemp(t, WithChunking())
+	if _, err := restored.Restore(bytes.NewReader(export.Bytes()), true); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	check("Restore", restored)
+
+	imported := NewTemp(t, WithChunking())
+	if _, err := imported.ImportTar(bytes.NewReader(export.Bytes()), ImportOverwrite); err != nil {
+		t.Fatalf("ImportTar failed: %v", err)
+	}
+	check("ImportTar", imported)
+
+	copied := NewTemp(t, WithChunking())
+	if err := src.CopyTo(copied, nil); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	check("CopyTo", copied)
+
+	// verification reads the chunks
+	report, err := copied.Verify(true)
+	if err != nil || report.Chunks != countChunks(src) || len(report.Corrupt) != 0 {
+		t.Errorf("Got report %+v (%v), expected %d good chunks", report, err, countChunks(src))
+	}
+	corruptChunks(copied)
+	report, _ = copied.Verify(true)
+	if len(report.Corrupt) != countChunks(src) {
+		t.Errorf("Got %d corrupt files, expected %d", len(report.Corrupt), countChunks(src))
+	}
+
+	// corrupt chunks are not imported
+	corruptChunks(src)
+	export.Reset()
+	src.ExportTar(export)
+	if _, err := NewTemp(t, WithChunking()).Restore(export, false); err == nil {
+		t.Errorf("Restore of corrupt chunks succeeded, expected an error")
+	}
+}
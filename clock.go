@@ -0,0 +1,30 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import "time"
+
+// Clock is the time source of an object store. All time based logic of the
+// store uses the clock, so it can be replaced by a fake clock in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default clock, which returns the system time.
+type systemClock struct{}
+
+// Now returns the current system time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock sets the time source of the object store. With a custom clock,
+// the modification times of stored objects are set from the clock as well.
+func WithClock(c Clock) Option {
+	return func(s *SOS) {
+		s.clock = c
+	}
+}
@@ -0,0 +1,57 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for tests.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Test time based logic with a fake clock
+func TestWithClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+
+	s.StoreString("old", "old value")
+	clock.Advance(time.Hour)
+	since := clock.Now()
+	clock.Advance(time.Hour)
+	s.StoreString("new", "new value")
+
+	buf := new(bytes.Buffer)
+	if err := s.ExportChangedSince(since, buf); err != nil {
+		t.Fatalf("ExportChangedSince failed: %v", err)
+	}
+	objs := readTar(t, buf)
+	if len(objs) != 1 {
+		t.Fatalf("Got %d objects in incremental export, expected 1", len(objs))
+	}
+	for _, v := range objs {
+		if v != "new value" {
+			t.Errorf("Got %s in incremental export, expected %s", v, "new value")
+		}
+	}
+}
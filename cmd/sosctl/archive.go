@@ -0,0 +1,92 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hweidner/sos"
+)
+
+// policies are the conflict policies of the import command.
+var policies = map[string]sos.ConflictPolicy{
+	"overwrite": sos.ImportOverwrite,
+	"skip":      sos.ImportSkipExisting,
+	"fail":      sos.ImportFail,
+	"newer":     sos.ImportKeepNewer,
+}
+
+// export writes all objects into a tar archive.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	store := addstoreflags(fs)
+	out := fs.String("o", "", "write the archive into this file, instead of stdout")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		usage()
+	}
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if *out == "" {
+		return s.ExportTar(os.Stdout)
+	}
+	fh, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := s.ExportTar(fh); err != nil {
+		fh.Close()
+		os.Remove(*out)
+		return err
+	}
+	return fh.Close()
+}
+
+// imports reads the objects of a tar archive, as written by export.
+func imports(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	store := addstoreflags(fs)
+	policy := fs.String("policy", "overwrite", "handling of existing objects: overwrite, skip, fail or newer")
+	_ = fs.Parse(args)
+	if fs.NArg() > 1 {
+		usage()
+	}
+
+	p, ok := policies[*policy]
+	if !ok {
+		return fmt.Errorf("invalid conflict policy %q", *policy)
+	}
+
+	var rd io.Reader = os.Stdin
+	if fs.NArg() == 1 && fs.Arg(0) != "-" {
+		fh, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		rd = fh
+	}
+
+	s, err := store.open(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// the report is valid, even if the import fails
+	report, err := s.ImportTar(rd, p)
+	fmt.Fprintf(os.Stderr, "imported %d objects, overwrote %d, skipped %d\n",
+		report.Imported, report.Overwritten, report.Skipped)
+	return err
+}
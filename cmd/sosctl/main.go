@@ -0,0 +1,285 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Command sosctl operates a simple object store on the command line.
+
+Usage:
+
+	sosctl put [STORE] KEY [FILE]
+	sosctl get [STORE] [-o FILE] KEY
+	sosctl delete [STORE] KEY...
+	sosctl list [STORE] [PREFIX]
+	sosctl stat [STORE] KEY...
+	sosctl export [STORE] [-o FILE]
+	sosctl import [STORE] [-policy overwrite|skip|fail|newer] [FILE]
+	sosctl stats [STORE] [-shards]
+	sosctl top [STORE] [-by size|age] [-n N]
+	sosctl gc [STORE] [-grace AGE]
+	sosctl fsck [STORE] [-full] [-verify] [-repair] [-quarantine] [-temp-age AGE]
+	sosctl maintain [STORE] [-every INTERVAL] [-grace AGE] [-full]
+	sosctl units [STORE] [-every INTERVAL] [-name NAME] [-user USER] [-out DIR]
+
+The store is selected by the flags -base DIR [-suffix SUFFIX] [-key-index]
+[-tombstones] [-compression FORMAT] [-key-file FILE] [-key-id ID], or by a
+configuration file with -config FILE (JSON or YAML, see sos.Config). One of
+-base and -config is required. The environment variables SOS_PATH,
+SOS_SHARD_DEPTH etc. override the flags and the configuration file. The
+flags precede the other arguments. Only put and import create a store which
+does not exist, the other commands fail.
+
+The put, get, delete and stat commands work on single objects. Values are
+read from stdin and written to stdout, unless a file is given. The list
+command lists the keys in the key index.
+
+The export command writes all objects into a tar archive, which the import
+command reads into a store, handling existing objects by the given policy.
+
+The stats command shows the number and size of the objects, the temporary
+files, the time of the last gc, and the free space and inodes of the file
+system. Stores without counters (see sos.WithCounters) are scanned for the
+number of objects. With -shards, the store is always scanned, and the number
+of objects per top level shard is shown as well. If the store is scanned and
+configured with compression, the compression ratio is shown.
+
+The top command lists the largest or oldest objects of the store. The keys
+are shown for objects in the key index, the key hashes otherwise.
+
+The gc command removes temporary files left over by crashed processes,
+expired objects, and unreferenced chunks and tombstones older than the grace
+period. The
+fsck command verifies the object files against the checksum manifests, and
+checks the directory tree for left over temporary files, misplaced files,
+empty shard directories and objects which do not match their key or digest
+(see sos.Fsck). With -repair and -quarantine, it fixes the problems. It fails
+if problems are left.
+
+The maintain command runs gc and fsck. With -every, it keeps running and
+repeats the maintenance periodically, until it receives SIGINT or SIGTERM.
+Otherwise, it runs once, e.g. from cron.
+
+The units command emits a systemd service and timer, which run the
+maintenance of the store periodically. With -out, the units are written into
+a directory like /etc/systemd/system, otherwise to stdout.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hweidner/sos"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "sosctl:", err)
+		os.Exit(1)
+	}
+}
+
+// commands are the sub-commands, by name.
+var commands = map[string]func(args []string) error{
+	"put":      put,
+	"get":      get,
+	"delete":   del,
+	"list":     list,
+	"stat":     stat,
+	"export":   export,
+	"import":   imports,
+	"stats":    stats,
+	"top":      top,
+	"gc":       gc,
+	"fsck":     fsck,
+	"maintain": maintain,
+	"units":    units,
+}
+
+// usage prints the usage and exits.
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: sosctl put [STORE] KEY [FILE]
+       sosctl get [STORE] [-o FILE] KEY
+       sosctl delete [STORE] KEY...
+       sosctl list [STORE] [PREFIX]
+       sosctl stat [STORE] KEY...
+       sosctl export [STORE] [-o FILE]
+       sosctl import [STORE] [-policy overwrite|skip|fail|newer] [FILE]
+       sosctl stats [STORE] [-shards]
+       sosctl top [STORE] [-by size|age] [-n N]
+       sosctl gc [STORE] [-grace AGE]
+       sosctl fsck [STORE] [-full] [-verify] [-repair] [-quarantine] [-temp-age AGE]
+       sosctl maintain [STORE] [-every INTERVAL] [-grace AGE] [-full]
+       sosctl units [STORE] [-every INTERVAL] [-name NAME] [-user USER] [-out DIR]
+STORE is -base DIR [-suffix SUFFIX] [-key-index] [-tombstones]
+      [-compression FORMAT] [-key-file FILE] [-key-id ID], or -config FILE`)
+	os.Exit(2)
+}
+
+// top lists the largest or oldest objects.
+func top(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	store := addstoreflags(fs)
+	by := fs.String("by", "size", "rank objects by \"size\" or \"age\"")
+	n := fs.Int("n", 10, "number of objects to show")
+	_ = fs.Parse(args)
+
+	var field sos.SortField
+	switch *by {
+	case "size":
+		field = sos.SortBySize
+	case "age":
+		field = sos.SortByAge
+	default:
+		return fmt.Errorf("invalid sort field %q", *by)
+	}
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	objs, err := s.TopN(field, *n)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SIZE\tMODIFIED\tKEY")
+	for _, obj := range objs {
+		key := obj.Key
+		if key == "" {
+			key = "(" + obj.Hash + ")"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", obj.Size, obj.ModTime.Format(time.RFC3339), key)
+	}
+	return tw.Flush()
+}
+
+// storeFlags are the flags which select the store.
+type storeFlags struct {
+	config      *string
+	base        *string
+	suffix      *string
+	keyIndex    *bool
+	tombstones  *bool
+	compression *string
+	keyFile     *string
+	keyID       *string
+}
+
+// addstoreflags registers the flags which select the store.
+func addstoreflags(fs *flag.FlagSet) *storeFlags {
+	return &storeFlags{
+		config:      fs.String("config", "", "configuration file of the store"),
+		base:        fs.String("base", "", "base directory of the store"),
+		suffix:      fs.String("suffix", "", "file name suffix of the object files"),
+		keyIndex:    fs.Bool("key-index", false, "keep the keys in the key index"),
+		tombstones:  fs.Bool("tombstones", false, "record deleted objects for incremental exports"),
+		compression: fs.String("compression", "", "compression of new values: gzip, zstd or snappy"),
+		keyFile:     fs.String("key-file", "", "file with the encryption keys"),
+		keyID:       fs.String("key-id", "", "name of the encryption key for new values"),
+	}
+}
+
+// load returns the configuration of the store, from the configuration file
+// or the flags, overridden by the environment.
+func (f *storeFlags) load() (*sos.Config, error) {
+	var c *sos.Config
+	switch {
+	case *f.config != "":
+		var err error
+		if c, err = sos.LoadConfig(*f.config); err != nil {
+			return nil, err
+		}
+	case *f.base != "":
+		c = &sos.Config{
+			Path:        *f.base,
+			Suffix:      *f.suffix,
+			KeyIndex:    *f.keyIndex,
+			Tombstones:  *f.tombstones,
+			Compression: *f.compression,
+			KeyFile:     *f.keyFile,
+			KeyID:       *f.keyID,
+		}
+	default:
+		return nil, errors.New("no store selected, use -base or -config")
+	}
+	if err := c.LoadEnv("SOS_"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// open opens the store, as configured by the configuration file or the
+// flags. Unless create is true, the store must exist, so commands which
+// only read or maintain a store never create one by mistake.
+func (f *storeFlags) open(create bool) (*sos.SOS, error) {
+	c, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	if !create {
+		if fi, err := os.Stat(c.Path); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("no store in %s", c.Path)
+		}
+	}
+	return c.New()
+}
+
+// args returns the flags which select the store, with absolute paths, for
+// commands which run in another working directory.
+func (f *storeFlags) args() (path, args string, err error) {
+	c, err := f.load()
+	if err != nil {
+		return "", "", err
+	}
+	if *f.config != "" {
+		path, err = filepath.Abs(*f.config)
+		return path, "-config " + path, err
+	}
+
+	path, err = filepath.Abs(c.Path)
+	if err != nil {
+		return "", "", err
+	}
+	args = "-base " + path
+	if *f.suffix != "" {
+		args += " -suffix " + *f.suffix
+	}
+	if *f.keyIndex {
+		args += " -key-index"
+	}
+	if *f.tombstones {
+		args += " -tombstones"
+	}
+	if *f.compression != "" {
+		args += " -compression " + *f.compression
+	}
+	if *f.keyFile != "" {
+		keyfile, err := filepath.Abs(*f.keyFile)
+		if err != nil {
+			return "", "", err
+		}
+		args += " -key-file " + keyfile
+	}
+	if *f.keyID != "" {
+		args += " -key-id " + *f.keyID
+	}
+	return path, args, nil
+}
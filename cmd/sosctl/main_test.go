@@ -0,0 +1,122 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hweidner/sos"
+)
+
+// run runs a command with the given stdin, and returns its output.
+func run(t *testing.T, args []string, stdin string) (string, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "stdin"), filepath.Join(dir, "stdout")
+	os.WriteFile(in, []byte(stdin), 0o600)
+	inf, _ := os.Open(in)
+	outf, _ := os.Create(out)
+	defer inf.Close()
+	defer outf.Close()
+
+	oldin, oldout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = inf, outf
+	defer func() { os.Stdin, os.Stdout = oldin, oldout }()
+
+	err := commands[args[0]](args[1:])
+	data, _ := os.ReadFile(out)
+	return string(data), err
+}
+
+// Test the commands against stores with different options
+func TestCommands(t *testing.T) {
+	key := []byte(strings.Repeat("k", 32))
+	keyfile := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(keyfile, []byte("main "+strings.Repeat("6b", 32)+"\n"), 0o600)
+
+	plain := sos.NewTemp(t)
+	plain.StoreString("hello", "world")
+	indexed := sos.NewTemp(t, sos.WithKeyIndex(), sos.WithCompression(sos.CompressionGzip))
+	indexed.StoreString("dir/hello", "world")
+	encrypted := sos.NewTemp(t, sos.WithEncryption(key))
+	encrypted.StoreString("secret", "world")
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		stdin string
+		out   string // expected output, or a part of it
+		fail  bool
+	}{
+		{"get", []string{"get", "-base", plain.Base(), "hello"}, "", "world", false},
+		{"get missing key", []string{"get", "-base", plain.Base(), "other"}, "", "", true},
+		{"stat", []string{"stat", "-base", plain.Base(), "hello"}, "", "size:     5", false},
+		{"put", []string{"put", "-base", plain.Base(), "new"}, "value", "", false},
+		{"get put value", []string{"get", "-base", plain.Base(), "new"}, "", "value", false},
+		{"delete", []string{"delete", "-base", plain.Base(), "new"}, "", "", false},
+		{"export", []string{"export", "-base", plain.Base()}, "", ".manifest", false},
+		{"list", []string{"list", "-base", indexed.Base(), "-key-index", "-compression", "gzip", "dir/"}, "", "dir/hello\n", false},
+		{"put indexed", []string{"put", "-base", indexed.Base(), "-key-index", "-compression", "gzip", "dir/new"}, "value", "", false},
+		{"list new key", []string{"list", "-base", indexed.Base(), "-key-index"}, "", "dir/hello\ndir/new\n", false},
+		{"get compressed", []string{"get", "-base", indexed.Base(), "dir/new"}, "", "value", false},
+		{"get encrypted", []string{"get", "-base", encrypted.Base(), "-key-file", keyfile, "secret"}, "", "world", false},
+		{"get encrypted without key", []string{"get", "-base", encrypted.Base(), "secret"}, "", "", true},
+		{"stats", []string{"stats", "-base", plain.Base()}, "", "objects", false},
+		{"no store", []string{"get", "hello"}, "", "", true},
+		{"missing store", []string{"get", "-base", missing, "hello"}, "", "", true},
+		{"list missing store", []string{"list", "-base", missing}, "", "", true},
+		{"units", []string{"units", "-base", plain.Base(), "-key-index"}, "", "-base " + plain.Base() + " -key-index", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := run(t, tc.args, tc.stdin)
+			if tc.fail != (err != nil) {
+				t.Fatalf("Got error %v, expected failure %v", err, tc.fail)
+			}
+			if !strings.Contains(out, tc.out) {
+				t.Errorf("Got output %q, expected %q", out, tc.out)
+			}
+		})
+	}
+
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Read commands created the missing store")
+	}
+	if v, err := indexed.GetString("dir/new"); err != nil || v != "value" {
+		t.Errorf("Got %q (%v) from store, expected %q", v, err, "value")
+	}
+}
+
+// Test that gc prunes the tombstones older than the grace period
+func TestGCTombstones(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithTombstones())
+	s.StoreString("old", "value")
+	s.Delete("old")
+	old := time.Now().Add(-2 * time.Hour)
+	tombdir := filepath.Join(s.Base(), ".tombstones")
+	filepath.WalkDir(tombdir, func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			os.Chtimes(name, old, old)
+		}
+		return nil
+	})
+	s.StoreString("new", "value")
+	s.Delete("new")
+
+	out, err := run(t, []string{"gc", "-base", s.Base(), "-grace", "1h"}, "")
+	if err != nil || !strings.Contains(out, ", 1 tombstones") {
+		t.Errorf("Got output %q (%v), expected 1 removed tombstone", out, err)
+	}
+	if n, _ := s.PruneTombstones(time.Now().Add(time.Hour)); n != 1 {
+		t.Errorf("Got %d tombstones after gc, expected 1", n)
+	}
+}
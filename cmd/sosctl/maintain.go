@@ -0,0 +1,248 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/hweidner/sos"
+)
+
+// maintain runs the maintenance tasks once, or periodically until it is
+// interrupted.
+func maintain(args []string) error {
+	fs := flag.NewFlagSet("maintain", flag.ExitOnError)
+	store := addstoreflags(fs)
+	every := fs.Duration("every", 0, "run periodically at this interval, instead of once")
+	grace := fs.Duration("grace", time.Hour, "minimum age of removed temporary files, chunks and tombstones")
+	full := fs.Bool("full", false, "verify all objects, not only the changed shards")
+	_ = fs.Parse(args)
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if *every <= 0 {
+		return maintainonce(s, *grace, *full)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		// a failed run is reported, and retried on the next tick
+		if err := maintainonce(s, *grace, *full); err != nil {
+			fmt.Fprintln(os.Stderr, "sosctl:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintainonce removes left over temporary files, expired objects,
+// unreferenced chunks and old tombstones, and verifies the object files.
+func maintainonce(s *sos.SOS, grace time.Duration, full bool) error {
+	if err := collect(s, grace); err != nil {
+		return err
+	}
+	return check(s, full)
+}
+
+// gc removes left over temporary files, expired objects, unreferenced
+// chunks and old tombstones once.
+func gc(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	store := addstoreflags(fs)
+	grace := fs.Duration("grace", time.Hour, "minimum age of removed temporary files, chunks and tombstones")
+	_ = fs.Parse(args)
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return collect(s, *grace)
+}
+
+// fsck verifies the object files against the checksum manifests, and checks
+// the directory tree of the store.
+func fsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	store := addstoreflags(fs)
+	full := fs.Bool("full", false, "verify all objects, not only the changed shards")
+	digests := fs.Bool("verify", false, "check the values against their digests")
+	repair := fs.Bool("repair", false, "remove left over files, and move misplaced objects")
+	quarantine := fs.Bool("quarantine", false, "move damaged and foreign files to .quarantine")
+	tempAge := fs.Duration("temp-age", 24*time.Hour, "minimum age of left over temporary files")
+	_ = fs.Parse(args)
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := check(s, *full); err != nil {
+		return err
+	}
+
+	report, err := s.Fsck(sos.FsckOptions{
+		TempAge:    *tempAge,
+		Verify:     *digests,
+		Repair:     *repair,
+		Quarantine: *quarantine,
+	})
+	if err != nil {
+		return err
+	}
+	problems := 0
+	for _, p := range []struct {
+		kind  string
+		names []string
+	}{
+		{"temporary", report.TempFiles},
+		{"misplaced", report.Misplaced},
+		{"empty", report.EmptyDirs},
+		{"mismatched", report.Mismatched},
+		{"corrupt", report.Corrupt},
+	} {
+		for _, name := range p.names {
+			fmt.Printf("%s: %s\n", p.kind, name)
+		}
+		problems += len(p.names)
+	}
+	fmt.Printf("checked %d objects, %d problems, %d repaired, %d quarantined\n",
+		report.Objects, problems, report.Repaired, report.Quarantined)
+	if problems > report.Repaired+report.Quarantined {
+		return fmt.Errorf("%d problems left", problems-report.Repaired-report.Quarantined)
+	}
+	return nil
+}
+
+// collect removes left over temporary files, expired objects, unreferenced
+// chunks and old tombstones.
+func collect(s *sos.SOS, grace time.Duration) error {
+	temps, err := s.CleanupTemp(grace)
+	if err != nil {
+		return err
+	}
+	expired, err := s.Expire()
+	if err != nil {
+		return err
+	}
+	chunks, err := s.PruneChunks(grace)
+	if err != nil {
+		return err
+	}
+	tombstones, err := s.PruneTombstones(time.Now().Add(-grace))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %d temporary files, %d expired objects, %d chunks, %d tombstones\n", temps, expired, chunks, tombstones)
+	return nil
+}
+
+// check verifies the object files, and lists the corrupt ones.
+func check(s *sos.SOS, full bool) error {
+	report, err := s.Verify(full)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("verified %d objects in %d shards\n", report.Objects, report.Scanned)
+	for _, name := range report.Corrupt {
+		fmt.Printf("corrupt: %s\n", name)
+	}
+	if len(report.Corrupt) > 0 {
+		return fmt.Errorf("%d corrupt objects", len(report.Corrupt))
+	}
+	return nil
+}
+
+// unitTemplate is the systemd service, which runs the maintenance once.
+var unitTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=Maintenance of the simple object store {{.Store}}
+
+[Service]
+Type=oneshot
+ExecStart={{.Binary}} maintain {{.Flags}}
+{{- if .User}}
+User={{.User}}
+{{- end}}
+Nice=10
+IOSchedulingClass=idle
+`))
+
+// timerTemplate is the systemd timer, which starts the service periodically.
+var timerTemplate = template.Must(template.New("timer").Parse(`[Unit]
+Description=Periodic maintenance of the simple object store {{.Store}}
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec={{.Every}}
+RandomizedDelaySec=1min
+
+[Install]
+WantedBy=timers.target
+`))
+
+// units emits a systemd service and timer, which run the maintenance
+// periodically.
+func units(args []string) error {
+	fs := flag.NewFlagSet("units", flag.ExitOnError)
+	store := addstoreflags(fs)
+	every := fs.Duration("every", time.Hour, "interval of the maintenance")
+	name := fs.String("name", "sos-maintain", "name of the units")
+	user := fs.String("user", "", "user which runs the maintenance")
+	out := fs.String("out", "", "write the units into this directory, instead of stdout")
+	_ = fs.Parse(args)
+
+	// the service may run in another working directory
+	path, flags, err := store.args()
+	if err != nil {
+		return err
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Store, Flags, Binary, User, Every string
+	}{path, flags, binary, *user, fmt.Sprintf("%ds", int64(every.Seconds()))}
+
+	for _, unit := range []struct {
+		ext  string
+		tmpl *template.Template
+	}{{".service", unitTemplate}, {".timer", timerTemplate}} {
+		buf := new(strings.Builder)
+		if err := unit.tmpl.Execute(buf, data); err != nil {
+			return err
+		}
+		if *out == "" {
+			fmt.Printf("# %s%s\n%s\n", *name, unit.ext, buf)
+			continue
+		}
+		filename := filepath.Join(*out, *name+unit.ext)
+		if err := os.WriteFile(filename, []byte(buf.String()), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
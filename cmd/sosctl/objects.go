@@ -0,0 +1,167 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// put stores a value read from a file or stdin.
+func put(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	store := addstoreflags(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		usage()
+	}
+
+	var rd io.Reader = os.Stdin
+	if fs.NArg() == 2 && fs.Arg(1) != "-" {
+		fh, err := os.Open(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		rd = fh
+	}
+
+	s, err := store.open(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.StoreFrom(fs.Arg(0), rd)
+}
+
+// get writes a value to a file or stdout.
+func get(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	store := addstoreflags(fs)
+	out := fs.String("o", "", "write the value into this file, instead of stdout")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if *out == "" {
+		return s.GetTo(fs.Arg(0), os.Stdout)
+	}
+	rd, err := s.GetReader(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	fh, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fh, rd); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// del deletes keys.
+func del(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	store := addstoreflags(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		usage()
+	}
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	for _, key := range fs.Args() {
+		if err := s.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list prints the keys in the key index with a prefix.
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	store := addstoreflags(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() > 1 {
+		usage()
+	}
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	keys, err := s.List(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+	return nil
+}
+
+// stat prints the metadata of objects.
+func stat(args []string) error {
+	fs := flag.NewFlagSet("stat", flag.ExitOnError)
+	store := addstoreflags(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		usage()
+	}
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	for _, key := range fs.Args() {
+		info, err := s.Stat(key)
+		if err != nil {
+			return err
+		}
+		meta, err := s.GetMeta(key)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("key:      %s\nhash:     %s\nsize:     %d\nmodified: %s\n",
+			key, info.Hash, info.Size, info.ModTime.Format(time.RFC3339))
+		if meta.ContentType != "" {
+			fmt.Printf("type:     %s\n", meta.ContentType)
+		}
+		attrs := make([]string, 0, len(meta.Attrs))
+		for name := range meta.Attrs {
+			attrs = append(attrs, name)
+		}
+		sort.Strings(attrs)
+		for _, name := range attrs {
+			fmt.Printf("attr:     %s=%s\n", name, meta.Attrs[name])
+		}
+	}
+	return nil
+}
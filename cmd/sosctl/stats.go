@@ -0,0 +1,71 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// stats prints statistics of the store and its file system.
+func stats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	store := addstoreflags(fs)
+	shards := fs.Bool("shards", false, "scan the store, and show the objects per shard")
+	_ = fs.Parse(args)
+
+	s, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// without counters, the object files are scanned
+	st, err := s.Stats(*shards)
+	if err != nil {
+		return err
+	}
+	free, err := s.FreeSpace()
+	if err != nil {
+		return err
+	}
+	used, total, err := s.InodeUsage()
+	if err != nil {
+		return err
+	}
+
+	lastgc := "never"
+	if !st.LastGC.IsZero() {
+		lastgc = st.LastGC.Local().Format(time.RFC3339)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "objects:\t%d\n", st.Objects)
+	fmt.Fprintf(tw, "bytes:\t%d\n", st.Bytes)
+	fmt.Fprintf(tw, "temporary files:\t%d (%d bytes, oldest %s)\n", st.Temp.Count, st.Temp.Bytes, st.Temp.Oldest.Round(time.Second))
+	if c := st.Compression; c.Objects > 0 {
+		fmt.Fprintf(tw, "compression:\t%d objects, %d of %d bytes stored (ratio %.2f)\n", c.Objects, c.Bytes, c.PlainBytes, c.Ratio())
+	}
+	fmt.Fprintf(tw, "last gc:\t%s\n", lastgc)
+	fmt.Fprintf(tw, "free space:\t%d bytes\n", free)
+	fmt.Fprintf(tw, "inodes used:\t%d of %d\n", used, total)
+	fmt.Fprintf(tw, "legacy:\t%v\n", s.Legacy())
+	if *shards {
+		names := make([]string, 0, len(st.Shards))
+		for name := range st.Shards {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(tw, "shard %s:\t%d\n", name, st.Shards[name])
+		}
+	}
+	return tw.Flush()
+}
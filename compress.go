@@ -0,0 +1,166 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a compression format for values, see WithCompression.
+type Compression int
+
+const (
+	// CompressionGzip compresses values with gzip (RFC 1952).
+	CompressionGzip Compression = iota + 1
+	// CompressionZstd compresses values with Zstandard. It is faster than
+	// gzip, at a similar or better compression ratio.
+	CompressionZstd
+	// CompressionSnappy compresses values with the framed Snappy format. It
+	// is the fastest format, but compresses the least.
+	CompressionSnappy
+)
+
+// zstdMagic and snappyMagic are the first bytes of every Zstandard stream and
+// of every framed Snappy stream. gzipMagic is defined with GetGunzipTo.
+var (
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// WithCompression compresses all values stored afterwards in the given
+// format, and marks the objects with FlagCompressed. This saves disk space for
+// large text or JSON values, at the cost of CPU time on Store and Get.
+//
+// Compressed objects are decompressed on read in any case, also by stores
+// without this option, and regardless of the format they were written with.
+// So, stores with compressed and plain objects, and with objects of different
+// formats, stay readable. The format is detected from the compressed value
+// itself.
+//
+// The size in Stat is the size of the compressed object file. The size of
+// the plain value is recorded in the header, and Stats reports the
+// compression ratio, to judge whether the CPU time is worth it. Compressing
+// values which are compressed already, like images, wastes CPU time.
+func WithCompression(c Compression) Option {
+	return func(s *SOS) {
+		s.compression = c
+		WithWriteTransform(FlagCompressed, func(w io.Writer) (io.WriteCloser, error) {
+			return compressor(c, w)
+		})(s)
+	}
+}
+
+// encodesize is like encodefields, but records the size of the plain value
+// in the header, so the compression ratio can be reported (see Stats). Like
+// with encodedigest, the header is written with a placeholder first. With
+// WithDigests, the size is taken from the digest instead.
+func (s *SOS) encodesize(w io.Writer, wa io.WriterAt, rd io.Reader, fields map[byte][]byte) error {
+	fields = maps.Clone(fields)
+	if fields == nil {
+		fields = make(map[byte][]byte)
+	}
+	fields[tagSize] = make([]byte, 8)
+	if s.keyring != nil {
+		// written by encodevalue, and placed before the size
+		fields[tagKeyID] = []byte(s.keyring.current)
+	}
+
+	cr := &countReader{r: rd}
+	var err error
+	if s.chunking {
+		err = s.encodechunked(w, cr, fields)
+	} else {
+		err = s.encodevalue(w, cr, fields)
+	}
+	if err != nil {
+		return err
+	}
+
+	h := header{fields: fields}
+	_, err = wa.WriteAt(binary.BigEndian.AppendUint64(nil, uint64(cr.n)), h.offset(tagSize))
+	return err
+}
+
+// plainsize returns the size of the plain value of a compressed object, if
+// it is recorded in the header.
+func plainsize(h *header) (int64, bool) {
+	if h == nil || h.flags&FlagCompressed == 0 {
+		return 0, false
+	}
+	if d, ok := headerdigest(h); ok {
+		return d.Size, true
+	}
+	if data := h.fields[tagSize]; len(data) == 8 {
+		return int64(binary.BigEndian.Uint64(data)), true
+	}
+	return 0, false
+}
+
+// compressor returns a writer which compresses into w in the format c.
+func compressor(c Compression, w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case CompressionSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	}
+	return nil, fmt.Errorf("invalid compression format %d", c)
+}
+
+// decompress is the read transformation of FlagCompressed. It detects the
+// format of the compressed value, and returns a reader for the plain value.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(snappyMagic))
+
+	switch {
+	case len(magic) == 0:
+		return br, nil // some encoders write nothing for an empty value
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{zr: zr}, nil
+	case bytes.HasPrefix(magic, snappyMagic):
+		return snappy.NewReader(br), nil
+	}
+	return nil, fmt.Errorf("%w: unknown compression format", ErrCorrupt)
+}
+
+// zstdReader releases the resources of a Zstandard decoder at the end of the
+// value.
+type zstdReader struct {
+	zr  *zstd.Decoder
+	err error // sticky error, e.g. io.EOF
+}
+
+// Read reads from the decoder, and closes it when the value is complete or
+// an error occurred.
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.zr.Read(p)
+	if err != nil {
+		r.err = err
+		r.zr.Close()
+	}
+	return n, err
+}
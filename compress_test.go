@@ -0,0 +1,78 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test storing and getting compressed values in all formats
+func TestCompression(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	value := strings.Repeat(`{"name": "value"}`, 1000)
+
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionSnappy} {
+		s, err := New(dir, WithCompression(c))
+		if err != nil {
+			t.Fatalf("Error creating store with compression %d: %v", c, err)
+		}
+		key := "key" + string(rune('0'+c))
+		if err := s.StoreString(key, value); err != nil {
+			t.Fatalf("Error storing value with compression %d: %v", c, err)
+		}
+		v, err := s.GetString(key)
+		if err != nil || v != value {
+			t.Errorf("Got %d bytes (%v) from store with compression %d, expected %d", len(v), err, c, len(value))
+		}
+
+		info, _ := s.Stat(key)
+		if info.Size >= int64(len(value)) {
+			t.Errorf("Got object file of %d bytes with compression %d, expected less than %d", info.Size, c, len(value))
+		}
+		s.Close()
+	}
+
+	// a store without compression reads all formats, and writes plain values
+	s, _ := New(dir)
+	defer s.Destroy()
+	s.StoreString("plain", value)
+	for _, key := range []string{"key1", "key2", "key3", "plain"} {
+		var buf bytes.Buffer
+		if err := s.GetTo(key, &buf); err != nil || buf.String() != value {
+			t.Errorf("Got %d bytes (%v) for key %s from mixed store, expected %d", buf.Len(), err, key, len(value))
+		}
+	}
+	_, filename := s.getpath("plain")
+	if data, _ := os.ReadFile(filename); string(data) != value {
+		t.Errorf("Plain value was not stored unmodified")
+	}
+}
+
+// Test empty values and invalid compression formats
+func TestCompressionEdgeCases(t *testing.T) {
+	s := NewTemp(t, WithCompression(CompressionZstd))
+	s.StoreString("empty", "")
+	if v, err := s.GetString("empty"); err != nil || v != "" {
+		t.Errorf("Got %q (%v) for empty value, expected empty string", v, err)
+	}
+
+	if _, err := New(t.TempDir(), WithCompression(Compression(42))); err == nil {
+		t.Errorf("Got no error for invalid compression format")
+	}
+
+	// a corrupt compressed value is detected
+	_, filename := s.getpath("empty")
+	h := header{flags: FlagCompressed}
+	os.WriteFile(filename, append(h.marshal(), "garbage"...), 0o644)
+	if _, err := s.Get("empty"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Got %v for corrupt compressed value, expected ErrCorrupt", err)
+	}
+}
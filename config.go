@@ -0,0 +1,366 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of a store in a serializable form, so services,
+// the command line tools and gateways can share one configuration file. It
+// covers the options which can be expressed as data. Options with callbacks
+// or writers (like WithEventSink) are passed to Config.New in addition.
+//
+// Configurations are read from JSON or YAML files with LoadConfig, and may be
+// overridden by environment variables with LoadEnv. The zero value of each
+// field means the default of the corresponding option.
+//
+// An encrypted store (see WithEncryption) is configured by a key file, which
+// holds one key per line, as a name and the hex encoded key, separated by
+// white space. Empty lines and lines starting with # are ignored. KeyID names
+// the key for new values, and may be left empty if the file holds one key
+// only. The other keys are passed as old keys, so their objects can still be
+// read.
+type Config struct {
+	Path           string      `json:"path" yaml:"path" env:"PATH"`
+	Suffix         string      `json:"suffix,omitempty" yaml:"suffix,omitempty" env:"SUFFIX"`
+	ShardDepth     *int        `json:"shardDepth,omitempty" yaml:"shardDepth,omitempty" env:"SHARD_DEPTH"`
+	Hash           string      `json:"hash,omitempty" yaml:"hash,omitempty" env:"HASH"`
+	Consistency    string      `json:"consistency,omitempty" yaml:"consistency,omitempty" env:"CONSISTENCY"`
+	Compression    string      `json:"compression,omitempty" yaml:"compression,omitempty" env:"COMPRESSION"`
+	FileMode       string      `json:"fileMode,omitempty" yaml:"fileMode,omitempty" env:"FILE_MODE"`
+	DirMode        string      `json:"dirMode,omitempty" yaml:"dirMode,omitempty" env:"DIR_MODE"`
+	NoOverwrite    bool        `json:"noOverwrite,omitempty" yaml:"noOverwrite,omitempty" env:"NO_OVERWRITE"`
+	KeyIndex       bool        `json:"keyIndex,omitempty" yaml:"keyIndex,omitempty" env:"KEY_INDEX"`
+	CollisionCheck bool        `json:"collisionCheck,omitempty" yaml:"collisionCheck,omitempty" env:"COLLISION_CHECK"`
+	Chunking       bool        `json:"chunking,omitempty" yaml:"chunking,omitempty" env:"CHUNKING"`
+	Digests        bool        `json:"digests,omitempty" yaml:"digests,omitempty" env:"DIGESTS"`
+	VerifyOnRead   bool        `json:"verifyOnRead,omitempty" yaml:"verifyOnRead,omitempty" env:"VERIFY_ON_READ"`
+	Fsync          bool        `json:"fsync,omitempty" yaml:"fsync,omitempty" env:"FSYNC"`
+	Counters       bool        `json:"counters,omitempty" yaml:"counters,omitempty" env:"COUNTERS"`
+	Tombstones     bool        `json:"tombstones,omitempty" yaml:"tombstones,omitempty" env:"TOMBSTONES"`
+	Tenant         string      `json:"tenant,omitempty" yaml:"tenant,omitempty" env:"TENANT"`
+	KeyFile        string      `json:"keyFile,omitempty" yaml:"keyFile,omitempty" env:"KEY_FILE"`
+	KeyID          string      `json:"keyID,omitempty" yaml:"keyID,omitempty" env:"KEY_ID"`
+	Limits         LimitConfig `json:"limits" yaml:"limits,omitempty"`
+}
+
+// LimitConfig holds the time limits of a store, and the size and count
+// limits, which are watched by a LimitMonitor (see Config.SoftLimits).
+type LimitConfig struct {
+	CloseTimeout Duration `json:"closeTimeout,omitempty" yaml:"closeTimeout,omitempty" env:"CLOSE_TIMEOUT"`
+	TempCleanup  Duration `json:"tempCleanup,omitempty" yaml:"tempCleanup,omitempty" env:"TEMP_CLEANUP"`
+	MaxBytes     int64    `json:"maxBytes,omitempty" yaml:"maxBytes,omitempty" env:"MAX_BYTES"`
+	MaxObjects   int64    `json:"maxObjects,omitempty" yaml:"maxObjects,omitempty" env:"MAX_OBJECTS"`
+}
+
+// Duration is a time.Duration, which is written as a string like "1m30s" in
+// configuration files.
+type Duration time.Duration
+
+// MarshalText returns the duration as string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses a duration string, see time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = Duration(v)
+	return err
+}
+
+// hashes are the key hash functions selectable in a configuration.
+var hashes = map[string]func() hash.Hash{
+	"sha256":  sha256.New,
+	"sha512":  sha512.New,
+	"fnv128a": fnv.New128a,
+}
+
+// consistencies are the consistency levels selectable in a configuration.
+var consistencies = map[string]Consistency{
+	"link":   ConsistencyLink,
+	"verify": ConsistencyVerify,
+	"strict": ConsistencyStrict,
+}
+
+// compressions are the compression formats selectable in a configuration.
+var compressions = map[string]Compression{
+	"gzip":   CompressionGzip,
+	"zstd":   CompressionZstd,
+	"snappy": CompressionSnappy,
+}
+
+// LoadConfig reads a configuration from a JSON file (extension .json) or a
+// YAML file (extension .yaml or .yml). Unknown fields are an error, to catch
+// typing errors. The configuration is not validated yet, as it may be
+// completed by LoadEnv.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Config)
+	switch ext := filepath.Ext(filename); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return c, nil
+}
+
+// LoadEnv overrides the configuration with the environment variables, which
+// are named by prefix and the field name in upper snake case, e.g.
+// SOS_SHARD_DEPTH for the prefix "SOS_". The limits have no extra prefix,
+// e.g. SOS_CLOSE_TIMEOUT. Variables which are not set leave the field
+// unchanged.
+func (c *Config) LoadEnv(prefix string) error {
+	return loadenv(reflect.ValueOf(c).Elem(), prefix)
+}
+
+// loadenv sets the fields of the struct v from the environment.
+func loadenv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, fv := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Tag.Get("env") == "" {
+			if err := loadenv(fv, prefix); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := prefix + field.Tag.Get("env")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setfield(fv, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setfield sets a configuration field from its string representation.
+func setfield(fv reflect.Value, value string) error {
+	if tu, ok := fv.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return tu.UnmarshalText([]byte(value))
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Pointer: // *int
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(&n))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+// Validate checks the configuration for errors, without creating the store.
+// Config.New validates the configuration as well.
+func (c *Config) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("path for object storage must not be empty")
+	}
+	opts, err := c.Options()
+	if err != nil {
+		return err
+	}
+	_, err = newstore(c.Path, opts)
+	return err
+}
+
+// Options returns the options, which correspond to the configuration.
+func (c *Config) Options() ([]Option, error) {
+	var opts []Option
+	if c.Suffix != "" {
+		opts = append(opts, WithSuffix(c.Suffix))
+	}
+	if c.ShardDepth != nil {
+		opts = append(opts, WithShardDepth(*c.ShardDepth))
+	}
+	if c.Hash != "" {
+		h, ok := hashes[strings.ToLower(c.Hash)]
+		if !ok {
+			return nil, fmt.Errorf("unknown key hash function %q", c.Hash)
+		}
+		opts = append(opts, WithHash(h))
+	}
+	if c.Consistency != "" {
+		level, ok := consistencies[strings.ToLower(c.Consistency)]
+		if !ok {
+			return nil, fmt.Errorf("unknown consistency level %q", c.Consistency)
+		}
+		opts = append(opts, WithConsistency(level))
+	}
+	if c.Compression != "" {
+		format, ok := compressions[strings.ToLower(c.Compression)]
+		if !ok {
+			return nil, fmt.Errorf("unknown compression format %q", c.Compression)
+		}
+		opts = append(opts, WithCompression(format))
+	}
+	if c.FileMode != "" {
+		mode, err := strconv.ParseUint(c.FileMode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file mode %q", c.FileMode)
+		}
+		opts = append(opts, WithFileMode(os.FileMode(mode)))
+	}
+	if c.DirMode != "" {
+		mode, err := strconv.ParseUint(c.DirMode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid directory mode %q", c.DirMode)
+		}
+		opts = append(opts, WithDirMode(os.FileMode(mode)))
+	}
+	if c.NoOverwrite {
+		opts = append(opts, WithNoOverwrite())
+	}
+	if c.KeyIndex {
+		opts = append(opts, WithKeyIndex())
+	}
+	if c.CollisionCheck {
+		opts = append(opts, WithCollisionCheck())
+	}
+	if c.Chunking {
+		opts = append(opts, WithChunking())
+	}
+	if c.Digests {
+		opts = append(opts, WithDigests())
+	}
+	if c.VerifyOnRead {
+		opts = append(opts, WithVerifyOnRead())
+	}
+	if c.Fsync {
+		opts = append(opts, WithFsync())
+	}
+	if c.Counters {
+		opts = append(opts, WithCounters())
+	}
+	if c.Tombstones {
+		opts = append(opts, WithTombstones())
+	}
+	if c.Tenant != "" {
+		opts = append(opts, WithTenant(c.Tenant))
+	}
+	if c.KeyFile != "" {
+		key, oldKeys, err := readkeyfile(c.KeyFile, c.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithEncryption(key, oldKeys...))
+	} else if c.KeyID != "" {
+		return nil, fmt.Errorf("key ID %q without key file", c.KeyID)
+	}
+	if c.Limits.CloseTimeout != 0 {
+		opts = append(opts, WithCloseTimeout(time.Duration(c.Limits.CloseTimeout)))
+	}
+	if c.Limits.TempCleanup != 0 {
+		opts = append(opts, WithTempCleanup(time.Duration(c.Limits.TempCleanup)))
+	}
+	return opts, nil
+}
+
+// SoftLimits returns the size and count limits of the configuration, for a
+// LimitMonitor.
+func (c *Config) SoftLimits() SoftLimits {
+	return SoftLimits{Bytes: c.Limits.MaxBytes, Objects: c.Limits.MaxObjects}
+}
+
+// readkeyfile reads the encryption keys from a key file, and returns the key
+// with the given name, and the other keys.
+func readkeyfile(filename, id string) (key []byte, oldKeys [][]byte, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var k []byte
+		if len(fields) == 2 {
+			k, err = hex.DecodeString(fields[1])
+		}
+		if len(fields) != 2 || err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: invalid key", filename, i+1)
+		}
+		if fields[0] == id || id == "" && key == nil {
+			key = k
+		} else {
+			oldKeys = append(oldKeys, k)
+		}
+		names = append(names, fields[0])
+	}
+	switch {
+	case id == "" && len(names) > 1:
+		return nil, nil, fmt.Errorf("%s: key ID required, as the file holds several keys", filename)
+	case key == nil && id != "":
+		return nil, nil, fmt.Errorf("%s: no key with ID %q", filename, id)
+	case key == nil:
+		return nil, nil, fmt.Errorf("%s: no key", filename)
+	}
+	return key, oldKeys, nil
+}
+
+// New creates the store described by the configuration, see New. The extra
+// options are applied after the configured ones.
+func (c *Config) New(extra ...Option) (*SOS, error) {
+	opts, err := c.Options()
+	if err != nil {
+		return nil, &Error{Op: "New", Path: c.Path, Err: err}
+	}
+	return New(c.Path, append(opts, extra...)...)
+}
@@ -0,0 +1,148 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test loading configurations from JSON, YAML and the environment
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"sos.json": `{"path": "` + dir + `/json", "shardDepth": 1, "hash": "sha512",
+			"keyIndex": true, "limits": {"closeTimeout": "5s"}}`,
+		"sos.yaml": "path: " + dir + "/yaml\nshardDepth: 1\nhash: sha512\nkeyIndex: true\nlimits:\n  closeTimeout: 5s\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		os.WriteFile(filename, []byte(content), 0o644)
+
+		c, err := LoadConfig(filename)
+		if err != nil {
+			t.Fatalf("Loading %s failed: %v", name, err)
+		}
+		if *c.ShardDepth != 1 || c.Hash != "sha512" || !c.KeyIndex || time.Duration(c.Limits.CloseTimeout) != 5*time.Second {
+			t.Errorf("Got configuration %+v from %s", c, name)
+		}
+
+		s, err := c.New()
+		if err != nil {
+			t.Fatalf("Creating the store from %s failed: %v", name, err)
+		}
+		s.StoreString("key", "value")
+		if keys, _ := s.List(""); len(keys) != 1 || keys[0] != "key" {
+			t.Errorf("Got keys %v from store, expected the key index", keys)
+		}
+		if s.shardDepth != 1 || s.hashlen() != 128 || s.timeout != 5*time.Second {
+			t.Errorf("The store from %s does not match the configuration", name)
+		}
+		s.Destroy()
+	}
+
+	// typing errors are detected
+	filename := filepath.Join(dir, "typo.yaml")
+	os.WriteFile(filename, []byte("path: /tmp\nshardDeph: 1\n"), 0o644)
+	if _, err := LoadConfig(filename); err == nil {
+		t.Errorf("Loading a configuration with an unknown field succeeded")
+	}
+}
+
+// Test overriding a configuration by environment variables
+func TestConfigEnv(t *testing.T) {
+	t.Setenv("SOS_PATH", "/srv/sos")
+	t.Setenv("SOS_SHARD_DEPTH", "3")
+	t.Setenv("SOS_FSYNC", "true")
+	t.Setenv("SOS_TEMP_CLEANUP", "1h")
+
+	c := &Config{Path: "/tmp/sos", Suffix: ".obj"}
+	if err := c.LoadEnv("SOS_"); err != nil {
+		t.Fatalf("LoadEnv failed: %v", err)
+	}
+	if c.Path != "/srv/sos" || c.Suffix != ".obj" || *c.ShardDepth != 3 || !c.Fsync || time.Duration(c.Limits.TempCleanup) != time.Hour {
+		t.Errorf("Got configuration %+v from the environment", c)
+	}
+
+	t.Setenv("SOS_FSYNC", "maybe")
+	if err := c.LoadEnv("SOS_"); err == nil {
+		t.Errorf("LoadEnv succeeded with an invalid boolean")
+	}
+}
+
+// Test validation of configurations
+func TestConfigValidate(t *testing.T) {
+	depth := 9
+	for _, c := range []Config{
+		{},
+		{Path: "/tmp/sos", Hash: "md5"},
+		{Path: "/tmp/sos", Consistency: "eventual"},
+		{Path: "/tmp/sos", Compression: "lz4"},
+		{Path: "/tmp/sos", FileMode: "rw-r--r--"},
+		{Path: "/tmp/sos", ShardDepth: &depth},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Configuration %+v is valid, expected an error", c)
+		}
+	}
+	if err := (&Config{Path: "/tmp/sos", Hash: "fnv128a", FileMode: "0640", Compression: "zstd"}).Validate(); err != nil {
+		t.Errorf("Validation of a correct configuration failed: %v", err)
+	}
+}
+
+// Test configuring the encryption keys and the soft limits
+func TestConfigKeysLimits(t *testing.T) {
+	dir := t.TempDir()
+	keyfile := filepath.Join(dir, "keys")
+	os.WriteFile(keyfile, []byte("# keys of the store\n"+
+		"old "+strings.Repeat("01", 32)+"\n"+
+		"new "+strings.Repeat("02", 32)+"\n"), 0o600)
+
+	c := &Config{Path: filepath.Join(dir, "store"), KeyFile: keyfile, KeyID: "old"}
+	s, err := c.New()
+	if err != nil {
+		t.Fatalf("Creating the store failed: %v", err)
+	}
+	s.StoreString("key", "value")
+	s.Close()
+	_, filename := s.getpath("key")
+	if data, _ := os.ReadFile(filename); strings.Contains(string(data), "value") {
+		t.Errorf("Got plain value in object file, expected encryption")
+	}
+
+	// the old key remains readable after the rotation
+	c.KeyID = "new"
+	s, err = c.New()
+	if err != nil {
+		t.Fatalf("Opening the store with the new key failed: %v", err)
+	}
+	if v, err := s.GetString("key"); err != nil || v != "value" {
+		t.Errorf("Got %q (%v), expected %q", v, err, "value")
+	}
+	s.Close()
+
+	for _, bad := range []Config{
+		{Path: c.Path, KeyFile: keyfile},
+		{Path: c.Path, KeyFile: keyfile, KeyID: "missing"},
+		{Path: c.Path, KeyID: "new"},
+	} {
+		if _, err := bad.Options(); err == nil {
+			t.Errorf("Configuration %+v is valid, expected an error", bad)
+		}
+	}
+
+	t.Setenv("SOS_MAX_BYTES", "1000000")
+	t.Setenv("SOS_MAX_OBJECTS", "1000")
+	if err := c.LoadEnv("SOS_"); err != nil {
+		t.Fatalf("LoadEnv failed: %v", err)
+	}
+	if l := c.SoftLimits(); l.Bytes != 1000000 || l.Objects != 1000 {
+		t.Errorf("Got soft limits %+v, expected 1000000 bytes and 1000 objects", l)
+	}
+}
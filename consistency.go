@@ -0,0 +1,88 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Consistency is the level of consistency checks when an object is read.
+type Consistency int
+
+const (
+	// ConsistencyLink reads the object through a private hard link, without
+	// further checks. This is the default. On local file systems, the link
+	// always refers to a complete value.
+	ConsistencyLink Consistency = iota
+	// ConsistencyVerify compares the hard link with the object file after
+	// it was created. If they differ in inode or size, e.g. because the
+	// object was replaced concurrently, or because of stale attribute caches
+	// on NFS, the link is created again, up to a few times. The same happens
+	// if the link fails because the object was replaced while it was linked.
+	// If the object keeps changing, the value of the last link is read.
+	ConsistencyVerify
+	// ConsistencyStrict works like ConsistencyVerify, but fails with
+	// ErrInconsistent if the link and the object file still differ after the
+	// retries.
+	ConsistencyStrict
+)
+
+// maxConsistencyRetries is the number of times a hard link is created again,
+// if it differs from the object file.
+const maxConsistencyRetries = 3
+
+// WithConsistency sets the level of consistency checks when objects are read.
+// The default is ConsistencyLink. The stronger levels cost an additional stat
+// call per read, and are mainly useful on shared file systems like NFS.
+func WithConsistency(c Consistency) Option {
+	return func(s *SOS) {
+		s.consistency = c
+	}
+}
+
+// relink reports whether a hard link, which failed because the object file
+// was not found, should be created again. On Linux, the link fails if the
+// object file is replaced at the same time, although a file exists under the
+// name all the time.
+func (s *SOS) relink(filename string, attempt int) bool {
+	if s.consistency == ConsistencyLink || attempt >= maxConsistencyRetries {
+		return false
+	}
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// checklink verifies a hard link opened by openfile against the object file,
+// according to the consistency level of the store. It returns false if the
+// link should be created again.
+func (s *SOS) checklink(fh *os.File, filename string, attempt int) (bool, error) {
+	if s.consistency == ConsistencyLink {
+		return true, nil
+	}
+
+	lfi, err := fh.Stat()
+	if err != nil {
+		return false, err
+	}
+	ofi, err := os.Stat(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if ofi != nil && os.SameFile(lfi, ofi) && lfi.Size() == ofi.Size() {
+		return true, nil
+	}
+
+	if attempt < maxConsistencyRetries {
+		return false, nil
+	}
+	if s.consistency == ConsistencyStrict {
+		return false, fmt.Errorf("%w: after %d attempts", ErrInconsistent, attempt+1)
+	}
+	return true, nil
+}
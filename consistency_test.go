@@ -0,0 +1,67 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// Test reading with all consistency levels
+func TestConsistency(t *testing.T) {
+	for _, c := range []Consistency{ConsistencyLink, ConsistencyVerify, ConsistencyStrict} {
+		s := NewTemp(t, WithConsistency(c))
+		s.StoreString("key", "value")
+		if obj, err := s.GetString("key"); err != nil || obj != "value" {
+			t.Errorf("Got %q, %v from store with consistency %d, expected %q", obj, err, c, "value")
+		}
+		if _, err := s.GetString("missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Got %v for a missing key with consistency %d, expected ErrNotFound", err, c)
+		}
+	}
+
+	if _, err := New(t.TempDir(), WithConsistency(Consistency(7))); err == nil {
+		t.Errorf("New succeeded with an invalid consistency level")
+	}
+}
+
+// Test that strict reads return complete values while the object is replaced
+func TestConsistencyConcurrent(t *testing.T) {
+	s := NewTemp(t, WithConsistency(ConsistencyStrict))
+	values := map[string]bool{"short": true, "a somewhat longer value": true}
+	s.StoreString("key", "short")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for v := range values {
+				s.StoreString("key", v)
+			}
+		}
+	}()
+
+	for i := 0; i < 500; i++ {
+		obj, err := s.GetString("key")
+		if errors.Is(err, ErrInconsistent) {
+			continue
+		}
+		if err != nil || !values[obj] {
+			t.Errorf("Got %q, %v from store, expected one of the stored values", obj, err)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,228 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// CopyTo copies all objects for which filter returns true into the store dst.
+// If filter is nil, all objects are copied. The object files are copied
+// unmodified, including their modification time, by several goroutines
+// concurrently.
+//
+// Objects which exist in dst with the same size and modification time are
+// skipped. So, an interrupted CopyTo can be resumed by simply calling it
+// again.
+//
+// As the files are copied unmodified, dst must use the same hash function
+// (see WithHash), and hold all encryption keys of the store (see
+// WithEncryption). Otherwise, ErrLayoutMismatch is returned before anything
+// is copied. The shard depth and the suffix may differ. The chunks of chunked
+// objects are copied along with them (see WithChunking), and so are the key
+// index entries if dst keeps a key index (see WithKeyIndex). Pointers are not
+// copied.
+func (s *SOS) CopyTo(dst *SOS, filter func(ObjectInfo) bool) (err error) {
+	defer s.wraperr(&err, "CopyTo", "")
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+	if err := dst.begin(); err != nil {
+		return err
+	}
+	defer dst.end()
+
+	if err := s.checkcompatible(dst); err != nil {
+		return err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		copyErr error
+	)
+	objects := make(chan ObjectInfo)
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range objects {
+				if err := s.copyobject(dst, info); err != nil {
+					mu.Lock()
+					if copyErr == nil {
+						copyErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	err = s.walk(func(rel string, fi fs.FileInfo) error {
+		mu.Lock()
+		failed := copyErr
+		mu.Unlock()
+		if failed != nil {
+			return failed
+		}
+
+		info := newinfo(s.relhash(rel), fi)
+		if filter == nil || filter(info) {
+			objects <- info
+		}
+		return nil
+	})
+	close(objects)
+	wg.Wait()
+
+	if copyErr != nil {
+		return copyErr
+	}
+	return err
+}
+
+// copyobject copies a single object file into the store dst, unless it
+// exists there with the same size and modification time, and its key index
+// entry if dst keeps a key index.
+func (s *SOS) copyobject(dst *SOS, info ObjectInfo) error {
+	dirname, filename := dst.hashpath(info.Hash)
+	if fi, err := os.Stat(filename); err == nil &&
+		fi.Size() == info.Size && fi.ModTime().Equal(info.ModTime) {
+		return s.copyindex(dst, info.Hash)
+	}
+
+	_, srcname := s.hashpath(info.Hash)
+	fh, err := s.openfile(srcname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // deleted in the meantime
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	// the chunks are copied first, so the object never refers to a missing
+	// chunk in dst
+	if err := s.copychunks(dst, fh.Name()); err != nil {
+		return err
+	}
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmpname := dst.tmpfilename()
+	wr, err := dst.createfile(tmpname)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(wr, fh)
+	if cerr := wr.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(tmpname, fi.ModTime(), fi.ModTime())
+	}
+	if err == nil {
+		err = copyxattrs(fh.Name(), tmpname)
+	}
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+
+	if err := dst.beginmodify(); err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	defer dst.endmodify()
+	err = dst.change(info.Hash, false, func() error {
+		return dst.commitfile(tmpname, dirname, filename)
+	})
+	if err != nil {
+		return err
+	}
+	return s.copyindex(dst, info.Hash)
+}
+
+// copyindex copies the key index entry of the key hash hs into the store
+// dst, if there is one and dst keeps a key index.
+func (s *SOS) copyindex(dst *SOS, hs string) error {
+	if !dst.keyIndex {
+		return nil
+	}
+	_, filename := s.indexpath(hs)
+	key, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return dst.writeindex(string(key))
+}
+
+// copychunks copies the chunks which the object file filename refers to into
+// the store dst, unless they exist there.
+func (s *SOS) copychunks(dst *SOS, filename string) error {
+	refs := make(map[string]bool)
+	if err := s.chunkrefs(filename, refs); err != nil && !errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	for sum := range refs {
+		if err := s.copychunk(dst, sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copychunk copies a single chunk file into the store dst, unless it exists
+// there.
+func (s *SOS) copychunk(dst *SOS, sum string) error {
+	_, filename := dst.chunkpath(sum)
+	if _, err := os.Stat(filename); err == nil {
+		return nil
+	}
+
+	_, srcname := s.chunkpath(sum)
+	fh, err := os.Open(srcname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: missing chunk %s", ErrCorrupt, sum)
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	tmpname := dst.tmpfilename()
+	wr, err := dst.createfile(tmpname)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpname)
+	_, err = io.Copy(wr, fh)
+	if err == nil {
+		err = dst.syncfile(wr)
+	}
+	if cerr := wr.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return dst.linkchunk(tmpname, sum)
+}
@@ -0,0 +1,73 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Test selective copying between stores
+func TestCopyTo(t *testing.T) {
+	src := NewTemp(t)
+	dst := NewTemp(t)
+
+	for i := 0; i < 20; i++ {
+		src.StoreString(fmt.Sprintf("key%d", i), fmt.Sprintf("value %d", i))
+	}
+	src.StoreString("large", "a considerably larger value")
+
+	err := src.CopyTo(dst, func(info ObjectInfo) bool {
+		return info.Size < 10
+	})
+	if err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	if obj, _ := dst.GetString("key7"); obj != "value 7" {
+		t.Errorf("Got %s from copy, expected %s", obj, "value 7")
+	}
+	if _, err := dst.Get("large"); err == nil {
+		t.Errorf("Got object which was excluded by the filter")
+	}
+
+	// resume with all objects
+	if err := src.CopyTo(dst, nil); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	if obj, _ := dst.GetString("large"); obj != "a considerably larger value" {
+		t.Errorf("Got %s from copy, expected %s", obj, "a considerably larger value")
+	}
+}
+
+// Test that CopyTo refuses stores which could not find or read the objects
+func TestCopyToIncompatible(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	src := NewTemp(t, WithEncryption(key))
+	src.StoreString("key", "value")
+
+	for name, dst := range map[string]*SOS{
+		"hash":       NewTemp(t, WithHash(sha512.New), WithEncryption(key)),
+		"encryption": NewTemp(t),
+	} {
+		if err := src.CopyTo(dst, nil); !errors.Is(err, ErrLayoutMismatch) {
+			t.Errorf("Got %v copying to store with different %s, expected %v", err, name, ErrLayoutMismatch)
+		}
+		if n, _ := dst.Count(); n != 0 {
+			t.Errorf("Got %d objects in store with different %s, expected 0", n, name)
+		}
+	}
+
+	dst := NewTemp(t, WithShardDepth(1), WithEncryption(bytes.Repeat([]byte{2}, 32), key))
+	if err := src.CopyTo(dst, nil); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	if v, err := dst.GetString("key"); err != nil || v != "value" {
+		t.Errorf("Got %q (%v) from copy, expected %q", v, err, "value")
+	}
+}
@@ -0,0 +1,315 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// counterTotal is the counter file, which holds the merged counts of
+// closed store instances.
+const counterTotal = "total"
+
+// counters holds the changes of the counts by this store instance, which
+// could not be written to its counter file yet.
+type counters struct {
+	mu      sync.Mutex
+	objects int64
+	bytes   int64
+}
+
+// WithCounters keeps the number of objects and their total size in counter
+// files, so Count and TotalSize do not need to scan the store. Each store
+// instance records its own changes in a separate file, which is merged into
+// the total when it is closed, and all files are summed up on read. So, the
+// counts stay correct with several processes writing to the store.
+//
+// All processes writing to the store must use WithCounters, as the changes of
+// other processes are not counted. The object file of a key is locked while
+// it is changed, like in CompareAndSwap, so the size of a replaced object is
+// known. When the counters are enabled for an existing store, its objects are
+// counted by New, see Recount.
+func WithCounters() Option {
+	return func(s *SOS) {
+		s.counts = new(counters)
+	}
+}
+
+// Count returns the number of objects in the store. Without WithCounters, all
+// object files are scanned.
+func (s *SOS) Count() (n int64, err error) {
+	n, _, err = s.counted("Count")
+	return n, err
+}
+
+// TotalSize returns the total size of the object files in the store. Chunks
+// of chunked values (see WithChunking) are not included. Without
+// WithCounters, all object files are scanned.
+func (s *SOS) TotalSize() (n int64, err error) {
+	_, n, err = s.counted("TotalSize")
+	return n, err
+}
+
+// counted returns the number of objects and their total size, from the
+// counter files or by scanning the store.
+func (s *SOS) counted(op string) (objects, bytes int64, err error) {
+	defer s.wraperr(&err, op, "")
+
+	if s.counts == nil {
+		return s.footprint()
+	}
+
+	if err := s.begin(); err != nil {
+		return 0, 0, err
+	}
+	defer s.end()
+
+	unlock, err := s.lockcounters()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	entries, err := os.ReadDir(s.counterdir())
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, e := range entries {
+		o, b, err := readcounter(filepath.Join(s.counterdir(), e.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		objects, bytes = objects+o, bytes+b
+	}
+
+	s.counts.mu.Lock()
+	defer s.counts.mu.Unlock()
+	return objects + s.counts.objects, bytes + s.counts.bytes, nil
+}
+
+// Recount counts the objects of the store, and resets the counter files to
+// the result. It repairs counters, which are wrong because a process wrote
+// to the store without WithCounters. Changes by other processes during the
+// recount may be miscounted.
+func (s *SOS) Recount() (err error) {
+	defer s.wraperr(&err, "Recount", "")
+
+	if s.counts == nil {
+		return fmt.Errorf("counters require WithCounters")
+	}
+	return s.recount()
+}
+
+// recount implements Recount.
+func (s *SOS) recount() error {
+	if err := s.mkdirall(s.counterdir()); err != nil {
+		return err
+	}
+	unlock, err := s.lockcounters()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.recountlocked()
+}
+
+// recountlocked counts the objects. The counters lock must be held.
+func (s *SOS) recountlocked() error {
+	objects, bytes, err := s.footprint()
+	if err != nil {
+		return err
+	}
+	if err := s.writecounter(counterTotal, objects, bytes); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(s.counterdir())
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() != counterTotal {
+			_ = os.Remove(filepath.Join(s.counterdir(), e.Name()))
+		}
+	}
+
+	s.counts.mu.Lock()
+	s.counts.objects, s.counts.bytes = 0, 0
+	s.counts.mu.Unlock()
+	return nil
+}
+
+// initcounters counts the objects, if the counters are enabled for the first
+// time. The total is checked again under the counters lock, so of several
+// processes opening the store at the same time, only the first one counts,
+// and the others keep the changes made in the meantime.
+func (s *SOS) initcounters() error {
+	if s.counts == nil {
+		return nil
+	}
+	total := filepath.Join(s.counterdir(), counterTotal)
+	if _, err := os.Stat(total); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := s.mkdirall(s.counterdir()); err != nil {
+		return err
+	}
+	unlock, err := s.lockcounters()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := os.Stat(total); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return s.recountlocked()
+}
+
+// mergecounters merges the changes of this instance into the total.
+func (s *SOS) mergecounters() error {
+	if s.counts == nil {
+		return nil
+	}
+	unlock, err := s.lockcounters()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.counts.mu.Lock()
+	defer s.counts.mu.Unlock()
+	objects, bytes, err := readcounter(filepath.Join(s.counterdir(), s.instanceID))
+	if errors.Is(err, fs.ErrNotExist) && s.counts.objects == 0 && s.counts.bytes == 0 {
+		return nil // no changes
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	o, b, err := readcounter(filepath.Join(s.counterdir(), counterTotal))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	objects, bytes = objects+o+s.counts.objects, bytes+b+s.counts.bytes
+	if err := s.writecounter(counterTotal, objects, bytes); err != nil {
+		return err
+	}
+	s.counts.objects, s.counts.bytes = 0, 0
+	err = os.Remove(filepath.Join(s.counterdir(), s.instanceID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// change runs fn, which stores, replaces or removes the object file of the
+// key hash hs, and records a successful change (see changed). With counters,
+// the change is counted, and unless the caller holds the lock of the key
+// already, the key is locked meanwhile.
+func (s *SOS) change(hs string, locked bool, fn func() error) error {
+	start := s.clock.Now()
+	if s.counts == nil {
+		err := fn()
+		if err == nil {
+			s.changed(hs, start)
+		}
+		return err
+	}
+	if !locked {
+		unlock, err := s.lockhash(hs)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	_, filename := s.hashpath(hs)
+	before, bsize := filesize(filename)
+	err := fn()
+	after, asize := filesize(filename)
+	s.count(after-before, asize-bsize)
+	if err == nil {
+		s.changed(hs, start)
+	}
+	return err
+}
+
+// filesize returns 1 and the size of an existing file, or 0 and 0.
+func filesize(filename string) (int64, int64) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return 0, 0
+	}
+	return 1, fi.Size()
+}
+
+// count adds a change of the counts to the counter file of this instance.
+// If the file cannot be written, the change is kept in memory, and written
+// with the next change. The file is read each time, as Recount may have
+// reset it.
+func (s *SOS) count(objects, bytes int64) {
+	if objects == 0 && bytes == 0 {
+		return
+	}
+	s.counts.mu.Lock()
+	defer s.counts.mu.Unlock()
+	s.counts.objects += objects
+	s.counts.bytes += bytes
+
+	o, b, err := readcounter(filepath.Join(s.counterdir(), s.instanceID))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if s.writecounter(s.instanceID, o+s.counts.objects, b+s.counts.bytes) == nil {
+		s.counts.objects, s.counts.bytes = 0, 0
+	}
+}
+
+// writecounter replaces a counter file.
+func (s *SOS) writecounter(name string, objects, bytes int64) error {
+	tmpname := s.tmpfilename()
+	if err := s.writefile(tmpname, []byte(fmt.Sprintf("%d %d\n", objects, bytes))); err != nil {
+		return err
+	}
+	err := s.retrydir(s.counterdir(), func() error {
+		return os.Rename(tmpname, filepath.Join(s.counterdir(), name))
+	})
+	if err != nil {
+		_ = os.Remove(tmpname)
+	}
+	return err
+}
+
+// readcounter reads a counter file.
+func readcounter(filename string) (objects, bytes int64, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscanf(string(data), "%d %d\n", &objects, &bytes); err != nil {
+		return 0, 0, fmt.Errorf("%w: counter file %s", ErrCorrupt, filename)
+	}
+	return objects, bytes, nil
+}
+
+// lockcounters serializes the merging and reading of the counter files.
+func (s *SOS) lockcounters() (func(), error) {
+	dirname := filepath.Join(s.base, dirLocks)
+	return s.lockfile(dirname, filepath.Join(dirname, "counters"))
+}
+
+// counterdir returns the directory of the counter files.
+func (s *SOS) counterdir() string {
+	return filepath.Join(s.base, dirCounters)
+}
@@ -0,0 +1,120 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkcounts compares the counters of the store with a scan.
+func checkcounts(t *testing.T, s *SOS) {
+	t.Helper()
+
+	objects, bytes, err := s.footprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Count(); err != nil || n != objects {
+		t.Errorf("Got count %d (%v), expected %d", n, err, objects)
+	}
+	if n, err := s.TotalSize(); err != nil || n != bytes {
+		t.Errorf("Got total size %d (%v), expected %d", n, err, bytes)
+	}
+}
+
+// Test that the counters follow the changes of the store
+func TestCounters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sos")
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	// objects stored before the counters are enabled are counted by New
+	s, _ := New(path)
+	s.StoreString("old", "value")
+	if n, _ := s.Count(); n != 1 {
+		t.Errorf("Got count %d without counters, expected %d", n, 1)
+	}
+	s.Close()
+
+	s, err := New(path, WithCounters(), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	checkcounts(t, s)
+
+	s.StoreString("a", "value")
+	s.StoreString("a", "longer value")
+	s.StoreWithTTL("b", []byte("expires"), time.Minute)
+	s.Append("c", []byte("one"))
+	s.Append("c", []byte("two"))
+	s.StoreIfAbsent("d", []byte("value"))
+	s.CompareAndSwap("d", []byte("value"), []byte("swapped"))
+	checkcounts(t, s)
+
+	s.Delete("a")
+	s.Take("c")
+	clock.Advance(time.Hour)
+	if n, _ := s.Expire(); n != 1 {
+		t.Errorf("Expired %d objects, expected %d", n, 1)
+	}
+	checkcounts(t, s)
+
+	// the changes are merged into the total on Close
+	s.Close()
+	s, err = New(path, WithCounters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkcounts(t, s)
+	if n, _ := s.Count(); n != 2 {
+		t.Errorf("Got count %d, expected %d", n, 2)
+	}
+}
+
+// Test that the counters are correct with several store instances
+func TestCountersConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sos")
+	var stores []*SOS
+	for i := 0; i < 3; i++ {
+		s, err := New(path, WithCounters())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, s)
+	}
+	defer stores[0].Destroy()
+
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func(i int, s *SOS) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := fmt.Sprintf("key%d", j%10)
+				if (i+j)%3 == 0 {
+					s.Delete(key)
+				} else {
+					s.StoreString(key, fmt.Sprintf("value %d of %d", j, i))
+				}
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	for _, s := range stores {
+		checkcounts(t, s)
+	}
+	stores[1].Close()
+	checkcounts(t, stores[0])
+
+	stores[0].StoreString("extra", "value")
+	stores[0].Recount()
+	checkcounts(t, stores[2])
+}
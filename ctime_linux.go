@@ -0,0 +1,24 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build linux
+
+package sos
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// changetime returns the time of the last status change of a file. Unlike
+// the modification time, it is updated when a hard link is created.
+func changetime(fi fs.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(st.Ctim.Unix())
+}
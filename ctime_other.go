@@ -0,0 +1,18 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build !linux
+
+package sos
+
+import (
+	"io/fs"
+	"time"
+)
+
+// changetime returns the modification time of a file on this platform.
+func changetime(fi fs.FileInfo) time.Time {
+	return fi.ModTime()
+}
@@ -0,0 +1,91 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+)
+
+// StoreCtx is like Store, but stops when the context is cancelled. See
+// StoreFromCtx.
+func (s *SOS) StoreCtx(ctx context.Context, key string, value []byte) error {
+	return s.StoreFromCtx(ctx, key, bytes.NewReader(value))
+}
+
+// GetCtx is like Get, but stops when the context is cancelled. See
+// GetToCtx.
+func (s *SOS) GetCtx(ctx context.Context, key string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	err := s.GetToCtx(ctx, key, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if buffer.Len() == 0 {
+		return []byte{}, nil // empty, but not missing
+	}
+	return buffer.Bytes(), nil
+}
+
+// ListCtx is like List, but stops when the context is cancelled.
+func (s *SOS) ListCtx(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := s.Iterate(prefix, func(key string, info ObjectInfo) error {
+		keys = append(keys, key)
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// contextReader returns a reader which fails with the error of the context,
+// once it is cancelled.
+func contextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r // never cancelled
+	}
+	return &ctxReader{ctx: ctx, r: r}
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// contextWriter returns a writer which fails with the error of the context,
+// once it is cancelled.
+func contextWriter(ctx context.Context, w io.Writer) io.Writer {
+	if ctx.Done() == nil {
+		return w // never cancelled
+	}
+	return &ctxWriter{ctx: ctx, w: w}
+}
+
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
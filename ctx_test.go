@@ -0,0 +1,68 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// cancelReader cancels a context after the first read.
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p[:1])
+	r.cancel()
+	return n, err
+}
+
+// Test cancelling operations with a context
+func TestContext(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex())
+	ctx := context.Background()
+	if err := s.StoreCtx(ctx, "key", []byte("value")); err != nil {
+		t.Fatalf("StoreCtx failed: %v", err)
+	}
+	if obj, _ := s.GetCtx(ctx, "key"); string(obj) != "value" {
+		t.Errorf("Got %s from store, expected %s", obj, "value")
+	}
+	if keys, _ := s.ListCtx(ctx, ""); len(keys) != 1 {
+		t.Errorf("Got keys %v, expected 1 key", keys)
+	}
+
+	// a store cancelled while reading the value keeps the previous value
+	cctx, cancel := context.WithCancel(ctx)
+	rd := &cancelReader{r: strings.NewReader("a new value"), cancel: cancel}
+	if err := s.StoreFromCtx(cctx, "key", rd); !errors.Is(err, context.Canceled) {
+		t.Errorf("Got error %v from a cancelled store, expected %v", err, context.Canceled)
+	}
+	if obj, _ := s.GetString("key"); obj != "value" {
+		t.Errorf("Got %s from store, expected %s", obj, "value")
+	}
+	if info, _ := s.TempStats(); info.Count != 0 {
+		t.Errorf("Got %d temporary files after a cancelled store, expected 0", info.Count)
+	}
+
+	if err := s.GetToCtx(cctx, "key", new(bytes.Buffer)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Got error %v from a cancelled get, expected %v", err, context.Canceled)
+	}
+	if err := s.DeleteCtx(cctx, "key"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Got error %v from a cancelled delete, expected %v", err, context.Canceled)
+	}
+	if _, err := s.ListCtx(cctx, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("Got error %v from a cancelled list, expected %v", err, context.Canceled)
+	}
+	if ok, _ := s.Exists("key"); !ok {
+		t.Errorf("Key was deleted by a cancelled delete")
+	}
+}
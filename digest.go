@@ -0,0 +1,110 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"maps"
+)
+
+// digestSize is the size of a digest in the object header: the checksum,
+// followed by the size as 8 bytes big endian.
+const digestSize = sha256.Size + 8
+
+// Digest is the SHA256 checksum and the size of a value.
+type Digest struct {
+	SHA256 [sha256.Size]byte
+	Size   int64
+}
+
+// String returns the checksum in hex encoding.
+func (d Digest) String() string {
+	return hex.EncodeToString(d.SHA256[:])
+}
+
+// StoreFromDigest stores a value, which is read from an io.Reader, under the
+// given key in the object store, like StoreFrom. Additionally, it returns the
+// SHA256 checksum and the size of the value, which are computed while
+// storing.
+func (s *SOS) StoreFromDigest(key string, rd io.Reader) (Digest, error) {
+	var d Digest
+	h := sha256.New()
+	cw := &countWriter{}
+
+	err := s.StoreFromMulti(key, rd, h, cw)
+	if err != nil {
+		return d, err
+	}
+
+	h.Sum(d.SHA256[:0])
+	d.Size = cw.n
+	return d, nil
+}
+
+// WithDigests records the SHA256 checksum and the size of each stored value in
+// the header of its object file, e.g. to serve them as ETag and
+// Content-Length without reading the value (see GetObject). The checksum is
+// computed while the value is written, and filled into the header before the
+// object is committed, so it always matches the value.
+//
+// Objects which were stored without digests, or with StoreParts, have none.
+func WithDigests() Option {
+	return func(s *SOS) {
+		s.digests = true
+	}
+}
+
+// encodedigest is like encodefields, but records the digest of the value in
+// the header. The header is written with a placeholder, which is overwritten
+// through wa when the value is complete.
+func (s *SOS) encodedigest(w io.Writer, wa io.WriterAt, rd io.Reader, fields map[byte][]byte) error {
+	fields = maps.Clone(fields)
+	if fields == nil {
+		fields = make(map[byte][]byte)
+	}
+	fields[tagDigest] = make([]byte, digestSize)
+
+	hash := sha256.New()
+	cr := &countReader{r: io.TeeReader(rd, hash)}
+	var err error
+	if s.chunking {
+		err = s.encodechunked(w, cr, fields)
+	} else {
+		err = s.encodevalue(w, cr, fields)
+	}
+	if err != nil {
+		return err
+	}
+
+	h := header{fields: fields}
+	data := binary.BigEndian.AppendUint64(hash.Sum(nil), uint64(cr.n))
+	_, err = wa.WriteAt(data, h.offset(tagDigest))
+	return err
+}
+
+// headerdigest returns the digest recorded in an object header, if any.
+func headerdigest(h *header) (d Digest, ok bool) {
+	if h == nil || len(h.fields[tagDigest]) != digestSize {
+		return d, false
+	}
+	data := h.fields[tagDigest]
+	copy(d.SHA256[:], data)
+	d.Size = int64(binary.BigEndian.Uint64(data[sha256.Size:]))
+	return d, true
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,74 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Test storing a value and getting its digest
+func TestStoreFromDigest(t *testing.T) {
+	s := NewTemp(t)
+
+	val := "hello world"
+	d, err := s.StoreFromDigest("hello", strings.NewReader(val))
+	if err != nil {
+		t.Fatalf("StoreFromDigest failed: %v", err)
+	}
+
+	expected := Digest{SHA256: sha256.Sum256([]byte(val)), Size: int64(len(val))}
+	if d != expected {
+		t.Errorf("Got digest %s/%d, expected %s/%d", d, d.Size, expected, expected.Size)
+	}
+	if obj, _ := s.GetString("hello"); obj != val {
+		t.Errorf("Got %s from store, expected %s", obj, val)
+	}
+}
+
+// Test that the digests of stored values are recorded in the object header
+func TestWithDigests(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+	for name, opts := range map[string][]Option{
+		"plain":     {WithDigests()},
+		"transform": {WithDigests(), WithReadTransform(FlagUser, xorRead), WithWriteTransform(FlagUser, xorWrite)},
+		"chunked":   {WithDigests(), WithChunking()},
+	} {
+		s := NewTemp(t, opts...)
+		s.StoreWithMeta("small", []byte("hello"), Meta{ContentType: "text/plain"})
+		s.Store("large", large)
+		s.Append("small", []byte(" world"))
+
+		for key, val := range map[string][]byte{"small": []byte("hello world"), "large": large} {
+			obj, err := s.GetObject(key)
+			if err != nil {
+				t.Fatalf("GetObject failed with %s: %v", name, err)
+			}
+			data, _ := io.ReadAll(obj)
+			obj.Close()
+
+			expected := Digest{SHA256: sha256.Sum256(val), Size: int64(len(val))}
+			if !obj.HasDigest || obj.Digest != expected {
+				t.Errorf("Got digest %s/%d for %s with %s, expected %s/%d", obj.Digest, obj.Digest.Size, key, name, expected, expected.Size)
+			}
+			if !bytes.Equal(data, val) {
+				t.Errorf("Got a different value for %s with %s", key, name)
+			}
+		}
+	}
+
+	// without the option, no digest is recorded
+	s := NewTemp(t)
+	s.StoreString("key", "value")
+	if obj, err := s.GetObject("key"); err != nil || obj.HasDigest {
+		t.Errorf("Got a digest without WithDigests (error %v)", err)
+	} else {
+		obj.Close()
+	}
+}
@@ -0,0 +1,229 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Encrypted values are written as a stream of segments, so values of any size
+// are encrypted and decrypted without buffering them:
+//
+//	salt     16 bytes  random, to derive the key of the object
+//	segments           AES-GCM sealed segments of up to 64 KiB plain text
+//
+// The key of the object is the HMAC-SHA256 of the salt with the store key.
+// The nonce of a segment is its number, and a flag which marks the last
+// segment, so segments cannot be reordered, dropped or appended. The ID of
+// the store key is recorded in the object header.
+const (
+	encSaltSize    = 16
+	encSegmentSize = 64 << 10
+	encKeyIDSize   = 8
+)
+
+// keyring holds the keys of an encrypted store.
+type keyring struct {
+	current string            // ID of the key for new values
+	keys    map[string][]byte // keys by ID
+	err     error             // invalid key, reported by New
+}
+
+// WithEncryption encrypts all values stored afterwards with AES-GCM, using
+// the given key of 16, 24 or 32 bytes (AES-128, AES-192 or AES-256), and
+// marks the objects with FlagEncrypted. Values are encrypted and decrypted
+// while they are streamed, so large values are not buffered in memory. The
+// integrity of the values is checked on read, and a value which was modified
+// on disk fails with ErrCorrupt.
+//
+// For key rotation, the previous keys are passed as oldKeys. Each object
+// records the ID of its key in the header, so objects encrypted with an old
+// key can still be read. New values are always encrypted with key, so an old
+// key can be dropped once all of its objects have been stored again.
+//
+// Only the values are encrypted. Metadata, expiry times, digests (see
+// WithDigests) and the key index (see WithKeyIndex) are stored in plain text.
+// To hide the keys in the file names as well, use a keyed hash function like
+// HMAC-SHA256 with WithHash.
+func WithEncryption(key []byte, oldKeys ...[]byte) Option {
+	return func(s *SOS) {
+		kr := &keyring{keys: make(map[string][]byte)}
+		for _, k := range append(append([][]byte(nil), oldKeys...), key) {
+			if _, err := aes.NewCipher(k); err != nil {
+				kr.err = fmt.Errorf("invalid encryption key: %w", err)
+			}
+			kr.current = keyid(k)
+			kr.keys[kr.current] = k
+		}
+		s.keyring = kr
+		WithWriteTransform(FlagEncrypted, kr.writer)(s)
+	}
+}
+
+// keyid returns the ID of an encryption key.
+func keyid(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("sos key id"))
+	return string(mac.Sum(nil)[:encKeyIDSize])
+}
+
+// objectcipher returns the AEAD cipher for an object with the given salt.
+func objectcipher(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writer is the write transformation of FlagEncrypted. It encrypts with the
+// current key.
+func (kr *keyring) writer(w io.Writer) (io.WriteCloser, error) {
+	salt := make([]byte, encSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := objectcipher(kr.keys[kr.current], salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &encWriter{w: w, aead: aead, buf: make([]byte, 0, encSegmentSize)}, nil
+}
+
+// reader undoes the encryption of an object with the given header.
+func (kr *keyring) reader(h *header, r io.Reader) (io.Reader, error) {
+	key, ok := kr.keys[string(h.fields[tagKeyID])]
+	if !ok {
+		return nil, fmt.Errorf("no encryption key with ID %x", h.fields[tagKeyID])
+	}
+
+	br := bufio.NewReaderSize(r, encSegmentSize+2*aes.BlockSize)
+	salt := make([]byte, encSaltSize)
+	if _, err := io.ReadFull(br, salt); err != nil {
+		return nil, fmt.Errorf("%w: encrypted value", ErrCorrupt)
+	}
+	aead, err := objectcipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &decReader{r: br, aead: aead, seg: make([]byte, encSegmentSize+aead.Overhead())}, nil
+}
+
+// segmentnonce returns the nonce of the segment with number n.
+func segmentnonce(aead cipher.AEAD, n uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, n)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// encWriter encrypts a value segment by segment.
+type encWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	buf  []byte // pending plain text of the current segment
+	n    uint64 // number of the current segment
+}
+
+// Write encrypts p. A full segment is written only when more data follows,
+// so the last segment is known on Close.
+func (e *encWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(e.buf) == encSegmentSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := min(len(p), encSegmentSize-len(e.buf))
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close writes the last segment. It does not close the underlying writer.
+func (e *encWriter) Close() error {
+	return e.flush(true)
+}
+
+// flush encrypts and writes the current segment.
+func (e *encWriter) flush(last bool) error {
+	out := e.aead.Seal(nil, segmentnonce(e.aead, e.n, last), e.buf, nil)
+	e.n++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(out)
+	return err
+}
+
+// decReader decrypts a value segment by segment.
+type decReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	seg   []byte // buffer for an encrypted segment
+	plain []byte // decrypted data, which was not read yet
+	n     uint64 // number of the next segment
+	done  bool   // the last segment was decrypted
+}
+
+// Read reads decrypted data. It fails with ErrCorrupt, if a segment was
+// modified, or the value was truncated.
+func (d *decReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next reads and decrypts the next segment.
+func (d *decReader) next() error {
+	n, err := io.ReadFull(d.r, d.seg)
+	last := err == io.ErrUnexpectedEOF
+	if err == nil {
+		_, perr := d.r.Peek(1)
+		if perr != nil && perr != io.EOF {
+			return perr
+		}
+		last = perr == io.EOF
+	} else if !last {
+		if err == io.EOF {
+			return fmt.Errorf("%w: encrypted value is truncated", ErrCorrupt)
+		}
+		return err
+	}
+
+	plain, err := d.aead.Open(d.seg[:0], segmentnonce(d.aead, d.n, last), d.seg[:n], nil)
+	if err != nil {
+		return fmt.Errorf("%w: encrypted value: %v", ErrCorrupt, err)
+	}
+	d.n++
+	d.plain = plain
+	d.done = last
+	return nil
+}
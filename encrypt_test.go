@@ -0,0 +1,96 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test storing and getting encrypted values of various sizes
+func TestEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	s := NewTemp(t, WithEncryption(key), WithCompression(CompressionGzip))
+
+	for _, size := range []int{0, 1, encSegmentSize - 1, encSegmentSize, 2*encSegmentSize + 7} {
+		value := make([]byte, size)
+		rand.Read(value)
+		if err := s.StoreFrom("key", bytes.NewReader(value)); err != nil {
+			t.Fatalf("Error storing %d bytes: %v", size, err)
+		}
+
+		var buf bytes.Buffer
+		if err := s.GetTo("key", &buf); err != nil || !bytes.Equal(buf.Bytes(), value) {
+			t.Errorf("Got %d bytes (%v) from store, expected %d", buf.Len(), err, size)
+		}
+	}
+
+	// the value is not stored in plain text
+	s.StoreString("secret", "attack at dawn")
+	_, filename := s.getpath("secret")
+	if data, _ := os.ReadFile(filename); bytes.Contains(data, []byte("attack")) {
+		t.Errorf("Found plain text value in object file")
+	}
+
+	// a modified object file is detected
+	data, _ := os.ReadFile(filename)
+	data[len(data)-1] ^= 1
+	os.WriteFile(filename, data, 0o644)
+	if _, err := s.Get("secret"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Got %v for modified object, expected ErrCorrupt", err)
+	}
+
+	// a truncated object file is detected
+	large := make([]byte, 2*encSegmentSize)
+	rand.Read(large)
+	s.Store("large", large)
+	_, filename = s.getpath("large")
+	fi, _ := os.Stat(filename)
+	os.Truncate(filename, fi.Size()-int64(encSegmentSize)-16)
+	if _, err := s.Get("large"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Got %v for truncated object, expected ErrCorrupt", err)
+	}
+}
+
+// Test key rotation and wrong keys
+func TestEncryptionKeys(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	oldKey := bytes.Repeat([]byte{1}, 16)
+	newKey := bytes.Repeat([]byte{2}, 16)
+
+	s, _ := New(dir, WithEncryption(oldKey))
+	s.StoreString("old", "old value")
+	s.Close()
+
+	s, err := New(dir, WithEncryption(newKey, oldKey))
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+	defer s.Destroy()
+	s.StoreString("new", "new value")
+	for key, value := range map[string]string{"old": "old value", "new": "new value"} {
+		if v, err := s.GetString(key); err != nil || v != value {
+			t.Errorf("Got %q (%v) for key %s, expected %q", v, err, key, value)
+		}
+	}
+
+	// without the old key, only new objects can be read
+	s2, _ := New(dir, WithEncryption(newKey))
+	if _, err := s2.GetString("old"); err == nil {
+		t.Errorf("Got no error for object with unknown key")
+	}
+	if v, err := s2.GetString("new"); err != nil || v != "new value" {
+		t.Errorf("Got %q (%v) for key new, expected %q", v, err, "new value")
+	}
+
+	if _, err := New(dir, WithEncryption([]byte("short"))); err == nil {
+		t.Errorf("Got no error for invalid encryption key")
+	}
+}
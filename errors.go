@@ -0,0 +1,120 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrNotFound is returned by operations on a single key (e.g. Get, Delete,
+// Touch or Take) and on pointers, if the key or pointer does not exist. It is
+// returned only if the object file is missing. Other failures, like missing
+// permissions or I/O errors, are returned as they are.
+var ErrNotFound = errors.New("key does not exist")
+
+// ErrExists is returned by Store operations on a store created with
+// WithNoOverwrite, when the key already exists.
+var ErrExists = errors.New("key already exists")
+
+// ErrSizeMismatch is returned by StoreFromSize, if the size of the value
+// differs from the expected size.
+var ErrSizeMismatch = errors.New("size of value does not match")
+
+// ErrCollision is returned on a store created with WithCollisionCheck, if
+// two different keys have the same hash.
+var ErrCollision = errors.New("hash collision with a different key")
+
+// ErrClosed is returned by all operations on a store after Close.
+var ErrClosed = errors.New("store is closed")
+
+// ErrDestroyed is returned by all operations on a store after Destroy.
+var ErrDestroyed = errors.New("store is destroyed")
+
+// ErrCorrupt is returned if stored data does not have the expected format,
+// or does not match its checksum, e.g. a truncated object header, a damaged
+// chunk or a backup which fails verification.
+var ErrCorrupt = errors.New("corrupt data")
+
+// ErrNoDigest is returned by VerifyKey, if the object was stored without a
+// digest, see WithDigests.
+var ErrNoDigest = errors.New("object has no digest")
+
+// ErrLayoutMismatch is returned by New, if the store was created with
+// another shard depth, file name suffix or hash function.
+var ErrLayoutMismatch = errors.New("options do not match the layout of the store")
+
+// ErrStoreUnhealthy is returned by all operations while the circuit breaker
+// of a store is open, see WithCircuitBreaker.
+var ErrStoreUnhealthy = errors.New("store is unhealthy")
+
+// ErrFrozen is returned by operations which would modify a frozen store
+// created with WithFreezeFailFast.
+var ErrFrozen = errors.New("store is frozen")
+
+// ErrInconsistent is returned by read operations on a store created with
+// WithConsistency(ConsistencyStrict), if the object kept changing while it
+// was opened.
+var ErrInconsistent = errors.New("object changed while it was read")
+
+// Error records a failed operation on the object store, together with the
+// key and the file system path involved. All errors returned by the methods
+// of SOS are of type *Error. The underlying error can be inspected with
+// errors.Is and errors.As.
+type Error struct {
+	Op   string // operation, e.g. "Store" or "Get"
+	Key  string // key of the object, if any
+	Path string // object file, or base directory of the store
+	Err  error  // underlying error
+}
+
+// Error returns a description of the error, including operation, key and
+// path.
+func (e *Error) Error() string {
+	msg := "SOS: " + e.Op
+	if e.Key != "" {
+		msg += " " + strconv.Quote(e.Key)
+	}
+	if e.Path != "" {
+		msg += " " + e.Path
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// wraperr wraps the error pointed to by err into an *Error, unless it is nil
+// or already wrapped. It is meant to be deferred by exported methods with a
+// named error result.
+func (s *SOS) wraperr(err *error, op, key string) {
+	if s.breaker != nil {
+		s.breaker.record(s.clock.Now(), *err)
+	}
+	if *err == nil {
+		return
+	}
+
+	path := s.base
+	if key != "" {
+		_, path = s.getpath(key)
+	}
+	wrappath(err, op, key, path)
+}
+
+// wrappath is like wraperr, but records the given path.
+func wrappath(err *error, op, key, path string) {
+	if *err == nil {
+		return
+	}
+	var e *Error
+	if errors.As(*err, &e) {
+		return
+	}
+	*err = &Error{Op: op, Key: key, Path: path, Err: *err}
+}
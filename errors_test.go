@@ -0,0 +1,89 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// Test the structured errors returned by the store
+func TestError(t *testing.T) {
+	s := NewTemp(t, WithNoOverwrite())
+
+	_, err := s.Get("missing")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Got error of type %T, expected *Error", err)
+	}
+	_, filename := s.getpath("missing")
+	if e.Op != "Get" || e.Key != "missing" || e.Path != filename {
+		t.Errorf("Got error %+v, expected operation, key and path", e)
+	}
+
+	s.StoreString("key", "value")
+	err = s.StoreString("key", "value")
+	if !errors.Is(err, ErrExists) {
+		t.Errorf("Got error %v, expected it to wrap %v", err, ErrExists)
+	}
+	if !errors.As(err, &e) || e.Op != "Store" || e.Key != "key" {
+		t.Errorf("Got error %v, expected a Store error on key", err)
+	}
+
+	s.Close()
+	if _, err := s.FreeSpace(); !errors.As(err, &e) || e.Op != "FreeSpace" || e.Path != s.base {
+		t.Errorf("Got error %v, expected a FreeSpace error on the base directory", err)
+	}
+}
+
+// Test that only missing objects are reported as not found
+func TestErrNotFound(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("hello", "world")
+
+	if _, err := s.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for a missing key, expected %v", err, ErrNotFound)
+	}
+
+	// break the store by removing the temporary directory
+	os.RemoveAll(s.tmpdir())
+	_, err := s.Get("hello")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for a broken store, expected an error other than %v", err, ErrNotFound)
+	}
+}
+
+// Test the sentinel errors of the store life cycle, missing keys and corrupt
+// data
+func TestSentinelErrors(t *testing.T) {
+	s := NewTemp(t)
+	if err := s.Delete("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v when deleting a missing key, expected %v", err, ErrNotFound)
+	}
+	if err := s.DeletePointer("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v when deleting a missing pointer, expected %v", err, ErrNotFound)
+	}
+
+	// a truncated header
+	s.StoreString("key", "value")
+	_, filename := s.getpath("key")
+	os.WriteFile(filename, headerMagic, 0o600)
+	if _, err := s.Get("key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Got error %v for a truncated header, expected %v", err, ErrCorrupt)
+	}
+
+	s.Close()
+	if _, err := s.Get("key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got error %v on a closed store, expected %v", err, ErrClosed)
+	}
+
+	d, _ := New(t.TempDir())
+	d.Destroy()
+	if err := d.StoreString("key", "value"); !errors.Is(err, ErrDestroyed) {
+		t.Errorf("Got error %v on a destroyed store, expected %v", err, ErrDestroyed)
+	}
+}
@@ -0,0 +1,126 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// eventQueueSize is the number of events which are queued for publishing.
+const eventQueueSize = 1024
+
+// errQueueFull is passed to EventQueue.OnError for dropped events.
+var errQueueFull = errors.New("event queue full, event dropped")
+
+// Event records a change of an object, so external systems can react to
+// changes without polling the store.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`    // "Store", "Delete", "Take", "Expire", "Expiring" (see WithExpiryWarning), a limit event (see LimitMonitor), or "Create", "Update", "Delete" (see Watch)
+	Key   string    `json:"key"`   // for Expire and Expiring, only known for indexed objects; name of the limit for limit events
+	Bytes int64     `json:"bytes"` // size of the value stored or taken, size of the object file for Watch
+}
+
+// EventSink receives change events. Notify is called synchronously by the
+// operation after the change, and may be called from several goroutines
+// concurrently. It should not block.
+type EventSink interface {
+	Notify(e Event)
+}
+
+// EventFunc is a function which receives change events.
+type EventFunc func(e Event)
+
+// Notify calls f(e).
+func (f EventFunc) Notify(e Event) {
+	f(e)
+}
+
+// WithEventSink sets a sink which receives an event for each successful
+// Store, Delete and Take operation of this process, and for each object
+// removed by Expire. Changes by other processes sharing the store are not
+// seen, see Watch for them. See Webhook for a sink which posts the events to
+// a URL.
+func WithEventSink(sink EventSink) Option {
+	return func(s *SOS) {
+		s.events = sink
+	}
+}
+
+// notify emits a change event, if a sink is configured.
+func (s *SOS) notify(op, key string, n int64) {
+	if s.events == nil {
+		return
+	}
+	s.events.Notify(Event{
+		Time:  s.clock.Now(),
+		Op:    op,
+		Key:   key,
+		Bytes: n,
+	})
+}
+
+// EventPublisher publishes change events to an external system, e.g. a
+// message broker. Publish may block until the event is delivered. The
+// sub-modules sosnats and soskafka provide publishers for NATS and Kafka.
+type EventPublisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// EventQueue is an EventSink which queues the events, and hands them to a
+// publisher in the background by Run, so the operations of the store are not
+// slowed down. If the queue is full, events are dropped.
+type EventQueue struct {
+	Publisher EventPublisher     // receiver of the events
+	OnError   func(Event, error) // optional, receives unpublished events
+
+	once  sync.Once
+	queue chan Event
+}
+
+// init creates the queue.
+func (q *EventQueue) init() {
+	q.once.Do(func() {
+		q.queue = make(chan Event, eventQueueSize)
+	})
+}
+
+// Notify queues the event. It implements EventSink.
+func (q *EventQueue) Notify(e Event) {
+	q.init()
+	select {
+	case q.queue <- e:
+	default:
+		q.fail(e, errQueueFull)
+	}
+}
+
+// Run publishes the queued events until the context is cancelled. Failed
+// events are reported to OnError, but do not stop the publishing of further
+// events. Run returns the error of the context.
+func (q *EventQueue) Run(ctx context.Context) error {
+	q.init()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-q.queue:
+			if err := q.Publisher.Publish(ctx, e); err != nil {
+				q.fail(e, err)
+			}
+		}
+	}
+}
+
+// fail reports an unpublished event.
+func (q *EventQueue) fail(e Event, err error) {
+	if q.OnError != nil {
+		q.OnError(e, err)
+	}
+}
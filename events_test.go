@@ -0,0 +1,79 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test the change events of store operations
+func TestEvents(t *testing.T) {
+	var events []Event
+	s := NewTemp(t, WithEventSink(EventFunc(func(e Event) {
+		e.Time = e.Time.UTC().Truncate(0)
+		events = append(events, e)
+	})))
+
+	s.StoreString("hello", "world")
+	s.GetString("hello")
+	s.StoreString("foo", "bar")
+	s.Take("foo")
+	s.Delete("hello")
+	s.Delete("missing")
+
+	expected := []Event{
+		{Op: "Store", Key: "hello", Bytes: 5},
+		{Op: "Store", Key: "foo", Bytes: 3},
+		{Op: "Take", Key: "foo", Bytes: 3},
+		{Op: "Delete", Key: "hello"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Got %d events, expected %d", len(events), len(expected))
+	}
+	for i, e := range events {
+		if e.Time.IsZero() {
+			t.Errorf("Event %+v has no time", e)
+		}
+		e.Time = expected[i].Time
+		if e != expected[i] {
+			t.Errorf("Got event %+v, expected %+v", e, expected[i])
+		}
+	}
+}
+
+// publisherFunc is an EventPublisher for tests.
+type publisherFunc func(ctx context.Context, e Event) error
+
+func (f publisherFunc) Publish(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// Test publishing events in the background
+func TestEventQueue(t *testing.T) {
+	published := make(chan Event, 1)
+	q := &EventQueue{Publisher: publisherFunc(func(ctx context.Context, e Event) error {
+		published <- e
+		return nil
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	s := NewTemp(t, WithEventSink(q))
+	s.StoreString("hello", "world")
+
+	select {
+	case e := <-published:
+		if e.Op != "Store" || e.Key != "hello" {
+			t.Errorf("Got event %+v, expected a Store of hello", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Got no published event")
+	}
+}
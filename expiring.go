@@ -0,0 +1,102 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// expiryWarnings tracks the objects, for which an Expiring event was
+// emitted.
+type expiryWarnings struct {
+	lead time.Duration
+
+	mu     sync.Mutex
+	warned map[string]time.Time // expiry time by key hash
+}
+
+// WithExpiryWarning emits an "Expiring" event to the event sink (see
+// WithEventSink) for each object which expires within the lead time, so
+// applications can renew it (see TouchTTL) or archive it before it is
+// removed. The Time of the event is the expiry time of the object, and Bytes
+// is the size of the object file. As with Expire events, the key is only
+// known for indexed objects.
+//
+// The warnings are emitted by Expire, so the lead time must exceed the
+// interval of the Reaper. Each object is reported once per expiry time by
+// this instance of the store. Renewing the object with a new TTL leads to a
+// new warning before the new expiry time. After a restart, objects may be
+// reported again.
+func WithExpiryWarning(lead time.Duration) Option {
+	return func(s *SOS) {
+		s.expiring = &expiryWarnings{lead: lead, warned: make(map[string]time.Time)}
+	}
+}
+
+// warnexpiry emits an Expiring event for the object file at the relative
+// path rel, if it expires within the lead time, and was not reported yet.
+func (s *SOS) warnexpiry(rel string, fi fs.FileInfo) error {
+	exp, ok, err := fileexpiry(filepath.Join(s.base, filepath.FromSlash(rel)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // removed in the meantime
+	}
+	now := s.clock.Now()
+	if err != nil || !ok || !now.Before(exp) || exp.After(now.Add(s.expiring.lead)) {
+		return err
+	}
+
+	hs := s.relhash(rel)
+	w := s.expiring
+	w.mu.Lock()
+	if w.warned[hs].Equal(exp) {
+		w.mu.Unlock()
+		return nil
+	}
+	w.warned[hs] = exp
+	w.mu.Unlock()
+
+	_, indexname := s.indexpath(hs)
+	key, _ := os.ReadFile(indexname)
+	if s.events != nil {
+		s.events.Notify(Event{Time: exp, Op: "Expiring", Key: string(key), Bytes: fi.Size()})
+	}
+	return nil
+}
+
+// prunewarnings forgets the objects whose expiry time has passed.
+func (s *SOS) prunewarnings() {
+	w := s.expiring
+	now := s.clock.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for hs, exp := range w.warned {
+		if !now.Before(exp) {
+			delete(w.warned, hs)
+		}
+	}
+}
+
+// fileexpiry returns the expiry time of an object file, if it has one.
+func fileexpiry(filename string) (time.Time, bool, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer fh.Close()
+
+	h, err := readheader(bufio.NewReader(fh))
+	if err != nil || h == nil {
+		return time.Time{}, false, err
+	}
+	exp, ok := expirytime(h)
+	return exp, ok, nil
+}
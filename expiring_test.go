@@ -0,0 +1,53 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"testing"
+	"time"
+)
+
+// Test the warnings before objects expire
+func TestExpiryWarning(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var events []Event
+	s := NewTemp(t, WithClock(clock), WithKeyIndex(), WithExpiryWarning(10*time.Minute),
+		WithEventSink(EventFunc(func(e Event) {
+			if e.Op == "Expiring" {
+				events = append(events, e)
+			}
+		})))
+
+	s.StoreWithTTL("soon", []byte("value"), 5*time.Minute)
+	s.StoreWithTTL("later", []byte("value"), time.Hour)
+	s.StoreString("forever", "value")
+
+	s.Expire()
+	if len(events) != 1 || events[0].Key != "soon" || !events[0].Time.Equal(clock.Now().Add(5*time.Minute)) {
+		t.Fatalf("Got events %+v, expected an Expiring event of soon", events)
+	}
+
+	// each object is reported once, until it is renewed
+	events = nil
+	s.Expire()
+	if len(events) != 0 {
+		t.Errorf("Got events %+v on the second sweep, expected none", events)
+	}
+	s.TouchTTL("soon", 8*time.Minute)
+	s.Expire()
+	if len(events) != 1 || events[0].Key != "soon" {
+		t.Errorf("Got events %+v after renewal, expected an Expiring event of soon", events)
+	}
+
+	events = nil
+	clock.Advance(55 * time.Minute)
+	if n, _ := s.Expire(); n != 1 {
+		t.Errorf("Got %d expired objects, expected 1", n)
+	}
+	if len(events) != 1 || events[0].Key != "later" {
+		t.Errorf("Got events %+v, expected an Expiring event of later", events)
+	}
+}
@@ -0,0 +1,464 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ExportTar writes all objects of the store as a tar stream to w.
+//
+// Every object is written as a regular file, named by its location below the
+// base directory (e.g. "e3/b0/c44298fc..."). The stream ends with a manifest
+// file named ".manifest", which holds the SHA256 checksum and the size of
+// each object file. The stream can be read back with ImportTar or Restore.
+//
+// The key index entries of the objects (see WithKeyIndex) follow the object
+// files, named like them below .index, and the chunks of chunked objects
+// (see WithChunking) precede them, named by their hash below .chunks.
+//
+// With WithParallelism, the partitions of the key space are read by several
+// workers. Each worker spools its partition into a temporary file, which is
+// then appended to the stream, so the memory use does not depend on the size
+// of the objects, and at most one spooled partition per worker waits for the
+// stream. The order of the objects in the stream is not defined.
+func (s *SOS) ExportTar(w io.Writer) error {
+	return s.ExportChangedSince(time.Time{}, w)
+}
+
+// ExportChangedSince writes all objects which were stored after the time t as
+// a tar stream to w. This allows for incremental backups, when t is the time
+// of the previous backup.
+//
+// On a store created with WithTombstones, objects which were deleted after
+// the time t are part of the stream as tombstones, i.e. empty files named
+// like the object file below .tombstones, with the time of the deletion.
+// ImportTar and Restore remove these objects, unless they were stored again
+// after the deletion. Full exports (the zero time) contain no tombstones.
+func (s *SOS) ExportChangedSince(t time.Time, w io.Writer) (err error) {
+	defer s.wraperr(&err, "Export", "")
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if s.parallelism > 1 && s.shardDepth > 0 {
+		return s.exportparallel(t, w)
+	}
+
+	tw := tar.NewWriter(w)
+	manifest := new(bytes.Buffer)
+	if err := s.exportpartition(tw, "", t, manifest); err != nil {
+		return err
+	}
+	if err := writemanifest(tw, manifest.Bytes(), s.fileMode, s.clock.Now()); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExportPartitions writes the objects which were stored after the time t
+// (all objects for the zero time) into one tar file per partition of the key
+// space in the directory dir, e.g. dir/e3.tar for the objects whose key hash
+// starts with "e3". The files have the format of ExportTar, including the
+// manifest, so they can be read back with ImportTar or Restore one by one, or
+// in parallel. The directory is created if necessary, and existing files are
+// replaced. A store with a shard depth of 0 is written to dir/all.tar.
+//
+// The partitions are written by the workers set with WithParallelism. Each
+// file is written under a temporary name first, so a failed export leaves
+// no partial files.
+func (s *SOS) ExportPartitions(dir string, t time.Time) (err error) {
+	defer s.wraperr(&err, "ExportPartitions", "")
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := s.mkdirall(dir); err != nil {
+		return err
+	}
+	return s.forpartitions(func(p string) error {
+		name := p
+		if name == "" {
+			name = "all"
+		}
+		filename := filepath.Join(dir, name+".tar")
+		tmpname := filepath.Join(dir, "."+name+".tar-"+s.instanceID)
+
+		fh, err := s.createfile(tmpname)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(fh)
+		tw := tar.NewWriter(bw)
+		manifest := new(bytes.Buffer)
+		err = s.exportpartition(tw, p, t, manifest)
+		if err == nil {
+			err = writemanifest(tw, manifest.Bytes(), s.fileMode, s.clock.Now())
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		if err == nil {
+			err = bw.Flush()
+		}
+		if err == nil {
+			err = s.syncfile(fh)
+		}
+		if cerr := fh.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmpname, filename)
+		}
+		if err != nil {
+			_ = os.Remove(tmpname)
+		}
+		return err
+	})
+}
+
+// exportpartition writes the objects of the partition p, which were stored
+// after the time t, into the tar stream, and adds them to the manifest. For
+// incremental exports, the tombstones of objects deleted after t follow.
+// The chunks of chunked objects are written before the first object which
+// refers to them, so each partition is complete on its own.
+func (s *SOS) exportpartition(tw *tar.Writer, p string, t time.Time, manifest *bytes.Buffer) error {
+	chunks := make(map[string]bool) // exported chunks
+	err := s.walkpartition(p, func(rel string, fi fs.FileInfo) error {
+		if !fi.ModTime().After(t) {
+			return nil
+		}
+		return s.exportobject(tw, rel, chunks, manifest)
+	})
+	if err != nil || t.IsZero() {
+		return err
+	}
+	return s.exporttombstones(tw, p, t)
+}
+
+// exporttombstones writes the tombstones of the partition p, which were
+// recorded after the time t, into the tar stream.
+func (s *SOS) exporttombstones(tw *tar.Writer, p string, t time.Time) error {
+	root := filepath.Join(s.base, dirTombstones, p)
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.base, name)
+		rel = filepath.ToSlash(rel)
+		if dir, _, ok := s.tarentry(rel); !ok || dir != dirTombstones {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || !fi.ModTime().After(t) {
+			return nil
+		}
+		return tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     rel,
+			Mode:     int64(s.fileMode.Perm()),
+			ModTime:  fi.ModTime(),
+			Format:   tar.FormatPAX, // keeps the exact time of the deletion
+		})
+	})
+	return err
+}
+
+// tarentry classifies the name of an entry of an exported tar stream. It
+// returns the internal directory of the entry (e.g. dirTombstones), or the
+// empty string for object files, and the key hash of the object. Chunk
+// entries have no key hash.
+func (s *SOS) tarentry(name string) (dir, hs string, ok bool) {
+	dir, rel, found := strings.Cut(name, "/")
+	if !found || !isreserved(dir) {
+		if !s.isobjectpath(name) {
+			return "", "", false
+		}
+		return "", s.relhash(name), true
+	}
+	switch dir {
+	case dirTombstones, dirIndex:
+		if !s.isobjectpath(rel + s.suffix) {
+			return "", "", false
+		}
+		return dir, s.relhash(rel + s.suffix), true
+	case dirChunks:
+		if _, ok := chunksum(name); !ok {
+			return "", "", false
+		}
+		return dir, "", true
+	}
+	return "", "", false
+}
+
+// spooledPartition is a partition of a parallel export, which was written
+// into a temporary file.
+type spooledPartition struct {
+	filename string
+	manifest []byte
+}
+
+// exportparallel implements ExportChangedSince with several workers. The
+// workers spool the tar entries of a partition into a temporary file, which
+// is appended to w as a whole. As tar entries are padded to blocks, the
+// entries of the partitions can simply be concatenated.
+func (s *SOS) exportparallel(t time.Time, w io.Writer) error {
+	spooled := make(chan spooledPartition)
+	merged := make(chan error, 1)
+	var failed atomic.Bool
+
+	go func() {
+		var err error
+		manifest := new(bytes.Buffer)
+		for sp := range spooled {
+			if err == nil {
+				err = appendfile(w, sp.filename)
+				manifest.Write(sp.manifest)
+				if err != nil {
+					failed.Store(true)
+				}
+			}
+			_ = os.Remove(sp.filename)
+		}
+		if err == nil {
+			tw := tar.NewWriter(w)
+			err = writemanifest(tw, manifest.Bytes(), s.fileMode, s.clock.Now())
+			if err == nil {
+				err = tw.Close()
+			}
+		}
+		merged <- err
+	}()
+
+	err := s.forpartitions(func(p string) error {
+		if failed.Load() {
+			return nil // the stream failed, see below
+		}
+		tmpname := s.tmpfilename()
+		fh, err := s.createfile(tmpname)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(fh)
+		tw := tar.NewWriter(bw)
+		manifest := new(bytes.Buffer)
+		err = s.exportpartition(tw, p, t, manifest)
+		if err == nil {
+			err = tw.Flush() // no end of archive
+		}
+		if err == nil {
+			err = bw.Flush()
+		}
+		if cerr := fh.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(tmpname)
+			return err
+		}
+
+		// wait until the stream takes the partition
+		spooled <- spooledPartition{filename: tmpname, manifest: manifest.Bytes()}
+		return nil
+	})
+	close(spooled)
+	if merr := <-merged; err == nil {
+		err = merr
+	}
+	return err
+}
+
+// appendfile copies the content of the file filename to w.
+func appendfile(w io.Writer, filename string) error {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	_, err = io.Copy(w, fh)
+	return err
+}
+
+// writemanifest writes the manifest file into the tar stream.
+func writemanifest(tw *tar.Writer, manifest []byte, mode fs.FileMode, mtime time.Time) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     exportManifest,
+		Size:     int64(len(manifest)),
+		Mode:     int64(mode.Perm()),
+		ModTime:  mtime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(manifest)
+	return err
+}
+
+// exportManifest is the name of the manifest file in an exported tar
+// stream. It starts with a dot, so it can never be an object file.
+const exportManifest = ".manifest"
+
+// exportobject writes the object file at the relative path rel into the tar
+// stream, preceded by the chunks it refers to which are not in the map
+// chunks yet, and followed by its key index entry, and adds the files to the
+// manifest. If the object was deleted, nothing is written.
+func (s *SOS) exportobject(tw *tar.Writer, rel string, chunks map[string]bool, manifest *bytes.Buffer) error {
+	fh, err := s.openfile(filepath.Join(s.base, filepath.FromSlash(rel)))
+	if err != nil {
+		// object was deleted in the meantime
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer fh.Close()
+
+	// the chunks of the opened file, as the object might have been replaced
+	// since it was found. A corrupt object is exported as it is.
+	refs := make(map[string]bool)
+	if err := s.chunkrefs(fh.Name(), refs); err != nil && !errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	sums := make([]string, 0, len(refs))
+	for sum := range refs {
+		if !chunks[sum] {
+			sums = append(sums, sum)
+		}
+	}
+	sort.Strings(sums)
+	for _, sum := range sums {
+		if err := s.exportchunk(tw, sum, manifest); err != nil {
+			return err
+		}
+		chunks[sum] = true
+	}
+
+	d, err := s.exportfile(tw, rel, fh.File)
+	if d != nil {
+		fmt.Fprintf(manifest, "%s %d %s\n", d, d.Size, rel)
+	}
+	if err != nil {
+		return err
+	}
+	return s.exportindex(tw, rel, manifest)
+}
+
+// exportindex writes the key index entry of the object file at the relative
+// path rel into the tar stream, if there is one, and adds it to the
+// manifest. The entry is named like the object file below .index, without
+// the suffix. Entries which do not match the object are left out, as they
+// would fail the import.
+func (s *SOS) exportindex(tw *tar.Writer, rel string, manifest *bytes.Buffer) error {
+	hs := s.relhash(rel)
+	_, filename := s.indexpath(hs)
+	fh, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	if _, err := s.readindexentry(fh, hs); err != nil {
+		if errors.Is(err, ErrCorrupt) {
+			return nil
+		}
+		return err
+	}
+	if _, err := fh.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	rel = dirIndex + "/" + strings.TrimSuffix(rel, s.suffix)
+	d, err := s.exportfile(tw, rel, fh)
+	if d != nil {
+		fmt.Fprintf(manifest, "%s %d %s\n", d, d.Size, rel)
+	}
+	return err
+}
+
+// exportchunk writes the chunk with the given hash into the tar stream, and
+// adds it to the manifest.
+func (s *SOS) exportchunk(tw *tar.Writer, sum string, manifest *bytes.Buffer) error {
+	_, filename := s.chunkpath(sum)
+	fh, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: missing chunk %s", ErrCorrupt, sum)
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	rel := chunkname(sum)
+	d, err := s.exportfile(tw, rel, fh)
+	if d != nil {
+		fmt.Fprintf(manifest, "%s %d %s\n", d, d.Size, rel)
+	}
+	return err
+}
+
+// exportfile writes the opened file fh into the tar stream under the
+// relative path rel, and returns its digest.
+func (s *SOS) exportfile(tw *tar.Writer, rel string, fh *os.File) (*Digest, error) {
+	// use the metadata of the opened file, as the object might have been
+	// replaced since it was found
+	fi, err := fh.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// extended attributes, like SELinux security contexts, are kept in PAX
+	// records
+	xattrs, err := paxxattrs(fh.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     rel,
+		Size:     fi.Size(),
+		Mode:     int64(s.fileMode.Perm()),
+		ModTime:  fi.ModTime(),
+		Format:   tar.FormatPAX, // keeps the exact modification time
+
+		PAXRecords: xattrs,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	d := &Digest{}
+	d.Size, err = io.Copy(io.MultiWriter(tw, h), fh)
+	h.Sum(d.SHA256[:0])
+	return d, err
+}
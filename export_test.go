@@ -0,0 +1,71 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// Test full and incremental tar exports
+func TestExport(t *testing.T) {
+	s, _ := New("./._sostest")
+	defer s.Destroy()
+
+	s.StoreString("old", "old value")
+	s.StoreString("new", "new value")
+
+	// backdate the old object
+	since := time.Now().Add(-time.Hour)
+	_, oldname := s.getpath("old")
+	os.Chtimes(oldname, since.Add(-time.Hour), since.Add(-time.Hour))
+
+	full := new(bytes.Buffer)
+	if err := s.ExportTar(full); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+	if n := len(readTar(t, full)); n != 2 {
+		t.Errorf("Got %d objects in full export, expected 2", n)
+	}
+
+	incr := new(bytes.Buffer)
+	if err := s.ExportChangedSince(since, incr); err != nil {
+		t.Fatalf("ExportChangedSince failed: %v", err)
+	}
+	objs := readTar(t, incr)
+	if len(objs) != 1 {
+		t.Fatalf("Got %d objects in incremental export, expected 1", len(objs))
+	}
+	for _, v := range objs {
+		if v != "new value" {
+			t.Errorf("Got %s in incremental export, expected %s", v, "new value")
+		}
+	}
+}
+
+// readTar reads a tar stream and returns the content of its files by name.
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	objs := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return objs
+		}
+		if err != nil {
+			t.Fatalf("Reading tar stream failed: %v", err)
+		}
+		if hdr.Name == exportManifest {
+			continue
+		}
+		b, _ := io.ReadAll(tr)
+		objs[hdr.Name] = string(b)
+	}
+}
@@ -0,0 +1,154 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// expvarBuckets are the upper bounds of the latency histogram buckets of an
+// ExpvarSink, in seconds. They are the default buckets of Prometheus, so the
+// histograms of both sinks can be compared.
+var expvarBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// ExpvarSink is a MetricsSink which keeps the metrics in memory, and
+// implements expvar.Var, so they can be published with the standard expvar
+// package, and served as JSON at /debug/vars:
+//
+//	sink := sos.NewExpvarSink()
+//	expvar.Publish("sos", sink)
+//	store, err := sos.New(path, sos.WithMetrics(sink))
+//
+// The counters are reported by metric name and operation. The durations are
+// reported as cumulative latency histograms by operation, with the count,
+// the sum in seconds, and the number of operations which took at most the
+// upper bound of each bucket.
+type ExpvarSink struct {
+	mu        sync.Mutex
+	counters  map[string]map[string]int64 // by metric name and op
+	durations map[string]*latency         // by op
+	inflight  float64
+}
+
+var _ MetricsSink = (*ExpvarSink)(nil)
+var _ expvar.Var = (*ExpvarSink)(nil)
+
+// latency is a histogram of operation durations.
+type latency struct {
+	Count   int64            `json:"count"`
+	Sum     float64          `json:"sum_seconds"`
+	Buckets map[string]int64 `json:"buckets"` // by upper bound in seconds
+}
+
+// NewExpvarSink creates an ExpvarSink. It must be published with
+// expvar.Publish to be served.
+func NewExpvarSink() *ExpvarSink {
+	return &ExpvarSink{
+		counters:  make(map[string]map[string]int64),
+		durations: make(map[string]*latency),
+	}
+}
+
+// Counter implements MetricsSink.
+func (e *ExpvarSink) Counter(name, op string, delta int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counters[name] == nil {
+		e.counters[name] = make(map[string]int64)
+	}
+	e.counters[name][op] += delta
+}
+
+// Timer implements MetricsSink. Timers other than MetricDuration are
+// ignored.
+func (e *ExpvarSink) Timer(name, op string, d time.Duration) {
+	if name != MetricDuration {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	l := e.durations[op]
+	if l == nil {
+		l = &latency{Buckets: make(map[string]int64, len(expvarBuckets))}
+		for _, b := range expvarBuckets {
+			l.Buckets[strconv.FormatFloat(b, 'g', -1, 64)] = 0
+		}
+		e.durations[op] = l
+	}
+	l.Count++
+	l.Sum += d.Seconds()
+	for _, b := range expvarBuckets {
+		if d.Seconds() <= b {
+			l.Buckets[strconv.FormatFloat(b, 'g', -1, 64)]++
+		}
+	}
+}
+
+// Gauge implements MetricsSink. Gauges other than MetricInflight are
+// ignored.
+func (e *ExpvarSink) Gauge(name string, value float64) {
+	if name != MetricInflight {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.inflight = value
+}
+
+// String implements expvar.Var. It returns the metrics as a JSON object.
+func (e *ExpvarSink) String() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	vars := map[string]interface{}{
+		MetricDuration: e.durations,
+		MetricInflight: e.inflight,
+	}
+	for name, ops := range e.counters {
+		vars[name] = ops
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// multiSink passes the metrics on to several sinks.
+type multiSink []MetricsSink
+
+// MultiMetrics returns a MetricsSink which passes the metrics on to all of
+// the given sinks, e.g. to a Prometheus collector (see sosprom) and an
+// ExpvarSink.
+func MultiMetrics(sinks ...MetricsSink) MetricsSink {
+	return multiSink(append([]MetricsSink(nil), sinks...))
+}
+
+// Counter implements MetricsSink.
+func (m multiSink) Counter(name, op string, delta int64) {
+	for _, s := range m {
+		s.Counter(name, op, delta)
+	}
+}
+
+// Timer implements MetricsSink.
+func (m multiSink) Timer(name, op string, d time.Duration) {
+	for _, s := range m {
+		s.Timer(name, op, d)
+	}
+}
+
+// Gauge implements MetricsSink.
+func (m multiSink) Gauge(name string, value float64) {
+	for _, s := range m {
+		s.Gauge(name, value)
+	}
+}
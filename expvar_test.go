@@ -0,0 +1,60 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Test the metrics published by an ExpvarSink
+func TestExpvarSink(t *testing.T) {
+	sink := NewExpvarSink()
+	m := newTestMetrics()
+	s := NewTemp(t, WithMetrics(MultiMetrics(sink, m)))
+
+	s.StoreString("hello", "world")
+	s.GetString("hello")
+	s.GetString("missing")
+	sink.Timer(MetricDuration, "Slow", 2*time.Second)
+
+	var vars struct {
+		Operations map[string]int64 `json:"operations"`
+		NotFound   map[string]int64 `json:"not_found"`
+		Bytes      map[string]int64 `json:"bytes"`
+		Duration   map[string]struct {
+			Count   int64            `json:"count"`
+			Sum     float64          `json:"sum_seconds"`
+			Buckets map[string]int64 `json:"buckets"`
+		} `json:"duration"`
+		Inflight float64 `json:"inflight"`
+	}
+	if err := json.Unmarshal([]byte(sink.String()), &vars); err != nil {
+		t.Fatalf("Error decoding %s: %v", sink.String(), err)
+	}
+
+	if vars.Operations["Store"] != 1 || vars.Operations["Get"] != 2 {
+		t.Errorf("Got operations %v, expected 1 Store and 2 Get", vars.Operations)
+	}
+	if vars.NotFound["Get"] != 1 || vars.Bytes["Store"] != 5 {
+		t.Errorf("Got %d not found and %d bytes, expected 1 and 5", vars.NotFound["Get"], vars.Bytes["Store"])
+	}
+	if d := vars.Duration["Get"]; d.Count != 2 || d.Buckets["10"] != 2 {
+		t.Errorf("Got Get durations %+v, expected 2 in all buckets", d)
+	}
+	if d := vars.Duration["Slow"]; d.Sum != 2 || d.Buckets["1"] != 0 || d.Buckets["2.5"] != 1 {
+		t.Errorf("Got slow durations %+v, expected one between 1 and 2.5 seconds", d)
+	}
+	if vars.Inflight != 0 {
+		t.Errorf("Got %v running operations, expected 0", vars.Inflight)
+	}
+
+	// all sinks receive the metrics
+	if m.counters["operations/Get"] != 2 {
+		t.Errorf("Got %d Get operations in second sink, expected 2", m.counters["operations/Get"])
+	}
+}
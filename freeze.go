@@ -0,0 +1,78 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"fmt"
+)
+
+// Freeze stops all modifications of the store tree, so external snapshot or
+// backup tools (e.g. LVM or ZFS snapshots, rsync) capture a consistent state.
+// Freeze waits until running modifications are finished. While the store is
+// frozen, operations which would modify the tree wait until Thaw is called,
+// or fail with ErrFrozen on a store created with WithFreezeFailFast.
+//
+// Values are still written to temporary files while the store is frozen; only
+// moving them into place is delayed. Read operations are not affected.
+//
+// Freeze only affects the current process. Other processes sharing the store
+// directory must be frozen separately.
+func (s *SOS) Freeze() (err error) {
+	defer s.wraperr(&err, "Freeze", "")
+
+	s.freezeState.Lock()
+	defer s.freezeState.Unlock()
+
+	if s.frozen {
+		return fmt.Errorf("store is already frozen")
+	}
+	s.freezeMu.Lock()
+	s.frozen = true
+	return nil
+}
+
+// Thaw resumes modifications of a store frozen with Freeze. Waiting
+// operations continue.
+func (s *SOS) Thaw() (err error) {
+	defer s.wraperr(&err, "Thaw", "")
+
+	s.freezeState.Lock()
+	defer s.freezeState.Unlock()
+
+	if !s.frozen {
+		return fmt.Errorf("store is not frozen")
+	}
+	s.frozen = false
+	s.freezeMu.Unlock()
+	return nil
+}
+
+// WithFreezeFailFast makes operations which would modify a frozen store fail
+// with ErrFrozen, instead of waiting until the store is thawed.
+func WithFreezeFailFast() Option {
+	return func(s *SOS) {
+		s.freezeFailFast = true
+	}
+}
+
+// beginmodify registers the start of a modification of the store tree. It
+// waits while the store is frozen, or fails with ErrFrozen. Every successful
+// call to beginmodify must be followed by a call to endmodify.
+func (s *SOS) beginmodify() error {
+	if !s.freezeFailFast {
+		s.freezeMu.RLock()
+		return nil
+	}
+	if !s.freezeMu.TryRLock() {
+		return ErrFrozen
+	}
+	return nil
+}
+
+// endmodify registers the end of a modification started with beginmodify.
+func (s *SOS) endmodify() {
+	s.freezeMu.RUnlock()
+}
@@ -0,0 +1,74 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test that writers wait while the store is frozen
+func TestFreeze(t *testing.T) {
+	s := NewTemp(t)
+
+	if err := s.Freeze(); err != nil {
+		t.Fatalf("Freeze failed: %v", err)
+	}
+	if err := s.Freeze(); err == nil {
+		t.Errorf("Second Freeze succeeded, expected an error")
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- s.StoreString("key", "value")
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Store finished on a frozen store with error %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := s.GetString("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v on a frozen store, expected %v", err, ErrNotFound)
+	}
+
+	if err := s.Thaw(); err != nil {
+		t.Fatalf("Thaw failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Store failed after Thaw: %v", err)
+	}
+	if obj, _ := s.GetString("key"); obj != "value" {
+		t.Errorf("Got %s from store, expected %s", obj, "value")
+	}
+
+	if err := s.Thaw(); err == nil {
+		t.Errorf("Thaw on a store which is not frozen succeeded, expected an error")
+	}
+}
+
+// Test that writers fail on a frozen store with WithFreezeFailFast
+func TestFreezeFailFast(t *testing.T) {
+	s := NewTemp(t, WithFreezeFailFast())
+	s.StoreString("key", "value")
+
+	s.Freeze()
+	if err := s.StoreString("key", "other"); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Got error %v on Store, expected %v", err, ErrFrozen)
+	}
+	if err := s.Delete("key"); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Got error %v on Delete, expected %v", err, ErrFrozen)
+	}
+	if obj, _ := s.GetString("key"); obj != "value" {
+		t.Errorf("Got %s from store, expected %s", obj, "value")
+	}
+	s.Thaw()
+
+	if err := s.StoreString("key", "other"); err != nil {
+		t.Errorf("Store failed after Thaw: %v", err)
+	}
+}
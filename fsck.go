@@ -0,0 +1,257 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultFsckTempAge is the age of temporary files, above which Fsck takes
+// them for left over.
+const defaultFsckTempAge = 24 * time.Hour
+
+// FsckOptions controls the checks and repairs of Fsck.
+type FsckOptions struct {
+	TempAge    time.Duration // age of left over temporary files, default 24h
+	Verify     bool          // check the values against their digests
+	Repair     bool          // remove or move the files which can be repaired
+	Quarantine bool          // move the files which cannot be repaired to .quarantine
+}
+
+// FsckReport describes the problems found by Fsck. The paths are relative to
+// the base directory.
+type FsckReport struct {
+	Objects     int      // object files which were checked
+	TempFiles   []string // temporary files left over by crashed processes
+	Misplaced   []string // files which are not at a valid object location
+	EmptyDirs   []string // shard directories without objects
+	Mismatched  []string // object files whose key in the key index has another hash
+	Corrupt     []string // object files which cannot be decoded, or do not match their digest
+	Repaired    int      // problems which were repaired
+	Quarantined int      // files which were moved to .quarantine
+}
+
+// Fsck checks the directory tree of the store, and optionally repairs the
+// problems. It finds
+//
+//   - temporary files which are older than opts.TempAge, and do not belong to
+//     this instance, see CleanupTemp,
+//   - files which are not at a valid object location, e.g. files of an
+//     external tool, or object files of a store with another shard depth,
+//   - empty shard directories,
+//   - object files whose key in the key index (see WithKeyIndex) has another
+//     hash than the name of the file,
+//   - and, if opts.Verify is set, object files whose header cannot be
+//     decoded, or whose value does not match its digest (see VerifyAll).
+//
+// If opts.Repair is set, left over temporary files and empty shard
+// directories are removed, and misplaced object files whose name is a key
+// hash are moved to their location, unless an object exists there. If
+// opts.Quarantine is set, all other misplaced files, and the mismatched and
+// corrupt object files, are moved to the directory .quarantine, keeping
+// their relative path. Fsck never deletes object files.
+func (s *SOS) Fsck(opts FsckOptions) (report FsckReport, err error) {
+	defer s.wraperr(&err, "Fsck", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	if opts.Repair || opts.Quarantine {
+		if err := s.beginmodify(); err != nil {
+			return report, err
+		}
+		defer s.endmodify()
+	}
+	if opts.TempAge == 0 {
+		opts.TempAge = defaultFsckTempAge
+	}
+
+	if err := s.fscktemp(opts, &report); err != nil {
+		return report, err
+	}
+
+	var dirs []string
+	err = filepath.WalkDir(s.base, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name != s.base && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		rel, _ := filepath.Rel(s.base, name)
+		rel = filepath.ToSlash(rel)
+		switch {
+		case rel == ".":
+			return nil
+		case isreserved(d.Name()):
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		case d.IsDir():
+			dirs = append(dirs, rel)
+			return nil
+		case !d.Type().IsRegular() || !s.isobjectpath(rel):
+			return s.fsckmisplaced(rel, opts, &report)
+		}
+
+		report.Objects++
+		problem, err := s.fsckobject(rel, opts.Verify, &report)
+		if err != nil || problem == nil {
+			return err
+		}
+		*problem = append(*problem, rel)
+		if opts.Quarantine {
+			return s.quarantine(rel, &report)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// deepest directories first, so their parents may become empty
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name := filepath.Join(s.base, filepath.FromSlash(dirs[i]))
+		entries, err := os.ReadDir(name)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		report.EmptyDirs = append(report.EmptyDirs, dirs[i])
+		if opts.Repair && os.Remove(name) == nil {
+			report.Repaired++
+		}
+	}
+	return report, nil
+}
+
+// fscktemp finds the left over temporary files, and removes them on repair.
+func (s *SOS) fscktemp(opts FsckOptions, report *FsckReport) error {
+	entries, err := os.ReadDir(s.tmpdir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	limit := s.clock.Now().Add(-opts.TempAge)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), s.instanceID) {
+			continue // temporary file of this instance
+		}
+		fi, err := e.Info()
+		if err != nil || fi.IsDir() || changetime(fi).After(limit) {
+			continue
+		}
+
+		report.TempFiles = append(report.TempFiles, dirTmp+"/"+e.Name())
+		if opts.Repair && os.Remove(filepath.Join(s.tmpdir(), e.Name())) == nil {
+			report.Repaired++
+		}
+	}
+	return nil
+}
+
+// fsckmisplaced handles a file which is not at a valid object location.
+func (s *SOS) fsckmisplaced(rel string, opts FsckOptions, report *FsckReport) error {
+	report.Misplaced = append(report.Misplaced, rel)
+
+	// an object file at the location of another shard depth
+	hs := strings.ReplaceAll(strings.TrimSuffix(rel, s.suffix), "/", "")
+	valid := strings.HasSuffix(rel, s.suffix) && len(hs) == s.hashlen() &&
+		strings.Trim(hs, "0123456789abcdef") == ""
+	if opts.Repair && valid {
+		dirname, filename := s.hashpath(hs)
+		if _, err := os.Lstat(filename); errors.Is(err, fs.ErrNotExist) {
+			src := filepath.Join(s.base, filepath.FromSlash(rel))
+			err := s.change(hs, false, func() error {
+				if err := s.mkdirall(dirname); err != nil {
+					return err
+				}
+				return os.Rename(src, filename)
+			})
+			if err != nil {
+				return err
+			}
+			report.Repaired++
+			return nil
+		}
+	}
+
+	if opts.Quarantine {
+		return s.quarantine(rel, report)
+	}
+	return nil
+}
+
+// fsckobject checks an object file. It returns the list of the report, to
+// which the file belongs, or nil if the file is fine.
+func (s *SOS) fsckobject(rel string, verify bool, report *FsckReport) (*[]string, error) {
+	hs := s.relhash(rel)
+	_, indexname := s.indexpath(hs)
+	key, err := os.ReadFile(indexname)
+	if err == nil && s.keyhash(string(key)) != hs {
+		return &report.Mismatched, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if !verify {
+		return nil, nil
+	}
+
+	_, filename := s.hashpath(hs)
+	fh, err := s.openfile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil // deleted in the meantime
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = s.verifydigest(fh)
+	_ = fh.Close()
+
+	switch {
+	case errors.Is(err, ErrCorrupt):
+		return &report.Corrupt, nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNoDigest):
+		return nil, nil
+	}
+	return nil, err
+}
+
+// quarantine moves the file at rel to the quarantine directory.
+func (s *SOS) quarantine(rel string, report *FsckReport) error {
+	src := filepath.Join(s.base, filepath.FromSlash(rel))
+	dst := filepath.Join(s.base, dirQuarantine, filepath.FromSlash(rel))
+	if err := s.mkdirall(filepath.Dir(dst)); err != nil {
+		return err
+	}
+
+	var err error
+	if s.isobjectpath(rel) {
+		err = s.change(s.relhash(rel), false, func() error { return os.Rename(src, dst) })
+	} else {
+		err = os.Rename(src, dst)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // removed in the meantime
+	}
+	if err != nil {
+		return err
+	}
+	report.Quarantined++
+	return nil
+}
@@ -0,0 +1,71 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test finding and repairing problems of the directory tree
+func TestFsck(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex(), WithDigests())
+	s.StoreString("good", "value")
+	s.StoreString("moved", "value")
+	s.StoreString("mismatched", "value")
+	s.StoreString("corrupt", "value")
+
+	// a left over temporary file, a foreign file and an empty directory
+	os.WriteFile(filepath.Join(s.tmpdir(), "crashed-1234"), nil, 0o644)
+	os.WriteFile(filepath.Join(s.base, "junk.txt"), []byte("junk"), 0o644)
+	os.MkdirAll(filepath.Join(s.base, "ff", "ff"), 0o755)
+
+	// an object file at the location of another shard depth
+	_, filename := s.getpath("moved")
+	hs := s.keyhash("moved")
+	os.Rename(filename, filepath.Join(s.base, hs))
+
+	// a wrong key index entry, and a corrupt value
+	_, indexname := s.indexpath(s.keyhash("mismatched"))
+	os.WriteFile(indexname, []byte("other"), 0o644)
+	corrupt(t, s, "corrupt")
+
+	opts := FsckOptions{TempAge: time.Nanosecond, Verify: true}
+	report, err := s.Fsck(opts)
+	if err != nil {
+		t.Fatalf("Error in Fsck: %v", err)
+	}
+	// the directory of the moved object file is empty as well
+	if len(report.TempFiles) != 1 || len(report.Misplaced) != 2 || len(report.EmptyDirs) != 2 ||
+		len(report.Mismatched) != 1 || len(report.Corrupt) != 1 || report.Repaired != 0 {
+		t.Errorf("Got %+v from Fsck, expected 2 misplaced files, 2 empty directories and one problem of each other kind", report)
+	}
+
+	opts.Repair, opts.Quarantine = true, true
+	report, err = s.Fsck(opts)
+	if err != nil {
+		t.Fatalf("Error in Fsck with repair: %v", err)
+	}
+	if report.Quarantined != 3 {
+		t.Errorf("Got %d quarantined files, expected 3", report.Quarantined)
+	}
+	if _, err := os.Stat(filepath.Join(s.base, "ff")); !os.IsNotExist(err) {
+		t.Errorf("Empty directories were not removed (%v)", err)
+	}
+	if v, err := s.GetString("moved"); err != nil || v != "value" {
+		t.Errorf("Got %q (%v) for moved object, expected %q", v, err, "value")
+	}
+	if _, err := os.Stat(filepath.Join(s.base, dirQuarantine, "junk.txt")); err != nil {
+		t.Errorf("Foreign file was not quarantined: %v", err)
+	}
+
+	report, err = s.Fsck(opts)
+	if err != nil || report.Objects != 2 || len(report.Misplaced)+len(report.EmptyDirs)+len(report.Corrupt) != 0 {
+		t.Errorf("Got %+v (%v) from Fsck after repair, expected 2 good objects", report, err)
+	}
+}
@@ -0,0 +1,63 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WithFsync makes stored values durable. The temporary file of a value is
+// flushed to disk before it is moved into place, and the object directory is
+// flushed afterwards, so a stored object survives a crash or power loss.
+// Newly created directories are flushed as well. This applies to objects and
+// chunks, but not to internal data like pointers, leases or the key index.
+//
+// Without this option, a power loss shortly after a Store can lose the
+// object, or leave an empty object file behind on some file systems. Flushing
+// makes Store considerably slower.
+func WithFsync() Option {
+	return func(s *SOS) {
+		s.fsync = true
+	}
+}
+
+// syncfile flushes a file which is written, if WithFsync is set.
+func (s *SOS) syncfile(fh *os.File) error {
+	if !s.fsync {
+		return nil
+	}
+	return fh.Sync()
+}
+
+// syncentry flushes the directory dirname, after an entry was created in
+// it, if WithFsync is set.
+func (s *SOS) syncentry(dirname string) error {
+	if !s.fsync {
+		return nil
+	}
+	return syncdir(dirname)
+}
+
+// syncparents flushes the parent directories of dirname up to the base
+// directory, after dirname was created, if WithFsync is set.
+func (s *SOS) syncparents(dirname string) error {
+	if !s.fsync {
+		return nil
+	}
+	base := filepath.Clean(s.base)
+	for dir := filepath.Clean(dirname); dir != base; {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break // dirname is not below the base directory
+		}
+		if err := syncdir(parent); err != nil {
+			return err
+		}
+		dir = parent
+	}
+	return nil
+}
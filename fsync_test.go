@@ -0,0 +1,40 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// Test that stores with flushing work like stores without
+func TestFsync(t *testing.T) {
+	s := NewTemp(t, WithFsync())
+	if err := s.StoreString("hello", "world"); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if v, _ := s.GetString("hello"); v != "world" {
+		t.Errorf("Got %s from store, expected %s", v, "world")
+	}
+
+	n := NewTemp(t, WithFsync(), WithNoOverwrite())
+	n.StoreString("hello", "world")
+	if err := n.StoreString("hello", "again"); !errors.Is(err, ErrExists) {
+		t.Errorf("Got %v for an existing key, expected ErrExists", err)
+	}
+
+	c := NewTemp(t, WithFsync(), WithChunking())
+	value := make([]byte, 4*chunkMax)
+	rand.New(rand.NewSource(1)).Read(value)
+	if err := c.Store("big", value); err != nil {
+		t.Fatalf("Store of a chunked value failed: %v", err)
+	}
+	if v, _ := c.Get("big"); !bytes.Equal(v, value) {
+		t.Errorf("Got a different chunked value from store")
+	}
+}
@@ -0,0 +1,23 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build !windows
+
+package sos
+
+import "os"
+
+// syncdir flushes the entries of a directory to disk.
+func syncdir(dirname string) error {
+	fh, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	err = fh.Sync()
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,14 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build windows
+
+package sos
+
+// syncdir does nothing, as directories cannot be flushed on this platform.
+// NTFS journals the directory entries anyway.
+func syncdir(dirname string) error {
+	return nil
+}
@@ -0,0 +1,299 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS returns a read-only file system of the objects in the key index (see
+// WithKeyIndex), so standard library consumers like http.FileServer,
+// template.ParseFS or fs.WalkDir can read them. The file names are the keys,
+// and the slashes in keys form directories. So, the key "static/css/main.css"
+// is the file static/css/main.css, in the directories static and static/css.
+//
+// Keys which are not valid file names (see fs.ValidPath) are left out. If a
+// key is also the prefix of other keys (e.g. "static" and "static/app.js"),
+// the file hides the directory.
+//
+// The size of a file is taken from the digest of its value, if the store
+// records it (see WithDigests). Otherwise, the value is read once to
+// determine its size. The files can be seeked. If the value is replaced while
+// a file is open, a backward seek fails with ErrInconsistent.
+func (s *SOS) FS() fs.FS {
+	return storeFS{s}
+}
+
+// storeFS implements FS.
+type storeFS struct {
+	s *SOS
+}
+
+// Open opens the file or directory name.
+func (f storeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.opendir(name, "")
+	}
+
+	// a file hides the keys below it
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		ok, err := f.s.Exists(dir)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		if ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+	}
+
+	obj, err := f.s.GetObject(name)
+	if err == nil {
+		return &fsFile{s: f.s, name: name, obj: obj, size: -1}, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f.opendir(name, name+"/")
+}
+
+// opendir opens the directory name, which holds the keys with the prefix.
+func (f storeFS) opendir(name, prefix string) (fs.File, error) {
+	keys, err := f.s.List(prefix)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	// the keys are sorted, so a file comes before the keys it hides
+	d := &fsDir{name: name}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, prefix)
+		if !fs.ValidPath(rest) {
+			continue
+		}
+		entry, _, isdir := strings.Cut(rest, "/")
+		if seen[entry] {
+			continue // a file hides the directory, or more keys in it
+		}
+		seen[entry] = true
+		d.entries = append(d.entries, &fsDirEntry{s: f.s, key: prefix + entry, name: entry, dir: isdir})
+	}
+	if len(d.entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(d.entries, func(i, j int) bool { return d.entries[i].name < d.entries[j].name })
+	return d, nil
+}
+
+// fsFile is an open file of FS.
+type fsFile struct {
+	s    *SOS
+	name string
+	obj  *Object
+	pos  int64 // offset of the next read from obj
+	seek int64 // offset of the next read, as set by Seek
+	size int64 // size of the value, or -1 if unknown
+}
+
+// Stat returns the file info.
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	size, err := f.valuesize()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return fsInfo{name: path.Base(f.name), size: size, modTime: f.obj.ModTime}, nil
+}
+
+// valuesize returns the size of the value, which is read to count its bytes
+// if it is not recorded in the digest.
+func (f *fsFile) valuesize() (int64, error) {
+	if f.obj.HasDigest {
+		return f.obj.Digest.Size, nil
+	}
+	if f.size < 0 {
+		obj, err := f.reopen()
+		if err != nil {
+			return 0, err
+		}
+		defer obj.Close()
+		if f.size, err = io.Copy(io.Discard, obj); err != nil {
+			return 0, err
+		}
+	}
+	return f.size, nil
+}
+
+// reopen opens the object again, and checks that it was not replaced.
+func (f *fsFile) reopen() (*Object, error) {
+	obj, err := f.s.GetObject(f.name)
+	if err != nil {
+		return nil, err
+	}
+	if !obj.ModTime.Equal(f.obj.ModTime) || obj.Digest != f.obj.Digest {
+		obj.Close()
+		return nil, fmt.Errorf("%w: %s", ErrInconsistent, f.name)
+	}
+	return obj, nil
+}
+
+// Read reads from the value.
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.seek < f.pos {
+		obj, err := f.reopen()
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.obj.Close()
+		f.obj, f.pos = obj, 0
+	}
+	if f.seek > f.pos {
+		n, err := io.CopyN(io.Discard, f.obj, f.seek-f.pos)
+		f.pos += n
+		if err != nil {
+			f.seek = f.pos
+			return 0, err
+		}
+	}
+
+	n, err := f.obj.Read(p)
+	f.pos += int64(n)
+	f.seek = f.pos
+	return n, err
+}
+
+// Seek sets the offset of the next read. Seeking relative to the end
+// requires the size of the value, see Stat.
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.seek
+	case io.SeekEnd:
+		size, err := f.valuesize()
+		if err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+		}
+		offset += size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.seek = offset
+	return offset, nil
+}
+
+// Close closes the file.
+func (f *fsFile) Close() error {
+	return f.obj.Close()
+}
+
+// fsDir is an open directory of FS.
+type fsDir struct {
+	name    string
+	entries []*fsDirEntry
+	read    int // number of entries returned by ReadDir
+}
+
+// Stat returns the file info.
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return fsInfo{name: path.Base(d.name), dir: true}, nil
+}
+
+// Read fails, as d is a directory.
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+// Close closes the directory.
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of the directory, see fs.ReadDirFile.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.read:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	d.read += len(rest)
+
+	list := make([]fs.DirEntry, len(rest))
+	for i, e := range rest {
+		list[i] = e
+	}
+	return list, nil
+}
+
+// fsDirEntry is an entry of a directory of FS. The file info is read lazily.
+type fsDirEntry struct {
+	s    *SOS
+	key  string
+	name string
+	dir  bool
+}
+
+func (e *fsDirEntry) Name() string {
+	return e.name
+}
+
+func (e *fsDirEntry) IsDir() bool {
+	return e.dir
+}
+
+func (e *fsDirEntry) Type() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (e *fsDirEntry) Info() (fs.FileInfo, error) {
+	if e.dir {
+		return fsInfo{name: e.name, dir: true}, nil
+	}
+	f, err := storeFS{e.s}.Open(e.key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// fsInfo is the file info of a file or directory of FS.
+type fsInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi fsInfo) Name() string       { return fi.name }
+func (fi fsInfo) Size() int64        { return fi.size }
+func (fi fsInfo) ModTime() time.Time { return fi.modTime }
+func (fi fsInfo) IsDir() bool        { return fi.dir }
+func (fi fsInfo) Sys() any           { return nil }
+
+func (fi fsInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
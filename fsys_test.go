@@ -0,0 +1,90 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// Test the file system of a store
+func TestFS(t *testing.T) {
+	for _, digests := range []bool{false, true} {
+		opts := []Option{WithKeyIndex()}
+		if digests {
+			opts = append(opts, WithDigests())
+		}
+		s := NewTemp(t, opts...)
+		s.StoreString("index.html", "<h1>hello</h1>")
+		s.StoreString("static/css/main.css", "body {}")
+		s.StoreString("static/app.js", "")
+		s.StoreString("static!", "sorted before static/")
+		s.StoreString("doc", "file hides the directory")
+		s.StoreString("doc/hidden", "hidden")
+		s.StoreString("/invalid", "left out")
+
+		fsys := s.FS()
+		if err := fstest.TestFS(fsys, "index.html", "static/css/main.css", "static/app.js", "static!", "doc"); err != nil {
+			t.Error(err)
+		}
+
+		data, err := fs.ReadFile(fsys, "static/css/main.css")
+		if err != nil || string(data) != "body {}" {
+			t.Errorf("Got %q (%v) from ReadFile, expected %q", data, err, "body {}")
+		}
+		if _, err := fs.ReadFile(fsys, "doc/hidden"); err == nil {
+			t.Errorf("Got no error for a hidden file")
+		}
+		if _, err := fsys.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Got %v for missing file, expected ErrNotExist", err)
+		}
+	}
+}
+
+// Test serving the file system with http.FileServer, including ranges
+func TestFSFileServer(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex())
+	s.StoreString("static/hello.txt", "hello world")
+
+	srv := httptest.NewServer(http.FileServer(http.FS(s.FS())))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/static/hello.txt", nil)
+	req.Header.Set("Range", "bytes=6-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "world" {
+		t.Errorf("Got status %d and %q, expected %d and %q", resp.StatusCode, body, http.StatusPartialContent, "world")
+	}
+}
+
+// Test that a backward seek detects a replaced value
+func TestFSSeekReplaced(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex())
+	s.StoreString("key", "old value")
+
+	f, err := s.FS().Open("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	io.ReadAll(f)
+
+	s.StoreString("key", "new value")
+	f.(io.Seeker).Seek(0, io.SeekStart)
+	if _, err := f.Read(make([]byte, 10)); !errors.Is(err, ErrInconsistent) {
+		t.Errorf("Got %v from read after seek, expected ErrInconsistent", err)
+	}
+}
@@ -1,3 +1,9 @@
 module github.com/hweidner/sos
 
 go 1.22
+
+require (
+	github.com/klauspost/compress v1.17.9
+	golang.org/x/sys v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,63 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// gzipMagic are the first two bytes of every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// GetGunzipTo fetches an object from the store, identified by the key, and
+// copies it into an io.Writer. If the stored value is gzip compressed, it is
+// decompressed on the fly. Otherwise, it is copied unmodified.
+func (s *SOS) GetGunzipTo(key string, wr io.Writer) (err error) {
+	defer s.wraperr(&err, "Get", key)
+
+	rd, err := s.GetGunzipReader(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(wr, rd)
+	if err != nil {
+		_ = rd.Close()
+		return err
+	}
+	return rd.Close()
+}
+
+// GetGunzipReader opens an object in the store, identified by the key, for
+// streaming. If the stored value is gzip compressed, it is decompressed on
+// the fly. Otherwise, it is returned unmodified. The caller must close the
+// reader after use.
+func (s *SOS) GetGunzipReader(key string) (_ io.ReadCloser, err error) {
+	defer s.wraperr(&err, "Get", key)
+
+	r, err := s.openreader(key)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r.Reader)
+	r.Reader = br
+	magic, _ := br.Peek(len(gzipMagic))
+	if !bytes.Equal(magic, gzipMagic) {
+		return r, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		r.abort(err)
+		return nil, err
+	}
+	r.Reader, r.inner = zr, zr
+	return r, nil
+}
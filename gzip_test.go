@@ -0,0 +1,52 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+// Test reading gzip compressed and uncompressed objects
+func TestGetGunzip(t *testing.T) {
+	s, _ := New("./._sostest")
+	defer s.Destroy()
+
+	val := "hello compressed world"
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	zw.Write([]byte(val))
+	zw.Close()
+
+	s.Store("zipped", buf.Bytes())
+	s.StoreString("plain", val)
+
+	for _, key := range []string{"zipped", "plain"} {
+		out := new(bytes.Buffer)
+		if err := s.GetGunzipTo(key, out); err != nil {
+			t.Fatalf("GetGunzipTo(%s) failed: %v", key, err)
+		}
+		if out.String() != val {
+			t.Errorf("Got %s from store for key %s, expected %s", out.String(), key, val)
+		}
+
+		rd, err := s.GetGunzipReader(key)
+		if err != nil {
+			t.Fatalf("GetGunzipReader(%s) failed: %v", key, err)
+		}
+		got, _ := io.ReadAll(rd)
+		rd.Close()
+		if string(got) != val {
+			t.Errorf("Got %s from store for key %s, expected %s", got, key, val)
+		}
+	}
+
+	if err := s.GetGunzipTo("missing", io.Discard); err == nil {
+		t.Errorf("Got no error for a missing key")
+	}
+}
@@ -0,0 +1,131 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Object files usually contain the plain value. If a value is transformed on
+// its way into the store (see WithWriteTransform), the object file starts
+// with a header which describes the transformations:
+//
+//	magic   8 bytes  "\x89SOS\r\n\x1a\n"
+//	version 1 byte   currently 1
+//	flags   1 byte   transformations applied to the value, see Flag
+//	length  4 bytes  length of the fields, big endian
+//	fields  length   sequence of tag (1 byte), size (2 bytes), data
+//
+// A plain value which happens to start with the magic bytes is stored with a
+// header without flags, so it cannot be mistaken for a header.
+
+// headerMagic marks an object file with a header.
+var headerMagic = []byte("\x89SOS\r\n\x1a\n")
+
+const (
+	headerVersion = 1
+	headerFixed   = 14 // size of magic, version, flags and length
+)
+
+// Tags of the header fields.
+const (
+	tagParts   byte = 1 // the value consists of named parts, see StoreParts
+	tagExpires byte = 2 // expiry time in Unix nanoseconds, see StoreWithTTL
+	tagMeta    byte = 3 // JSON encoded metadata, see StoreWithMeta
+	tagDigest  byte = 4 // SHA-256 checksum and size of the value, see WithDigests
+	tagKeyID   byte = 5 // ID of the encryption key, see WithEncryption
+	tagSize    byte = 6 // size of the plain value, see WithCompression
+)
+
+// header is the decoded header of an object file.
+type header struct {
+	flags  Flag
+	fields map[byte][]byte
+}
+
+// marshal returns the binary encoding of the header.
+func (h *header) marshal() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(headerMagic)
+	buf.WriteByte(headerVersion)
+	buf.WriteByte(byte(h.flags))
+
+	tags := make([]byte, 0, len(h.fields))
+	for tag := range h.fields {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+
+	var fields []byte
+	for _, tag := range tags {
+		data := h.fields[tag]
+		fields = append(fields, tag)
+		fields = binary.BigEndian.AppendUint16(fields, uint16(len(data)))
+		fields = append(fields, data...)
+	}
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(fields)))
+	buf.Write(fields)
+
+	return buf.Bytes()
+}
+
+// offset returns the position of the data of a field in the binary encoding
+// of the header.
+func (h *header) offset(tag byte) int64 {
+	off := int64(headerFixed)
+	for t, data := range h.fields {
+		if t < tag {
+			off += 3 + int64(len(data))
+		}
+	}
+	return off + 3
+}
+
+// readheader reads the header of an object file, if there is one. If the
+// file does not start with a header, nil is returned and nothing is consumed
+// from br.
+func readheader(br *bufio.Reader) (*header, error) {
+	magic, _ := br.Peek(len(headerMagic))
+	if !bytes.Equal(magic, headerMagic) {
+		return nil, nil
+	}
+
+	fixed := make([]byte, headerFixed)
+	if _, err := io.ReadFull(br, fixed); err != nil {
+		return nil, fmt.Errorf("%w: object header", ErrCorrupt)
+	}
+	if fixed[8] != headerVersion {
+		return nil, fmt.Errorf("unsupported object header version %d", fixed[8])
+	}
+
+	h := &header{
+		flags:  Flag(fixed[9]),
+		fields: make(map[byte][]byte),
+	}
+
+	fields := make([]byte, binary.BigEndian.Uint32(fixed[10:]))
+	if _, err := io.ReadFull(br, fields); err != nil {
+		return nil, fmt.Errorf("%w: object header", ErrCorrupt)
+	}
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%w: object header", ErrCorrupt)
+		}
+		tag, size := fields[0], int(binary.BigEndian.Uint16(fields[1:]))
+		if len(fields) < 3+size {
+			return nil, fmt.Errorf("%w: object header", ErrCorrupt)
+		}
+		h.fields[tag] = fields[3 : 3+size]
+		fields = fields[3+size:]
+	}
+
+	return h, nil
+}
@@ -0,0 +1,108 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// OpInfo describes an operation on a key, see WithHooks and WithLogger.
+type OpInfo struct {
+	Op       string        // name of the operation, e.g. "Store" or "Get"
+	KeyHash  string        // hex encoded hash of the key
+	Bytes    int64         // bytes stored or read, when finished
+	Duration time.Duration // duration, when finished
+	Err      error         // error of the operation, when finished
+}
+
+// Hooks are called for the Store, Get, Delete, Take, Touch, Append and
+// SetMeta operations. Streaming reads (e.g. GetReader and GetObject) finish
+// when the reader is closed. The sub-module sosotel provides hooks which
+// create OpenTelemetry spans.
+type Hooks struct {
+	// Start is called when an operation starts, with the context of the
+	// operation, which is context.Background for the variants without a
+	// context. If it returns a function, it is called when the operation has
+	// finished, with the result.
+	Start func(ctx context.Context, info OpInfo) func(info OpInfo)
+}
+
+// WithHooks sets hooks which are called around each operation on a key.
+func WithHooks(h Hooks) Option {
+	return func(s *SOS) {
+		s.hooks = h
+	}
+}
+
+// WithLogger logs each operation on a key (see Hooks) to a structured
+// logger, with the key hash, the number of bytes, the duration and the
+// error. Successful operations, and operations on missing keys, are logged at
+// debug level, failed ones at error level. The keys themselves are not
+// logged, as they may contain personal data.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *SOS) {
+		s.logger = l
+	}
+}
+
+// operation is a running operation on a key, which is observed by the
+// metrics, the logger and the hooks.
+type operation struct {
+	ctx   context.Context
+	info  OpInfo
+	start time.Time
+	end   func(OpInfo) // returned by the start hook
+}
+
+// startop starts observing an operation. The key is hashed only if a logger
+// or hooks are set.
+func (s *SOS) startop(ctx context.Context, op, key string) *operation {
+	o := &operation{ctx: ctx, info: OpInfo{Op: op}, start: time.Now()}
+	if s.logger == nil && s.hooks.Start == nil {
+		return o
+	}
+	o.info.KeyHash = s.keyhash(key)
+	if s.hooks.Start != nil {
+		o.end = s.hooks.Start(ctx, o.info)
+	}
+	return o
+}
+
+// observe reports the end of an operation, which failed with *err, or
+// succeeded if *err is nil. It is meant to be deferred.
+func (s *SOS) observe(o *operation, err *error) {
+	o.info.Duration = time.Since(o.start)
+	o.info.Err = *err
+	s.measure(o.info)
+
+	if s.logger != nil {
+		level := slog.LevelDebug
+		if *err != nil && !errors.Is(*err, ErrNotFound) {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("key_hash", o.info.KeyHash),
+			slog.Int64("bytes", o.info.Bytes),
+			slog.Duration("duration", o.info.Duration),
+		}
+		if *err != nil {
+			// without the key of *Error
+			msg := (*err).Error()
+			var e *Error
+			if errors.As(*err, &e) {
+				msg = e.Err.Error()
+			}
+			attrs = append(attrs, slog.String("error", msg))
+		}
+		s.logger.LogAttrs(o.ctx, level, "sos "+o.info.Op, attrs...)
+	}
+	if o.end != nil {
+		o.end(o.info)
+	}
+}
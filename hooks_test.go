@@ -0,0 +1,141 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test the structured log of the operations
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := NewTemp(t, WithLogger(logger))
+
+	s.StoreString("hello", "world")
+	s.GetString("hello")
+	s.GetString("missing")
+	s.Append("hello", []byte("!"))
+
+	type record struct {
+		Level   string
+		Msg     string
+		KeyHash string `json:"key_hash"`
+		Bytes   int64
+		Error   string
+	}
+	expected := []record{
+		{"DEBUG", "sos Store", s.keyhash("hello"), 5, ""},
+		{"DEBUG", "sos Get", s.keyhash("hello"), 5, ""},
+		{"DEBUG", "sos Get", s.keyhash("missing"), 0, "key does not exist"},
+		{"DEBUG", "sos Append", s.keyhash("hello"), 1, ""},
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d log records, expected %d:\n%s", len(lines), len(expected), buf.String())
+	}
+	for i, line := range lines {
+		var r record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Error decoding log record %q: %v", line, err)
+		}
+		e := expected[i]
+		if r.Level != e.Level || r.Msg != e.Msg || r.KeyHash != e.KeyHash || r.Bytes != e.Bytes || r.Error != e.Error {
+			t.Errorf("Got log record %+v, expected %+v", r, e)
+		}
+	}
+	if strings.Contains(buf.String(), "missing") {
+		t.Errorf("Found key in log records")
+	}
+}
+
+// Test that the hooks see the context and the result of the operations
+func TestHooks(t *testing.T) {
+	type ctxKey struct{}
+	var started, finished []OpInfo
+	s := NewTemp(t, WithHooks(Hooks{
+		Start: func(ctx context.Context, info OpInfo) func(OpInfo) {
+			if ctx.Value(ctxKey{}) == nil {
+				return nil
+			}
+			started = append(started, info)
+			return func(info OpInfo) {
+				finished = append(finished, info)
+			}
+		},
+	}))
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, true)
+	s.StoreString("untraced", "value")
+	s.StoreCtx(ctx, "key", []byte("value"))
+	s.DeleteCtx(ctx, "missing")
+
+	if len(started) != 2 || started[0].Op != "Store" || started[0].KeyHash != s.keyhash("key") {
+		t.Fatalf("Got started operations %+v, expected Store and Delete", started)
+	}
+	if len(finished) != 2 || finished[0].Bytes != 5 || finished[0].Err != nil || finished[0].Duration <= 0 {
+		t.Errorf("Got finished Store %+v, expected 5 bytes without error", finished[0])
+	}
+	if !errors.Is(finished[1].Err, ErrNotFound) {
+		t.Errorf("Got error %v for missing key, expected ErrNotFound", finished[1].Err)
+	}
+}
+
+// Test that streaming reads and downloads are observed
+func TestHooksStreaming(t *testing.T) {
+	var finished []OpInfo
+	s := NewTemp(t, WithHooks(Hooks{
+		Start: func(ctx context.Context, info OpInfo) func(OpInfo) {
+			return func(info OpInfo) {
+				finished = append(finished, info)
+			}
+		},
+	}))
+	s.StoreString("key", "value")
+	finished = nil
+
+	rd, err := s.GetReader("key")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	io.ReadAll(rd)
+	if len(finished) != 0 {
+		t.Errorf("Got finished operations %+v before Close, expected none", finished)
+	}
+	rd.Close()
+	if len(finished) != 1 || finished[0].Op != "Get" || finished[0].Bytes != 5 || finished[0].Err != nil {
+		t.Errorf("Got finished operations %+v, expected Get of 5 bytes", finished)
+	}
+
+	finished = nil
+	if _, err := s.GetObject("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Got error %v from GetObject, expected ErrNotFound", err)
+	}
+	if len(finished) != 1 || !errors.Is(finished[0].Err, ErrNotFound) {
+		t.Errorf("Got finished operations %+v, expected Get with ErrNotFound", finished)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("remote value"))
+	}))
+	defer srv.Close()
+	finished = nil
+	if err := s.StoreFromURL(context.Background(), "remote", srv.URL); err != nil {
+		t.Fatalf("StoreFromURL failed: %v", err)
+	}
+	if len(finished) != 1 || finished[0].Op != "Store" || finished[0].Bytes != 12 {
+		t.Errorf("Got finished operations %+v, expected Store of 12 bytes", finished)
+	}
+}
@@ -0,0 +1,322 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package httpd exposes a simple object store as a REST API over HTTP.
+
+The Handler maps requests on /objects/{key} to the operations of the store:
+
+	PUT    stores the request body as value, with its Content-Type
+	GET    returns the value
+	HEAD   returns the headers of GET, without reading the value
+	DELETE deletes the object
+
+Keys may contain slashes. Values are streamed in both directions, so they
+are never held in memory. For example:
+
+	s, err := sos.New("/srv/objects", sos.WithDigests())
+	...
+	http.Handle("/objects/", httpd.New(s))
+	log.Fatal(http.ListenAndServe(":8080", nil))
+
+Responses carry the SHA256 checksum of the value as ETag, and the
+modification time as Last-Modified. Conditional requests (If-Match,
+If-None-Match, If-Modified-Since, If-Unmodified-Since) are supported. The
+checksums are recorded by the store when an object is stored, so it should
+be created with sos.WithDigests; otherwise, responses have no ETag.
+*/
+package httpd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hweidner/sos"
+)
+
+// prefix is the path prefix of the objects.
+const prefix = "/objects/"
+
+// Handler serves the objects of a store over HTTP.
+type Handler struct {
+	Store   *sos.SOS
+	MaxSize int64 // maximum size of a stored value, or 0 for no limit
+}
+
+// New returns a handler which serves the objects of the store s.
+func New(s *sos.SOS) *Handler {
+	return &Handler{Store: s}
+}
+
+// ServeHTTP handles a request on /objects/{key}.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok || key == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, key)
+	case http.MethodPut:
+		h.put(w, r, key)
+	case http.MethodDelete:
+		h.delete(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// get sends the value of an object, or only its headers on HEAD.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj, err := h.Store.GetObject(key)
+	if err != nil {
+		if errors.Is(err, sos.ErrNotFound) && r.Header.Get("If-Match") != "" {
+			// no object matches
+			writeerror(w, errPrecondition)
+			return
+		}
+		writeerror(w, err)
+		return
+	}
+	defer obj.Close()
+
+	state := objectstate(obj)
+	if status := precondition(r, state); status != 0 {
+		setheaders(w, obj, state)
+		w.WriteHeader(status)
+		return
+	}
+
+	setheaders(w, obj, state)
+	if obj.HasDigest {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Digest.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	// the status is sent already, so a failure only cuts the body short
+	_, _ = io.Copy(w, obj)
+}
+
+// put stores the request body as value of an object.
+//
+// Conditional requests are checked against the current object before the
+// body is read, and again with sos.StoreFromIf while the value replaces the
+// object, so the check is atomic among conditional requests, e.g. only one
+// of two requests with If-None-Match: * succeeds.
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, key string) {
+	state, err := h.current(key)
+	if err != nil {
+		writeerror(w, err)
+		return
+	}
+	if status := precondition(r, state); status != 0 {
+		writeerror(w, errPrecondition)
+		return
+	}
+
+	body := r.Body
+	if h.MaxSize > 0 {
+		body = http.MaxBytesReader(w, body, h.MaxSize)
+	}
+	hash := sha256.New()
+	value := io.TeeReader(body, hash)
+	meta := sos.Meta{ContentType: r.Header.Get("Content-Type")}
+	if conditional(r) {
+		stored, err := h.Store.StoreFromIf(key, value, meta, func(obj *sos.Object) bool {
+			state = objectstate(obj)
+			return precondition(r, state) == 0
+		})
+		if err == nil && !stored {
+			err = errPrecondition
+		}
+		if err != nil {
+			writeerror(w, err)
+			return
+		}
+	} else if err := h.Store.StoreFromMeta(key, value, meta); err != nil {
+		writeerror(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash.Sum(nil))+`"`)
+	if state.exists {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// delete deletes an object. Preconditions are checked atomically with
+// sos.DeleteIf, like in put.
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, key string) {
+	var err error
+	if conditional(r) {
+		var deleted bool
+		deleted, err = h.Store.DeleteIf(key, func(obj *sos.Object) bool {
+			return precondition(r, objectstate(obj)) == 0
+		})
+		if err == nil && !deleted {
+			err = errPrecondition
+		}
+	} else {
+		err = h.Store.Delete(key)
+	}
+	if err != nil {
+		writeerror(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// conditional reports whether a request has conditional headers.
+func conditional(r *http.Request) bool {
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if r.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the state of an object, for checking preconditions. A
+// missing object is not an error.
+func (h *Handler) current(key string) (state, error) {
+	obj, err := h.Store.GetObject(key)
+	if errors.Is(err, sos.ErrNotFound) {
+		return state{}, nil
+	}
+	if err != nil {
+		return state{}, err
+	}
+	defer obj.Close()
+	return objectstate(obj), nil
+}
+
+// state is the state of an object, which preconditions are checked against.
+type state struct {
+	exists  bool
+	etag    string // quoted entity tag, or empty if unknown
+	modTime time.Time
+}
+
+// objectstate returns the state of an opened object, or of a missing object
+// if obj is nil.
+func objectstate(obj *sos.Object) state {
+	if obj == nil {
+		return state{}
+	}
+	st := state{exists: true, modTime: obj.ModTime}
+	if obj.HasDigest {
+		st.etag = `"` + obj.Digest.String() + `"`
+	}
+	return st
+}
+
+// setheaders sets the response headers describing an object.
+func setheaders(w http.ResponseWriter, obj *sos.Object, st state) {
+	ct := obj.Meta.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Last-Modified", st.modTime.UTC().Format(http.TimeFormat))
+	if st.etag != "" {
+		w.Header().Set("ETag", st.etag)
+	}
+}
+
+// precondition evaluates the conditional headers of a request against the
+// state of the object, in the order of RFC 9110, section 13.2.2. It returns
+// 0 if the request is to be performed, or the status code to respond with
+// otherwise.
+func precondition(r *http.Request, st state) int {
+	readonly := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !st.exists || !etagmatch(im, st.etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius, ok := httptime(r.Header.Get("If-Unmodified-Since")); ok && st.exists {
+		if st.modTime.Truncate(time.Second).After(ius) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if st.exists && etagmatch(inm, st.etag, true) {
+			if readonly {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims, ok := httptime(r.Header.Get("If-Modified-Since")); ok && readonly && st.exists {
+		if !st.modTime.Truncate(time.Second).After(ims) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// etagmatch reports whether a list of entity tags from a conditional header
+// matches etag. "*" matches any existing object. With weak comparison, the
+// W/ prefix is ignored.
+func etagmatch(list, etag string, weak bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if etag != "" && tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// httptime parses the date of a conditional header.
+func httptime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
+
+// errPrecondition is reported when a precondition of a request fails.
+var errPrecondition = errors.New("precondition failed")
+
+// writeerror sends an error response, with a status code matching err.
+func writeerror(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errPrecondition):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, sos.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, sos.ErrExists):
+		status = http.StatusConflict
+	case errors.As(err, &maxErr):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, sos.ErrClosed), errors.Is(err, sos.ErrFrozen),
+		errors.Is(err, sos.ErrStoreUnhealthy):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,221 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package httpd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hweidner/sos"
+)
+
+// do sends a request to the server, and returns the response with its body.
+func do(t *testing.T, method, url, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+// Test storing, reading and deleting objects
+func TestHandler(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithDigests())
+	srv := httptest.NewServer(New(s))
+	defer srv.Close()
+	url := srv.URL + "/objects/dir/hello"
+
+	sum := sha256.Sum256([]byte("world"))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	resp, _ := do(t, "PUT", url, "world", map[string]string{"Content-Type": "text/plain"})
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("ETag") != etag {
+		t.Errorf("Got status %d and ETag %s from PUT, expected %d and %s", resp.StatusCode, resp.Header.Get("ETag"), http.StatusCreated, etag)
+	}
+	if obj, _ := s.GetString("dir/hello"); obj != "world" {
+		t.Errorf("Got %s from store, expected %s", obj, "world")
+	}
+
+	resp, body := do(t, "GET", url, "", nil)
+	if resp.StatusCode != http.StatusOK || body != "world" {
+		t.Errorf("Got status %d and %q from GET, expected %d and %q", resp.StatusCode, body, http.StatusOK, "world")
+	}
+	if resp.Header.Get("ETag") != etag || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("Got ETag %s and Content-Type %s, expected %s and %s", resp.Header.Get("ETag"), resp.Header.Get("Content-Type"), etag, "text/plain")
+	}
+
+	resp, body = do(t, "HEAD", url, "", nil)
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != 5 || body != "" {
+		t.Errorf("Got status %d and length %d from HEAD, expected %d and %d", resp.StatusCode, resp.ContentLength, http.StatusOK, 5)
+	}
+
+	resp, _ = do(t, "PUT", url, "again", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Got status %d from replacing PUT, expected %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	resp, _ = do(t, "DELETE", url, "", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Got status %d from DELETE, expected %d", resp.StatusCode, http.StatusNoContent)
+	}
+	for _, method := range []string{"GET", "DELETE"} {
+		if resp, _ = do(t, method, url, "", nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Got status %d from %s on a missing object, expected %d", resp.StatusCode, method, http.StatusNotFound)
+		}
+	}
+
+	if resp, _ = do(t, "POST", url, "", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Got status %d from POST, expected %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+	if resp, _ = do(t, "GET", srv.URL+"/other/hello", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Got status %d outside of /objects/, expected %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+// Test conditional requests
+func TestConditional(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithDigests())
+	srv := httptest.NewServer(New(s))
+	defer srv.Close()
+	url := srv.URL + "/objects/hello"
+
+	resp, _ := do(t, "PUT", url, "world", map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Got status %d from create-only PUT, expected %d", resp.StatusCode, http.StatusCreated)
+	}
+	etag := resp.Header.Get("ETag")
+
+	resp, _ = do(t, "PUT", url, "again", map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Got status %d from create-only PUT on an existing object, expected %d", resp.StatusCode, http.StatusPreconditionFailed)
+	}
+
+	resp, body := do(t, "GET", url, "", map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified || body != "" {
+		t.Errorf("Got status %d from GET with matching If-None-Match, expected %d", resp.StatusCode, http.StatusNotModified)
+	}
+	resp, _ = do(t, "GET", url, "", map[string]string{"If-Modified-Since": resp.Header.Get("Last-Modified")})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Got status %d from GET with If-Modified-Since, expected %d", resp.StatusCode, http.StatusNotModified)
+	}
+
+	resp, _ = do(t, "PUT", url, "again", map[string]string{"If-Match": `"other"`})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Got status %d from PUT with a different If-Match, expected %d", resp.StatusCode, http.StatusPreconditionFailed)
+	}
+	resp, _ = do(t, "PUT", url, "again", map[string]string{"If-Match": etag})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Got status %d from PUT with matching If-Match, expected %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if obj, _ := s.GetString("hello"); obj != "again" {
+		t.Errorf("Got %s from store, expected %s", obj, "again")
+	}
+
+	resp, _ = do(t, "DELETE", url, "", map[string]string{"If-Match": etag})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Got status %d from DELETE with an outdated If-Match, expected %d", resp.StatusCode, http.StatusPreconditionFailed)
+	}
+}
+
+// Test that only one of concurrent create-only requests succeeds
+func TestConditionalConcurrent(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithDigests())
+	srv := httptest.NewServer(New(s))
+	defer srv.Close()
+	url := srv.URL + "/objects/hello"
+
+	const clients = 8
+	statuses := make(chan int, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, _ := do(t, "PUT", url, fmt.Sprint("value ", i), map[string]string{"If-None-Match": "*"})
+			statuses <- resp.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusPreconditionFailed:
+		default:
+			t.Errorf("Got status %d from create-only PUT", status)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Got %d created objects, expected 1", created)
+	}
+}
+
+// Test the size limit of stored values
+func TestMaxSize(t *testing.T) {
+	s := sos.NewTemp(t)
+	srv := httptest.NewServer(&Handler{Store: s, MaxSize: 4})
+	defer srv.Close()
+
+	resp, _ := do(t, "PUT", srv.URL+"/objects/hello", "world", nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Got status %d from PUT of a large value, expected %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+	if ok, _ := s.Exists("hello"); ok {
+		t.Errorf("A value larger than the limit was stored")
+	}
+}
+
+// Test that GET and HEAD requests are observed by the hooks and metrics of
+// the store
+func TestObserved(t *testing.T) {
+	ops := make(chan sos.OpInfo, 10)
+	s := sos.NewTemp(t, sos.WithDigests(), sos.WithHooks(sos.Hooks{
+		Start: func(ctx context.Context, info sos.OpInfo) func(sos.OpInfo) {
+			return func(info sos.OpInfo) {
+				ops <- info
+			}
+		},
+	}))
+	s.StoreString("hello", "world")
+	<-ops
+	srv := httptest.NewServer(New(s))
+	defer srv.Close()
+
+	for _, method := range []string{"GET", "HEAD"} {
+		do(t, method, srv.URL+"/objects/hello", "", nil)
+		select {
+		case info := <-ops:
+			if info.Op != "Get" || info.Err != nil {
+				t.Errorf("Got operation %s (%v) for %s, expected Get", info.Op, info.Err, method)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Got no operation for %s, expected Get", method)
+		}
+	}
+}
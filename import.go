@@ -0,0 +1,231 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ConflictPolicy defines how ImportTar treats objects which already exist in
+// the store.
+type ConflictPolicy int
+
+const (
+	// ImportOverwrite replaces existing objects.
+	ImportOverwrite ConflictPolicy = iota
+	// ImportSkipExisting keeps existing objects and skips the imported ones.
+	ImportSkipExisting
+	// ImportFail aborts the import on the first existing object.
+	ImportFail
+	// ImportKeepNewer keeps the object with the newer modification time.
+	ImportKeepNewer
+)
+
+// ImportReport summarizes the result of an ImportTar operation.
+type ImportReport struct {
+	Imported    int // objects which did not exist before
+	Overwritten int // existing objects which were replaced
+	Skipped     int // imported objects which were discarded due to a conflict
+	Deleted     int // objects removed by the tombstones of the stream
+}
+
+// ImportTar reads a tar stream, as written by ExportTar, and stores the
+// contained objects in the store. Objects which already exist in the store
+// are handled according to the conflict policy. The modification times of
+// the objects are preserved. The chunks of chunked objects are verified, and
+// stored unless they exist already. The key index entries of the stream are
+// stored if the store keeps a key index (see WithKeyIndex). The deletions of
+// an incremental export are applied to objects which were not stored after
+// the deletion, regardless of the conflict policy.
+//
+// The returned report is valid even if an error occurs, and describes the
+// objects imported so far.
+func (s *SOS) ImportTar(r io.Reader, policy ConflictPolicy) (report ImportReport, err error) {
+	defer s.wraperr(&err, "Import", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Name == exportManifest {
+			continue
+		}
+		dir, hs, ok := s.tarentry(hdr.Name)
+		if !ok {
+			return report, fmt.Errorf("invalid object name %q in tar stream", hdr.Name)
+		}
+
+		switch dir {
+		case dirTombstones:
+			var removed bool
+			removed, err = s.applytombstone(hs, hdr.ModTime)
+			if removed {
+				report.Deleted++
+			}
+		case dirChunks:
+			err = s.importchunk(tr, hdr)
+		case dirIndex:
+			err = s.importindex(tr, hs)
+		default:
+			err = s.importfile(tr, hdr, policy, &report)
+		}
+		if err != nil {
+			path := filepath.Join(s.base, filepath.FromSlash(hdr.Name))
+			return report, &Error{Op: "Import", Path: path, Err: err}
+		}
+	}
+}
+
+// importfile stores a single object from the tar stream.
+func (s *SOS) importfile(tr *tar.Reader, hdr *tar.Header, policy ConflictPolicy, report *ImportReport) error {
+	filename := filepath.Join(s.base, filepath.FromSlash(hdr.Name))
+	dirname := filepath.Dir(filename)
+
+	tmpname, err := s.writetmpfile(tr, hdr)
+	if err != nil {
+		return err
+	}
+
+	if err := s.beginmodify(); err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	defer s.endmodify()
+
+	fi, err := os.Stat(filename)
+	exists := err == nil
+
+	if policy == ImportOverwrite ||
+		exists && policy == ImportKeepNewer && hdr.ModTime.After(fi.ModTime()) {
+		err = s.change(s.relhash(hdr.Name), false, func() error {
+			return s.commitfile(tmpname, dirname, filename)
+		})
+		if err != nil {
+			return err
+		}
+		if exists {
+			report.Overwritten++
+		} else {
+			report.Imported++
+		}
+		return nil
+	}
+
+	if !exists {
+		// link instead of rename, so an object which was stored in the
+		// meantime is not overwritten
+		_ = s.mkdirall(dirname)
+		err = s.change(s.relhash(hdr.Name), false, func() error {
+			return os.Link(tmpname, filename)
+		})
+		_ = os.Remove(tmpname)
+		if err == nil {
+			report.Imported++
+			return nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	} else {
+		_ = os.Remove(tmpname)
+	}
+
+	report.Skipped++
+	if policy == ImportFail {
+		return ErrExists
+	}
+	return nil
+}
+
+// importchunk verifies and stores a single chunk from the tar stream, unless
+// the chunk exists already.
+func (s *SOS) importchunk(tr *tar.Reader, hdr *tar.Header) error {
+	sum, _ := chunksum(hdr.Name)
+	tmpname, err := s.writetmpfile(tr, hdr)
+	if err != nil {
+		return err
+	}
+	return s.storechunk(tmpname, sum)
+}
+
+// storechunk verifies the chunk file tmpname from a tar stream, and stores it
+// under its hash, unless the chunk exists already. tmpname is removed.
+func (s *SOS) storechunk(tmpname, sum string) error {
+	defer os.Remove(tmpname)
+
+	if err := s.checkchunk(tmpname, sum); err != nil {
+		return err
+	}
+	return s.linkchunk(tmpname, sum)
+}
+
+// importindex reads a key index entry for the key hash hs from r, and
+// stores it if the store keeps a key index.
+func (s *SOS) importindex(r io.Reader, hs string) error {
+	key, err := s.readindexentry(r, hs)
+	if err != nil || !s.keyIndex {
+		return err
+	}
+	return s.writeindex(key)
+}
+
+// readindexentry reads a key index entry for the key hash hs from r, and
+// returns the key. If the key does not match the hash, e.g. as the entry
+// comes from a store with another hash function, an error wrapping
+// ErrCorrupt is returned.
+func (s *SOS) readindexentry(r io.Reader, hs string) (string, error) {
+	key, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if s.keyhash(string(key)) != hs {
+		return "", fmt.Errorf("%w: index entry does not match its key", ErrCorrupt)
+	}
+	return string(key), nil
+}
+
+// writetmpfile writes an object file from a tar stream unmodified to a
+// temporary file, with the modification time and the extended attributes
+// from the tar header. The object file already holds the encoded value, so
+// no transformations are applied.
+func (s *SOS) writetmpfile(r io.Reader, hdr *tar.Header) (string, error) {
+	tmpname := s.tmpfilename()
+	wr, err := s.createfile(tmpname)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(wr, r)
+	if cerr := wr.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(tmpname, hdr.ModTime, hdr.ModTime)
+	}
+	if err == nil {
+		err = setpaxxattrs(tmpname, hdr)
+	}
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return "", err
+	}
+	return tmpname, nil
+}
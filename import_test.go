@@ -0,0 +1,81 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// Test tar imports with the different conflict policies
+func TestImport(t *testing.T) {
+	src, _ := New("./._sostest_src")
+	defer src.Destroy()
+
+	src.StoreString("a", "new a")
+	src.StoreString("b", "new b")
+	export := new(bytes.Buffer)
+	if err := src.ExportTar(export); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+
+	tests := []struct {
+		policy     ConflictPolicy
+		fail       bool
+		report     ImportReport
+		valA, valB string
+	}{
+		{ImportOverwrite, false, ImportReport{Imported: 1, Overwritten: 1}, "new a", "new b"},
+		{ImportSkipExisting, false, ImportReport{Imported: 1, Skipped: 1}, "new a", "old b"},
+		{ImportFail, true, ImportReport{Skipped: 1}, "", "old b"},
+		{ImportKeepNewer, false, ImportReport{Imported: 1, Overwritten: 1}, "new a", "new b"},
+	}
+
+	for _, tc := range tests {
+		s, _ := New("./._sostest")
+
+		// b exists in the destination, with an old modification time
+		s.StoreString("b", "old b")
+		_, bname := s.getpath("b")
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(bname, old, old)
+
+		report, err := s.ImportTar(bytes.NewReader(export.Bytes()), tc.policy)
+		if (err != nil) != tc.fail {
+			t.Errorf("Policy %d: got error %v, expected failure %v", tc.policy, err, tc.fail)
+		}
+		if !tc.fail && report != tc.report {
+			t.Errorf("Policy %d: got report %+v, expected %+v", tc.policy, report, tc.report)
+		}
+
+		a, _ := s.GetString("a")
+		b, _ := s.GetString("b")
+		if !tc.fail && a != tc.valA || b != tc.valB {
+			t.Errorf("Policy %d: got values %q, %q, expected %q, %q", tc.policy, a, b, tc.valA, tc.valB)
+		}
+
+		s.Destroy()
+	}
+}
+
+// Test that transformed objects are imported unmodified
+func TestImportTransformed(t *testing.T) {
+	opts := []Option{WithReadTransform(FlagUser, xorRead), WithWriteTransform(FlagUser, xorWrite)}
+	src := NewTemp(t, opts...)
+	src.StoreString("key", "value")
+	export := new(bytes.Buffer)
+	src.ExportTar(export)
+
+	dst := NewTemp(t, opts...)
+	if _, err := dst.ImportTar(export, ImportOverwrite); err != nil {
+		t.Fatalf("ImportTar failed: %v", err)
+	}
+	if obj, _ := dst.GetString("key"); obj != "value" {
+		t.Errorf("Got %q from store, expected %q", obj, "value")
+	}
+}
@@ -0,0 +1,90 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// The key index keeps the original key of objects in the directory .index,
+// in a file named like the object file. As the key of a given hash never
+// changes, an index entry is written once and never updated. It is removed
+// when the object is deleted.
+
+// indexpath returns the directory and file name of the index entry for a
+// given hex encoded key hash.
+func (s *SOS) indexpath(hs string) (dirname, filename string) {
+	return s.shardpath(s.base+"/"+dirIndex, hs)
+}
+
+// writeindex creates the index entry for key, if it does not exist yet. If
+// an entry with a different key exists, ErrCollision is returned.
+func (s *SOS) writeindex(key string) error {
+	dirname, filename := s.indexpath(s.keyhash(key))
+
+	stored, err := os.ReadFile(filename)
+	if err == nil {
+		return checkcollision(key, stored)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	tmpname := s.tmpfilename()
+	if err := s.writefile(tmpname, []byte(key)); err != nil {
+		return err
+	}
+	defer os.Remove(tmpname)
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	// link instead of rename, so a concurrently written entry is not
+	// replaced
+	_ = s.mkdirall(dirname)
+	err = os.Link(tmpname, filename)
+	if errors.Is(err, fs.ErrExist) {
+		stored, err = os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		return checkcollision(key, stored)
+	}
+	return err
+}
+
+// checkindex verifies that the index entry for key, if there is one, holds
+// the key. Objects without index entry are accepted.
+func (s *SOS) checkindex(key string) error {
+	_, filename := s.indexpath(s.keyhash(key))
+
+	stored, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return checkcollision(key, stored)
+}
+
+// removeindex removes the index entry for key.
+func (s *SOS) removeindex(key string) {
+	_, filename := s.indexpath(s.keyhash(key))
+	_ = os.Remove(filename)
+}
+
+// checkcollision compares a key to the key stored in an index entry.
+func checkcollision(key string, stored []byte) error {
+	if string(stored) != key {
+		return ErrCollision
+	}
+	return nil
+}
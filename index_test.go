@@ -0,0 +1,98 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// Test the detection of hash collisions
+func TestCollisionCheck(t *testing.T) {
+	s := NewTemp(t, WithCollisionCheck())
+
+	if err := s.StoreString("hello", "world"); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if obj, err := s.GetString("hello"); err != nil || obj != "world" {
+		t.Errorf("Got %s, %v from store, expected %s", obj, err, "world")
+	}
+
+	// fake a collision by changing the key in the index entry
+	_, filename := s.indexpath(s.keyhash("hello"))
+	os.WriteFile(filename, []byte("other key"), 0o600)
+
+	if _, err := s.GetString("hello"); !errors.Is(err, ErrCollision) {
+		t.Errorf("Got error %v on Get, expected %v", err, ErrCollision)
+	}
+	if err := s.StoreString("hello", "world"); !errors.Is(err, ErrCollision) {
+		t.Errorf("Got error %v on Store, expected %v", err, ErrCollision)
+	}
+
+	s.Delete("hello")
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Index entry was not removed on Delete")
+	}
+}
+
+// Test that exports, copies, syncs and mirrors carry the key index
+func TestIndexTransfer(t *testing.T) {
+	src := NewTemp(t, WithKeyIndex())
+	src.StoreString("a", "value")
+	src.StoreString("b", "value")
+	expected := []string{"a", "b"}
+
+	export := new(bytes.Buffer)
+	if err := src.ExportTar(export); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+
+	check := func(name string, dst *SOS, expected []string) {
+		t.Helper()
+		if keys, err := dst.List(""); err != nil || !reflect.DeepEqual(keys, expected) {
+			t.Errorf("Got keys %v (%v) after %s, expected %v", keys, err, name, expected)
+		}
+	}
+
+	restored := NewTemp(t, WithKeyIndex())
+	if _, err := restored.Restore(bytes.NewReader(export.Bytes()), true); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	check("Restore", restored, expected)
+
+	imported := NewTemp(t, WithKeyIndex())
+	if _, err := imported.ImportTar(bytes.NewReader(export.Bytes()), ImportOverwrite); err != nil {
+		t.Fatalf("ImportTar failed: %v", err)
+	}
+	check("ImportTar", imported, expected)
+
+	copied := NewTemp(t, WithKeyIndex(), WithShardDepth(1))
+	if err := src.CopyTo(copied, nil); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	check("CopyTo", copied, expected)
+
+	synced := NewTemp(t, WithKeyIndex())
+	if _, err := src.Sync(synced, nil); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	check("Sync", synced, expected)
+
+	// deletions remove the index entries
+	src.Delete("a")
+	if _, err := src.Sync(synced, nil); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	check("Sync of a deletion", synced, []string{"b"})
+	m := &Mirror{Source: src, Replica: copied}
+	if err := m.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	check("Mirror", copied, []string{"b"})
+}
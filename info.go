@@ -0,0 +1,89 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ObjectInfo describes an object in the store.
+type ObjectInfo struct {
+	Hash    string    // hex encoded hash of the key
+	Size    int64     // size of the object file
+	ModTime time.Time // time of the last Store or Touch
+}
+
+// Stat returns the metadata of an object, without reading its value. If the
+// key does not exist, or the object has expired, ErrNotFound is returned.
+//
+// The size is the size of the object file. For transformed or chunked values,
+// it differs from the size of the value.
+func (s *SOS) Stat(key string) (info ObjectInfo, err error) {
+	defer s.wraperr(&err, "Stat", key)
+
+	if err := s.begin(); err != nil {
+		return info, err
+	}
+	defer s.end()
+
+	if s.collisionCheck {
+		if err := s.checkindex(key); err != nil {
+			return info, err
+		}
+	}
+
+	return s.statobject(s.keyhash(key))
+}
+
+// Exists reports whether the key exists in the store, without reading its
+// value. An error is returned only if the existence cannot be determined.
+func (s *SOS) Exists(key string) (bool, error) {
+	_, err := s.Stat(key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// statobject returns the ObjectInfo for the object with the hex encoded key
+// hash hs. Only the header of the object file is read, to check its expiry.
+func (s *SOS) statobject(hs string) (ObjectInfo, error) {
+	_, filename := s.hashpath(hs)
+	fh, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer fh.Close()
+
+	h, err := readheader(bufio.NewReader(fh))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if h != nil && s.expired(h) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return newinfo(hs, fi), nil
+}
+
+// newinfo returns the ObjectInfo for an object file.
+func newinfo(hash string, fi fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Hash:    hash,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}
+}
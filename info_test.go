@@ -0,0 +1,42 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test probing objects without reading them
+func TestStat(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+	s.StoreString("key", "value")
+
+	info, err := s.Stat("key")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Hash != s.keyhash("key") || info.Size != 5 || !info.ModTime.Equal(clock.Now()) {
+		t.Errorf("Got info %+v, expected hash, size 5 and time %v", info, clock.Now())
+	}
+	if _, err := s.Stat("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for a missing key, expected %v", err, ErrNotFound)
+	}
+
+	if ok, err := s.Exists("key"); !ok || err != nil {
+		t.Errorf("Got %v, %v for an existing key, expected true", ok, err)
+	}
+	if ok, err := s.Exists("missing"); ok || err != nil {
+		t.Errorf("Got %v, %v for a missing key, expected false", ok, err)
+	}
+
+	s.Close()
+	if _, err := s.Exists("key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got error %v on a closed store, expected %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,144 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path/filepath"
+)
+
+// DigestReport summarizes the result of a VerifyAll operation.
+type DigestReport struct {
+	Objects  int      // objects which were found
+	Verified int      // objects whose value matches the digest
+	NoDigest int      // objects without a digest, which cannot be verified
+	Corrupt  []string // object files whose value does not match the digest
+}
+
+// WithVerifyOnRead checks each value against its digest while it is read, to
+// detect bit rot on Get. If the value does not match, the read fails with
+// ErrCorrupt at the end of the value. As the value is streamed, a part or
+// all of it may have been passed on already, e.g. by GetTo. Values which are
+// not read to the end are not verified.
+//
+// The option implies WithDigests. Objects stored without a digest are read
+// without verification, see AdoptLegacy for recording the missing digests.
+func WithVerifyOnRead() Option {
+	return func(s *SOS) {
+		s.digests = true
+		s.verifyOnRead = true
+	}
+}
+
+// VerifyKey reads the value of an object, and checks it against its digest.
+// It returns ErrCorrupt if the value does not match, and ErrNoDigest if the
+// object was stored without a digest.
+func (s *SOS) VerifyKey(key string) (err error) {
+	defer s.wraperr(&err, "VerifyKey", key)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	fh, err := s.open(key)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	return s.verifydigest(fh)
+}
+
+// VerifyAll reads the values of all objects, and checks them against their
+// digests, like VerifyKey. Objects whose value does not match, or which
+// cannot be decoded, are reported as corrupt. The object paths in the report
+// are relative to the base directory.
+//
+// Unlike Verify, VerifyAll does not depend on manifests, so it also detects
+// values which were corrupted before they were first verified, but it reads
+// all objects every time. The operation stops when ctx is cancelled.
+func (s *SOS) VerifyAll(ctx context.Context) (report DigestReport, err error) {
+	defer s.wraperr(&err, "VerifyAll", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	err = s.walk(func(rel string, fi fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fh, err := s.openfile(filepath.Join(s.base, filepath.FromSlash(rel)))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // deleted in the meantime
+		}
+		if err != nil {
+			return err
+		}
+		err = s.verifydigest(fh)
+		_ = fh.Close()
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return nil // expired
+		case errors.Is(err, ErrNoDigest):
+			report.NoDigest++
+		case errors.Is(err, ErrCorrupt):
+			report.Corrupt = append(report.Corrupt, rel)
+		case err != nil:
+			return err
+		default:
+			report.Verified++
+		}
+		report.Objects++
+		return nil
+	})
+	return report, err
+}
+
+// verifydigest reads the value of the object file fh, and checks it against
+// its digest.
+func (s *SOS) verifydigest(fh io.Reader) error {
+	h, rd, err := s.decodevalue(fh)
+	if err != nil {
+		return err
+	}
+	d, ok := headerdigest(h)
+	if !ok {
+		return ErrNoDigest
+	}
+	_, err = io.Copy(io.Discard, &digestReader{r: rd, want: d, hash: sha256.New()})
+	return err
+}
+
+// digestReader checks the data read from r against a digest. At the end of
+// the data, it returns ErrCorrupt instead of io.EOF on a mismatch.
+type digestReader struct {
+	r    io.Reader
+	want Digest
+	hash hash.Hash
+	n    int64
+}
+
+// Read reads from the underlying reader, and checks the digest at the end.
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.hash.Write(p[:n])
+	d.n += int64(n)
+	if err == io.EOF && (d.n != d.want.Size || !bytes.Equal(d.hash.Sum(nil), d.want.SHA256[:])) {
+		err = fmt.Errorf("%w: value does not match its digest", ErrCorrupt)
+	}
+	return n, err
+}
@@ -0,0 +1,79 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// corrupt flips a bit in the last byte of the object file of key.
+func corrupt(t *testing.T, s *SOS, key string) {
+	t.Helper()
+	_, filename := s.getpath(key)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading object file: %v", err)
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatalf("Error writing object file: %v", err)
+	}
+}
+
+// Test detecting corrupted values on read
+func TestVerifyOnRead(t *testing.T) {
+	s := NewTemp(t, WithVerifyOnRead())
+	s.StoreString("key", "value")
+	if v, err := s.GetString("key"); err != nil || v != "value" {
+		t.Errorf("Got %q (%v) from store, expected %q", v, err, "value")
+	}
+
+	corrupt(t, s, "key")
+	if _, err := s.Get("key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Got %v for corrupted value, expected ErrCorrupt", err)
+	}
+
+	// without the option, the corruption goes unnoticed
+	s2, _ := New(s.base)
+	if v, err := s2.GetString("key"); err != nil || v != "valud" {
+		t.Errorf("Got %q (%v) from store without verification, expected %q", v, err, "valud")
+	}
+}
+
+// Test verifying single objects and the whole store
+func TestVerifyKey(t *testing.T) {
+	s := NewTemp(t, WithDigests())
+	s.StoreString("good", "value")
+	s.StoreString("bad", "value")
+	corrupt(t, s, "bad")
+
+	s2, _ := New(s.base)
+	s2.StoreString("plain", "value")
+
+	if err := s.VerifyKey("good"); err != nil {
+		t.Errorf("Got %v for good object, expected no error", err)
+	}
+	if err := s.VerifyKey("bad"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Got %v for corrupted object, expected ErrCorrupt", err)
+	}
+	if err := s.VerifyKey("plain"); !errors.Is(err, ErrNoDigest) {
+		t.Errorf("Got %v for object without digest, expected ErrNoDigest", err)
+	}
+	if err := s.VerifyKey("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for missing object, expected ErrNotFound", err)
+	}
+
+	report, err := s.VerifyAll(context.Background())
+	if err != nil {
+		t.Fatalf("Error in VerifyAll: %v", err)
+	}
+	if report.Objects != 3 || report.Verified != 1 || report.NoDigest != 1 || len(report.Corrupt) != 1 {
+		t.Errorf("Got %+v from VerifyAll, expected 3 objects, 1 verified, 1 without digest and 1 corrupt", report)
+	}
+}
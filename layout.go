@@ -0,0 +1,133 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// layoutVersion is the version of the layout file format.
+const layoutVersion = 1
+
+// layout returns the content of the layout file for the options of the
+// store, which determine the location of the object files. The hash function
+// is identified by the hash of the empty key.
+func (s *SOS) layout() string {
+	return fmt.Sprintf("sos layout %d\nshards %d\nhash %s\nsuffix %s\n",
+		layoutVersion, s.shardDepth, s.keyhash(""), strconv.Quote(s.suffix))
+}
+
+// initlayout records the layout options in the layout file, if the store
+// does not have one yet, or checks them against the recorded ones otherwise.
+// The file is written completely under a temporary name, and then linked to
+// its final name, which fails if it exists. So, if several processes create
+// the same store at the same time, exactly one of them records its options,
+// and the others never see a partial file, but compare their options with
+// the winner's.
+func (s *SOS) initlayout() error {
+	want := s.layout()
+	filename := filepath.Join(s.base, fileLayout)
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = s.createlayout(filename, want)
+	}
+	if err != nil {
+		return err
+	}
+	return checklayout(string(data), want)
+}
+
+// createlayout creates the layout file with the given content. If another
+// process created it in the meantime, its content is returned instead.
+func (s *SOS) createlayout(filename, content string) ([]byte, error) {
+	tmpname := s.tmpfilename()
+	fh, err := s.createfile(tmpname)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fh.WriteString(content)
+	if err == nil {
+		err = s.syncfile(fh)
+	}
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Link(tmpname, filename)
+	}
+	_ = os.Remove(tmpname)
+
+	if errors.Is(err, fs.ErrExist) {
+		return os.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), s.syncentry(s.base)
+}
+
+// checklayout compares the recorded layout with the wanted one, and reports
+// the first option which differs.
+func checklayout(got, want string) error {
+	gotLines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	wantLines := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	for i, w := range wantLines {
+		g := ""
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if g != w {
+			return fmt.Errorf("%w: %s records %q, options give %q", ErrLayoutMismatch, fileLayout, g, w)
+		}
+	}
+	return nil
+}
+
+// checkcompatible reports an error, unless the object files of the store can
+// be copied unmodified into the store dst: both stores must hash the keys
+// with the same function, as the files are placed by the key hash, and dst
+// must hold all encryption keys of the store, so it can read the values. The
+// shard depth and the suffix may differ.
+func (s *SOS) checkcompatible(dst *SOS) error {
+	src, err := os.ReadFile(filepath.Join(s.base, fileLayout))
+	if err != nil {
+		return err
+	}
+	other, err := os.ReadFile(filepath.Join(dst.base, fileLayout))
+	if err != nil {
+		return err
+	}
+	if want, got := layoutfield(string(src), "hash"), layoutfield(string(other), "hash"); got != want {
+		return fmt.Errorf("%w: %s hashes keys differently", ErrLayoutMismatch, dst.base)
+	}
+
+	if s.keyring == nil {
+		return nil
+	}
+	for id := range s.keyring.keys {
+		if dst.keyring == nil || dst.keyring.keys[id] == nil {
+			return fmt.Errorf("%w: encryption key with ID %x missing in %s", ErrLayoutMismatch, id, dst.base)
+		}
+	}
+	return nil
+}
+
+// layoutfield returns the value of a field of a layout file.
+func layoutfield(layout, name string) string {
+	for _, line := range strings.Split(layout, "\n") {
+		if v, ok := strings.CutPrefix(line, name+" "); ok {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Test that concurrent New calls on the same path agree on the layout
+func TestNewConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sos")
+
+	const n = 16
+	stores := make([]*SOS, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stores[i], errs[i] = New(path, WithCounters(), WithShardDepth(1))
+			if errs[i] == nil {
+				errs[i] = stores[i].StoreString(fmt.Sprintf("key%d", i), "value")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Error in instance %d: %v", i, err)
+		}
+	}
+	for _, s := range stores {
+		if err := s.Close(); err != nil {
+			t.Errorf("Error closing store: %v", err)
+		}
+	}
+
+	s, err := New(path, WithCounters(), WithShardDepth(1))
+	if err != nil {
+		t.Fatalf("Error reopening store: %v", err)
+	}
+	defer s.Destroy()
+	if data, _ := os.ReadFile(filepath.Join(path, fileLayout)); string(data) != s.layout() {
+		t.Errorf("Got layout %q, expected %q", data, s.layout())
+	}
+	if s.legacy.Load() {
+		t.Errorf("Got store taken for a legacy one")
+	}
+	if c, err := s.Count(); err != nil || c != n {
+		t.Errorf("Got count %d (%v), expected %d", c, err, n)
+	}
+}
+
+// Test that New rejects options which do not match the layout of the store
+func TestNewLayoutMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sos")
+	s, err := New(path, WithSuffix(".obj"))
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+	defer s.Destroy()
+
+	for name, opts := range map[string][]Option{
+		"shard depth": {WithSuffix(".obj"), WithShardDepth(3)},
+		"suffix":      {},
+		"hash":        {WithSuffix(".obj"), WithHash(sha512.New)},
+	} {
+		if _, err := New(path, opts...); !errors.Is(err, ErrLayoutMismatch) {
+			t.Errorf("Got %v for other %s, expected ErrLayoutMismatch", err, name)
+		}
+	}
+
+	if s2, err := New(path, WithSuffix(".obj"), WithKeyIndex()); err != nil {
+		t.Errorf("Got %v for matching layout, expected no error", err)
+	} else {
+		s2.Close()
+	}
+}
@@ -0,0 +1,165 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Claim marks an object as being processed by this store instance, for the
+// duration ttl. It returns true if the claim succeeded, and false if another
+// instance holds a lease on the object which has not expired yet. Claiming
+// an object again from the same instance renews the lease. This allows
+// several workers, possibly on different hosts, to scan a shared store
+// without processing the same object twice.
+//
+// The lease is kept in a separate file, so the object itself is not changed.
+// It ends when it expires, or when it is released with Release. Expired
+// leases are taken over atomically, so at most one of several competing
+// workers succeeds.
+func (s *SOS) Claim(key string, ttl time.Duration) (_ bool, err error) {
+	defer s.wraperr(&err, "Claim", key)
+
+	if err := s.begin(); err != nil {
+		return false, err
+	}
+	defer s.end()
+
+	_, objname := s.getpath(key)
+	if _, err := os.Stat(objname); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, ErrNotFound
+		}
+		return false, err
+	}
+
+	if err := s.beginmodify(); err != nil {
+		return false, err
+	}
+	defer s.endmodify()
+
+	expires := s.clock.Now().Add(ttl)
+	tmpname := s.tmpfilename()
+	lease := fmt.Sprintf("%s %d\n", s.instanceID, expires.UnixNano())
+	if err := s.writefile(tmpname, []byte(lease)); err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpname)
+
+	dirname, filename := s.leasepath(s.keyhash(key))
+	_ = s.mkdirall(dirname)
+
+	// try twice: if an expired lease is broken, the second attempt takes
+	// the object over
+	for i := 0; i < 2; i++ {
+		// link instead of rename, so a lease of another instance is not
+		// replaced
+		err := os.Link(tmpname, filename)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+
+		owner, until, fi, err := readlease(filename)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // released in the meantime
+		}
+		if err != nil {
+			return false, err
+		}
+		if owner == s.instanceID {
+			return true, os.Rename(tmpname, filename)
+		}
+		if s.clock.Now().Before(until) {
+			return false, nil
+		}
+		if err := s.breaklease(filename, fi); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Release ends the lease of this store instance on an object. It does
+// nothing if the object is not claimed, or claimed by another instance.
+func (s *SOS) Release(key string) (err error) {
+	defer s.wraperr(&err, "Release", key)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	_, filename := s.leasepath(s.keyhash(key))
+	owner, _, fi, err := readlease(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil || owner != s.instanceID {
+		return err
+	}
+	return s.breaklease(filename, fi)
+}
+
+// leasepath returns the directory and file name of the lease of an object,
+// given the hex encoded hash of its key.
+func (s *SOS) leasepath(hs string) (dirname, filename string) {
+	return s.shardpath(s.base+"/"+dirLeases, hs)
+}
+
+// readlease reads the owner and the expiry time of a lease file.
+func readlease(filename string) (owner string, until time.Time, fi fs.FileInfo, err error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	defer fh.Close()
+
+	if fi, err = fh.Stat(); err != nil {
+		return "", time.Time{}, nil, err
+	}
+	var nanos int64
+	if _, err := fmt.Fscanf(fh, "%s %d\n", &owner, &nanos); err != nil {
+		return "", time.Time{}, nil, fmt.Errorf("%w: lease %s", ErrCorrupt, filename)
+	}
+	return owner, time.Unix(0, nanos), fi, nil
+}
+
+// breaklease removes the lease file, if it is still the file described by
+// fi. The file is first moved to a private name, so that a lease which was
+// taken by another instance in the meantime is not lost.
+func (s *SOS) breaklease(filename string, fi fs.FileInfo) error {
+	tmpname := s.tmpfilename()
+	err := os.Rename(filename, tmpname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpname)
+
+	moved, err := os.Stat(tmpname)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(fi, moved) {
+		// a new lease was taken in the meantime: put it back
+		_ = os.Link(tmpname, filename)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test claiming objects by several workers
+func TestClaim(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	dir := t.TempDir()
+	worker1, _ := New(dir, WithClock(clock))
+	worker2, _ := New(dir, WithClock(clock))
+	worker1.StoreString("job", "data")
+
+	if ok, err := worker1.Claim("job", time.Minute); !ok || err != nil {
+		t.Fatalf("Claim failed: %v, %v", ok, err)
+	}
+	if ok, _ := worker2.Claim("job", time.Minute); ok {
+		t.Errorf("Second worker claimed a leased object")
+	}
+	if ok, _ := worker1.Claim("job", time.Minute); !ok {
+		t.Errorf("Renewing the lease failed")
+	}
+
+	// expired leases are taken over
+	clock.Advance(2 * time.Minute)
+	if ok, _ := worker2.Claim("job", time.Minute); !ok {
+		t.Errorf("Second worker could not claim an expired lease")
+	}
+	worker1.Release("job") // not the owner, does nothing
+	if ok, _ := worker1.Claim("job", time.Minute); ok {
+		t.Errorf("First worker claimed an object leased by the second worker")
+	}
+
+	worker2.Release("job")
+	if ok, _ := worker1.Claim("job", time.Minute); !ok {
+		t.Errorf("First worker could not claim a released object")
+	}
+
+	if _, err := worker1.Claim("missing", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v when claiming a missing key, expected %v", err, ErrNotFound)
+	}
+}
+
+// Test that exactly one of several concurrent workers claims an object
+func TestClaimConcurrent(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("job", "data")
+
+	var claimed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, _ := New(s.base)
+			if ok, err := w.Claim("job", time.Minute); ok && err == nil {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed != 1 {
+		t.Errorf("Object was claimed %d times, expected once", claimed)
+	}
+}
@@ -0,0 +1,174 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// defaultMonitorInterval is the default time between two checks of a limit
+// monitor.
+const defaultMonitorInterval = 5 * time.Minute
+
+// Names of the soft limits, as passed in LimitEvent.Limit.
+const (
+	LimitBytes   = "bytes"
+	LimitObjects = "objects"
+	LimitInodes  = "inodes"
+	LimitTempAge = "tempAge"
+)
+
+// SoftLimits are thresholds of a store, which are watched by a LimitMonitor.
+// Unlike hard limits, they do not fail any operation, but warn before the
+// store or the file system runs full. A zero field disables the limit.
+type SoftLimits struct {
+	Bytes   int64         // total size of the object files
+	Objects int64         // number of objects
+	Inodes  float64       // used fraction of the inodes of the file system, e.g. 0.9
+	TempAge time.Duration // age of the oldest temporary file
+}
+
+// LimitStatus holds the values, which are compared to the soft limits. Only
+// the values of enabled limits are measured.
+type LimitStatus struct {
+	Bytes   int64
+	Objects int64
+	Inodes  float64
+	TempAge time.Duration
+}
+
+// LimitEvent reports that a soft limit was crossed.
+type LimitEvent struct {
+	Time     time.Time
+	Limit    string      // name of the limit, e.g. LimitBytes
+	Exceeded bool        // true when the limit was exceeded, false when the value fell below again
+	Status   LimitStatus // values at the time of the check
+}
+
+// LimitMonitor checks the soft limits of a store periodically, and reports
+// each crossing of a threshold once, in either direction. The crossings are
+// passed to OnCross, and are sent to the event sink of the store (see
+// WithEventSink) as events with the operation "LimitExceeded" or
+// "LimitCleared" and the name of the limit as key.
+//
+// The size and the number of objects are measured by scanning all object
+// files, so the interval should not be too short for large stores.
+type LimitMonitor struct {
+	Store    *SOS             // store to watch
+	Limits   SoftLimits       // thresholds
+	Interval time.Duration    // time between checks, default five minutes
+	OnCross  func(LimitEvent) // optional, receives the crossings
+	OnError  func(error)      // optional, receives the errors of failed checks
+
+	mu       sync.Mutex
+	exceeded map[string]bool
+}
+
+// Check measures the values of the enabled limits, and reports the limits
+// which were crossed since the last check. The first check reports all
+// exceeded limits.
+func (m *LimitMonitor) Check() (status LimitStatus, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, l := m.Store, m.Limits
+	if l.Bytes > 0 || l.Objects > 0 {
+		if status.Objects, status.Bytes, err = s.footprint(); err != nil {
+			return status, err
+		}
+	}
+	if l.Inodes > 0 {
+		used, total, err := s.InodeUsage()
+		if err != nil {
+			return status, err
+		}
+		if total > 0 {
+			status.Inodes = float64(used) / float64(total)
+		}
+	}
+	if l.TempAge > 0 {
+		info, err := s.TempStats()
+		if err != nil {
+			return status, err
+		}
+		status.TempAge = info.Oldest
+	}
+
+	if m.exceeded == nil {
+		m.exceeded = make(map[string]bool)
+	}
+	now := s.clock.Now()
+	for _, c := range []struct {
+		name     string
+		enabled  bool
+		exceeded bool
+	}{
+		{LimitBytes, l.Bytes > 0, status.Bytes > l.Bytes},
+		{LimitObjects, l.Objects > 0, status.Objects > l.Objects},
+		{LimitInodes, l.Inodes > 0, status.Inodes > l.Inodes},
+		{LimitTempAge, l.TempAge > 0, status.TempAge > l.TempAge},
+	} {
+		if !c.enabled || c.exceeded == m.exceeded[c.name] {
+			continue
+		}
+		m.exceeded[c.name] = c.exceeded
+
+		op := "LimitCleared"
+		if c.exceeded {
+			op = "LimitExceeded"
+		}
+		s.notify(op, c.name, 0)
+		if m.OnCross != nil {
+			m.OnCross(LimitEvent{Time: now, Limit: c.name, Exceeded: c.exceeded, Status: status})
+		}
+	}
+	return status, nil
+}
+
+// Run checks the limits immediately, and then periodically until the context
+// is cancelled. Failed checks are reported to OnError, but do not stop the
+// monitor. Run returns the error of the context.
+func (m *LimitMonitor) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = defaultMonitorInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Check(); err != nil && m.OnError != nil {
+			m.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// footprint returns the number of objects and the total size of the object
+// files in the store.
+func (s *SOS) footprint() (objects, bytes int64, err error) {
+	defer s.wraperr(&err, "footprint", "")
+
+	if err := s.begin(); err != nil {
+		return 0, 0, err
+	}
+	defer s.end()
+
+	err = s.walk(func(rel string, fi fs.FileInfo) error {
+		objects++
+		bytes += fi.Size()
+		return nil
+	})
+	return objects, bytes, err
+}
@@ -0,0 +1,89 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that crossings of soft limits are reported once, in both directions
+func TestLimitMonitor(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var events []Event
+	s := NewTemp(t, WithClock(clock), WithEventSink(EventFunc(func(e Event) {
+		events = append(events, e)
+	})))
+
+	var crossings []LimitEvent
+	m := &LimitMonitor{
+		Store:  s,
+		Limits: SoftLimits{Objects: 2, Bytes: 1000, TempAge: time.Hour},
+		OnCross: func(e LimitEvent) {
+			crossings = append(crossings, e)
+		},
+	}
+
+	s.StoreString("a", "value")
+	s.StoreString("b", "value")
+	status, err := m.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Objects != 2 || status.Bytes != 10 || len(crossings) != 0 {
+		t.Errorf("Got %d objects, %d bytes and %d crossings, expected %d, %d and %d", status.Objects, status.Bytes, len(crossings), 2, 10, 0)
+	}
+
+	s.StoreString("c", "value")
+	m.Check()
+	m.Check()
+	if len(crossings) != 1 || crossings[0].Limit != LimitObjects || !crossings[0].Exceeded {
+		t.Fatalf("Got crossings %+v, expected objects exceeded once", crossings)
+	}
+	if len(events) != 4 || events[3].Op != "LimitExceeded" || events[3].Key != LimitObjects {
+		t.Errorf("Got events %+v, expected LimitExceeded for %s", events, LimitObjects)
+	}
+
+	// a left over temporary file, which gets too old
+	if err := os.WriteFile(filepath.Join(s.tmpdir(), "leftover"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(2 * time.Hour)
+	s.Delete("c")
+	m.Check()
+	if len(crossings) != 3 {
+		t.Fatalf("Got %d crossings, expected %d", len(crossings), 3)
+	}
+	for i, want := range []LimitEvent{{Limit: LimitObjects, Exceeded: false}, {Limit: LimitTempAge, Exceeded: true}} {
+		if got := crossings[1+i]; got.Limit != want.Limit || got.Exceeded != want.Exceeded {
+			t.Errorf("Got crossing of %s (exceeded %v), expected %s (exceeded %v)", got.Limit, got.Exceeded, want.Limit, want.Exceeded)
+		}
+	}
+	if crossings[2].Status.TempAge < time.Hour {
+		t.Errorf("Got temp file age %v, expected more than %v", crossings[2].Status.TempAge, time.Hour)
+	}
+}
+
+// Test the inode limit
+func TestLimitInodes(t *testing.T) {
+	s := NewTemp(t)
+	used, total, err := s.InodeUsage()
+	if err != nil || total == 0 || used == 0 {
+		t.Skip("no inode information on this file system")
+	}
+
+	exceeded := false
+	m := &LimitMonitor{
+		Store:   s,
+		Limits:  SoftLimits{Inodes: float64(used) / float64(total) / 2},
+		OnCross: func(e LimitEvent) { exceeded = e.Exceeded },
+	}
+	if status, err := m.Check(); err != nil || status.Inodes <= 0 || !exceeded {
+		t.Errorf("Got inode usage %v (%v), expected an exceeded limit", status.Inodes, err)
+	}
+}
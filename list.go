@@ -0,0 +1,93 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WithKeyIndex records the original key of each stored object in the key
+// index, so the keys can be enumerated with List and Iterate. It costs an
+// additional small file per object. WithCollisionCheck implies WithKeyIndex.
+//
+// Objects which were stored without key index are not enumerated.
+func WithKeyIndex() Option {
+	return func(s *SOS) {
+		s.keyIndex = true
+	}
+}
+
+// Iterate calls fn for each object in the key index whose key starts with
+// prefix, together with the metadata of the object. The keys are passed in
+// no particular order. If fn returns an error, the iteration stops and the
+// error is returned.
+//
+// Only objects stored with WithKeyIndex or WithCollisionCheck are found, and
+// expired objects are skipped. Objects stored or deleted during the iteration may or may not be passed
+// to fn.
+func (s *SOS) Iterate(prefix string, fn func(key string, info ObjectInfo) error) (err error) {
+	defer s.wraperr(&err, "Iterate", "")
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	indexdir := filepath.Join(s.base, dirIndex)
+	return filepath.WalkDir(indexdir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(indexdir, name)
+		hs := strings.ReplaceAll(filepath.ToSlash(rel), "/", "")
+		if len(hs) != s.hashlen() {
+			return nil // not an index entry
+		}
+		key, err := os.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // deleted in the meantime
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(string(key), prefix) {
+			return nil
+		}
+
+		info, err := s.statobject(hs)
+		if errors.Is(err, ErrNotFound) {
+			return nil // expired, or removed externally
+		}
+		if err != nil {
+			return err
+		}
+		return fn(string(key), info)
+	})
+}
+
+// List returns the keys of all objects in the key index which start with
+// prefix, in sorted order. See Iterate for the limitations.
+func (s *SOS) List(prefix string) ([]string, error) {
+	var keys []string
+	err := s.Iterate(prefix, func(key string, info ObjectInfo) error {
+		keys = append(keys, key)
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
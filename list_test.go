@@ -0,0 +1,56 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test enumerating the keys of a store
+func TestList(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex())
+	for _, key := range []string{"img/b.png", "img/a.png", "doc/readme", "img/c.png"} {
+		s.StoreString(key, "value of "+key)
+	}
+	s.Delete("img/c.png")
+
+	keys, err := s.List("")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if got := strings.Join(keys, ","); got != "doc/readme,img/a.png,img/b.png" {
+		t.Errorf("Got keys %s, expected doc/readme,img/a.png,img/b.png", got)
+	}
+	if keys, _ := s.List("img/"); len(keys) != 2 {
+		t.Errorf("Got keys %v with prefix, expected 2 keys", keys)
+	}
+
+	n := 0
+	err = s.Iterate("doc/", func(key string, info ObjectInfo) error {
+		n++
+		if info.Hash != s.keyhash(key) || info.Size != int64(len("value of "+key)) {
+			t.Errorf("Got info %+v for key %s", info, key)
+		}
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Errorf("Iterate returned %d keys with error %v, expected 1 key", n, err)
+	}
+
+	stop := errors.New("stop")
+	if err := s.Iterate("", func(string, ObjectInfo) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("Got error %v from Iterate, expected the error of the callback", err)
+	}
+
+	// objects stored without key index are not listed
+	plain, _ := New(s.base)
+	plain.StoreString("unlisted", "value")
+	if keys, _ := s.List(""); len(keys) != 3 {
+		t.Errorf("Got keys %v, expected 3 keys", keys)
+	}
+}
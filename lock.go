@@ -0,0 +1,144 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// lockTimeout is the time after which the lock of a key is considered stale,
+// e.g. because the process holding it crashed, and is broken by other
+// writers. A held lock is renewed every lockRenewal, so long operations keep
+// it.
+const lockTimeout = time.Minute
+
+// lockRenewal is the interval at which a held lock is renewed. It is a
+// variable for the tests.
+var lockRenewal = lockTimeout / 4
+
+// maxLockWait is the maximum pause between two attempts to lock a key.
+const maxLockWait = 50 * time.Millisecond
+
+// lockkey serializes conditional writes (StoreIfAbsent, CompareAndSwap and
+// Append) on a key, among all store instances on a shared file system. The
+// lock is a file in the lock directory, which is created by a hard link, so
+// only one writer succeeds. Other writers wait until it is removed, or until
+// it expires after lockTimeout. The lock is renewed while it is held, so it
+// only expires if the process holding it stops. The returned function
+// releases the lock.
+//
+// Plain Store and Delete operations do not take the lock, unless the counters
+// are enabled (see WithCounters).
+func (s *SOS) lockkey(key string) (func(), error) {
+	return s.lockhash(s.keyhash(key))
+}
+
+// lockhash is like lockkey, but takes the hex encoded hash of the key.
+func (s *SOS) lockhash(hs string) (func(), error) {
+	return s.lockfile(s.lockpath(hs))
+}
+
+// lockfile takes the lock with the given file name in the directory dirname.
+func (s *SOS) lockfile(dirname, filename string) (func(), error) {
+	// the file is kept open to renew the lock
+	tmpname := s.tmpfilename()
+	fh, err := s.createfile(tmpname)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpname)
+	_, err = fh.Write(s.lockcontent())
+	var fi fs.FileInfo
+	if err == nil {
+		fi, err = fh.Stat()
+	}
+	if err != nil {
+		_ = fh.Close()
+		return nil, err
+	}
+
+	wait := time.Millisecond
+	for {
+		err := s.retrydir(dirname, func() error {
+			return os.Link(tmpname, filename)
+		})
+		if err == nil {
+			stop := s.renewlock(fh)
+			return func() {
+				stop()
+				_ = fh.Close()
+				_ = s.breaklease(filename, fi)
+			}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			_ = fh.Close()
+			return nil, err
+		}
+
+		_, until, held, err := readlease(filename)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // released in the meantime
+		}
+		if err != nil {
+			_ = fh.Close()
+			return nil, err
+		}
+		if !s.clock.Now().Before(until) {
+			if err := s.breaklease(filename, held); err != nil {
+				_ = fh.Close()
+				return nil, err
+			}
+			continue
+		}
+
+		time.Sleep(wait)
+		if wait *= 2; wait > maxLockWait {
+			wait = maxLockWait
+		}
+	}
+}
+
+// lockcontent returns the content of a lock file, with the instance which
+// holds it and the time when it expires. The length is always the same, so a
+// renewal overwrites the content in place.
+func (s *SOS) lockcontent() []byte {
+	expires := s.clock.Now().Add(lockTimeout)
+	return []byte(fmt.Sprintf("%s %019d\n", s.instanceID, expires.UnixNano()))
+}
+
+// renewlock renews the lock in the open lock file fh every lockRenewal,
+// until the returned function is called.
+func (s *SOS) renewlock(fh *os.File) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t := time.NewTicker(lockRenewal)
+	go func() {
+		defer close(stopped)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				_, _ = fh.WriteAt(s.lockcontent(), 0)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// lockpath returns the directory and file name of the lock of a key, given
+// the hex encoded hash of the key.
+func (s *SOS) lockpath(hs string) (dirname, filename string) {
+	return s.shardpath(s.base+"/"+dirLocks, hs)
+}
@@ -0,0 +1,78 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that stale locks of crashed writers are broken
+func TestLockStale(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+
+	if _, err := s.lockkey("key"); err != nil {
+		t.Fatalf("Locking failed: %v", err)
+	}
+	clock.Advance(2 * lockTimeout)
+
+	done := make(chan error, 1)
+	go func() {
+		unlock, err := s.lockkey("key")
+		if err == nil {
+			unlock()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Locking after a stale lock failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Stale lock was not broken")
+	}
+}
+
+// Test that a held lock is renewed, so it is not broken by other writers
+func TestLockRenewal(t *testing.T) {
+	defer func(d time.Duration) { lockRenewal = d }(lockRenewal)
+	lockRenewal = 10 * time.Millisecond
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+
+	unlock, err := s.lockkey("key")
+	if err != nil {
+		t.Fatalf("Locking failed: %v", err)
+	}
+	clock.Advance(2 * lockTimeout)
+	time.Sleep(100 * time.Millisecond) // renewed meanwhile
+
+	done := make(chan error, 1)
+	go func() {
+		unlock, err := s.lockkey("key")
+		if err == nil {
+			unlock()
+		}
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Held lock was broken")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Locking after unlock failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Lock was not released")
+	}
+}
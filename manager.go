@@ -0,0 +1,277 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultManagerMaxOpen is the default limit of open stores of a Manager.
+const defaultManagerMaxOpen = 1000
+
+// minIdleCheck is the minimum interval of the idle eviction, for very short
+// idle timeouts.
+const minIdleCheck = 10 * time.Millisecond
+
+// ManagerOptions configures a Manager.
+type ManagerOptions struct {
+	MaxOpen     int                        // maximum number of open stores, default 1000
+	IdleTimeout time.Duration              // close stores which were not used for this long, 0 for never
+	Options     func(path string) []Option // options for the store at path, may be nil
+}
+
+// Manager opens stores on demand, and keeps them open for later use, e.g. in
+// a service with a store per tenant. The number of open stores is limited;
+// when the limit is reached, the least recently used store which is not in
+// use is closed. With an idle timeout, stores which were not used for that
+// long are closed by a single background goroutine, however many stores are
+// managed.
+//
+// A store is used between Acquire and the call of the returned release
+// function, and is never closed meanwhile. A Manager is safe for concurrent
+// use.
+type Manager struct {
+	maxOpen int
+	idle    time.Duration
+	options func(path string) []Option
+	open    func(path string, opts ...Option) (*SOS, error) // replaced in tests
+
+	mu       sync.Mutex
+	stores   map[string]*managedStore // by path
+	released chan struct{}            // closed when a store becomes unused
+	closed   bool
+
+	stop chan struct{} // stops the idle eviction
+	done chan struct{} // closed when the idle eviction has stopped
+}
+
+// managedStore is a store of a Manager.
+type managedStore struct {
+	s       *SOS
+	err     error         // error of New
+	ready   chan struct{} // closed when New has returned
+	refs    int           // number of running uses
+	lastUse time.Time
+}
+
+// NewManager creates a Manager. It must be closed, to close the open stores
+// and stop the background goroutine.
+func NewManager(opts ManagerOptions) *Manager {
+	m := &Manager{
+		maxOpen:  opts.MaxOpen,
+		idle:     opts.IdleTimeout,
+		options:  opts.Options,
+		open:     New,
+		stores:   make(map[string]*managedStore),
+		released: make(chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if m.maxOpen <= 0 {
+		m.maxOpen = defaultManagerMaxOpen
+	}
+
+	if m.idle > 0 {
+		go m.evictidle()
+	} else {
+		close(m.done)
+	}
+	return m
+}
+
+// Acquire returns the store at path, which is opened if it is not open yet,
+// and a function which must be called when the store is not used anymore.
+// If the limit of open stores is reached and all of them are in use, Acquire
+// waits until one is released, or ctx is cancelled.
+func (m *Manager) Acquire(ctx context.Context, path string) (*SOS, func(), error) {
+	m.mu.Lock()
+	for {
+		if m.closed {
+			m.mu.Unlock()
+			return nil, nil, &Error{Op: "Acquire", Path: path, Err: ErrClosed}
+		}
+
+		if ms := m.stores[path]; ms != nil {
+			ms.refs++
+			m.mu.Unlock()
+			return m.ready(ctx, path, ms)
+		}
+
+		if len(m.stores) < m.maxOpen {
+			ms := &managedStore{refs: 1, ready: make(chan struct{})}
+			m.stores[path] = ms
+			m.mu.Unlock()
+
+			var opts []Option
+			if m.options != nil {
+				opts = m.options(path)
+			}
+			ms.s, ms.err = m.open(path, opts...)
+			if ms.err != nil {
+				m.mu.Lock()
+				delete(m.stores, path)
+				m.signal()
+				m.mu.Unlock()
+			}
+			close(ms.ready)
+			return m.ready(ctx, path, ms)
+		}
+
+		if victim := m.leastrecent(); victim != nil {
+			m.mu.Unlock()
+			_ = victim.Close()
+			m.mu.Lock()
+			continue
+		}
+
+		// all stores are in use
+		released := m.released
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, nil, &Error{Op: "Acquire", Path: path, Err: ctx.Err()}
+		case <-released:
+		}
+		m.mu.Lock()
+	}
+}
+
+// Do acquires the store at path, calls fn with it, and releases it.
+func (m *Manager) Do(ctx context.Context, path string, fn func(s *SOS) error) error {
+	s, release, err := m.Acquire(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(s)
+}
+
+// Len returns the number of open stores.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.stores)
+}
+
+// Close closes all open stores, and stops the background goroutine. Stores
+// which are still in use are closed as well, so their running operations
+// are waited for (see Close of SOS), and later ones fail with ErrClosed. The
+// first error of closing the stores is returned.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	stores := m.stores
+	m.stores = make(map[string]*managedStore)
+	m.signal()
+	m.mu.Unlock()
+
+	close(m.stop)
+	<-m.done
+
+	var err error
+	for _, ms := range stores {
+		<-ms.ready
+		if ms.err != nil {
+			continue
+		}
+		if cerr := ms.s.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ready waits until the store ms is opened, and returns it with its release
+// function. The use of ms was counted already.
+func (m *Manager) ready(ctx context.Context, path string, ms *managedStore) (*SOS, func(), error) {
+	select {
+	case <-ms.ready:
+	case <-ctx.Done():
+		m.release(ms)
+		return nil, nil, &Error{Op: "Acquire", Path: path, Err: ctx.Err()}
+	}
+	if ms.err != nil {
+		return nil, nil, ms.err
+	}
+
+	var once sync.Once
+	return ms.s, func() { once.Do(func() { m.release(ms) }) }, nil
+}
+
+// release ends a use of the store ms.
+func (m *Manager) release(ms *managedStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms.refs--
+	ms.lastUse = time.Now()
+	if ms.refs == 0 {
+		m.signal()
+	}
+}
+
+// signal wakes up the Acquire calls which wait for an unused store. m.mu must
+// be held.
+func (m *Manager) signal() {
+	close(m.released)
+	m.released = make(chan struct{})
+}
+
+// leastrecent removes the least recently used store which is not in use,
+// and returns it for closing. It returns nil if all stores are in use. m.mu
+// must be held.
+func (m *Manager) leastrecent() *SOS {
+	var (
+		path   string
+		oldest *managedStore
+	)
+	for p, ms := range m.stores {
+		if ms.refs == 0 && (oldest == nil || ms.lastUse.Before(oldest.lastUse)) {
+			path, oldest = p, ms
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+	delete(m.stores, path)
+	return oldest.s
+}
+
+// evictidle closes the stores which were not used for the idle timeout, until
+// the Manager is closed.
+func (m *Manager) evictidle() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(max(m.idle/2, minIdleCheck))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var idle []*SOS
+		limit := time.Now().Add(-m.idle)
+		m.mu.Lock()
+		for path, ms := range m.stores {
+			if ms.refs == 0 && ms.lastUse.Before(limit) {
+				delete(m.stores, path)
+				idle = append(idle, ms.s)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, s := range idle {
+			_ = s.Close()
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test opening, caching and evicting stores
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(ManagerOptions{
+		MaxOpen: 2,
+		Options: func(path string) []Option { return []Option{WithKeyIndex()} },
+	})
+	defer m.Close()
+	var opened atomic.Int32
+	m.open = func(path string, opts ...Option) (*SOS, error) {
+		opened.Add(1)
+		return New(path, opts...)
+	}
+	ctx := context.Background()
+
+	// concurrent users of a store share one handle
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.Do(ctx, filepath.Join(dir, "a"), func(s *SOS) error {
+				return s.StoreString("key", "value")
+			})
+			if err != nil {
+				t.Errorf("Error storing in managed store: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := opened.Load(); n != 1 {
+		t.Errorf("Got %d opened stores, expected 1", n)
+	}
+
+	// the least recently used store is closed at the limit
+	a, releaseA, _ := m.Acquire(ctx, filepath.Join(dir, "a"))
+	releaseA()
+	m.Do(ctx, filepath.Join(dir, "b"), func(s *SOS) error { return nil })
+	m.Do(ctx, filepath.Join(dir, "c"), func(s *SOS) error { return nil })
+	if n := m.Len(); n != 2 {
+		t.Errorf("Got %d open stores, expected 2", n)
+	}
+	if _, err := a.GetString("key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %v from evicted store, expected ErrClosed", err)
+	}
+
+	// a store in use is not evicted, so Acquire waits
+	c, releaseC, _ := m.Acquire(ctx, filepath.Join(dir, "c"))
+	b, releaseB, _ := m.Acquire(ctx, filepath.Join(dir, "b"))
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := m.Acquire(short, filepath.Join(dir, "a")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v at the limit, expected context.DeadlineExceeded", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		releaseB()
+	}()
+	s, release, err := m.Acquire(ctx, filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatalf("Error acquiring released store: %v", err)
+	}
+	if v, err := s.GetString("key"); err != nil || v != "value" {
+		t.Errorf("Got %q (%v), expected %q", v, err, "value")
+	}
+	if _, err := b.GetString("key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %v from evicted store, expected ErrClosed", err)
+	}
+	release()
+	releaseC()
+	releaseC() // released only once
+
+	// closing the manager closes the stores
+	if err := m.Close(); err != nil {
+		t.Errorf("Error closing manager: %v", err)
+	}
+	if _, err := c.GetString("key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %v after Close, expected ErrClosed", err)
+	}
+	if _, _, err := m.Acquire(ctx, filepath.Join(dir, "a")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %v from closed manager, expected ErrClosed", err)
+	}
+}
+
+// Test closing idle stores and failing opens
+func TestManagerIdle(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(ManagerOptions{IdleTimeout: 20 * time.Millisecond})
+	defer m.Close()
+	ctx := context.Background()
+
+	m.Do(ctx, filepath.Join(dir, "a"), func(s *SOS) error { return nil })
+	for i := 0; i < 100 && m.Len() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := m.Len(); n != 0 {
+		t.Errorf("Got %d open stores after idle timeout, expected 0", n)
+	}
+
+	// a tiny idle timeout is checked at the minimum interval
+	tiny := NewManager(ManagerOptions{IdleTimeout: time.Nanosecond})
+	defer tiny.Close()
+	tiny.Do(ctx, filepath.Join(dir, "b"), func(s *SOS) error { return nil })
+	for i := 0; i < 100 && tiny.Len() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := tiny.Len(); n != 0 {
+		t.Errorf("Got %d open stores after a tiny idle timeout, expected 0", n)
+	}
+
+	// a failed open is not cached
+	if err := m.Do(ctx, "", func(s *SOS) error { return nil }); err == nil {
+		t.Errorf("Got no error for invalid path")
+	}
+	if n := m.Len(); n != 0 {
+		t.Errorf("Got %d open stores after failed open, expected 0", n)
+	}
+}
@@ -0,0 +1,150 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+)
+
+// Meta is the metadata of an object, like the content type and user defined
+// attributes. It is kept in the header of the object file, so it is replaced
+// atomically with the value, and can be read without reading the value.
+type Meta struct {
+	ContentType string            `json:"contentType,omitempty"`
+	Attrs       map[string]string `json:"attrs,omitempty"`
+}
+
+// StoreWithMeta stores a key/value pair together with its metadata. A later
+// Store of the key removes the metadata.
+func (s *SOS) StoreWithMeta(key string, value []byte, meta Meta) error {
+	return s.StoreFromMeta(key, bytes.NewReader(value), meta)
+}
+
+// StoreFromMeta is like StoreWithMeta, but reads the value from an io.Reader.
+func (s *SOS) StoreFromMeta(key string, rd io.Reader, meta Meta) (err error) {
+	o := s.startop(context.Background(), "Store", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Store", key)
+
+	data, err := marshalmeta(meta)
+	if err != nil {
+		return err
+	}
+	var fields map[byte][]byte
+	if data != nil {
+		fields = map[byte][]byte{tagMeta: data}
+	}
+	return s.store(context.Background(), o, key, rd, fields)
+}
+
+// GetMeta returns the metadata of an object, without reading its value. An
+// object stored without metadata has an empty Meta. If the key does not
+// exist, or the object has expired, ErrNotFound is returned.
+func (s *SOS) GetMeta(key string) (meta Meta, err error) {
+	defer s.wraperr(&err, "GetMeta", key)
+
+	if err := s.begin(); err != nil {
+		return meta, err
+	}
+	defer s.end()
+
+	_, filename := s.getpath(key)
+	fh, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return meta, ErrNotFound
+	}
+	if err != nil {
+		return meta, err
+	}
+	defer fh.Close()
+
+	h, err := readheader(bufio.NewReader(fh))
+	if err != nil || h == nil {
+		return meta, err
+	}
+	if s.expired(h) {
+		return meta, ErrNotFound
+	}
+	return unmarshalmeta(h.fields[tagMeta])
+}
+
+// SetMeta replaces the metadata of an object, and keeps its value and time to
+// live. An empty Meta removes the metadata. If the key does not exist, or the
+// object has expired, ErrNotFound is returned.
+//
+// Like TouchTTL, the object file is rewritten with the new header. SetMeta
+// holds the lock of the key (see CompareAndSwap), so it never interleaves
+// with an append, and if the object is replaced by a concurrent Store, the
+// new object is rewritten instead.
+func (s *SOS) SetMeta(key string, meta Meta) (err error) {
+	o := s.startop(context.Background(), "SetMeta", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "SetMeta", key)
+
+	data, err := marshalmeta(meta)
+	if err != nil {
+		return err
+	}
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockkey(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.rewriteheader(key, true, func(h *header) {
+		delete(h.fields, tagMeta)
+		if data != nil {
+			h.fields[tagMeta] = data
+		}
+	})
+}
+
+// marshalmeta returns the encoding of the metadata for the object header, or
+// nil for empty metadata.
+func marshalmeta(meta Meta) ([]byte, error) {
+	if meta.ContentType == "" && len(meta.Attrs) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > math.MaxUint16 {
+		return nil, fmt.Errorf("metadata too large (%d bytes)", len(data))
+	}
+	return data, nil
+}
+
+// unmarshalmeta decodes the metadata from the object header.
+func unmarshalmeta(data []byte) (meta Meta, err error) {
+	if len(data) == 0 {
+		return meta, nil
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return Meta{}, fmt.Errorf("%w: object metadata", ErrCorrupt)
+	}
+	return meta, nil
+}
@@ -0,0 +1,70 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test storing, reading and replacing metadata
+func TestMeta(t *testing.T) {
+	s := NewTemp(t)
+	meta := Meta{ContentType: "text/plain", Attrs: map[string]string{"owner": "alice"}}
+
+	if err := s.StoreWithMeta("key", []byte("value"), meta); err != nil {
+		t.Fatalf("StoreWithMeta failed: %v", err)
+	}
+	if obj, _ := s.GetString("key"); obj != "value" {
+		t.Errorf("Got %q from store, expected %q", obj, "value")
+	}
+	if got, err := s.GetMeta("key"); err != nil || !reflect.DeepEqual(got, meta) {
+		t.Errorf("Got metadata %v, %v, expected %v", got, err, meta)
+	}
+
+	meta.ContentType = "text/markdown"
+	if err := s.SetMeta("key", meta); err != nil {
+		t.Fatalf("SetMeta failed: %v", err)
+	}
+	if got, _ := s.GetMeta("key"); !reflect.DeepEqual(got, meta) {
+		t.Errorf("Got metadata %v, expected %v", got, meta)
+	}
+	s.Append("key", []byte("s"))
+	if got, _ := s.GetMeta("key"); !reflect.DeepEqual(got, meta) {
+		t.Errorf("Got metadata %v after Append, expected %v", got, meta)
+	}
+	if obj, _ := s.GetString("key"); obj != "values" {
+		t.Errorf("Got %q from store, expected %q", obj, "values")
+	}
+
+	// a plain Store removes the metadata
+	s.StoreString("key", "value")
+	if got, err := s.GetMeta("key"); err != nil || !reflect.DeepEqual(got, Meta{}) {
+		t.Errorf("Got metadata %v, %v, expected none", got, err)
+	}
+
+	if err := s.SetMeta("missing", meta); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v from SetMeta on a missing key, expected ErrNotFound", err)
+	}
+	if _, err := s.GetMeta("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v from GetMeta on a missing key, expected ErrNotFound", err)
+	}
+}
+
+// Test that SetMeta keeps the time to live
+func TestMetaTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+
+	s.StoreWithTTL("key", []byte("value"), time.Minute)
+	s.SetMeta("key", Meta{ContentType: "text/plain"})
+	clock.Advance(time.Hour)
+	if _, err := s.GetMeta("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for an expired key, expected ErrNotFound", err)
+	}
+}
@@ -0,0 +1,67 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"time"
+)
+
+// Names of the metrics reported to a MetricsSink.
+const (
+	MetricOperations = "operations" // counter of finished operations, by op
+	MetricErrors     = "errors"     // counter of failed operations, by op
+	MetricNotFound   = "not_found"  // counter of operations on missing keys, by op
+	MetricBytes      = "bytes"      // counter of bytes stored or read, by op
+	MetricDuration   = "duration"   // timer of operations, by op
+	MetricInflight   = "inflight"   // gauge of running operations
+)
+
+// MetricsSink receives the metrics of a store. It is a minimal interface,
+// so any metrics library can be bridged. The methods are called
+// synchronously by the operations, and may be called from several
+// goroutines concurrently.
+//
+// The op argument is the name of the operation, e.g. "Store" or "Get". The
+// sub-package sosprom provides an implementation for Prometheus.
+type MetricsSink interface {
+	Counter(name, op string, delta int64)
+	Timer(name, op string, d time.Duration)
+	Gauge(name string, value float64)
+}
+
+// WithMetrics sets a sink for the metrics of the Store, Get, Delete, Take and
+// Touch operations. Streaming reads, e.g. the GET and HEAD requests of the
+// httpd and s3gw gateways, are measured when the reader is closed.
+func WithMetrics(m MetricsSink) Option {
+	return func(s *SOS) {
+		s.metrics = m
+	}
+}
+
+// measure reports the metrics of a finished operation.
+func (s *SOS) measure(info OpInfo) {
+	if s.metrics == nil {
+		return
+	}
+	s.metrics.Counter(MetricOperations, info.Op, 1)
+	switch {
+	case errors.Is(info.Err, ErrNotFound):
+		s.metrics.Counter(MetricNotFound, info.Op, 1)
+	case info.Err != nil:
+		s.metrics.Counter(MetricErrors, info.Op, 1)
+	}
+	s.metrics.Timer(MetricDuration, info.Op, info.Duration)
+}
+
+// running changes the number of running operations by delta, and reports
+// it to the inflight gauge.
+func (s *SOS) running(delta int64) {
+	n := s.runningOps.Add(delta)
+	if s.metrics != nil {
+		s.metrics.Gauge(MetricInflight, float64(n))
+	}
+}
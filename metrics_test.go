@@ -0,0 +1,86 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMetrics records the counters and the last gauge values.
+type testMetrics struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	timers   map[string]int
+	gauges   map[string]float64
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		counters: make(map[string]int64),
+		timers:   make(map[string]int),
+		gauges:   make(map[string]float64),
+	}
+}
+
+func (m *testMetrics) Counter(name, op string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name+"/"+op] += delta
+}
+
+func (m *testMetrics) Timer(name, op string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timers[name+"/"+op]++
+}
+
+func (m *testMetrics) Gauge(name string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = value
+}
+
+// Test the metrics of store operations
+func TestMetrics(t *testing.T) {
+	m := newTestMetrics()
+	s := NewTemp(t, WithMetrics(m))
+
+	if err := s.StoreString("hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetString("hello"); err != nil {
+		t.Fatal(err)
+	}
+	s.GetString("missing")
+	if err := s.Delete("hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{
+		"operations/Store":  1,
+		"operations/Get":    2,
+		"operations/Delete": 1,
+		"not_found/Get":     1,
+		"bytes/Store":       5,
+		"bytes/Get":         5,
+	}
+	for name, n := range expected {
+		if m.counters[name] != n {
+			t.Errorf("Got %d for counter %s, expected %d", m.counters[name], name, n)
+		}
+	}
+	if len(m.counters) != len(expected) {
+		t.Errorf("Got counters %v, expected %v", m.counters, expected)
+	}
+	if m.timers["duration/Get"] != 2 {
+		t.Errorf("Got %d Get durations, expected 2", m.timers["duration/Get"])
+	}
+	if m.gauges[MetricInflight] != 0 {
+		t.Errorf("Got %v inflight operations, expected 0", m.gauges[MetricInflight])
+	}
+}
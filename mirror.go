@@ -0,0 +1,106 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// defaultMirrorInterval is the default time between two refreshes of a
+// mirror.
+const defaultMirrorInterval = time.Minute
+
+// Mirror keeps a local replica of a source store up to date, by pulling the
+// changes periodically. This allows e.g. edge caches to serve the same data
+// set as a central store on a shared or network file system.
+//
+// The replica should be used read-only. Objects which do not exist in the
+// source store are removed from the replica on each refresh. Key index
+// entries are mirrored if the replica keeps a key index (see WithKeyIndex),
+// while pointers are not mirrored.
+type Mirror struct {
+	Source   *SOS          // store to pull the changes from
+	Replica  *SOS          // local store which is kept up to date
+	Interval time.Duration // time between refreshes, default one minute
+	OnError  func(error)   // optional, receives the errors of failed refreshes
+}
+
+// Refresh pulls the changes from the source store into the replica once.
+// New and changed objects are copied, objects deleted in the source store
+// are removed from the replica.
+func (m *Mirror) Refresh() error {
+	if err := m.Source.CopyTo(m.Replica, nil); err != nil {
+		return err
+	}
+	return m.prune()
+}
+
+// Run refreshes the replica immediately, and then periodically until the
+// context is cancelled. Failed refreshes are reported to OnError, but do not
+// stop the mirror. Run returns the error of the context.
+func (m *Mirror) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = defaultMirrorInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Refresh(); err != nil && m.OnError != nil {
+			m.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune removes all objects from the replica, which do not exist in the
+// source store.
+func (m *Mirror) prune() (err error) {
+	src, dst := m.Source, m.Replica
+	defer dst.wraperr(&err, "Mirror", "")
+
+	if err := dst.begin(); err != nil {
+		return err
+	}
+	defer dst.end()
+
+	return dst.walk(func(rel string, fi fs.FileInfo) error {
+		_, srcname := src.hashpath(dst.relhash(rel))
+		_, err := os.Stat(srcname)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		if err := dst.beginmodify(); err != nil {
+			return err
+		}
+		defer dst.endmodify()
+
+		hs := dst.relhash(rel)
+		_, filename := dst.hashpath(hs)
+		err = dst.change(hs, false, func() error {
+			return os.Remove(filename)
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err == nil {
+			_, indexname := dst.indexpath(hs)
+			_ = os.Remove(indexname)
+		}
+		return err
+	})
+}
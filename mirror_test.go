@@ -0,0 +1,71 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test pulling changes into a replica
+func TestMirror(t *testing.T) {
+	src := NewTemp(t)
+	replica := NewTemp(t, WithSuffix(".obj"))
+	m := &Mirror{Source: src, Replica: replica}
+
+	src.StoreString("key1", "value1")
+	src.StoreString("key2", "value2")
+	if err := m.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if obj, _ := replica.GetString("key1"); obj != "value1" {
+		t.Errorf("Got %s from replica, expected %s", obj, "value1")
+	}
+
+	src.Delete("key1")
+	src.StoreString("key2", "changed")
+	if err := m.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if _, err := replica.GetString("key1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for a deleted key, expected %v", err, ErrNotFound)
+	}
+	if obj, _ := replica.GetString("key2"); obj != "changed" {
+		t.Errorf("Got %s from replica, expected %s", obj, "changed")
+	}
+}
+
+// Test that Run refreshes until the context is cancelled
+func TestMirrorRun(t *testing.T) {
+	src := NewTemp(t)
+	replica := NewTemp(t)
+	m := &Mirror{Source: src, Replica: replica, Interval: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx)
+	}()
+
+	src.StoreString("key", "value")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if obj, _ := replica.GetString("key"); obj == "value" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Object was not mirrored")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Got error %v from Run, expected %v", err, context.Canceled)
+	}
+}
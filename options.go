@@ -0,0 +1,159 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// defaultCloseTimeout is the default maximum time that Close and Destroy
+// wait for running operations.
+const defaultCloseTimeout = 30 * time.Second
+
+// defaultShardDepth is the default number of directory levels below the base
+// directory.
+const defaultShardDepth = 2
+
+// maxShardDepth is the maximum number of directory levels.
+const maxShardDepth = 4
+
+// minHashSize is the minimum size of a key hash in bytes, to keep hash
+// collisions unlikely.
+const minHashSize = 16
+
+// Option configures an object store on creation. Options are passed to New.
+type Option func(*SOS)
+
+// WithTee sets a writer which receives a copy of every value stored in the
+// object store, while it is written to the store. This allows mirroring the
+// values to an external sink (e.g. a backup upload) without reading them a
+// second time.
+//
+// Concurrent Store operations are serialized on the writer, so the values
+// are written one after another and never interleave. If writing to the
+// writer fails, the Store operation fails as well and the value is not
+// stored.
+func WithTee(w io.Writer) Option {
+	return func(s *SOS) {
+		s.tee = w
+	}
+}
+
+// WithCloseTimeout sets the maximum time that Close and Destroy wait for
+// running operations to finish. A timeout of zero or less waits without a
+// limit. The default is 30 seconds.
+func WithCloseTimeout(d time.Duration) Option {
+	return func(s *SOS) {
+		s.timeout = d
+	}
+}
+
+// WithNoOverwrite makes Store operations fail with ErrExists if the key
+// already exists in the store, instead of replacing the value. The check is
+// atomic, even with concurrent writers on a shared file system. An expired
+// object (see StoreWithTTL) is replaced, as for StoreIfAbsent.
+//
+// This is useful for workloads where an overwrite indicates a bug, e.g. for
+// content-addressed data.
+func WithNoOverwrite() Option {
+	return func(s *SOS) {
+		s.noOverwrite = true
+	}
+}
+
+// WithSuffix sets a file name suffix (e.g. ".obj") for the object files. This
+// allows external tools like backup clients or virus scanners to treat the
+// object files appropriately. The suffix must not contain a slash.
+//
+// All processes accessing a store must use the same suffix. Objects stored
+// with a different suffix are not found.
+func WithSuffix(suffix string) Option {
+	return func(s *SOS) {
+		s.suffix = suffix
+	}
+}
+
+// WithShardDepth sets the number of directory levels below the base
+// directory. Each level is named by one byte of the key hash, i.e. it holds up
+// to 256 subdirectories. The default is 2 levels, which suits up to some ten
+// millions of objects. With more objects, a depth of 3 keeps the directories
+// small; with few objects, 1 or 0 levels save inodes. The depth must be
+// between 0 and 4.
+//
+// All processes accessing a store must use the same depth. Objects stored
+// with a different depth are not found.
+func WithShardDepth(n int) Option {
+	return func(s *SOS) {
+		s.shardDepth = n
+	}
+}
+
+// WithHash sets the hash function for the keys, e.g. sha512.New or a faster
+// non-cryptographic hash. The hash must be at least 16 bytes long. The
+// default is SHA-256.
+//
+// All processes accessing a store must use the same hash function. Objects
+// stored with a different hash function are not found. Chunks (see
+// WithChunking) are always addressed by their SHA-256 checksum.
+func WithHash(h func() hash.Hash) Option {
+	return func(s *SOS) {
+		s.newHash = h
+	}
+}
+
+// WithCollisionCheck records the original key of each stored object in the
+// key index, and verifies it on Get. This turns the astronomically unlikely
+// event of a hash collision into an ErrCollision error, instead of silently
+// returning the value of a different key. It costs an additional small file
+// per object.
+//
+// Objects which were stored without collision check are read unverified.
+func WithCollisionCheck() Option {
+	return func(s *SOS) {
+		s.collisionCheck = true
+		s.keyIndex = true
+	}
+}
+
+// checkoptions validates the options of a new store.
+func (s *SOS) checkoptions() error {
+	if strings.Contains(s.suffix, "/") {
+		return fmt.Errorf("invalid object file suffix %q", s.suffix)
+	}
+	if s.shardDepth < 0 || s.shardDepth > maxShardDepth {
+		return fmt.Errorf("invalid shard depth %d", s.shardDepth)
+	}
+	if s.newHash == nil || s.newHash().Size() < minHashSize {
+		return fmt.Errorf("invalid key hash function")
+	}
+	if s.consistency < ConsistencyLink || s.consistency > ConsistencyStrict {
+		return fmt.Errorf("invalid consistency level %d", s.consistency)
+	}
+	if s.compression < 0 || s.compression > CompressionSnappy {
+		return fmt.Errorf("invalid compression format %d", s.compression)
+	}
+	if s.keyring != nil && s.keyring.err != nil {
+		return s.keyring.err
+	}
+	if s.fileMode&0o600 != 0o600 || s.fileMode&^fs.ModePerm != 0 {
+		return fmt.Errorf("invalid file mode %v", s.fileMode)
+	}
+	if s.dirMode&0o700 != 0o700 || s.dirMode&^(fs.ModePerm|fs.ModeSetgid) != 0 {
+		return fmt.Errorf("invalid directory mode %v", s.dirMode)
+	}
+	if b := s.breaker; b != nil && (b.threshold <= 0 || b.window <= 0) {
+		return fmt.Errorf("invalid circuit breaker threshold %d or window %v", b.threshold, b.window)
+	}
+	if p := s.sampler; p != nil && (p.rate <= 0 || p.rate > 1 || len(p.samples) == 0) {
+		return fmt.Errorf("invalid read sampling rate %v or size %d", p.rate, len(p.samples))
+	}
+	return nil
+}
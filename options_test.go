@@ -0,0 +1,121 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test mirroring of stored values to a tee writer
+func TestWithTee(t *testing.T) {
+	tee := new(bytes.Buffer)
+	s, _ := New("./._sostest", WithTee(tee))
+	defer s.Destroy()
+
+	s.StoreString("key1", "hello ")
+	s.Store("key2", []byte("world"))
+
+	if tee.String() != "hello world" {
+		t.Errorf("Got %q from tee, expected %q", tee.String(), "hello world")
+	}
+
+	if obj, _ := s.GetString("key2"); obj != "world" {
+		t.Errorf("Got %s from store, expected %s", obj, "world")
+	}
+}
+
+// Test that existing keys are not overwritten
+func TestWithNoOverwrite(t *testing.T) {
+	s := NewTemp(t, WithNoOverwrite())
+
+	if err := s.StoreString("key", "first"); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if err := s.StoreString("key", "second"); !errors.Is(err, ErrExists) {
+		t.Errorf("Got error %v when overwriting a key, expected %v", err, ErrExists)
+	}
+	if obj, _ := s.GetString("key"); obj != "first" {
+		t.Errorf("Got %s from store, expected %s", obj, "first")
+	}
+
+	s.Delete("key")
+	if err := s.StoreString("key", "third"); err != nil {
+		t.Errorf("Store of a deleted key failed: %v", err)
+	}
+}
+
+// Test object file names with suffix
+func TestWithSuffix(t *testing.T) {
+	s := NewTemp(t, WithSuffix(".obj"))
+
+	s.StoreString("hello", "world")
+	_, filename := s.getpath("hello")
+	if !strings.HasSuffix(filename, ".obj") {
+		t.Errorf("Object file %s has no suffix", filename)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Errorf("Object file %s does not exist", filename)
+	}
+	if obj, _ := s.GetString("hello"); obj != "world" {
+		t.Errorf("Got %s from store, expected %s", obj, "world")
+	}
+
+	dst := NewTemp(t)
+	s.CopyTo(dst, nil)
+	if obj, _ := dst.GetString("hello"); obj != "world" {
+		t.Errorf("Got %s from copy, expected %s", obj, "world")
+	}
+
+	if _, err := New(t.TempDir(), WithSuffix("/obj")); err == nil {
+		t.Errorf("Got no error for an invalid suffix")
+	}
+}
+
+// Test other directory layouts and hash functions
+func TestWithShardDepth(t *testing.T) {
+	for depth := 0; depth <= maxShardDepth; depth++ {
+		s := NewTemp(t, WithShardDepth(depth), WithHash(sha512.New), WithKeyIndex())
+		s.StoreString("hello", "world")
+
+		_, filename := s.getpath("hello")
+		rel, _ := filepath.Rel(s.base, filename)
+		if n := strings.Count(filepath.ToSlash(rel), "/"); n != depth {
+			t.Errorf("Got object file %s with %d levels, expected %d", rel, n, depth)
+		}
+		if len(strings.ReplaceAll(rel, string(filepath.Separator), "")) != 128 {
+			t.Errorf("Got object file %s, expected a SHA512 name", rel)
+		}
+
+		if obj, _ := s.GetString("hello"); obj != "world" {
+			t.Errorf("Got %s from store, expected %s", obj, "world")
+		}
+		if keys, _ := s.List(""); len(keys) != 1 || keys[0] != "hello" {
+			t.Errorf("Got keys %v, expected [hello]", keys)
+		}
+		if top, _ := s.TopN(SortBySize, 1); len(top) != 1 || top[0].Key != "hello" {
+			t.Errorf("Got %+v, expected the object hello", top)
+		}
+	}
+
+	if _, err := New(t.TempDir(), WithShardDepth(maxShardDepth+1)); err == nil {
+		t.Errorf("Got no error for an invalid shard depth")
+	}
+	if _, err := New(t.TempDir(), WithHash(func() hash.Hash { return crc32.NewIEEE() })); err == nil {
+		t.Errorf("Got no error for a short hash")
+	}
+	if _, err := New(t.TempDir(), WithHash(md5.New)); err != nil {
+		t.Errorf("Got error %v for a 128 bit hash", err)
+	}
+}
@@ -0,0 +1,90 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"fmt"
+	"sync"
+)
+
+// WithParallelism sets the number of workers of ExportTar,
+// ExportChangedSince, ExportPartitions and Sync. They split the key space
+// into 256 partitions by the first two hex digits of the key hash, which
+// name the top level shard directories, and process n partitions at the same
+// time. This cuts the wall clock time of large stores on disks and file
+// systems which serve parallel reads well, like SSDs, RAID arrays or network
+// file systems. The default is 1.
+//
+// Stores with a shard depth of 0 (see WithShardDepth) have a single
+// partition, so their operations are not parallelized.
+func WithParallelism(n int) Option {
+	return func(s *SOS) {
+		s.parallelism = n
+	}
+}
+
+// partitions returns the partitions of the key space, which are the names of
+// the top level shard directories, or the empty string for the base
+// directory of a store without shard directories.
+func (s *SOS) partitions() []string {
+	if s.shardDepth == 0 {
+		return []string{""}
+	}
+	ps := make([]string, 256)
+	for i := range ps {
+		ps[i] = fmt.Sprintf("%02x", i)
+	}
+	return ps
+}
+
+// partition returns the partition of a key hash.
+func (s *SOS) partition(hash string) string {
+	if s.shardDepth == 0 || len(hash) < 2 {
+		return ""
+	}
+	return hash[:2]
+}
+
+// forpartitions calls fn for each partition, by the configured number of
+// workers. After the first error, no further partitions are started, and
+// the error is returned.
+func (s *SOS) forpartitions(fn func(p string) error) error {
+	workers := max(s.parallelism, 1)
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	jobs := make(chan string)
+	stop := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				if err := fn(p); err != nil {
+					once.Do(func() {
+						first = err
+						close(stop)
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, p := range s.partitions() {
+		select {
+		case jobs <- p:
+		case <-stop:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,128 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that a parallel export has the objects of a sequential one
+func TestExportParallel(t *testing.T) {
+	s := NewTemp(t, WithParallelism(8))
+	for i := 0; i < 100; i++ {
+		s.StoreString(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+
+	parallel := new(bytes.Buffer)
+	if err := s.ExportTar(parallel); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+	s.parallelism = 1
+	sequential := new(bytes.Buffer)
+	if err := s.ExportTar(sequential); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+	p, q := readTar(t, bytes.NewReader(parallel.Bytes())), readTar(t, sequential)
+	if len(p) != 100 || len(p) != len(q) {
+		t.Fatalf("Got %d objects in parallel export, expected %d", len(p), len(q))
+	}
+	for name, v := range q {
+		if p[name] != v {
+			t.Errorf("Got %q for %s in parallel export, expected %q", p[name], name, v)
+		}
+	}
+
+	// the stream can be restored, with a valid manifest
+	r := NewTemp(t)
+	report, err := r.Restore(parallel, true)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if report.Restored != 100 {
+		t.Errorf("Got %d restored objects, expected 100", report.Restored)
+	}
+	if v, _ := r.GetString("key42"); v != "value42" {
+		t.Errorf("Got %q from restored store, expected %q", v, "value42")
+	}
+}
+
+// Test exports into a file per partition
+func TestExportPartitions(t *testing.T) {
+	s := NewTemp(t, WithParallelism(4))
+	for i := 0; i < 20; i++ {
+		s.StoreString(fmt.Sprintf("key%d", i), "value")
+	}
+
+	dir := filepath.Join(t.TempDir(), "export")
+	if err := s.ExportPartitions(dir, time.Time{}); err != nil {
+		t.Fatalf("ExportPartitions failed: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 256 {
+		t.Errorf("Got %d files, expected 256", len(files))
+	}
+
+	r := NewTemp(t)
+	for _, file := range files {
+		fh, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("Error opening %s: %v", file, err)
+		}
+		_, err = r.Restore(fh, true)
+		fh.Close()
+		if err != nil {
+			t.Fatalf("Restore of %s failed: %v", file, err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if v, _ := r.GetString(fmt.Sprintf("key%d", i)); v != "value" {
+			t.Errorf("Got %q for key%d from restored store, expected %q", v, i, "value")
+		}
+	}
+
+	// a store without shards has a single partition
+	f := NewTemp(t, WithShardDepth(0))
+	f.StoreString("key", "value")
+	dir = filepath.Join(t.TempDir(), "flat")
+	if err := f.ExportPartitions(dir, time.Time{}); err != nil {
+		t.Fatalf("ExportPartitions failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "all.tar")); err != nil {
+		t.Errorf("Error reading export of flat store: %v", err)
+	}
+}
+
+// Test Sync with several workers
+func TestSyncParallel(t *testing.T) {
+	a := NewTemp(t, WithParallelism(4))
+	b := NewTemp(t)
+	for i := 0; i < 50; i++ {
+		a.StoreString(fmt.Sprintf("a%d", i), "from a")
+		b.StoreString(fmt.Sprintf("b%d", i), "from b")
+	}
+	a.StoreString("both", "a")
+	b.StoreString("both", "from b")
+
+	conflicts := 0
+	report, err := a.Sync(b, func(c SyncConflict) SyncResolution {
+		conflicts++ // not called concurrently
+		return SyncKeepLocal
+	})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.ToRemote != 51 || report.ToLocal != 50 || conflicts != 1 {
+		t.Errorf("Got report %+v and %d conflicts, expected 51/50 and 1", report, conflicts)
+	}
+	if v, _ := b.GetString("both"); v != "a" {
+		t.Errorf("Got %q from store b, expected %q", v, "a")
+	}
+}
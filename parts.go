@@ -0,0 +1,244 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Objects with parts hold a sequence of parts as their value. Each part is
+// the length of its name (2 bytes, big endian), the name, and the data in
+// frames of a length (4 bytes, big endian) followed by that many bytes. A
+// frame of length 0 ends the part, a name of length 0 ends the sequence. The
+// header of the object file carries the field tagParts, so the value is not
+// mistaken for a plain value.
+
+// maxPartName is the maximum length of a part name.
+const maxPartName = 255
+
+// errParts is returned when an object with parts is read as a plain value.
+var errParts = errors.New("object consists of parts, use GetPart")
+
+// StoreParts stores a set of named parts (e.g. "data", "meta" and "preview")
+// under a single key. The parts are published atomically: readers see either
+// all of the new parts, or all of the old ones. Part names must not be empty,
+// and are limited to 255 bytes.
+//
+// An object with parts is read with GetPart or PartNames. Get returns an
+// error for such an object.
+func (s *SOS) StoreParts(key string, parts map[string]io.Reader) (err error) {
+	defer s.wraperr(&err, "StoreParts", key)
+
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		if name == "" || len(name) > maxPartName {
+			return fmt.Errorf("invalid part name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return err
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeparts(pw, names, parts))
+	}()
+
+	fields := map[byte][]byte{tagParts: {1}}
+	tmpname, n, err := s.writetmpenc(pr, -1, func(w io.Writer, rd io.Reader) error {
+		return s.encodevalue(w, rd, fields)
+	})
+	// stop the writer, if the temporary file could not be written
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return err
+	}
+
+	err = s.commit(key, tmpname)
+	if err == nil {
+		s.usage("Store", key, n)
+		s.notify("Store", key, n)
+	}
+	return err
+}
+
+// GetPart fetches a single part of an object stored with StoreParts. If the
+// key or the part does not exist, ErrNotFound is returned.
+func (s *SOS) GetPart(key, part string) (_ []byte, err error) {
+	defer s.wraperr(&err, "GetPart", key)
+
+	buffer := new(bytes.Buffer)
+	found := false
+	err = s.readparts(key, func(name string, rd io.Reader) error {
+		if name != part {
+			return nil
+		}
+		found = true
+		_, err := io.Copy(buffer, rd)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: part %q", ErrNotFound, part)
+	}
+	s.usage("Get", key, int64(buffer.Len()))
+	return buffer.Bytes(), nil
+}
+
+// PartNames returns the names of the parts of an object stored with
+// StoreParts, in sorted order.
+func (s *SOS) PartNames(key string) (names []string, err error) {
+	defer s.wraperr(&err, "PartNames", key)
+
+	err = s.readparts(key, func(name string, rd io.Reader) error {
+		names = append(names, name)
+		return nil
+	})
+	return names, err
+}
+
+// readparts calls fn for each part of an object. The data of a part which
+// is not read by fn is skipped.
+func (s *SOS) readparts(key string, fn func(name string, rd io.Reader) error) error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if s.collisionCheck {
+		if err := s.checkindex(key); err != nil {
+			return err
+		}
+	}
+
+	fh, err := s.open(key)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	h, rd, err := s.decodeheader(fh)
+	if err != nil {
+		return err
+	}
+	if h == nil || h.fields[tagParts] == nil {
+		return fmt.Errorf("object does not consist of parts")
+	}
+
+	for {
+		var size uint16
+		if err := binary.Read(rd, binary.BigEndian, &size); err != nil {
+			return partserr(err)
+		}
+		if size == 0 {
+			return nil
+		}
+		name := make([]byte, size)
+		if _, err := io.ReadFull(rd, name); err != nil {
+			return partserr(err)
+		}
+
+		fr := &frameReader{r: rd}
+		if err := fn(string(name), fr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, fr); err != nil {
+			return err
+		}
+	}
+}
+
+// writeparts writes the parts in the given order to w.
+func writeparts(w io.Writer, names []string, parts map[string]io.Reader) error {
+	buf := make([]byte, 32<<10)
+	for _, name := range names {
+		if err := binary.Write(w, binary.BigEndian, uint16(len(name))); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, name); err != nil {
+			return err
+		}
+
+		rd := parts[name]
+		for {
+			n, err := rd.Read(buf)
+			if n > 0 {
+				if err := binary.Write(w, binary.BigEndian, uint32(n)); err != nil {
+					return err
+				}
+				if _, err := w.Write(buf[:n]); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := binary.Write(w, binary.BigEndian, uint32(0)); err != nil {
+			return err
+		}
+	}
+	return binary.Write(w, binary.BigEndian, uint16(0))
+}
+
+// frameReader reads the data of a single part.
+type frameReader struct {
+	r    io.Reader
+	left uint32 // bytes left in the current frame
+	done bool   // the end of the part has been reached
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	if f.done {
+		return 0, io.EOF
+	}
+	if f.left == 0 {
+		if err := binary.Read(f.r, binary.BigEndian, &f.left); err != nil {
+			return 0, partserr(err)
+		}
+		if f.left == 0 {
+			f.done = true
+			return 0, io.EOF
+		}
+	}
+	if uint32(len(p)) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.r.Read(p)
+	f.left -= uint32(n)
+	if err == io.EOF {
+		err = partserr(err)
+	}
+	return n, err
+}
+
+// partserr maps an unexpected end of an object with parts to ErrCorrupt.
+func partserr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: object parts", ErrCorrupt)
+	}
+	return err
+}
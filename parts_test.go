@@ -0,0 +1,84 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Test storing and reading objects with named parts
+func TestParts(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":     nil,
+		"transform": {WithReadTransform(FlagUser, xorRead), WithWriteTransform(FlagUser, xorWrite)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewTemp(t, opts...)
+			data := strings.Repeat("large data ", 10000)
+
+			err := s.StoreParts("doc", map[string]io.Reader{
+				"data":    strings.NewReader(data),
+				"meta":    strings.NewReader(`{"type":"text"}`),
+				"preview": strings.NewReader(""),
+			})
+			if err != nil {
+				t.Fatalf("StoreParts failed: %v", err)
+			}
+
+			if part, _ := s.GetPart("doc", "meta"); string(part) != `{"type":"text"}` {
+				t.Errorf("Got part %q, expected %q", part, `{"type":"text"}`)
+			}
+			if part, _ := s.GetPart("doc", "data"); string(part) != data {
+				t.Errorf("Got part of %d bytes, expected %d bytes", len(part), len(data))
+			}
+			if part, err := s.GetPart("doc", "preview"); err != nil || len(part) != 0 {
+				t.Errorf("Got part %q with error %v, expected an empty part", part, err)
+			}
+			if _, err := s.GetPart("doc", "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Got error %v for a missing part, expected %v", err, ErrNotFound)
+			}
+			if names, _ := s.PartNames("doc"); strings.Join(names, ",") != "data,meta,preview" {
+				t.Errorf("Got part names %v, expected data, meta and preview", names)
+			}
+
+			if _, err := s.Get("doc"); err == nil {
+				t.Errorf("Get of an object with parts succeeded, expected an error")
+			}
+			s.StoreString("plain", "value")
+			if _, err := s.GetPart("plain", "data"); err == nil {
+				t.Errorf("GetPart of a plain object succeeded, expected an error")
+			}
+		})
+	}
+}
+
+// Test that a failing part leaves the previous parts in place
+func TestPartsAtomic(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreParts("doc", map[string]io.Reader{"data": strings.NewReader("old")})
+
+	err := s.StoreParts("doc", map[string]io.Reader{
+		"data": strings.NewReader("new"),
+		"meta": io.MultiReader(bytes.NewReader([]byte("partial")), &failReader{}),
+	})
+	if err == nil {
+		t.Fatalf("StoreParts with a failing part succeeded, expected an error")
+	}
+	if part, _ := s.GetPart("doc", "data"); string(part) != "old" {
+		t.Errorf("Got part %q, expected %q", part, "old")
+	}
+}
+
+// failReader always fails.
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
@@ -0,0 +1,156 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// default permissions of object files and directories
+const (
+	defaultFileMode = os.FileMode(0o600)
+	defaultDirMode  = os.FileMode(0o700)
+)
+
+// WithFileMode sets the permissions of the object files and other files
+// created in the store. The mode is set with an explicit chmod after
+// creation, so it does not depend on the umask of the process. The mode must
+// allow the owner to read and write. The default is 0600.
+func WithFileMode(mode os.FileMode) Option {
+	return func(s *SOS) {
+		s.fileMode = mode
+		s.fixPerms = true
+	}
+}
+
+// WithDirMode sets the permissions of the directories created in the store.
+// The mode is set with an explicit chmod after creation, so it does not
+// depend on the umask of the process. The mode must allow the owner to read,
+// write and enter the directory. The default is 0700.
+//
+// The mode may include os.ModeSetgid, so that files created by other
+// processes inherit the group of the directory.
+func WithDirMode(mode os.FileMode) Option {
+	return func(s *SOS) {
+		s.dirMode = mode
+		s.fixPerms = true
+	}
+}
+
+// WithGroup sets the group ID which owns the files and directories created
+// in the store. Together with WithFileMode and WithDirMode, this allows
+// several services running as different users to share a store. The process
+// must be a member of the group.
+func WithGroup(gid int) Option {
+	return func(s *SOS) {
+		s.gid = gid
+		s.fixPerms = true
+	}
+}
+
+// createfile creates a new file with the configured permissions, and opens
+// it for writing.
+func (s *SOS) createfile(filename string) (fh *os.File, err error) {
+	err = s.retrydir(filepath.Dir(filename), func() error {
+		fh, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, s.fileMode)
+		return err
+	})
+	if err != nil || !s.fixPerms {
+		return fh, err
+	}
+
+	err = fh.Chmod(s.fileMode)
+	if err == nil && s.gid >= 0 {
+		err = fh.Chown(-1, s.gid)
+	}
+	if err != nil {
+		_ = fh.Close()
+		_ = os.Remove(filename)
+		return nil, err
+	}
+	return fh, nil
+}
+
+// writefile creates a new file with the configured permissions, and writes
+// data to it.
+func (s *SOS) writefile(filename string, data []byte) error {
+	fh, err := s.createfile(filename)
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(data)
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(filename)
+	}
+	return err
+}
+
+// mkdirall creates a directory with the configured permissions, along with
+// any necessary parents. It succeeds if the directory already exists.
+func (s *SOS) mkdirall(dirname string) error {
+	if !s.fixPerms {
+		return os.MkdirAll(dirname, s.dirMode)
+	}
+
+	if fi, err := os.Stat(dirname); err == nil && fi.IsDir() {
+		return nil
+	}
+	if parent := filepath.Dir(dirname); parent != dirname {
+		if err := s.mkdirall(parent); err != nil {
+			return err
+		}
+	}
+
+	err := os.Mkdir(dirname, s.dirMode)
+	if errors.Is(err, fs.ErrExist) {
+		// created by another process in the meantime
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(dirname, s.dirMode)
+	if err == nil && s.gid >= 0 {
+		err = os.Chown(dirname, -1, s.gid)
+	}
+	return err
+}
+
+// retrydir runs fn, which creates an entry in the directory dirname. If fn
+// fails because the directory does not exist, as it was not needed before or
+// was removed externally (e.g. by a cleanup script or a partial restore),
+// the directory is created and fn is retried once.
+func (s *SOS) retrydir(dirname string, fn func() error) error {
+	err := fn()
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if _, serr := os.Stat(dirname); !errors.Is(serr, fs.ErrNotExist) {
+		return err // something else is missing, e.g. the source file
+	}
+	if err := s.mkdirall(dirname); err != nil {
+		return err
+	}
+	if err := s.syncparents(dirname); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// chownlink sets the configured group of a symbolic link.
+func (s *SOS) chownlink(filename string) error {
+	if s.gid < 0 {
+		return nil
+	}
+	return os.Lchown(filename, -1, s.gid)
+}
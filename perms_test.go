@@ -0,0 +1,50 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test that files and directories get the configured permissions and group
+func TestPermissions(t *testing.T) {
+	// 0666 and 0777 are reduced by any common umask, unless set explicitly
+	s := NewTemp(t, WithFileMode(0o666), WithDirMode(0o777), WithGroup(os.Getgid()))
+
+	s.StoreString("key", "value")
+	dirname, filename := s.getpath("key")
+
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Stat of object file failed: %v", err)
+	}
+	if fi.Mode().Perm() != 0o666 {
+		t.Errorf("Got mode %v for object file, expected %v", fi.Mode().Perm(), os.FileMode(0o666))
+	}
+
+	for _, d := range []string{dirname, filepath.Dir(dirname), s.tmpdir()} {
+		fi, err := os.Stat(d)
+		if err != nil {
+			t.Fatalf("Stat of directory failed: %v", err)
+		}
+		if fi.Mode().Perm() != 0o777 {
+			t.Errorf("Got mode %v for directory %s, expected %v", fi.Mode().Perm(), d, os.FileMode(0o777))
+		}
+	}
+}
+
+// Test that invalid permissions are rejected
+func TestInvalidPermissions(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := New(dir, WithFileMode(0o400)); err == nil {
+		t.Errorf("New with read-only file mode succeeded, expected an error")
+	}
+	if _, err := New(dir, WithDirMode(0o600)); err == nil {
+		t.Errorf("New with directory mode without execute bit succeeded, expected an error")
+	}
+}
@@ -0,0 +1,165 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pointers are named references to objects, e.g. "latest" for the current
+// version of an artifact. They are stored as symbolic links in the directory
+// .pointers below the base directory, so they can also be followed by
+// external tools.
+
+// SetPointer sets the pointer with the given name to the object identified by
+// the key. The pointer is replaced atomically, if it already exists. The
+// object must exist.
+//
+// The name must not be empty, must not start with a dot and must not contain
+// a slash.
+func (s *SOS) SetPointer(name, key string) (err error) {
+	defer wrappath(&err, "SetPointer", key, s.pointerpath(name))
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := checkpointer(name); err != nil {
+		return err
+	}
+
+	_, filename := s.getpath(key)
+	if _, err := os.Stat(filename); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	// the link target is relative to the pointer directory, so the store
+	// can be moved
+	target, err := filepath.Rel(s.pointerdir(), filename)
+	if err != nil {
+		return err
+	}
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	tmpname := s.tmpfilename()
+	if err := os.Symlink(target, tmpname); err != nil {
+		return err
+	}
+	if err := s.chownlink(tmpname); err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	_ = s.mkdirall(s.pointerdir())
+
+	err = os.Rename(tmpname, s.pointerpath(name))
+	if err != nil {
+		_ = os.Remove(tmpname)
+	}
+	return err
+}
+
+// GetPointer fetches the object referenced by the pointer with the given name,
+// and returns it as byte slice.
+func (s *SOS) GetPointer(name string) (_ []byte, err error) {
+	defer wrappath(&err, "GetPointer", "", s.pointerpath(name))
+
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	defer s.end()
+
+	if err := checkpointer(name); err != nil {
+		return nil, err
+	}
+
+	// a hard link to the symbolic link itself would not help, so resolve
+	// it first
+	target, err := os.Readlink(s.pointerpath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	fh, err := s.openfile(filepath.Join(s.pointerdir(), target))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer fh.Close()
+
+	rd, err := s.decode(fh)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := io.Copy(buffer, rd); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// DeletePointer removes the pointer with the given name. The referenced
+// object is not affected.
+func (s *SOS) DeletePointer(name string) (err error) {
+	defer wrappath(&err, "DeletePointer", "", s.pointerpath(name))
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := checkpointer(name); err != nil {
+		return err
+	}
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	err = os.Remove(s.pointerpath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// pointerdir returns the directory holding the pointers.
+func (s *SOS) pointerdir() string {
+	return s.base + "/" + dirPointers
+}
+
+// pointerpath returns the file name of the pointer with the given name.
+func (s *SOS) pointerpath(name string) string {
+	return s.pointerdir() + "/" + name
+}
+
+// checkpointer checks whether name is a valid pointer name.
+func checkpointer(name string) error {
+	if name == "" || isreserved(name) || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid pointer name %q", name)
+	}
+	return nil
+}
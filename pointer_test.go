@@ -0,0 +1,45 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import "testing"
+
+// Test setting and following pointers
+func TestPointer(t *testing.T) {
+	s := NewTemp(t)
+
+	s.StoreString("v1", "version 1")
+	s.StoreString("v2", "version 2")
+
+	if err := s.SetPointer("latest", "v1"); err != nil {
+		t.Fatalf("SetPointer failed: %v", err)
+	}
+	if obj, _ := s.GetPointer("latest"); string(obj) != "version 1" {
+		t.Errorf("Got %s from pointer, expected %s", obj, "version 1")
+	}
+
+	s.SetPointer("latest", "v2")
+	if obj, _ := s.GetPointer("latest"); string(obj) != "version 2" {
+		t.Errorf("Got %s from pointer, expected %s", obj, "version 2")
+	}
+
+	if err := s.SetPointer("latest", "missing"); err == nil {
+		t.Errorf("Got no error when pointing to a missing key")
+	}
+	for _, name := range []string{"", ".hidden", "a/b"} {
+		if err := s.SetPointer(name, "v1"); err == nil {
+			t.Errorf("Got no error for invalid pointer name %q", name)
+		}
+	}
+
+	s.DeletePointer("latest")
+	if _, err := s.GetPointer("latest"); err == nil {
+		t.Errorf("Got no error for a deleted pointer")
+	}
+	if obj, _ := s.GetString("v2"); obj != "version 2" {
+		t.Errorf("Deleting a pointer affected the object")
+	}
+}
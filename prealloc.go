@@ -0,0 +1,55 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// StoreFromSize stores a value of known size, which is read from an
+// io.Reader, under the given key in the object store.
+//
+// The disk space for the value is preallocated before it is written, where
+// the platform supports it. This avoids fragmentation of large objects, and
+// detects a full file system before gigabytes are streamed. If the reader
+// yields more or less than size bytes, the value is not stored, and an error
+// wrapping ErrSizeMismatch is returned.
+func (s *SOS) StoreFromSize(key string, rd io.Reader, size int64) (err error) {
+	defer s.wraperr(&err, "Store", key)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return err
+		}
+	}
+
+	// read one byte more than expected, to detect oversized values
+	tmpname, n, err := s.writetmpsize(io.LimitReader(rd, size+1), size)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		_ = os.Remove(tmpname)
+		if n > size {
+			return fmt.Errorf("%w: expected %d bytes, got more", ErrSizeMismatch, size)
+		}
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrSizeMismatch, size, n)
+	}
+
+	err = s.commit(key, tmpname)
+	if err == nil {
+		s.usage("Store", key, n)
+		s.notify("Store", key, n)
+	}
+	return err
+}
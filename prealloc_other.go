@@ -0,0 +1,15 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build !linux
+
+package sos
+
+import "os"
+
+// preallocate does nothing on this platform.
+func preallocate(f *os.File, size int64) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test storing values of known size
+func TestStoreFromSize(t *testing.T) {
+	s := NewTemp(t)
+	val := strings.Repeat("x", 100000)
+
+	if err := s.StoreFromSize("ok", strings.NewReader(val), int64(len(val))); err != nil {
+		t.Fatalf("StoreFromSize failed: %v", err)
+	}
+	if obj, _ := s.GetString("ok"); obj != val {
+		t.Errorf("Got %d bytes from store, expected %d", len(obj), len(val))
+	}
+
+	for _, size := range []int64{int64(len(val)) - 1, int64(len(val)) + 1} {
+		err := s.StoreFromSize("bad", strings.NewReader(val), size)
+		if !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("Got error %v for size %d, expected %v", err, size, ErrSizeMismatch)
+		}
+	}
+	if _, err := s.Get("bad"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got object with mismatching size")
+	}
+}
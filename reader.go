@@ -0,0 +1,160 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// GetReader opens an object in the store, identified by the key, for
+// streaming. The value is read lazily from a hard link of the object file, so
+// it is not affected by a Store or Delete of the key in the meantime. The
+// caller must close the reader after use, which removes the hard link.
+func (s *SOS) GetReader(key string) (_ io.ReadCloser, err error) {
+	defer s.wraperr(&err, "Get", key)
+
+	return s.openreader(key)
+}
+
+// Object is an object opened for streaming by GetObject, together with the
+// attributes of its object file. All of them are taken from the same version
+// of the object.
+type Object struct {
+	io.ReadCloser
+	Meta      Meta      // metadata, see StoreWithMeta
+	ModTime   time.Time // time of the last Store or Touch
+	Digest    Digest    // checksum and size of the value, if HasDigest is set
+	HasDigest bool      // the digest was recorded, see WithDigests
+}
+
+// GetObject opens an object for streaming, like GetReader, and returns its
+// metadata, modification time and digest. Only the header of the object file
+// is read, until the value is read from the Object. The caller must close the
+// Object after use.
+func (s *SOS) GetObject(key string) (_ *Object, err error) {
+	defer s.wraperr(&err, "Get", key)
+
+	r, err := s.openreader(key)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Object{ReadCloser: r}
+	obj.Digest, obj.HasDigest = headerdigest(r.h)
+	if r.h != nil {
+		obj.Meta, err = unmarshalmeta(r.h.fields[tagMeta])
+	}
+	if err == nil {
+		var fi os.FileInfo
+		if fi, err = r.fh.Stat(); err == nil {
+			obj.ModTime = fi.ModTime()
+		}
+	}
+	if err != nil {
+		r.abort(err)
+		return nil, err
+	}
+	return obj, nil
+}
+
+// openreader opens an object and returns a reader for its plain value. The
+// operation lasts until the reader is closed, and is observed then.
+func (s *SOS) openreader(key string) (_ *objectReader, err error) {
+	o := s.startop(context.Background(), "Get", key)
+	defer func() {
+		if err != nil {
+			_, path := s.getpath(key)
+			wrappath(&err, "Get", key, path)
+			s.observe(o, &err)
+		}
+	}()
+
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+
+	if s.collisionCheck {
+		if err := s.checkindex(key); err != nil {
+			s.end()
+			return nil, err
+		}
+	}
+
+	fh, err := s.open(key)
+	if err != nil {
+		s.end()
+		return nil, err
+	}
+
+	h, rd, err := s.decodeheader(fh)
+	if err == nil && h != nil && h.fields[tagParts] != nil {
+		err = errParts
+	}
+	if err != nil {
+		_ = fh.Close()
+		s.end()
+		return nil, err
+	}
+
+	cr := &countReader{r: rd}
+	return &objectReader{Reader: cr, s: s, key: key, op: o, fh: fh, cr: cr, h: h}, nil
+}
+
+// objectReader reads an object and releases the underlying file on Close.
+type objectReader struct {
+	io.Reader
+	s      *SOS
+	key    string
+	op     *operation // observed on Close
+	fh     *linkedFile
+	cr     *countReader
+	h      *header   // header of the object file, or nil
+	inner  io.Closer // optional decoder, closed before the file
+	closed bool
+}
+
+// Close closes the decoder, if any, and the object file. The operation is
+// observed with the bytes read, and fails with the first read error, if
+// any.
+func (r *objectReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	defer r.s.end()
+
+	var err error
+	if r.inner != nil {
+		err = r.inner.Close()
+	}
+	if cerr := r.fh.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		r.s.usage("Get", r.key, r.cr.n)
+	}
+
+	operr := err
+	if operr == nil {
+		operr = r.cr.err
+	}
+	r.op.info.Bytes = r.cr.n
+	r.s.observe(r.op, &operr)
+	return err
+}
+
+// abort closes the reader after a failure while it was set up, and observes
+// the operation with err.
+func (r *objectReader) abort(err error) {
+	r.closed = true
+	_ = r.fh.Close()
+	r.s.end()
+	_, path := r.s.getpath(r.key)
+	wrappath(&err, "Get", r.key, path)
+	r.s.observe(r.op, &err)
+}
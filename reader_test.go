@@ -0,0 +1,80 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// Test streaming a value which is replaced and deleted while it is read
+func TestGetReader(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("hello", "world")
+
+	rd, err := s.GetReader("hello")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+
+	s.StoreString("hello", "again")
+	s.Delete("hello")
+
+	buf, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatalf("Reading the value failed: %v", err)
+	}
+	if string(buf) != "world" {
+		t.Errorf("Got %s from store, expected %s", buf, "world")
+	}
+
+	if err := rd.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := rd.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+
+	// the hard link has been removed
+	entries, _ := os.ReadDir(s.tmpdir())
+	if len(entries) != 0 {
+		t.Errorf("Got %d temporary files after Close, expected none", len(entries))
+	}
+
+	if _, err := s.GetReader("hello"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for a missing key, expected ErrNotFound", err)
+	}
+}
+
+// Test that GetObject returns the attributes of the object
+func TestGetObject(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+	s.StoreWithMeta("hello", []byte("world"), Meta{ContentType: "text/plain"})
+
+	obj, err := s.GetObject("hello")
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	defer obj.Close()
+
+	if obj.Meta.ContentType != "text/plain" {
+		t.Errorf("Got content type %q, expected %q", obj.Meta.ContentType, "text/plain")
+	}
+	if !obj.ModTime.Equal(clock.Now()) {
+		t.Errorf("Got modification time %v, expected %v", obj.ModTime, clock.Now())
+	}
+	if buf, _ := io.ReadAll(obj); string(buf) != "world" {
+		t.Errorf("Got %s from store, expected %s", buf, "world")
+	}
+
+	if _, err := s.GetObject("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for a missing key, expected ErrNotFound", err)
+	}
+}
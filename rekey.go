@@ -0,0 +1,125 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// RekeyReport summarizes the result of a Rekey operation.
+type RekeyReport struct {
+	Renamed int // objects moved to a new key
+	Deleted int // objects dropped by the mapper
+}
+
+// Rekey passes the key of every object in the key index to mapper, and moves
+// the object to the returned new key. If mapper returns keep as false, the
+// object is deleted. Objects whose key is not changed are left untouched.
+// The values are not rewritten, so this is fast even for large objects.
+//
+// If the new key exists already, Rekey fails with ErrExists, so a mapper
+// which maps several keys to the same new key does not lose objects. The
+// objects moved so far remain moved.
+//
+// A moved object is reported to the event sink (see WithEventSink) as a
+// Delete of the old key and a Store of the new key, with the size of the
+// object file. Only objects stored with WithKeyIndex or WithCollisionCheck
+// are found. The returned report is valid even if an error occurs.
+func (s *SOS) Rekey(mapper func(oldKey string) (newKey string, keep bool)) (report RekeyReport, err error) {
+	defer s.wraperr(&err, "Rekey", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	// list the keys first, so objects are not moved while iterating
+	keys, err := s.List("")
+	if err != nil {
+		return report, err
+	}
+
+	for _, key := range keys {
+		newkey, keep := mapper(key)
+		switch {
+		case !keep:
+			err = s.Delete(key)
+			if err == nil {
+				report.Deleted++
+			}
+		case newkey != key:
+			err = s.rekeyobject(key, newkey)
+			if err == nil {
+				report.Renamed++
+			}
+		}
+		if errors.Is(err, ErrNotFound) {
+			continue // deleted in the meantime
+		}
+		if err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				return report, err
+			}
+			_, filename := s.getpath(key)
+			return report, &Error{Op: "Rekey", Key: key, Path: filename, Err: err}
+		}
+	}
+	return report, nil
+}
+
+// rekeyobject moves the object of key to newkey, along with its index entry.
+// The object is linked to its new location instead of renamed, as this fails
+// if newkey exists.
+func (s *SOS) rekeyobject(key, newkey string) error {
+	// the index entry is written first, so the moved object is never
+	// missing from the index
+	if err := s.writeindex(newkey); err != nil {
+		return err
+	}
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	hs, newhs := s.keyhash(key), s.keyhash(newkey)
+	_, filename := s.hashpath(hs)
+	newdir, newname := s.hashpath(newhs)
+	err := s.change(newhs, false, func() error {
+		return s.retrydir(newdir, func() error {
+			return os.Link(filename, newname)
+		})
+	})
+	if errors.Is(err, fs.ErrExist) {
+		return ErrExists
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.change(hs, false, func() error {
+		return os.Remove(filename)
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	s.removeindex(key)
+
+	var size int64
+	if fi, err := os.Stat(newname); err == nil {
+		size = fi.Size()
+	}
+	s.usage("Rekey", newkey, 0)
+	s.notify("Delete", key, 0)
+	s.notify("Store", newkey, size)
+	return nil
+}
@@ -0,0 +1,65 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test renaming and dropping keys through a mapping function
+func TestRekey(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex())
+	s.StoreString("user/1", "alice")
+	s.StoreString("user/2", "bob")
+	s.StoreString("tmp/1", "junk")
+	s.StoreString("config", "x")
+
+	report, err := s.Rekey(func(key string) (string, bool) {
+		if strings.HasPrefix(key, "tmp/") {
+			return "", false
+		}
+		return strings.Replace(key, "user/", "users/", 1), true
+	})
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if report != (RekeyReport{Renamed: 2, Deleted: 1}) {
+		t.Errorf("Got report %+v, expected 2 renamed and 1 deleted", report)
+	}
+
+	keys, _ := s.List("")
+	if got := strings.Join(keys, " "); got != "config users/1 users/2" {
+		t.Errorf("Got keys %s, expected %s", got, "config users/1 users/2")
+	}
+	if obj, _ := s.GetString("users/2"); obj != "bob" {
+		t.Errorf("Got %s from store, expected %s", obj, "bob")
+	}
+	if _, err := s.GetString("user/2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for the old key, expected ErrNotFound", err)
+	}
+}
+
+// Test that Rekey does not overwrite existing keys
+func TestRekeyExisting(t *testing.T) {
+	s := NewTemp(t, WithKeyIndex())
+	s.StoreString("a", "first")
+	s.StoreString("b", "second")
+
+	_, err := s.Rekey(func(key string) (string, bool) {
+		return "b", true
+	})
+	if !errors.Is(err, ErrExists) {
+		t.Errorf("Got %v when mapping onto an existing key, expected ErrExists", err)
+	}
+	if obj, _ := s.GetString("a"); obj != "first" {
+		t.Errorf("Got %s from store, expected %s", obj, "first")
+	}
+	if obj, _ := s.GetString("b"); obj != "second" {
+		t.Errorf("Got %s from store, expected %s", obj, "second")
+	}
+}
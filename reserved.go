@@ -0,0 +1,45 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import "strings"
+
+// Internal directories below the base directory. All of them start with a
+// dot, while the shard directories and object files are named by hex digits
+// of the key hash. So, an object can never collide with an internal
+// directory, whatever its key is.
+const (
+	dirTmp        = ".tmp"        // temporary files of Store and Get
+	dirPointers   = ".pointers"   // named pointers to objects
+	dirIndex      = ".index"      // original keys of objects
+	dirSnapshots  = ".snapshots"  // reserved for snapshots
+	dirTrash      = ".trash"      // reserved for deleted objects
+	dirSync       = ".sync"       // state of two-way synchronizations
+	dirLeases     = ".leases"     // claims of objects by workers
+	dirChunks     = ".chunks"     // content addressed chunks of large values
+	dirManifests  = ".manifests"  // checksums of the shards, see Verify
+	dirLocks      = ".locks"      // locks of conditional writes on keys
+	dirCounters   = ".counters"   // counts of objects and bytes, see WithCounters
+	dirQuarantine = ".quarantine" // damaged files moved away by Fsck
+	dirTombstones = ".tombstones" // deleted objects, see ExportChangedSince
+)
+
+// Internal files in the base directory.
+const (
+	fileLayout = ".layout" // options which determine the object locations, see New
+	fileLastGC = ".lastgc" // time of the last complete Expire run, see Stats
+)
+
+// reservedDirs lists all internal directories.
+var reservedDirs = []string{dirTmp, dirPointers, dirIndex, dirSnapshots, dirTrash, dirSync, dirLeases, dirChunks, dirManifests, dirLocks, dirCounters, dirQuarantine, dirTombstones}
+
+// isreserved reports whether name, an entry of the base directory, is an
+// internal directory or otherwise reserved. All names starting with a dot
+// are reserved for future use, so walks, listings and exports never treat
+// them as objects.
+func isreserved(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
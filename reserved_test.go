@@ -0,0 +1,57 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test that internal directories are never treated as objects
+func TestReserved(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("hello", "world")
+	_, filename := s.getpath("hello")
+	rel, _ := filepath.Rel(s.base, filename)
+
+	// put files which look like objects into all reserved directories
+	for _, dir := range reservedDirs {
+		name := filepath.Join(s.base, dir, rel)
+		os.MkdirAll(filepath.Dir(name), 0o700)
+		os.WriteFile(name, []byte("internal"), 0o600)
+	}
+
+	n := 0
+	s.walk(func(rel string, fi fs.FileInfo) error {
+		n++
+		if strings.HasPrefix(rel, ".") {
+			t.Errorf("Walk returned internal file %s", rel)
+		}
+		return nil
+	})
+	if n != 1 {
+		t.Errorf("Walk returned %d objects, expected 1", n)
+	}
+
+	buf := new(bytes.Buffer)
+	s.ExportTar(buf)
+	if objs := readTar(t, buf); len(objs) != 1 {
+		t.Errorf("Got %d objects in export, expected 1", len(objs))
+	}
+
+	for _, dir := range reservedDirs {
+		if !isreserved(dir) {
+			t.Errorf("Internal directory %s is not reserved", dir)
+		}
+		if s.isobjectpath(dir + "/" + filepath.ToSlash(rel)) {
+			t.Errorf("Path in internal directory %s is a valid object path", dir)
+		}
+	}
+}
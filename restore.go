@@ -0,0 +1,271 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RestoreReport describes the result of a Restore operation.
+type RestoreReport struct {
+	Restored   int      // objects written to the store
+	Deleted    int      // objects removed by the tombstones of the stream
+	Mismatches []string // objects which differ from the manifest, or are not listed
+	Missing    []string // objects listed in the manifest, but not in the stream
+}
+
+// Restore reads a full export, as written by ExportTar, into the store.
+// Existing objects are overwritten, and the modification times of the
+// objects are preserved. The deletions of an incremental export are applied
+// like in ImportTar, so a full export followed by the incremental exports
+// since restores the store of the last export.
+//
+// If verify is true, the checksum and the size of every object are verified
+// against the manifest at the end of the stream, before the store is
+// changed. The objects are staged in temporary files until then. If an
+// object does not match, or an object of the manifest is missing, the store
+// is left unchanged, and an error is returned together with a report of the
+// problems. A stream without a manifest cannot be verified.
+//
+// The chunks of chunked objects are verified against their hash in any
+// case. With verify, the chunks which the objects refer to must be part of
+// the stream or exist in the store, or they are reported as missing. The key
+// index entries of the stream are stored if the store keeps a key index (see
+// WithKeyIndex).
+//
+// The object paths in the report are relative to the base directory.
+func (s *SOS) Restore(r io.Reader, verify bool) (report RestoreReport, err error) {
+	defer s.wraperr(&err, "Restore", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	type staged struct {
+		rel, tmpname string
+		digest       string
+		size         int64
+		dir, hs      string // see tarentry
+	}
+	type tombstone struct {
+		hs      string
+		deleted time.Time
+	}
+	var (
+		objects    []staged
+		tombstones []tombstone
+		manifest   map[string]string
+	)
+	applytombstones := func() error {
+		for _, ts := range tombstones {
+			removed, err := s.applytombstone(ts.hs, ts.deleted)
+			if err != nil {
+				return err
+			}
+			if removed {
+				report.Deleted++
+			}
+		}
+		return nil
+	}
+	defer func() {
+		for _, o := range objects {
+			_ = os.Remove(o.tmpname)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Name == exportManifest {
+			if manifest, err = readexportmanifest(tr); err != nil {
+				return report, err
+			}
+			continue
+		}
+		dir, hs, ok := s.tarentry(hdr.Name)
+		if !ok {
+			return report, fmt.Errorf("invalid object name %q in tar stream", hdr.Name)
+		}
+		if dir == dirTombstones {
+			tombstones = append(tombstones, tombstone{hs, hdr.ModTime})
+			continue
+		}
+
+		h := sha256.New()
+		cw := &countWriter{}
+		tmpname, err := s.writetmpfile(io.TeeReader(tr, io.MultiWriter(h, cw)), hdr)
+		if err != nil {
+			return report, err
+		}
+		o := staged{hdr.Name, tmpname, hex.EncodeToString(h.Sum(nil)), cw.n, dir, hs}
+		if verify {
+			objects = append(objects, o)
+			continue
+		}
+		if err := s.restorestaged(o.dir, o.rel, o.hs, o.tmpname); err != nil {
+			return report, err
+		}
+		if o.dir == "" {
+			report.Restored++
+		}
+	}
+	if !verify {
+		err := applytombstones()
+		return report, err
+	}
+
+	if manifest == nil {
+		return report, fmt.Errorf("no manifest in tar stream")
+	}
+	found := make(map[string]bool)
+	for _, o := range objects {
+		found[o.rel] = true
+		if manifest[o.rel] != fmt.Sprintf("%s %d", o.digest, o.size) ||
+			s.checkstaged(o.dir, o.rel, o.hs, o.tmpname) != nil {
+			report.Mismatches = append(report.Mismatches, o.rel)
+		}
+	}
+	for rel := range manifest {
+		if !found[rel] {
+			report.Missing = append(report.Missing, rel)
+		}
+	}
+
+	// the chunks of the objects must be in the stream or in the store
+	refs := make(map[string]bool)
+	for _, o := range objects {
+		if o.dir == "" {
+			if err := s.chunkrefs(o.tmpname, refs); err != nil && !errors.Is(err, ErrCorrupt) {
+				return report, err
+			}
+		}
+	}
+	for sum := range refs {
+		rel := chunkname(sum)
+		if found[rel] || manifest[rel] != "" {
+			continue
+		}
+		_, filename := s.chunkpath(sum)
+		if _, err := os.Stat(filename); err != nil {
+			report.Missing = append(report.Missing, rel)
+		}
+	}
+	sort.Strings(report.Missing)
+	if len(report.Mismatches) > 0 || len(report.Missing) > 0 {
+		return report, fmt.Errorf("%w: %d mismatched and %d missing objects",
+			ErrCorrupt, len(report.Mismatches), len(report.Missing))
+	}
+
+	// chunks first, so no object refers to a missing chunk, and index
+	// entries last, so no entry refers to a missing object
+	order := map[string]int{dirChunks: 0, "": 1, dirIndex: 2}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return order[objects[i].dir] < order[objects[j].dir]
+	})
+	for len(objects) > 0 {
+		o := objects[0]
+		objects = objects[1:]
+		if err := s.restorestaged(o.dir, o.rel, o.hs, o.tmpname); err != nil {
+			return report, err
+		}
+		if o.dir == "" {
+			report.Restored++
+		}
+	}
+	err = applytombstones()
+	return report, err
+}
+
+// checkstaged verifies a staged chunk or key index entry against its name.
+// dir, rel and hs describe the tar entry, see tarentry.
+func (s *SOS) checkstaged(dir, rel, hs, tmpname string) error {
+	switch dir {
+	case dirChunks:
+		sum, _ := chunksum(rel)
+		return s.checkchunk(tmpname, sum)
+	case dirIndex:
+		fh, err := os.Open(tmpname)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		_, err = s.readindexentry(fh, hs)
+		return err
+	}
+	return nil
+}
+
+// restorestaged moves a staged file to its place in the store. dir, rel and
+// hs describe the tar entry, see tarentry.
+func (s *SOS) restorestaged(dir, rel, hs, tmpname string) error {
+	switch dir {
+	case dirChunks:
+		sum, _ := chunksum(rel)
+		return s.storechunk(tmpname, sum)
+	case dirIndex:
+		defer os.Remove(tmpname)
+		fh, err := os.Open(tmpname)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		return s.importindex(fh, hs)
+	}
+	return s.restorefile(rel, tmpname)
+}
+
+// restorefile moves a staged object file to its place in the store.
+func (s *SOS) restorefile(rel, tmpname string) error {
+	if err := s.beginmodify(); err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	defer s.endmodify()
+
+	filename := filepath.Join(s.base, filepath.FromSlash(rel))
+	return s.change(s.relhash(rel), false, func() error {
+		return s.commitfile(tmpname, filepath.Dir(filename), filename)
+	})
+}
+
+// readexportmanifest reads the manifest of an exported tar stream. It maps
+// the object paths to their checksum and size.
+func readexportmanifest(r io.Reader) (map[string]string, error) {
+	manifest := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var (
+			digest, rel string
+			size        int64
+		)
+		if _, err := fmt.Sscanf(sc.Text(), "%s %d %s", &digest, &size, &rel); err != nil {
+			return nil, fmt.Errorf("%w: manifest in tar stream", ErrCorrupt)
+		}
+		manifest[rel] = fmt.Sprintf("%s %d", digest, size)
+	}
+	return manifest, sc.Err()
+}
@@ -0,0 +1,86 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Test restoring a verified export
+func TestRestore(t *testing.T) {
+	src := NewTemp(t)
+	src.StoreString("key1", "value1")
+	src.StoreString("key2", "value2")
+
+	export := new(bytes.Buffer)
+	if err := src.ExportTar(export); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+
+	dst := NewTemp(t)
+	report, err := dst.Restore(bytes.NewReader(export.Bytes()), true)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if report.Restored != 2 {
+		t.Errorf("Got %d restored objects, expected 2", report.Restored)
+	}
+	if obj, _ := dst.GetString("key2"); obj != "value2" {
+		t.Errorf("Got %s from store, expected %s", obj, "value2")
+	}
+}
+
+// Test that a corrupt or incomplete export leaves the store unchanged
+func TestRestoreMismatch(t *testing.T) {
+	src := NewTemp(t)
+	src.StoreString("key1", "value1")
+	src.StoreString("key2", "value2")
+	export := new(bytes.Buffer)
+	src.ExportTar(export)
+
+	// rewrite the stream with the first object corrupted and the second
+	// object dropped
+	corrupt := new(bytes.Buffer)
+	tr := tar.NewReader(export)
+	tw := tar.NewWriter(corrupt)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		switch {
+		case i == 0:
+			data = []byte("valueX")
+		case i == 1:
+			continue
+		}
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+
+	dst := NewTemp(t)
+	report, err := dst.Restore(corrupt, true)
+	if err == nil {
+		t.Fatalf("Restore of a corrupt export succeeded, expected an error")
+	}
+	if len(report.Mismatches) != 1 || len(report.Missing) != 1 || report.Restored != 0 {
+		t.Errorf("Got report %+v, expected one mismatch and one missing object", report)
+	}
+	for _, key := range []string{"key1", "key2"} {
+		if _, err := dst.GetString(key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Got error %v for %s, expected %v", err, key, ErrNotFound)
+		}
+	}
+	if info, _ := dst.TempStats(); info.Count != 0 {
+		t.Errorf("Got %d temporary files after Restore, expected 0", info.Count)
+	}
+}
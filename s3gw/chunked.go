@@ -0,0 +1,95 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package s3gw
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// payload returns the value of a PutObject request. Clients may send it in
+// the aws-chunked encoding, with chunk signatures or trailing checksums,
+// which are not verified.
+func payload(r *http.Request) (io.Reader, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return r.Body, nil
+	}
+	size, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	if err != nil {
+		return nil, errInvalidArgument
+	}
+	return &sizeReader{r: &chunkedReader{br: bufio.NewReader(r.Body)}, n: size}, nil
+}
+
+// chunkedReader decodes the aws-chunked encoding. Each chunk starts with its
+// hex encoded size, optionally followed by ";chunk-signature=...", and ends
+// with CRLF. The last chunk has the size 0, and is followed by optional
+// trailing headers.
+type chunkedReader struct {
+	br   *bufio.Reader
+	left int64 // remaining bytes of the current chunk
+	eof  bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.left == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.br.Read(p)
+	c.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// next reads the end of the previous chunk, and the size of the next one.
+func (c *chunkedReader) next() error {
+	line, err := c.br.ReadString('\n')
+	if err == nil && strings.TrimSpace(line) == "" {
+		// the CRLF after the data of the previous chunk
+		line, err = c.br.ReadString('\n')
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errIncompleteBody, err)
+	}
+
+	hexsize, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+	size, err := strconv.ParseInt(hexsize, 16, 64)
+	if err != nil || size < 0 {
+		return errIncompleteBody
+	}
+	c.left, c.eof = size, size == 0
+	return nil
+}
+
+// sizeReader fails, if the reader does not return exactly n bytes.
+type sizeReader struct {
+	r io.Reader
+	n int64
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n -= int64(n)
+	if s.n < 0 || (err == io.EOF && s.n != 0) {
+		return n, errIncompleteBody
+	}
+	return n, err
+}
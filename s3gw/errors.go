@@ -0,0 +1,62 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package s3gw
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/hweidner/sos"
+)
+
+// s3Error is an error in the terms of the S3 API.
+type s3Error struct {
+	code   string
+	status int
+}
+
+func (e *s3Error) Error() string {
+	return e.code
+}
+
+var (
+	errNoSuchKey       = &s3Error{"NoSuchKey", http.StatusNotFound}
+	errNoSuchBucket    = &s3Error{"NoSuchBucket", http.StatusNotFound}
+	errNotImplemented  = &s3Error{"NotImplemented", http.StatusNotImplemented}
+	errInvalidRange    = &s3Error{"InvalidRange", http.StatusRequestedRangeNotSatisfiable}
+	errInvalidArgument = &s3Error{"InvalidArgument", http.StatusBadRequest}
+	errIncompleteBody  = &s3Error{"IncompleteBody", http.StatusBadRequest}
+	errInternal        = &s3Error{"InternalError", http.StatusInternalServerError}
+	errUnavailable     = &s3Error{"ServiceUnavailable", http.StatusServiceUnavailable}
+)
+
+// writeerror sends an S3 error response matching err.
+func writeerror(w http.ResponseWriter, r *http.Request, err error) {
+	var e *s3Error
+	switch {
+	case errors.As(err, &e):
+	case errors.Is(err, sos.ErrNotFound):
+		e = errNoSuchKey
+	case errors.Is(err, sos.ErrClosed), errors.Is(err, sos.ErrFrozen),
+		errors.Is(err, sos.ErrStoreUnhealthy):
+		e = errUnavailable
+	default:
+		e = errInternal
+	}
+
+	if r.Method == http.MethodHead {
+		// responses to HEAD have no body
+		w.WriteHeader(e.status)
+		return
+	}
+	writexml(w, e.status, struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string   `xml:"Code"`
+		Message  string   `xml:"Message"`
+		Resource string   `xml:"Resource"`
+	}{Code: e.code, Message: err.Error(), Resource: r.URL.Path})
+}
@@ -0,0 +1,398 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package s3gw serves a simple object store through a minimal subset of the
+Amazon S3 REST API, so S3 clients and backup tools can use it directly.
+
+The store appears as a single bucket, addressed in path style
+(http://host:port/bucket/key). The supported operations are PutObject,
+GetObject (including single byte ranges), HeadObject, DeleteObject,
+ListObjectsV2, HeadBucket and ListBuckets. The content type and the user
+metadata (x-amz-meta-*) of objects are kept, see sos.Meta. For example:
+
+	s, err := sos.New("/srv/objects", sos.WithKeyIndex(), sos.WithDigests())
+	...
+	log.Fatal(http.ListenAndServe(":9000", s3gw.New(s, "backup")))
+
+The store should be created with sos.WithKeyIndex, as ListObjectsV2 only
+finds the objects in the key index, and with sos.WithDigests, which provides
+the ETags, the object sizes in listings and the byte ranges.
+
+Requests are not authenticated: signatures are accepted without checking
+them. The gateway must be run on a trusted network, or behind a proxy which
+authenticates the clients. Multipart uploads, versioning, ACLs and copying
+are not supported, and answered with NotImplemented; clients like the AWS
+CLI need a multipart threshold larger than their largest object.
+*/
+package s3gw
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hweidner/sos"
+)
+
+// maxKeys is the default and maximum number of keys in a listing.
+const maxKeys = 1000
+
+// metaPrefix is the header prefix of user metadata.
+const metaPrefix = "X-Amz-Meta-"
+
+// Gateway serves a store as a single S3 bucket.
+type Gateway struct {
+	Store  *sos.SOS
+	Bucket string
+}
+
+// New returns a gateway which serves the store s as the bucket named bucket.
+func New(s *sos.SOS, bucket string) *Gateway {
+	return &Gateway{Store: s, Bucket: bucket}
+}
+
+// ServeHTTP handles an S3 request.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			writeerror(w, r, errNotImplemented)
+			return
+		}
+		g.listbuckets(w)
+	case bucket != g.Bucket:
+		writeerror(w, r, errNoSuchBucket)
+	case unsupported(query):
+		writeerror(w, r, errNotImplemented)
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case key == "" && r.Method == http.MethodGet:
+		g.list(w, r)
+	case key == "":
+		writeerror(w, r, errNotImplemented)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		g.get(w, r, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") == "":
+		g.put(w, r, key)
+	case r.Method == http.MethodDelete:
+		g.delete(w, r, key)
+	default:
+		writeerror(w, r, errNotImplemented)
+	}
+}
+
+// unsupported reports whether a request addresses a subresource like
+// ?uploads or ?acl, which the gateway does not implement.
+func unsupported(query map[string][]string) bool {
+	for name := range query {
+		switch name {
+		case "list-type", "prefix", "delimiter", "max-keys", "continuation-token",
+			"start-after", "encoding-type", "fetch-owner", "x-id":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// put stores an object.
+func (g *Gateway) put(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := payload(r)
+	if err != nil {
+		writeerror(w, r, err)
+		return
+	}
+
+	meta := sos.Meta{ContentType: r.Header.Get("Content-Type")}
+	for name, values := range r.Header {
+		if attr, ok := strings.CutPrefix(name, metaPrefix); ok && len(values) > 0 {
+			if meta.Attrs == nil {
+				meta.Attrs = make(map[string]string)
+			}
+			meta.Attrs[strings.ToLower(attr)] = values[0]
+		}
+	}
+
+	if err := g.Store.StoreFromMeta(key, body, meta); err != nil {
+		writeerror(w, r, err)
+		return
+	}
+
+	// the digest of the stored value, if the store records it
+	if obj, err := g.Store.GetObject(key); err == nil {
+		if obj.HasDigest {
+			w.Header().Set("ETag", etag(obj))
+		}
+		obj.Close()
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// get sends an object, or only its headers on HEAD.
+func (g *Gateway) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj, err := g.Store.GetObject(key)
+	if err != nil {
+		writeerror(w, r, err)
+		return
+	}
+	defer obj.Close()
+
+	h := w.Header()
+	ct := obj.Meta.ContentType
+	if ct == "" {
+		ct = "binary/octet-stream"
+	}
+	h.Set("Content-Type", ct)
+	h.Set("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	for attr, value := range obj.Meta.Attrs {
+		h.Set(metaPrefix+attr, value)
+	}
+	if !obj.HasDigest {
+		// without the size, ranges cannot be served
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = io.Copy(w, obj)
+		}
+		return
+	}
+
+	h.Set("ETag", etag(obj))
+	h.Set("Accept-Ranges", "bytes")
+	size := obj.Digest.Size
+	start, length, ok := byterange(r.Header.Get("Range"), size)
+	if !ok {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		writeerror(w, r, errInvalidRange)
+		return
+	}
+	status := http.StatusOK
+	if length < size {
+		status = http.StatusPartialContent
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	}
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// the status is sent already, so a failure only cuts the body short
+	if _, err := io.CopyN(io.Discard, obj, start); err == nil {
+		_, _ = io.CopyN(w, obj, length)
+	}
+}
+
+// byterange parses a Range header with a single byte range. It returns the
+// whole value for an empty header, and false for an unsatisfiable range.
+func byterange(header string, size int64) (start, length int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, true // ranges may be ignored
+	}
+	first, last, _ := strings.Cut(spec, "-")
+	end := size - 1
+	var err error
+	switch {
+	case first == "": // suffix range, e.g. -500
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size, true
+		}
+		start = max(size-n, 0)
+	default:
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+			return 0, size, true
+		}
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil {
+				return 0, size, true
+			}
+			end = min(end, size-1)
+		}
+	}
+	if start >= size || end < start {
+		return 0, 0, false
+	}
+	return start, end - start + 1, true
+}
+
+// delete deletes an object. Like S3, deleting a missing object succeeds.
+func (g *Gateway) delete(w http.ResponseWriter, r *http.Request, key string) {
+	if err := g.Store.Delete(key); err != nil && !errors.Is(err, sos.ErrNotFound) {
+		writeerror(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listResult is the response of ListObjectsV2.
+type listResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObject describes an object in a listing.
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// commonPrefix is a group of keys in a listing with a delimiter.
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// list lists the keys of the bucket (ListObjectsV2). The continuation token
+// is the last key of the previous page.
+func (g *Gateway) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	res := listResult{
+		Name:              g.Bucket,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           maxKeys,
+	}
+	if s := q.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeerror(w, r, errInvalidArgument)
+			return
+		}
+		res.MaxKeys = min(n, maxKeys)
+	}
+	after := max(res.StartAfter, res.ContinuationToken)
+
+	keys, err := g.Store.List(res.Prefix)
+	if err != nil {
+		writeerror(w, r, err)
+		return
+	}
+	i := sort.SearchStrings(keys, after)
+	if i < len(keys) && keys[i] == after {
+		i++
+	}
+
+	last := ""
+	for ; i < len(keys); i++ {
+		key := keys[i]
+		// a group of keys is listed once, as common prefix
+		if res.Delimiter != "" {
+			if j := strings.Index(key[len(res.Prefix):], res.Delimiter); j >= 0 {
+				prefix := key[:len(res.Prefix)+j+len(res.Delimiter)]
+				if prefix == last || strings.HasPrefix(after, prefix) {
+					continue
+				}
+				if res.KeyCount == res.MaxKeys {
+					res.IsTruncated = true
+					break
+				}
+				res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{prefix})
+				res.KeyCount++
+				res.NextContinuationToken, last = prefix, prefix
+				continue
+			}
+		}
+
+		if res.KeyCount == res.MaxKeys {
+			res.IsTruncated = true
+			break
+		}
+		entry, found, err := g.entry(key)
+		if err != nil {
+			writeerror(w, r, err)
+			return
+		}
+		if !found {
+			continue // deleted in the meantime
+		}
+		res.Contents = append(res.Contents, entry)
+		res.KeyCount++
+		res.NextContinuationToken = key
+	}
+	if !res.IsTruncated {
+		res.NextContinuationToken = ""
+	}
+	writexml(w, http.StatusOK, res)
+}
+
+// entry returns the description of an object in a listing. The size of the
+// value is only known from the digest; otherwise, the size of the object file
+// is listed.
+func (g *Gateway) entry(key string) (listObject, bool, error) {
+	obj, err := g.Store.GetObject(key)
+	if errors.Is(err, sos.ErrNotFound) {
+		return listObject{}, false, nil
+	}
+	if err != nil {
+		return listObject{}, false, err
+	}
+	defer obj.Close()
+
+	e := listObject{
+		Key:          key,
+		LastModified: obj.ModTime.UTC().Format(time.RFC3339),
+		StorageClass: "STANDARD",
+	}
+	if obj.HasDigest {
+		e.ETag, e.Size = etag(obj), obj.Digest.Size
+		return e, true, nil
+	}
+	info, err := g.Store.Stat(key)
+	if errors.Is(err, sos.ErrNotFound) {
+		return e, false, nil
+	}
+	e.Size = info.Size
+	return e, err == nil, err
+}
+
+// listbuckets lists the single bucket of the gateway (ListBuckets).
+func (g *Gateway) listbuckets(w http.ResponseWriter) {
+	type bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+	writexml(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{Buckets: []bucket{{g.Bucket, time.Unix(0, 0).UTC().Format(time.RFC3339)}}})
+}
+
+// etag returns the entity tag of an object with a digest.
+func etag(obj *sos.Object) string {
+	return `"` + obj.Digest.String() + `"`
+}
+
+// writexml sends an XML response.
+func writexml(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,251 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package s3gw
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hweidner/sos"
+)
+
+// do sends a request to the gateway, and returns the response with its body.
+func do(t *testing.T, method, url, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+// Test PutObject, GetObject, HeadObject and DeleteObject
+func TestObjects(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithKeyIndex(), sos.WithDigests())
+	srv := httptest.NewServer(New(s, "bucket"))
+	defer srv.Close()
+	url := srv.URL + "/bucket/dir/hello"
+
+	resp, _ := do(t, "PUT", url, "hello world", map[string]string{
+		"Content-Type":      "text/plain",
+		"X-Amz-Meta-Author": "harald",
+	})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+		t.Errorf("Got status %d and ETag %q from PutObject, expected %d and an ETag", resp.StatusCode, resp.Header.Get("ETag"), http.StatusOK)
+	}
+	etag := resp.Header.Get("ETag")
+
+	resp, body := do(t, "GET", url, "", nil)
+	if resp.StatusCode != http.StatusOK || body != "hello world" {
+		t.Errorf("Got status %d and %q from GetObject, expected %d and %q", resp.StatusCode, body, http.StatusOK, "hello world")
+	}
+	if resp.Header.Get("ETag") != etag || resp.Header.Get("Content-Type") != "text/plain" || resp.Header.Get("X-Amz-Meta-Author") != "harald" {
+		t.Errorf("Got ETag %s, Content-Type %s and author %s, expected %s, %s and %s", resp.Header.Get("ETag"),
+			resp.Header.Get("Content-Type"), resp.Header.Get("X-Amz-Meta-Author"), etag, "text/plain", "harald")
+	}
+
+	resp, body = do(t, "GET", url, "", map[string]string{"Range": "bytes=6-"})
+	if resp.StatusCode != http.StatusPartialContent || body != "world" {
+		t.Errorf("Got status %d and %q from ranged GetObject, expected %d and %q", resp.StatusCode, body, http.StatusPartialContent, "world")
+	}
+	if resp.Header.Get("Content-Range") != "bytes 6-10/11" {
+		t.Errorf("Got Content-Range %s, expected %s", resp.Header.Get("Content-Range"), "bytes 6-10/11")
+	}
+	resp, _ = do(t, "GET", url, "", map[string]string{"Range": "bytes=-3"})
+	if resp.StatusCode != http.StatusPartialContent || resp.ContentLength != 3 {
+		t.Errorf("Got status %d and length %d from suffix range, expected %d and %d", resp.StatusCode, resp.ContentLength, http.StatusPartialContent, 3)
+	}
+	resp, body = do(t, "GET", url, "", map[string]string{"Range": "bytes=20-"})
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable || !strings.Contains(body, "<Code>InvalidRange</Code>") {
+		t.Errorf("Got status %d and %q from unsatisfiable range, expected %d and InvalidRange", resp.StatusCode, body, http.StatusRequestedRangeNotSatisfiable)
+	}
+
+	resp, body = do(t, "HEAD", url, "", nil)
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != 11 || body != "" {
+		t.Errorf("Got status %d and length %d from HeadObject, expected %d and %d", resp.StatusCode, resp.ContentLength, http.StatusOK, 11)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, _ = do(t, "DELETE", url, "", nil)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Got status %d from DeleteObject, expected %d", resp.StatusCode, http.StatusNoContent)
+		}
+	}
+
+	resp, body = do(t, "GET", url, "", nil)
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "<Code>NoSuchKey</Code>") {
+		t.Errorf("Got status %d and %q from GetObject of deleted key, expected %d and NoSuchKey", resp.StatusCode, body, http.StatusNotFound)
+	}
+	resp, _ = do(t, "HEAD", url, "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Got status %d from HeadObject of deleted key, expected %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	resp, body = do(t, "GET", srv.URL+"/other/key", "", nil)
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "<Code>NoSuchBucket</Code>") {
+		t.Errorf("Got status %d and %q for other bucket, expected %d and NoSuchBucket", resp.StatusCode, body, http.StatusNotFound)
+	}
+	resp, _ = do(t, "POST", srv.URL+"/bucket/big?uploads", "", nil)
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Got status %d for multipart upload, expected %d", resp.StatusCode, http.StatusNotImplemented)
+	}
+}
+
+// Test uploads in the aws-chunked encoding
+func TestChunked(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithKeyIndex())
+	srv := httptest.NewServer(New(s, "bucket"))
+	defer srv.Close()
+	url := srv.URL + "/bucket/chunked"
+
+	sig := ";chunk-signature=" + strings.Repeat("0", 64)
+	body := "6" + sig + "\r\nhello \r\n" + "5" + sig + "\r\nworld\r\n" + "0" + sig + "\r\n\r\n"
+	header := map[string]string{
+		"X-Amz-Content-Sha256":         "STREAMING-AWS4-HMAC-SHA256-PAYLOAD",
+		"X-Amz-Decoded-Content-Length": "11",
+	}
+	resp, _ := do(t, "PUT", url, body, header)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Got status %d from chunked PutObject, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	if value, _ := s.GetString("chunked"); value != "hello world" {
+		t.Errorf("Got %q from store, expected %q", value, "hello world")
+	}
+
+	// a trailing checksum, as sent by newer clients
+	body = "b\r\nhello again\r\n0\r\nx-amz-checksum-crc32:AAAAAA==\r\n\r\n"
+	header["X-Amz-Content-Sha256"] = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	if resp, _ = do(t, "PUT", url, body, header); resp.StatusCode != http.StatusOK {
+		t.Errorf("Got status %d from chunked PutObject with trailer, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	if value, _ := s.GetString("chunked"); value != "hello again" {
+		t.Errorf("Got %q from store, expected %q", value, "hello again")
+	}
+
+	// a truncated body does not replace the value
+	header["X-Amz-Decoded-Content-Length"] = "20"
+	if resp, _ = do(t, "PUT", url, body, header); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Got status %d from truncated PutObject, expected %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if value, _ := s.GetString("chunked"); value != "hello again" {
+		t.Errorf("Got %q from store, expected %q", value, "hello again")
+	}
+}
+
+// Test ListObjectsV2 with prefixes, delimiters and pagination
+func TestList(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithKeyIndex(), sos.WithDigests())
+	srv := httptest.NewServer(New(s, "bucket"))
+	defer srv.Close()
+
+	for _, key := range []string{"a/1", "a/2", "b/1", "c", "d"} {
+		if err := s.StoreString(key, "value of "+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string) listResult {
+		t.Helper()
+		resp, body := do(t, "GET", srv.URL+"/bucket?list-type=2"+query, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Got status %d and %q from ListObjectsV2, expected %d", resp.StatusCode, body, http.StatusOK)
+		}
+		var res listResult
+		if err := xml.Unmarshal([]byte(body), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	names := func(res listResult) string {
+		var names []string
+		for _, p := range res.CommonPrefixes {
+			names = append(names, p.Prefix)
+		}
+		for _, o := range res.Contents {
+			names = append(names, o.Key)
+		}
+		return strings.Join(names, ",")
+	}
+
+	res := list("")
+	if got := names(res); got != "a/1,a/2,b/1,c,d" || res.IsTruncated {
+		t.Errorf("Got %s (truncated %v) from listing, expected %s", got, res.IsTruncated, "a/1,a/2,b/1,c,d")
+	}
+	if size := res.Contents[0].Size; size != int64(len("value of a/1")) || res.Contents[0].ETag == "" {
+		t.Errorf("Got size %d and ETag %q, expected %d and an ETag", size, res.Contents[0].ETag, len("value of a/1"))
+	}
+
+	if got := names(list("&prefix=a/")); got != "a/1,a/2" {
+		t.Errorf("Got %s from listing with prefix, expected %s", got, "a/1,a/2")
+	}
+	if got := names(list("&delimiter=/")); got != "a/,b/,c,d" {
+		t.Errorf("Got %s from listing with delimiter, expected %s", got, "a/,b/,c,d")
+	}
+
+	// page through the listing with the delimiter, two entries at a time
+	var pages []string
+	token := ""
+	for {
+		res := list("&delimiter=/&max-keys=2&continuation-token=" + token)
+		pages = append(pages, names(res))
+		if !res.IsTruncated {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	if got := strings.Join(pages, "|"); got != "a/,b/|c,d" {
+		t.Errorf("Got pages %s, expected %s", got, "a/,b/|c,d")
+	}
+
+	if got := names(list("&start-after=b/1")); got != "c,d" {
+		t.Errorf("Got %s from listing with start-after, expected %s", got, "c,d")
+	}
+}
+
+// Test that GET and HEAD requests are observed by the hooks and metrics of
+// the store
+func TestObserved(t *testing.T) {
+	ops := make(chan sos.OpInfo, 10)
+	s := sos.NewTemp(t, sos.WithDigests(), sos.WithHooks(sos.Hooks{
+		Start: func(ctx context.Context, info sos.OpInfo) func(sos.OpInfo) {
+			return func(info sos.OpInfo) {
+				ops <- info
+			}
+		},
+	}))
+	s.StoreString("hello", "world")
+	<-ops
+	srv := httptest.NewServer(New(s, "bucket"))
+	defer srv.Close()
+
+	for _, method := range []string{"GET", "HEAD"} {
+		do(t, method, srv.URL+"/bucket/hello", "", nil)
+		select {
+		case info := <-ops:
+			if info.Op != "Get" || info.Err != nil {
+				t.Errorf("Got operation %s (%v) for %s, expected Get", info.Op, info.Err, method)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Got no operation for %s, expected Get", method)
+		}
+	}
+}
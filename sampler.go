@@ -0,0 +1,88 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ReadSample records a single sampled Get operation.
+type ReadSample struct {
+	Time time.Time // start of the operation
+	Key  string    // requested key
+	Hit  bool      // the key existed
+}
+
+// WithReadSampling records a random fraction rate (between 0 and 1) of all
+// Get operations, together with their outcome (hit or miss), in a ring
+// buffer of the given size. The most recent samples are returned by
+// RecentReads. This helps to understand the access patterns, e.g. for
+// sizing a cache in front of the store, without the overhead of full usage
+// records.
+//
+// Get operations which fail for other reasons than a missing key are not
+// sampled.
+func WithReadSampling(rate float64, size int) Option {
+	return func(s *SOS) {
+		if size < 0 {
+			size = 0
+		}
+		s.sampler = &readSampler{rate: rate, samples: make([]ReadSample, size)}
+	}
+}
+
+// RecentReads returns the most recent sampled Get operations, oldest first.
+// It returns nil if read sampling is not enabled.
+func (s *SOS) RecentReads() []ReadSample {
+	if s.sampler == nil {
+		return nil
+	}
+	return s.sampler.recent()
+}
+
+// readSampler keeps the most recent samples in a ring buffer.
+type readSampler struct {
+	rate float64
+
+	mu      sync.Mutex
+	samples []ReadSample // ring buffer
+	next    int          // position of the next sample
+	full    bool         // the ring buffer has wrapped around
+}
+
+// sample records an operation with the given outcome, with probability
+// rate.
+func (p *readSampler) sample(now time.Time, key string, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return
+	}
+	if p.rate < 1 && rand.Float64() >= p.rate {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.samples[p.next] = ReadSample{Time: now, Key: key, Hit: err == nil}
+	p.next++
+	if p.next == len(p.samples) {
+		p.next, p.full = 0, true
+	}
+}
+
+// recent returns a copy of the samples, oldest first.
+func (p *readSampler) recent() []ReadSample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.full {
+		return append([]ReadSample(nil), p.samples[:p.next]...)
+	}
+	return append(append([]ReadSample(nil), p.samples[p.next:]...), p.samples[:p.next]...)
+}
@@ -0,0 +1,39 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Test sampling of Get operations into a ring buffer
+func TestReadSampling(t *testing.T) {
+	s := NewTemp(t, WithReadSampling(1, 3))
+	s.StoreString("key", "value")
+
+	s.GetString("key")
+	s.GetString("missing")
+	reads := s.RecentReads()
+	if len(reads) != 2 || reads[0].Key != "key" || !reads[0].Hit || reads[1].Hit {
+		t.Errorf("Got samples %+v, expected a hit on key and a miss", reads)
+	}
+
+	for i := 0; i < 5; i++ {
+		s.GetString(fmt.Sprintf("key%d", i))
+	}
+	reads = s.RecentReads()
+	if len(reads) != 3 || reads[0].Key != "key2" || reads[2].Key != "key4" {
+		t.Errorf("Got samples %+v, expected the last 3 reads", reads)
+	}
+
+	if _, err := New(t.TempDir(), WithReadSampling(2, 3)); err == nil {
+		t.Errorf("New with sampling rate 2 succeeded, expected an error")
+	}
+	if reads := NewTemp(t).RecentReads(); reads != nil {
+		t.Errorf("Got samples %+v without sampling, expected none", reads)
+	}
+}
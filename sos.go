@@ -9,10 +9,11 @@ SOS, a simple object store.
 Package sos implements a simple, file system based object (key/value) store.
 
 Objects are stored in a file system directory, one file per object. The file
-name is a SHA256, hex encoded hash of the key. The file's content is the
-value.
+name is a SHA256 (or, see WithHash, another), hex encoded hash of the key.
+The file's content is the value.
 
-For performance reasons, the files are stored in a two layer directory structure.
+For performance reasons, the files are stored in a two layer directory structure
+(see WithShardDepth for other depths).
 The subdirecories are the first and second byte of the key hash, in hex encoding.
 The filename is the remainder of the hash. For example, if the hash to a given
 key is
@@ -36,12 +37,19 @@ package sos
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"log/slog"
 	"math/rand"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,6 +57,66 @@ import (
 type SOS struct {
 	instanceID string
 	base       string
+
+	suffix      string           // file name suffix of object files
+	shardDepth  int              // number of directory levels
+	newHash     func() hash.Hash // hash function for keys
+	noOverwrite bool             // Store fails if the key already exists
+
+	fileMode os.FileMode // permissions of created files
+	dirMode  os.FileMode // permissions of created directories
+	gid      int         // group of created files and directories, or -1
+	fixPerms bool        // set permissions explicitly, regardless of umask
+
+	keyIndex       bool // keep the original keys
+	collisionCheck bool // verify the original keys
+	chunking       bool // store large values as deduplicated chunks
+	fsync          bool // flush stored values to disk
+	digests        bool // record the checksums of stored values
+	verifyOnRead   bool // check values against their checksums on read
+	tombstones     bool // record deleted objects for incremental exports
+
+	consistency Consistency   // checks of hard links on read
+	parallelism int           // workers of exports and Sync
+	watchPoll   time.Duration // interval of polling watchers, or 0
+
+	transforms  map[Flag]transform // registered value transformations
+	compression Compression        // format of compressed values, or 0
+	keyring     *keyring           // keys of encrypted values, or nil
+
+	tenant  string       // tenant name for usage records
+	usages  UsageSink    // optional sink for usage records
+	sampler *readSampler // optional sampler of Get operations
+	breaker *breaker     // optional circuit breaker for I/O errors
+	metrics MetricsSink  // optional sink for metrics
+	logger  *slog.Logger // optional logger of the operations
+	hooks   Hooks        // optional hooks around the operations
+	events  EventSink    // optional sink for change events
+	counts  *counters    // optional counts of objects and bytes
+
+	expiring *expiryWarnings // optional warnings before objects expire
+
+	clock Clock      // time source
+	namer TempNamer  // optional provider of temporary file labels
+	tee   io.Writer  // optional sink for all stored values
+	teeMu sync.Mutex // serializes writes to tee
+
+	tempCleanup time.Duration // age of left over temporary files removed by New
+	legacy      atomic.Bool   // the store has no checksum manifests yet
+	manifestMu  sync.Map      // *sync.Mutex by shard directory, see manifestlock
+
+	mu         sync.RWMutex   // protects closed, destroyed and done
+	closed     bool           // no new operations are accepted
+	done       chan struct{}  // closed with the store, see closing
+	destroyed  bool           // the store directory has been removed
+	inflight   sync.WaitGroup // running operations
+	runningOps atomic.Int64   // number of running operations, for metrics
+	timeout    time.Duration  // maximum wait for running operations on Close
+
+	freezeMu       sync.RWMutex // held exclusively while frozen
+	freezeState    sync.Mutex   // protects frozen
+	frozen         bool         // modifications are suspended
+	freezeFailFast bool         // fail instead of waiting while frozen
 }
 
 // New creates a new simple object store at the directory path.
@@ -57,17 +125,57 @@ type SOS struct {
 // must support the open/read/write/close methods, and UNIX-style hard links.
 // The directory under path must not cross file system boundaries. If the
 // directory does not exist yet, it is created upon invocation.
-func New(path string) (*SOS, error) {
+//
+// The behaviour of the store can be adjusted by options, see the With...
+// functions.
+//
+// The options which determine the location of the object files (shard depth,
+// file name suffix and hash function) are recorded in the file .layout on the
+// first call. Later calls, also by other processes, fail with
+// ErrLayoutMismatch if their options differ, instead of placing objects where
+// the other instances do not find them. Several processes may call New on
+// the same path at the same time; exactly one of them records the layout.
+func New(path string, opts ...Option) (*SOS, error) {
 	if path == "" {
-		return nil, fmt.Errorf("SOS: path for object storage must not be empty")
+		return nil, &Error{Op: "New", Err: fmt.Errorf("path for object storage must not be empty")}
+	}
+
+	s, err := newstore(path, opts)
+	if err != nil {
+		return nil, &Error{Op: "New", Path: path, Err: err}
 	}
 
 	// create directory for object storage
-	err := os.MkdirAll(path+"/.tmp", os.FileMode(0o700))
+	err = s.mkdirall(s.tmpdir())
 	if err != nil {
-		return nil, err
+		return nil, &Error{Op: "New", Path: path, Err: err}
 	}
 
+	if err := s.initlayout(); err != nil {
+		return nil, &Error{Op: "New", Path: path, Err: err}
+	}
+
+	legacy, err := s.detectlegacy()
+	if err != nil {
+		return nil, &Error{Op: "New", Path: path, Err: err}
+	}
+	s.legacy.Store(legacy)
+
+	if err := s.initcounters(); err != nil {
+		return nil, &Error{Op: "New", Path: path, Err: err}
+	}
+
+	if s.tempCleanup > 0 {
+		_, _ = s.CleanupTemp(s.tempCleanup)
+	}
+
+	// Return the SOS object
+	return s, nil
+}
+
+// newstore returns the controlling data structure for a store at path, with
+// the default settings changed by opts. The directory is not touched.
+func newstore(path string, opts []Option) (*SOS, error) {
 	// create unique ID from hostname and random number.
 	// This will be used for temporary filename creation.
 	h, _ := os.Hostname()
@@ -77,22 +185,68 @@ func New(path string) (*SOS, error) {
 	rnd := rand.Intn(1 << 32)
 	id := fmt.Sprintf("%s-%08x", h, rnd)
 
-	// Return the SOS object
-	return &SOS{
+	s := &SOS{
 		instanceID: id,
 		base:       path,
-	}, nil
+		transforms: map[Flag]transform{FlagCompressed: {read: decompress}},
+		clock:      systemClock{},
+		timeout:    defaultCloseTimeout,
+		fileMode:   defaultFileMode,
+		dirMode:    defaultDirMode,
+		gid:        -1,
+		shardDepth: defaultShardDepth,
+		newHash:    sha256.New,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.checkoptions(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Base returns the base directory of the store, as passed to New.
+func (s *SOS) Base() string {
+	return s.base
+}
+
+// Close closes the object store. No new operations are accepted, and Close
+// waits for running operations to finish, but at most for the close timeout
+// (see WithCloseTimeout). In that case, an error is returned. The content of
+// the store is kept.
+func (s *SOS) Close() (err error) {
+	defer s.wraperr(&err, "Close", "")
+
+	s.mu.Lock()
+	s.setclosed()
+	s.mu.Unlock()
+
+	err = s.wait()
+	if merr := s.mergecounters(); err == nil {
+		err = merr
+	}
+	return err
 }
 
 // Destroy will delete an object store and remove all of its content, and the
 // directory itself.
 //
-// Note: on NFS, this can break running Get operations.
+// Running operations are waited for, but at most for the close timeout (see
+// WithCloseTimeout). Operations which are still running afterwards might
+// fail.
 func (s *SOS) Destroy() {
-	if s.base != "" {
-		_ = os.RemoveAll(s.base)
-		s.base = ""
+	s.mu.Lock()
+	if s.destroyed {
+		s.mu.Unlock()
+		return
 	}
+	s.setclosed()
+	s.destroyed = true
+	s.mu.Unlock()
+
+	_ = s.wait()
+	_ = os.RemoveAll(s.base)
 }
 
 // Store stores a key/value pair, given as string and byte slice, in the
@@ -109,55 +263,81 @@ func (s *SOS) StoreString(key, value string) error {
 // StoreFrom stores a value, which is read from an io.Reader, under the given
 // key in the object store.
 func (s *SOS) StoreFrom(key string, rd io.Reader) error {
-	if s.base == "" {
-		return fmt.Errorf("SOS: Running Store on a destroyed store")
-	}
+	return s.StoreFromCtx(context.Background(), key, rd)
+}
 
-	dirname, filename := s.getpath(key)
-	tmpname := s.tmpfilename()
+// StoreFromCtx is like StoreFrom, but stops when the context is cancelled.
+// The context is checked between the blocks of the value. When the store is
+// cancelled, the temporary file is removed, and the previous value of the key
+// is kept.
+func (s *SOS) StoreFromCtx(ctx context.Context, key string, rd io.Reader) (err error) {
+	o := s.startop(ctx, "Store", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Store", key)
 
-	// write object to temporary file
-	wr, err := os.OpenFile(tmpname, os.O_WRONLY|os.O_CREATE, os.FileMode(0o600))
-	if err != nil {
+	return s.store(ctx, o, key, rd, nil)
+}
+
+// store stores a value with the given header fields, if fields is not nil.
+// The size of the value is recorded in the operation o.
+func (s *SOS) store(ctx context.Context, o *operation, key string, rd io.Reader, fields map[byte][]byte) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	_, err = io.Copy(wr, rd)
-	if err != nil {
-		_ = os.Remove(tmpname)
+	if err := s.begin(); err != nil {
 		return err
 	}
+	defer s.end()
 
-	err = wr.Close()
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return err
+		}
+	}
+
+	tmpname, n, err := s.writetmpenc(contextReader(ctx, rd), -1, func(w io.Writer, rd io.Reader) error {
+		return s.encodefields(w, rd, fields)
+	})
 	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
 		_ = os.Remove(tmpname)
 		return err
 	}
 
-	// create directory in storage space.
-	// Note: errors are ok here, because the directory could have been created
-	// by another process in the meantime
-	_ = os.MkdirAll(dirname, os.FileMode(0o700))
+	err = s.commit(key, tmpname)
+	if err == nil {
+		o.info.Bytes = n
+		s.usage("Store", key, n)
+		s.notify("Store", key, n)
+	}
+	return err
+}
 
-	// move object to final directory and name
-	return os.Rename(tmpname, filename)
+// StoreFromMulti stores a value, which is read from an io.Reader, under the
+// given key in the object store, and writes it to all the given writers at
+// the same time. This allows e.g. to compute hashes of values from
+// non-seekable sources without reading them twice. If a writer fails, the
+// value is not stored.
+func (s *SOS) StoreFromMulti(key string, rd io.Reader, alsoTo ...io.Writer) error {
+	return s.StoreFrom(key, io.TeeReader(rd, io.MultiWriter(alsoTo...)))
 }
 
 // Get fetches an object from the store, identified by the key, and returns
-// it as byte slice.
+// it as byte slice. An empty value is returned as an empty, non-nil slice.
+//
+// If the key does not exist, the error matches ErrNotFound (see errors.Is),
+// also for expired objects. Any other error means that the store failed, so
+// the existence of the key is unknown. See Lookup for a variant which
+// reports missing keys without an error.
 func (s *SOS) Get(key string) ([]byte, error) {
-	buffer := new(bytes.Buffer)
-
-	err := s.GetTo(key, buffer)
-	if err != nil {
-		return nil, err
-	}
-
-	return buffer.Bytes(), nil
+	return s.GetCtx(context.Background(), key)
 }
 
 // GetString fetches an object from the store, identified by the key, and returns
-// it as a string
+// it as a string. Missing keys are reported like in Get.
 func (s *SOS) GetString(key string) (string, error) {
 	var buffer strings.Builder
 
@@ -169,63 +349,544 @@ func (s *SOS) GetString(key string) (string, error) {
 	return buffer.String(), nil
 }
 
+// Lookup is like Get, but reports whether the key exists instead of
+// returning ErrNotFound, so a missing key, an empty value and a failure of
+// the store can be told apart without inspecting the error. An error is
+// returned only if the existence cannot be determined.
+func (s *SOS) Lookup(key string) (value []byte, found bool, err error) {
+	value, err = s.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+// LookupString is like Lookup, but returns the value as a string.
+func (s *SOS) LookupString(key string) (value string, found bool, err error) {
+	value, err = s.GetString(key)
+	if errors.Is(err, ErrNotFound) {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
 // GetTo fetches an object from the store, identified by the key, and copies
 // it into an io.Writer.
 func (s *SOS) GetTo(key string, wr io.Writer) error {
-	if s.base == "" {
-		return fmt.Errorf("SOS: Running Get on a destroyed store")
+	return s.GetToCtx(context.Background(), key, wr)
+}
+
+// GetToCtx is like GetTo, but stops when the context is cancelled. The
+// context is checked between the blocks of the value, so wr may have
+// received a part of the value.
+func (s *SOS) GetToCtx(ctx context.Context, key string, wr io.Writer) (err error) {
+	o := s.startop(ctx, "Get", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Get", key)
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	_, filename := s.getpath(key)
-	tmpname := s.tmpfilename()
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
 
-	// create hard link
-	err := os.Link(filename, tmpname)
-	if err != nil {
-		return fmt.Errorf("SOS: Key does not exist")
+	if s.collisionCheck {
+		if err := s.checkindex(key); err != nil {
+			return err
+		}
 	}
-	defer os.Remove(tmpname)
 
-	// read value from file
-	fh, err := os.Open(tmpname)
+	fh, err := s.open(key)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
 
-	_, err = io.Copy(wr, fh)
+	rd, err := s.decode(fh)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(contextWriter(ctx, wr), rd)
+	if err == nil {
+		o.info.Bytes = n
+		s.usage("Get", key, n)
+	}
 	return err
 }
 
 // Delete removes an object from the store.
 func (s *SOS) Delete(key string) error {
-	if s.base == "" {
-		return fmt.Errorf("SOS: Running Delete on a destroyed store")
+	return s.DeleteCtx(context.Background(), key)
+}
+
+// DeleteCtx is like Delete, but does nothing if the context is cancelled.
+func (s *SOS) DeleteCtx(ctx context.Context, key string) (err error) {
+	o := s.startop(ctx, "Delete", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Delete", key)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	hs := s.keyhash(key)
+	_, filename := s.hashpath(hs)
+	err = s.change(hs, false, func() error {
+		return os.Remove(filename)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err == nil {
+		if s.keyIndex {
+			s.removeindex(key)
+		}
+		s.usage("Delete", key, 0)
+		s.notify("Delete", key, 0)
+	}
+	return err
+}
+
+// Take fetches an object from the store and removes it, atomically. If
+// several processes take the same key concurrently, exactly one of them gets
+// the value, while the others get ErrNotFound. This allows for exactly-once
+// consumer patterns across processes sharing the store.
+func (s *SOS) Take(key string) (_ []byte, err error) {
+	o := s.startop(context.Background(), "Take", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Take", key)
+
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	defer s.end()
+
+	if s.collisionCheck {
+		if err := s.checkindex(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.beginmodify(); err != nil {
+		return nil, err
+	}
+	defer s.endmodify()
+
+	// claim the object by moving it to a private name
+	hs := s.keyhash(key)
+	_, filename := s.hashpath(hs)
+	tmpname := s.tmpfilename()
+	err = s.change(hs, false, func() error {
+		return os.Rename(filename, tmpname)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, serr := os.Stat(filename); errors.Is(serr, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpname)
+
+	if s.keyIndex {
+		s.removeindex(key)
+	}
+
+	fh, err := os.Open(tmpname)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	rd, err := s.decode(fh)
+	if err != nil {
+		return nil, err
 	}
 
+	buffer := new(bytes.Buffer)
+	if _, err := io.Copy(buffer, rd); err != nil {
+		return nil, err
+	}
+
+	o.info.Bytes = int64(buffer.Len())
+	s.usage("Take", key, o.info.Bytes)
+	s.notify("Take", key, int64(buffer.Len()))
+	return buffer.Bytes(), nil
+}
+
+// Touch sets the modification time of an object to the current time, without
+// rewriting its value.
+func (s *SOS) Touch(key string) (err error) {
+	o := s.startop(context.Background(), "Touch", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Touch", key)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
 	_, filename := s.getpath(key)
-	return os.Remove(filename)
+	now := s.clock.Now()
+
+	err = os.Chtimes(filename, now, now)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
 }
 
 // internal (unexported) helper methods
 
+// begin registers the start of an operation. It fails if the store has been
+// closed or destroyed. Every successful call to begin must be followed by a
+// call to end.
+func (s *SOS) begin() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch {
+	case s.destroyed:
+		return ErrDestroyed
+	case s.closed:
+		return ErrClosed
+	}
+	if s.breaker != nil {
+		if err := s.breaker.allow(s.clock.Now()); err != nil {
+			return err
+		}
+	}
+
+	s.inflight.Add(1)
+	s.running(1)
+	return nil
+}
+
+// setclosed marks the store as closed. The caller must hold s.mu.
+func (s *SOS) setclosed() {
+	if !s.closed && s.done != nil {
+		close(s.done)
+	}
+	s.closed = true
+}
+
+// closing returns a channel which is closed when the store is closed or
+// destroyed.
+func (s *SOS) closing() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done == nil {
+		s.done = make(chan struct{})
+		if s.closed {
+			close(s.done)
+		}
+	}
+	return s.done
+}
+
+// end registers the end of an operation started with begin.
+func (s *SOS) end() {
+	s.running(-1)
+	s.inflight.Done()
+}
+
+// wait waits for all running operations to finish, at most for the close
+// timeout.
+func (s *SOS) wait() error {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	if s.timeout <= 0 {
+		<-done
+		return nil
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("timeout waiting for running operations")
+	}
+}
+
 // getpath returns the directory and full path filename for a given key.
 func (s *SOS) getpath(key string) (dirname, filename string) {
-	h := sha256.New()
+	return s.hashpath(s.keyhash(key))
+}
+
+// keyhash returns the hex encoded hash of a key.
+func (s *SOS) keyhash(key string) string {
+	h := s.newHash()
 	h.Write([]byte(key))
-	hs := fmt.Sprintf("%x", h.Sum(nil))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// hashlen returns the length of a hex encoded key hash.
+func (s *SOS) hashlen() int {
+	return 2 * s.newHash().Size()
+}
 
-	dirname = fmt.Sprintf("%s/%c%c/%c%c", s.base, hs[0], hs[1], hs[2], hs[3])
-	filename = fmt.Sprintf("%s/%s", dirname, hs[4:])
+// hashpath returns the directory and full path filename for a given hex
+// encoded key hash.
+func (s *SOS) hashpath(hs string) (dirname, filename string) {
+	dirname, filename = s.shardpath(s.base, hs)
+	return dirname, filename + s.suffix
+}
+
+// shardpath returns the directory and file name for a given hex encoded key
+// hash below the directory root, according to the shard depth. For example,
+// with a depth of 2, the hash "e3b0c442..." is placed in root/e3/b0/c442...
+func (s *SOS) shardpath(root, hs string) (dirname, filename string) {
+	dirname = root
+	for i := 0; i < s.shardDepth; i++ {
+		dirname += "/" + hs[2*i:2*i+2]
+	}
+	filename = dirname + "/" + hs[2*s.shardDepth:]
 	return
 }
 
+// writetmp writes the content of rd into a new temporary file and returns
+// the name of that file, and the size of the value.
+func (s *SOS) writetmp(rd io.Reader) (string, int64, error) {
+	return s.writetmpsize(rd, -1)
+}
+
+// writetmpsize is like writetmp. If size is not negative, it is the expected
+// size of the value, and disk space is preallocated accordingly.
+func (s *SOS) writetmpsize(rd io.Reader, size int64) (string, int64, error) {
+	return s.writetmpenc(rd, size, s.encode)
+}
+
+// writetmpenc is like writetmpsize, but writes the file with the given
+// encoding function.
+func (s *SOS) writetmpenc(rd io.Reader, size int64, encode func(io.Writer, io.Reader) error) (string, int64, error) {
+	tmpname := s.tmpfilename()
+
+	wr, err := s.createfile(tmpname)
+	if err != nil {
+		return "", 0, err
+	}
+	if size > 0 {
+		if err := preallocate(wr, size); err != nil {
+			_ = wr.Close()
+			_ = os.Remove(tmpname)
+			return "", 0, err
+		}
+	}
+	cr := &countReader{r: rd}
+	rd = cr
+
+	if s.tee != nil {
+		s.teeMu.Lock()
+		defer s.teeMu.Unlock()
+		rd = io.TeeReader(rd, s.tee)
+	}
+
+	err = encode(wr, rd)
+	if err != nil {
+		_ = wr.Close()
+		_ = os.Remove(tmpname)
+		return "", 0, err
+	}
+
+	err = s.syncfile(wr)
+	if cerr := wr.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return "", 0, err
+	}
+
+	// with a custom clock, the modification time is taken from the clock,
+	// so that time based logic sees consistent times
+	if _, ok := s.clock.(systemClock); !ok {
+		now := s.clock.Now()
+		_ = os.Chtimes(tmpname, now, now)
+	}
+
+	return tmpname, cr.n, nil
+}
+
+// commit moves a temporary file, written by writetmp, to the final position
+// of the given key.
+func (s *SOS) commit(key, tmpname string) error {
+	if err := s.beginmodify(); err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	defer s.endmodify()
+
+	hs := s.keyhash(key)
+	dirname, filename := s.hashpath(hs)
+	if !s.noOverwrite {
+		return s.change(hs, false, func() error {
+			return s.commitfile(tmpname, dirname, filename)
+		})
+	}
+
+	// an expired object is replaced, under the lock of the key
+	unlock, err := s.lockhash(hs)
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	defer unlock()
+	return s.change(hs, true, func() error {
+		return s.commitnew(tmpname, dirname, filename)
+	})
+}
+
+// commitnew moves a temporary file to the given object file name, but fails
+// with ErrExists if the object file already exists and has not expired. A
+// hard link is used instead of a rename, as this check is atomic. The caller
+// must hold the lock of the key.
+func (s *SOS) commitnew(tmpname, dirname, filename string) error {
+	defer os.Remove(tmpname)
+	for {
+		err := s.retrydir(dirname, func() error {
+			return os.Link(tmpname, filename)
+		})
+		if errors.Is(err, fs.ErrExist) {
+			removed, rerr := s.removeexpired(filename)
+			if removed || errors.Is(rerr, fs.ErrNotExist) {
+				continue // expired, or removed in the meantime
+			}
+			if rerr != nil {
+				return rerr
+			}
+			return ErrExists
+		}
+		if err != nil {
+			return err
+		}
+		return s.syncentry(dirname)
+	}
+}
+
+// commitfile moves a temporary file to the given object file name, creating
+// the directory if necessary.
+func (s *SOS) commitfile(tmpname, dirname, filename string) error {
+	// move object to final directory and name
+	err := s.retrydir(dirname, func() error {
+		return os.Rename(tmpname, filename)
+	})
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	return s.syncentry(dirname)
+}
+
+// linkedFile is an object file which was opened through a private hard link.
+// Closing it removes the hard link.
+type linkedFile struct {
+	*os.File
+	tmpname string
+}
+
+// Close closes the file and removes the hard link.
+func (f *linkedFile) Close() error {
+	err := f.File.Close()
+	_ = os.Remove(f.tmpname)
+	return err
+}
+
+// open creates a hard link to the object file of the given key, and opens it
+// for reading.
+func (s *SOS) open(key string) (*linkedFile, error) {
+	_, filename := s.getpath(key)
+	fh, err := s.openfile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		// the link also fails if the temporary directory is missing, so
+		// make sure it's the object which does not exist. The directory is
+		// checked instead of the object, which may have been stored again
+		// in the meantime.
+		if _, serr := os.Stat(s.tmpdir()); serr == nil {
+			err = ErrNotFound
+		}
+	}
+	if s.sampler != nil {
+		s.sampler.sample(s.clock.Now(), key, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
+
+// openfile creates a hard link to the given object file, and opens it for
+// reading. Depending on the consistency level of the store, the link is
+// verified against the object file.
+func (s *SOS) openfile(filename string) (*linkedFile, error) {
+	for attempt := 0; ; attempt++ {
+		tmpname := s.tmpfilename()
+
+		// create hard link
+		err := os.Link(filename, tmpname)
+		if errors.Is(err, fs.ErrNotExist) && s.relink(filename, attempt) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fh, err := os.Open(tmpname)
+		if err != nil {
+			_ = os.Remove(tmpname)
+			return nil, err
+		}
+		lf := &linkedFile{File: fh, tmpname: tmpname}
+
+		ok, err := s.checklink(fh, filename, attempt)
+		if ok {
+			return lf, nil
+		}
+		_ = lf.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tmpdir returns the directory for temporary files.
+func (s *SOS) tmpdir() string {
+	return s.base + "/" + dirTmp
+}
+
 // tmpfilename returns a temporary file name used in Store and Get
 // operations
 func (s *SOS) tmpfilename() string {
-	tmpfname := fmt.Sprintf("%s/.tmp/%s-%d-%08x",
-		s.base, s.instanceID,
-		time.Now().UnixNano(),
+	tmpfname := fmt.Sprintf("%s/%s%s-%d-%08x",
+		s.tmpdir(), s.templabel(), s.instanceID,
+		s.clock.Now().UnixNano(),
 		rand.Intn(1<<32))
 	return tmpfname
 }
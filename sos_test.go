@@ -7,7 +7,15 @@ package sos
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Test the byte slice and string interface
@@ -20,9 +28,15 @@ func TestSOS(t *testing.T) {
 	s.StoreString(key1, val1)
 	s.Store(key2, []byte(val2))
 
-	obj1s, _ := s.Get(key1)
+	obj1s, err := s.Get(key1)
+	if err != nil {
+		t.Fatalf("Error getting %s: %v", key1, err)
+	}
 	obj1 := string(obj1s)
-	obj2, _ := s.GetString(key2)
+	obj2, err := s.GetString(key2)
+	if err != nil {
+		t.Fatalf("Error getting %s: %v", key2, err)
+	}
 
 	if obj1 != val1 {
 		t.Errorf("Got %s from store, expected %s", obj1, val1)
@@ -33,16 +47,49 @@ func TestSOS(t *testing.T) {
 	}
 
 	s.Delete(key1)
-	obj3, _ := s.Get(key1)
-	if len(obj3) > 0 {
-		t.Errorf("Got non empty value for deleted object")
+	obj3, err := s.Get(key1)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for deleted object, expected %v", err, ErrNotFound)
+	}
+	if obj3 != nil {
+		t.Errorf("Got non nil value for deleted object")
 	}
 
 	s.Destroy()
-	s.StoreString(key1, val1)
-	obj4, _ := s.Get(key1)
-	if len(obj4) > 0 {
-		t.Errorf("Got non empty value from destroyed object store")
+	if err := s.StoreString(key1, val1); !errors.Is(err, ErrDestroyed) {
+		t.Errorf("Got error %v storing into destroyed object store, expected %v", err, ErrDestroyed)
+	}
+	if _, err := s.Get(key1); !errors.Is(err, ErrDestroyed) {
+		t.Errorf("Got error %v from destroyed object store, expected %v", err, ErrDestroyed)
+	}
+}
+
+// Test telling missing keys, empty values and failures apart
+func TestLookup(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("empty", "")
+	s.StoreString("key", "value")
+
+	if v, err := s.Get("empty"); err != nil || v == nil || len(v) != 0 {
+		t.Errorf("Got %v (%v) for empty value, expected empty slice", v, err)
+	}
+	if v, found, err := s.Lookup("empty"); err != nil || !found || v == nil {
+		t.Errorf("Got %v, %t (%v) for empty value, expected empty slice and found", v, found, err)
+	}
+	if v, found, err := s.LookupString("key"); err != nil || !found || v != "value" {
+		t.Errorf("Got %q, %t (%v), expected %q and found", v, found, err, "value")
+	}
+	if v, found, err := s.Lookup("missing"); err != nil || found || v != nil {
+		t.Errorf("Got %v, %t (%v) for missing key, expected not found without error", v, found, err)
+	}
+	if _, err := s.GetString("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for missing key, expected %v", err, ErrNotFound)
+	}
+
+	// failures are errors, not missing keys
+	s.Close()
+	if _, found, err := s.LookupString("key"); !errors.Is(err, ErrClosed) || found {
+		t.Errorf("Got %t (%v) from closed store, expected %v", found, err, ErrClosed)
 	}
 }
 
@@ -66,3 +113,173 @@ func TestSOSFile(t *testing.T) {
 	s.Delete(key)
 	s.Destroy()
 }
+
+// Test that Close and Destroy wait for running operations
+func TestDestroyWaits(t *testing.T) {
+	s, _ := New("./._sostest", WithCloseTimeout(50*time.Millisecond))
+	s.StoreString("hello", "world")
+
+	rd, err := s.GetGunzipReader("hello")
+	if err != nil {
+		t.Fatalf("GetGunzipReader failed: %v", err)
+	}
+
+	if err := s.Close(); err == nil {
+		t.Errorf("Got no timeout error from Close with a running operation")
+	}
+	if err := s.StoreString("foo", "bar"); err == nil {
+		t.Errorf("Got no error from Store on a closed store")
+	}
+
+	done := make(chan struct{})
+	s.timeout = 0
+	go func() {
+		s.Destroy()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("Destroy did not wait for the running operation")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	obj, _ := io.ReadAll(rd)
+	rd.Close()
+	<-done
+
+	if string(obj) != "world" {
+		t.Errorf("Got %s from store, expected %s", obj, "world")
+	}
+}
+
+// Test updating the modification time of objects
+func TestTouch(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+
+	s.StoreString("hello", "world")
+	clock.Advance(time.Hour)
+	if err := s.Touch("hello"); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+
+	_, filename := s.getpath("hello")
+	fi, _ := os.Stat(filename)
+	if !fi.ModTime().Equal(clock.Now()) {
+		t.Errorf("Got modification time %v, expected %v", fi.ModTime(), clock.Now())
+	}
+
+	if err := s.Touch("missing"); err == nil {
+		t.Errorf("Got no error when touching a missing key")
+	}
+}
+
+// Test storing a value while feeding other consumers
+func TestStoreFromMulti(t *testing.T) {
+	s := NewTemp(t)
+
+	val := "hello world"
+	h := sha256.New()
+	buf := new(bytes.Buffer)
+	if err := s.StoreFromMulti("hello", strings.NewReader(val), h, buf); err != nil {
+		t.Fatalf("StoreFromMulti failed: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(val))
+	if !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Errorf("Got hash %x, expected %x", h.Sum(nil), sum)
+	}
+	if buf.String() != val {
+		t.Errorf("Got %s from writer, expected %s", buf.String(), val)
+	}
+	if obj, _ := s.GetString("hello"); obj != val {
+		t.Errorf("Got %s from store, expected %s", obj, val)
+	}
+}
+
+// Benchmark storing small objects
+func BenchmarkStoreSmall(b *testing.B) {
+	s := NewTemp(b)
+	value := bytes.Repeat([]byte("x"), 4096)
+
+	b.SetBytes(int64(len(value)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.Store("key", value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark storing large objects
+func BenchmarkStoreLarge(b *testing.B) {
+	s := NewTemp(b)
+	value := bytes.Repeat([]byte("x"), 4<<20)
+
+	b.SetBytes(int64(len(value)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.Store("key", value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Test that each object is taken exactly once
+func TestTake(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("job", "payload")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			obj, err := s.Take("job")
+			if err == nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+				if string(obj) != "payload" {
+					t.Errorf("Got %s from Take, expected %s", obj, "payload")
+				}
+			} else if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Got error %v from Take, expected %v", err, ErrNotFound)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken != 1 {
+		t.Errorf("Object was taken %d times, expected once", taken)
+	}
+	if _, err := s.Get("job"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Object still exists after Take")
+	}
+}
+
+// Test that directories removed externally are recreated
+func TestMissingDirectories(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"overwrite":   nil,
+		"noOverwrite": {WithNoOverwrite()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewTemp(t, opts...)
+			s.StoreString("key", "value")
+			dirname, _ := s.getpath("key")
+
+			os.RemoveAll(filepath.Dir(dirname))
+			os.RemoveAll(s.tmpdir())
+			if err := s.StoreString("key", "again"); err != nil {
+				t.Fatalf("Store after removing the directories failed: %v", err)
+			}
+			if obj, _ := s.GetString("key"); obj != "again" {
+				t.Errorf("Got %s from store, expected %s", obj, "again")
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/hweidner/sos/sosfuse
+
+go 1.22
+
+require (
+	github.com/hanwen/go-fuse/v2 v2.9.0
+	github.com/hweidner/sos v0.0.0
+)
+
+require (
+	github.com/klauspost/compress v1.17.9 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/hweidner/sos => ../
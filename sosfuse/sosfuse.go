@@ -0,0 +1,277 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package sosfuse mounts a simple object store read-only via FUSE, so standard
+tools like grep, find or file managers can inspect its contents.
+
+It is a separate module, so the sos package itself does not depend on the
+FUSE library.
+
+	server, err := sosfuse.Mount(store, "/mnt/objects")
+	...
+	server.Wait() // until unmounted with "fusermount -u /mnt/objects"
+
+The keys in the key index (see sos.WithKeyIndex) appear as files, and the
+slashes in keys as directories. So, the key "logs/2021/app.log" is the file
+logs/2021/app.log below the mount point. Keys which cannot be file paths,
+like keys with empty path components, are left out. If a key is also the
+prefix of other keys (e.g. "logs" and "logs/app.log"), the file hides the
+directory.
+
+The size of a file is taken from the digest of its value, if the store
+records it (see sos.WithDigests). Otherwise, the value is read to determine
+its size, so listing large directories is slow.
+*/
+package sosfuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hweidner/sos"
+)
+
+// cacheTimeout is the time for which the kernel caches names and
+// attributes.
+const cacheTimeout = time.Second
+
+// Mount mounts the store s read-only at the directory mountpoint. The file
+// system is served until it is unmounted, see fuse.Server.
+func Mount(s *sos.SOS, mountpoint string) (*fuse.Server, error) {
+	timeout := cacheTimeout
+	return fs.Mount(mountpoint, NewRoot(s), &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:  "sos",
+			Name:    "sos",
+			Options: []string{"ro"},
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+}
+
+// NewRoot returns the root directory of the file system, e.g. for mounting
+// with custom options by fs.Mount.
+func NewRoot(s *sos.SOS) fs.InodeEmbedder {
+	return &dirNode{store: s}
+}
+
+// dirNode is a directory, which holds the keys with its prefix.
+type dirNode struct {
+	fs.Inode
+	store  *sos.SOS
+	prefix string // empty, or ending with a slash
+}
+
+var (
+	_ fs.NodeLookuper  = (*dirNode)(nil)
+	_ fs.NodeReaddirer = (*dirNode)(nil)
+	_ fs.NodeGetattrer = (*dirNode)(nil)
+)
+
+// entries returns the names of the files and directories in the directory.
+func (d *dirNode) entries() (files, dirs map[string]bool, err error) {
+	keys, err := d.store.List(d.prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, dirs = make(map[string]bool), make(map[string]bool)
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, d.prefix)
+		if !validpath(rest) {
+			continue
+		}
+		if name, _, found := strings.Cut(rest, "/"); found {
+			dirs[name] = true
+		} else {
+			files[name] = true
+		}
+	}
+	return files, dirs, nil
+}
+
+// validpath reports whether the key, relative to a directory, is a valid
+// path.
+func validpath(rel string) bool {
+	for _, name := range strings.Split(rel, "/") {
+		if name == "" || name == "." || name == ".." || strings.ContainsRune(name, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup finds a file or directory in the directory.
+func (d *dirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	key := d.prefix + name
+	_, err := d.store.Stat(key)
+	if err == nil {
+		f := &fileNode{store: d.store, key: key}
+		if errno := f.getattr(&out.Attr); errno != 0 {
+			return nil, errno
+		}
+		return d.NewInode(ctx, f, fs.StableAttr{Mode: fuse.S_IFREG}), 0
+	}
+	if !errors.Is(err, sos.ErrNotFound) {
+		return nil, toerrno(err)
+	}
+
+	sub := &dirNode{store: d.store, prefix: key + "/"}
+	files, dirs, err := sub.entries()
+	if err != nil {
+		return nil, toerrno(err)
+	}
+	if len(files) == 0 && len(dirs) == 0 {
+		return nil, syscall.ENOENT
+	}
+	out.Attr.Mode = fuse.S_IFDIR | 0o555
+	return d.NewInode(ctx, sub, fs.StableAttr{Mode: fuse.S_IFDIR}), 0
+}
+
+// Readdir lists the directory.
+func (d *dirNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	files, dirs, err := d.entries()
+	if err != nil {
+		return nil, toerrno(err)
+	}
+
+	list := make([]fuse.DirEntry, 0, len(files)+len(dirs))
+	for name := range files {
+		list = append(list, fuse.DirEntry{Name: name, Mode: fuse.S_IFREG})
+	}
+	for name := range dirs {
+		if !files[name] {
+			list = append(list, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return fs.NewListDirStream(list), 0
+}
+
+// Getattr returns the attributes of the directory.
+func (d *dirNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFDIR | 0o555
+	return 0
+}
+
+// fileNode is a file, which holds the value of a key.
+type fileNode struct {
+	fs.Inode
+	store *sos.SOS
+	key   string
+}
+
+var (
+	_ fs.NodeGetattrer = (*fileNode)(nil)
+	_ fs.NodeOpener    = (*fileNode)(nil)
+	_ fs.NodeReader    = (*fileNode)(nil)
+	_ fs.NodeReleaser  = (*fileNode)(nil)
+)
+
+// Getattr returns the attributes of the file.
+func (f *fileNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	return f.getattr(&out.Attr)
+}
+
+// getattr sets the attributes of the file.
+func (f *fileNode) getattr(attr *fuse.Attr) syscall.Errno {
+	obj, err := f.store.GetObject(f.key)
+	if err != nil {
+		return toerrno(err)
+	}
+	defer obj.Close()
+
+	size := obj.Digest.Size
+	if !obj.HasDigest {
+		if size, err = io.Copy(io.Discard, obj); err != nil {
+			return toerrno(err)
+		}
+	}
+	attr.Mode = fuse.S_IFREG | 0o444
+	attr.Size = uint64(size)
+	attr.SetTimes(nil, &obj.ModTime, &obj.ModTime)
+	return 0
+}
+
+// Open opens the file for reading. The reads bypass the page cache, as the
+// value may be replaced at any time.
+func (f *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY || flags&syscall.O_TRUNC != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	return &handle{}, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// handle is an open file. It reads the value sequentially, and opens it
+// again for reads at other offsets.
+type handle struct {
+	mu  sync.Mutex
+	rd  io.ReadCloser
+	pos int64
+}
+
+// Read reads from the value at the offset off.
+func (f *fileNode) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h := fh.(*handle)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rd == nil || h.pos != off {
+		if h.rd != nil {
+			h.rd.Close()
+		}
+		rd, err := f.store.GetReader(f.key)
+		if err != nil {
+			h.rd = nil
+			return nil, toerrno(err)
+		}
+		h.rd, h.pos = rd, 0
+		n, err := io.CopyN(io.Discard, rd, off)
+		h.pos = n
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, toerrno(err)
+		}
+	}
+
+	n, err := io.ReadFull(h.rd, dest)
+	h.pos += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, toerrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+// Release closes the file.
+func (f *fileNode) Release(ctx context.Context, fh fs.FileHandle) syscall.Errno {
+	h := fh.(*handle)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rd != nil {
+		h.rd.Close()
+		h.rd = nil
+	}
+	return 0
+}
+
+// toerrno converts an error of the store to an error number.
+func toerrno(err error) syscall.Errno {
+	switch {
+	case errors.Is(err, sos.ErrNotFound):
+		return syscall.ENOENT
+	case errors.Is(err, sos.ErrClosed), errors.Is(err, sos.ErrFrozen),
+		errors.Is(err, sos.ErrStoreUnhealthy):
+		return syscall.EAGAIN
+	}
+	return syscall.EIO
+}
@@ -0,0 +1,93 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sosfuse
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hweidner/sos"
+)
+
+// Test browsing and reading a mounted store
+func TestMount(t *testing.T) {
+	for _, digests := range []bool{false, true} {
+		opts := []sos.Option{sos.WithKeyIndex()}
+		if digests {
+			opts = append(opts, sos.WithDigests())
+		}
+		s := sos.NewTemp(t, opts...)
+		s.StoreString("hello", "world")
+		s.StoreString("logs/2021/app.log", "line 1\nline 2\n")
+		s.StoreString("logs/2021/db.log", "")
+		s.StoreString("logs/readme", strings.Repeat("x", 200000))
+		s.StoreString("bad//key", "hidden")
+
+		mnt := t.TempDir()
+		timeout := time.Second
+		server, err := gofs.Mount(mnt, NewRoot(s), &gofs.Options{
+			MountOptions: fuse.MountOptions{DirectMount: true, Options: []string{"ro"}},
+			EntryTimeout: &timeout,
+			AttrTimeout:  &timeout,
+		})
+		if err != nil {
+			t.Skipf("cannot mount FUSE file system: %v", err)
+		}
+		defer server.Unmount()
+
+		var files []string
+		filepath.WalkDir(mnt, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				t.Error(err)
+				return err
+			}
+			if !d.IsDir() {
+				rel, _ := filepath.Rel(mnt, name)
+				files = append(files, rel)
+			}
+			return nil
+		})
+		if got := strings.Join(files, ","); got != "hello,logs/2021/app.log,logs/2021/db.log,logs/readme" {
+			t.Errorf("Got files %s, expected %s", got, "hello,logs/2021/app.log,logs/2021/db.log,logs/readme")
+		}
+
+		data, err := os.ReadFile(filepath.Join(mnt, "logs/2021/app.log"))
+		if err != nil || string(data) != "line 1\nline 2\n" {
+			t.Errorf("Got %q (%v) from file, expected %q", data, err, "line 1\nline 2\n")
+		}
+		data, err = os.ReadFile(filepath.Join(mnt, "logs/readme"))
+		if err != nil || len(data) != 200000 {
+			t.Errorf("Got %d bytes (%v) from file, expected %d", len(data), err, 200000)
+		}
+		if fi, err := os.Stat(filepath.Join(mnt, "hello")); err != nil || fi.Size() != 5 {
+			t.Errorf("Got stat %v (%v), expected size %d", fi, err, 5)
+		}
+
+		// reads at an offset
+		fh, err := os.Open(filepath.Join(mnt, "hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 3)
+		if n, _ := fh.ReadAt(buf, 2); string(buf[:n]) != "rld" {
+			t.Errorf("Got %q from offset %d, expected %q", buf[:n], 2, "rld")
+		}
+		fh.Close()
+
+		if err := os.WriteFile(filepath.Join(mnt, "hello"), []byte("x"), 0o644); err == nil {
+			t.Errorf("Writing to the mounted store succeeded")
+		}
+		if _, err := os.Stat(filepath.Join(mnt, "missing")); !os.IsNotExist(err) {
+			t.Errorf("Got %v for missing file, expected not exist", err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sosgrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hweidner/sos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client accesses a remote store through the ObjectStore service.
+type Client struct {
+	rpc ObjectStoreClient
+}
+
+// NewClient returns a client, which uses the connection conn.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{rpc: NewObjectStoreClient(conn)}
+}
+
+// Store stores a value under the given key.
+func (c *Client) Store(ctx context.Context, key string, value []byte) error {
+	return c.StoreFrom(ctx, key, bytes.NewReader(value))
+}
+
+// StoreFrom stores the value read from rd under the given key. If reading
+// fails, the stream is aborted, and the value is not stored.
+func (c *Client) StoreFrom(ctx context.Context, key string, rd io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.rpc.Put(ctx)
+	if err != nil {
+		return fromStatus(err)
+	}
+	buf := make([]byte, chunkSize)
+	req := &PutRequest{Key: key}
+	for {
+		n, err := io.ReadFull(rd, buf)
+		if n > 0 || req.Key != "" {
+			req.Data = buf[:n]
+			if err := stream.Send(req); errors.Is(err, io.EOF) {
+				break // the server failed, its error is returned below
+			} else if err != nil {
+				return fromStatus(err)
+			}
+			req = &PutRequest{}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err // cancelling the stream aborts the upload
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return fromStatus(err)
+}
+
+// Get returns the value of the key.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.GetTo(ctx, key, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetTo writes the value of the key to wr. If the key does not exist, an
+// error wrapping sos.ErrNotFound is returned, and nothing is written.
+func (c *Client) GetTo(ctx context.Context, key string, wr io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.rpc.Get(ctx, &GetRequest{Key: key})
+	if err != nil {
+		return fromStatus(err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fromStatus(err)
+		}
+		if _, err := wr.Write(msg.GetData()); err != nil {
+			return err
+		}
+	}
+}
+
+// Delete deletes the key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.rpc.Delete(ctx, &DeleteRequest{Key: key})
+	return fromStatus(err)
+}
+
+// List returns the keys with the given prefix. The remote store must have a
+// key index, see sos.WithKeyIndex.
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	stream, err := c.rpc.List(ctx, &ListRequest{Prefix: prefix})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	var keys []string
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, fromStatus(err)
+		}
+		keys = append(keys, msg.GetKeys()...)
+	}
+}
+
+// Stat returns the metadata of an object.
+func (c *Client) Stat(ctx context.Context, key string) (sos.ObjectInfo, error) {
+	resp, err := c.rpc.Stat(ctx, &StatRequest{Key: key})
+	if err != nil {
+		return sos.ObjectInfo{}, fromStatus(err)
+	}
+	return sos.ObjectInfo{
+		Hash:    resp.GetHash(),
+		Size:    resp.GetSize(),
+		ModTime: time.Unix(0, resp.GetModTimeUnixNano()),
+	}, nil
+}
+
+// fromStatus converts a gRPC status error to an error, which wraps the
+// corresponding sentinel error of the sos package.
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", sos.ErrNotFound, st.Message())
+	case codes.AlreadyExists:
+		return fmt.Errorf("%w: %s", sos.ErrExists, st.Message())
+	case codes.DataLoss:
+		return fmt.Errorf("%w: %s", sos.ErrCorrupt, st.Message())
+	}
+	return err
+}
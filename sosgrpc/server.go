@@ -0,0 +1,174 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package sosgrpc provides remote access to a simple object store over gRPC,
+so it can be used from hosts which do not share its file system.
+
+It is a separate module, so the sos package itself does not depend on gRPC.
+The service ObjectStore is defined in sos.proto. A Server serves a store,
+and a Client accesses it with an API similar to the one of the store:
+
+	srv := grpc.NewServer()
+	sosgrpc.RegisterObjectStoreServer(srv, sosgrpc.NewServer(store))
+	log.Fatal(srv.Serve(listener))
+
+	conn, err := grpc.NewClient("storehost:7070", grpc.WithTransportCredentials(creds))
+	client := sosgrpc.NewClient(conn)
+	err = client.Store(ctx, "key", []byte("value"))
+
+Values are streamed in chunks in both directions, so large values are not
+buffered in memory. Errors of the store are mapped to gRPC status codes, and
+back to the sentinel errors of the sos package by the client, so errors.Is
+works with sos.ErrNotFound and sos.ErrExists.
+*/
+package sosgrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative sos.proto
+
+import (
+	"bufio"
+	"context"
+	"errors"
+
+	"github.com/hweidner/sos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkSize is the maximum size of the value chunk in a message.
+const chunkSize = 64 << 10
+
+// listBatch is the maximum number of keys in a List message.
+const listBatch = 1000
+
+// Server implements the ObjectStore service for a store.
+type Server struct {
+	UnimplementedObjectStoreServer
+	Store *sos.SOS
+}
+
+var _ ObjectStoreServer = (*Server)(nil)
+
+// NewServer returns a server for the store s.
+func NewServer(s *sos.SOS) *Server {
+	return &Server{Store: s}
+}
+
+// Put stores the streamed value. A value is only stored if the stream ends
+// regularly, an aborted stream does not change the store.
+func (srv *Server) Put(stream ObjectStore_PutServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.GetKey() == "" {
+		return status.Error(codes.InvalidArgument, "missing key")
+	}
+
+	rd := &putReader{stream: stream, buf: first.GetData()}
+	if err := srv.Store.StoreFromCtx(stream.Context(), first.GetKey(), rd); err != nil {
+		return toStatus(err)
+	}
+	return stream.SendAndClose(&PutResponse{})
+}
+
+// putReader reads the value chunks of a Put stream.
+type putReader struct {
+	stream ObjectStore_PutServer
+	buf    []byte
+}
+
+func (r *putReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = msg.GetData()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Get streams the value of a key.
+func (srv *Server) Get(req *GetRequest, stream ObjectStore_GetServer) error {
+	w := bufio.NewWriterSize(getWriter{stream}, chunkSize)
+	if err := srv.Store.GetToCtx(stream.Context(), req.GetKey(), w); err != nil {
+		return toStatus(err)
+	}
+	return w.Flush()
+}
+
+// getWriter sends each write as a value chunk of a Get stream.
+type getWriter struct {
+	stream ObjectStore_GetServer
+}
+
+func (w getWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&GetResponse{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Delete deletes a key.
+func (srv *Server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	if err := srv.Store.DeleteCtx(ctx, req.GetKey()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &DeleteResponse{}, nil
+}
+
+// List streams the keys with a prefix.
+func (srv *Server) List(req *ListRequest, stream ObjectStore_ListServer) error {
+	keys, err := srv.Store.ListCtx(stream.Context(), req.GetPrefix())
+	if err != nil {
+		return toStatus(err)
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), listBatch)
+		if err := stream.Send(&ListResponse{Keys: keys[:n]}); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// Stat returns the metadata of an object.
+func (srv *Server) Stat(_ context.Context, req *StatRequest) (*StatResponse, error) {
+	info, err := srv.Store.Stat(req.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &StatResponse{
+		Hash:            info.Hash,
+		Size:            info.Size,
+		ModTimeUnixNano: info.ModTime.UnixNano(),
+	}, nil
+}
+
+// toStatus converts an error of the store to a gRPC status error.
+func toStatus(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, sos.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, sos.ErrExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, sos.ErrClosed), errors.Is(err, sos.ErrFrozen),
+		errors.Is(err, sos.ErrStoreUnhealthy):
+		code = codes.Unavailable
+	case errors.Is(err, sos.ErrCorrupt):
+		code = codes.DataLoss
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
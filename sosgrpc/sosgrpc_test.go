@@ -0,0 +1,136 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sosgrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/hweidner/sos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newClient serves the store over an in-memory connection, and returns a
+// client for it.
+func newClient(t *testing.T, s *sos.SOS) *Client {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterObjectStoreServer(srv, NewServer(s))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+// Test the operations through a client
+func TestClient(t *testing.T) {
+	s := sos.NewTemp(t, sos.WithKeyIndex())
+	c := newClient(t, s)
+	ctx := context.Background()
+
+	if err := c.Store(ctx, "hello", []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := s.GetString("hello"); value != "world" {
+		t.Errorf("Got %s from store, expected %s", value, "world")
+	}
+	if value, err := c.Get(ctx, "hello"); err != nil || string(value) != "world" {
+		t.Errorf("Got %s (%v) from client, expected %s", value, err, "world")
+	}
+
+	// a value spanning several messages
+	large := bytes.Repeat([]byte("0123456789abcdef"), chunkSize/4+3)
+	if err := c.StoreFrom(ctx, "large", bytes.NewReader(large)); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := c.Get(ctx, "large"); err != nil || !bytes.Equal(value, large) {
+		t.Errorf("Got %d bytes (%v) from client, expected %d", len(value), err, len(large))
+	}
+
+	if err := c.Store(ctx, "empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := c.Get(ctx, "empty"); err != nil || len(value) != 0 {
+		t.Errorf("Got %q (%v) for empty value, expected an empty value", value, err)
+	}
+
+	info, err := c.Stat(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := s.Stat("hello"); info.Hash != want.Hash || info.Size != want.Size || !info.ModTime.Equal(want.ModTime) {
+		t.Errorf("Got %+v from Stat, expected %+v", info, want)
+	}
+
+	keys, err := c.List(ctx, "")
+	if err != nil || strings.Join(keys, ",") != "empty,hello,large" {
+		t.Errorf("Got %v (%v) from List, expected %s", keys, err, "empty,hello,large")
+	}
+
+	if err := c.Delete(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "hello"); !errors.Is(err, sos.ErrNotFound) {
+		t.Errorf("Got %v from Get of deleted key, expected ErrNotFound", err)
+	}
+	if err := c.Delete(ctx, "hello"); !errors.Is(err, sos.ErrNotFound) {
+		t.Errorf("Got %v from Delete of deleted key, expected ErrNotFound", err)
+	}
+	if _, err := c.Stat(ctx, "hello"); !errors.Is(err, sos.ErrNotFound) {
+		t.Errorf("Got %v from Stat of deleted key, expected ErrNotFound", err)
+	}
+}
+
+// failingReader returns some data, and then an error.
+type failingReader struct {
+	data io.Reader
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("read failed")
+	}
+	return n, err
+}
+
+// Test that an aborted upload does not change the store
+func TestClientAbort(t *testing.T) {
+	s := sos.NewTemp(t)
+	c := newClient(t, s)
+	ctx := context.Background()
+
+	s.StoreString("key", "old")
+	rd := failingReader{bytes.NewReader(make([]byte, 3*chunkSize))}
+	if err := c.StoreFrom(ctx, "key", rd); err == nil {
+		t.Errorf("Failed upload returned no error")
+	}
+	if value, _ := s.GetString("key"); value != "old" {
+		t.Errorf("Got %s from store, expected %s", value, "old")
+	}
+
+	if err := c.Store(ctx, "", []byte("value")); err == nil {
+		t.Errorf("Store with empty key returned no error")
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/hweidner/sos/soskafka
+
+go 1.22
+
+require (
+	github.com/hweidner/sos v0.0.0
+	github.com/segmentio/kafka-go v0.4.47
+)
+
+require (
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/hweidner/sos => ../
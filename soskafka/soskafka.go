@@ -0,0 +1,61 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package soskafka publishes the change events of a simple object store to
+Kafka.
+
+It is a separate module, so the sos package itself does not depend on the
+Kafka client library.
+
+	w := &kafka.Writer{Addr: kafka.TCP("localhost:9092"), Topic: "sos-events"}
+	queue := &sos.EventQueue{Publisher: soskafka.New(w)}
+	go queue.Run(ctx)
+	store, err := sos.New(path, sos.WithEventSink(queue))
+*/
+package soskafka
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hweidner/sos"
+	"github.com/segmentio/kafka-go"
+)
+
+// Writer is the part of a Kafka writer used by Publisher. It is implemented
+// by *kafka.Writer.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+var _ Writer = (*kafka.Writer)(nil)
+
+// Publisher is a sos.EventPublisher which writes each event as a JSON object
+// to Kafka. The message key is the object key, so the events of a key keep
+// their order, and the header "op" holds the operation.
+type Publisher struct {
+	Writer Writer // Kafka writer, with the topic set
+}
+
+var _ sos.EventPublisher = (*Publisher)(nil)
+
+// New creates a Publisher for the Kafka writer.
+func New(w *kafka.Writer) *Publisher {
+	return &Publisher{Writer: w}
+}
+
+// Publish implements sos.EventPublisher.
+func (p *Publisher) Publish(ctx context.Context, e sos.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.Writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(e.Key),
+		Value:   data,
+		Headers: []kafka.Header{{Key: "op", Value: []byte(e.Op)}},
+	})
+}
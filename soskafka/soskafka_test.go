@@ -0,0 +1,50 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package soskafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hweidner/sos"
+	"github.com/segmentio/kafka-go"
+)
+
+// testWriter records the written messages.
+type testWriter struct {
+	msgs []kafka.Message
+}
+
+func (w *testWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+// Test publishing store events
+func TestPublisher(t *testing.T) {
+	w := &testWriter{}
+	p := &Publisher{Writer: w}
+
+	s := sos.NewTemp(t, sos.WithEventSink(sos.EventFunc(func(e sos.Event) {
+		if err := p.Publish(context.Background(), e); err != nil {
+			t.Errorf("Publish failed: %v", err)
+		}
+	})))
+	s.StoreString("hello", "world")
+
+	if len(w.msgs) != 1 {
+		t.Fatalf("Got %d messages, expected 1", len(w.msgs))
+	}
+	msg := w.msgs[0]
+	if string(msg.Key) != "hello" || len(msg.Headers) != 1 || string(msg.Headers[0].Value) != "Store" {
+		t.Errorf("Got message %+v, expected a Store of hello", msg)
+	}
+	var e sos.Event
+	if err := json.Unmarshal(msg.Value, &e); err != nil || e.Bytes != 5 {
+		t.Errorf("Got message value %q, expected a Store of 5 bytes", msg.Value)
+	}
+}
@@ -0,0 +1,57 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package sosnats publishes the change events of a simple object store to NATS.
+
+It is a separate module, so the sos package itself does not depend on the
+NATS client library.
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	queue := &sos.EventQueue{Publisher: sosnats.New(nc, "sos.events")}
+	go queue.Run(ctx)
+	store, err := sos.New(path, sos.WithEventSink(queue))
+*/
+package sosnats
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hweidner/sos"
+	"github.com/nats-io/nats.go"
+)
+
+// Conn is the part of a NATS connection used by Publisher. It is implemented
+// by *nats.Conn.
+type Conn interface {
+	Publish(subject string, data []byte) error
+}
+
+var _ Conn = (*nats.Conn)(nil)
+
+// Publisher is a sos.EventPublisher which publishes each event as a JSON
+// object to the subject "<Subject>.<op>", e.g. "sos.events.Store".
+type Publisher struct {
+	Conn    Conn   // NATS connection
+	Subject string // subject prefix
+}
+
+var _ sos.EventPublisher = (*Publisher)(nil)
+
+// New creates a Publisher for the NATS connection and the subject prefix.
+func New(nc *nats.Conn, subject string) *Publisher {
+	return &Publisher{Conn: nc, Subject: subject}
+}
+
+// Publish implements sos.EventPublisher. The message is buffered by the NATS
+// client, the context is not used.
+func (p *Publisher) Publish(ctx context.Context, e sos.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.Conn.Publish(p.Subject+"."+e.Op, data)
+}
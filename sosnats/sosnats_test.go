@@ -0,0 +1,48 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sosnats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hweidner/sos"
+)
+
+// testConn records the published messages.
+type testConn struct {
+	subjects []string
+	data     [][]byte
+}
+
+func (c *testConn) Publish(subject string, data []byte) error {
+	c.subjects = append(c.subjects, subject)
+	c.data = append(c.data, data)
+	return nil
+}
+
+// Test publishing store events
+func TestPublisher(t *testing.T) {
+	conn := &testConn{}
+	p := &Publisher{Conn: conn, Subject: "sos.events"}
+
+	s := sos.NewTemp(t, sos.WithEventSink(sos.EventFunc(func(e sos.Event) {
+		if err := p.Publish(context.Background(), e); err != nil {
+			t.Errorf("Publish failed: %v", err)
+		}
+	})))
+	s.StoreString("hello", "world")
+	s.Delete("hello")
+
+	if len(conn.subjects) != 2 || conn.subjects[0] != "sos.events.Store" || conn.subjects[1] != "sos.events.Delete" {
+		t.Fatalf("Got subjects %v, expected a Store and a Delete", conn.subjects)
+	}
+	var e sos.Event
+	if err := json.Unmarshal(conn.data[0], &e); err != nil || e.Key != "hello" || e.Bytes != 5 {
+		t.Errorf("Got message %q, expected a Store of hello", conn.data[0])
+	}
+}
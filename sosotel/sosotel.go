@@ -0,0 +1,58 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package sosotel creates OpenTelemetry spans for the operations of a simple
+object store, so they show up in distributed traces.
+
+It is a separate module, so the sos package itself does not depend on the
+OpenTelemetry libraries.
+
+	tracer := otel.Tracer("github.com/hweidner/sos")
+	store, err := sos.New(path, sos.WithHooks(sosotel.Hooks(tracer)))
+	err = store.StoreCtx(ctx, key, value)
+*/
+package sosotel
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hweidner/sos"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Hooks returns hooks which create a span for each operation on a key, as a
+// child of the span in the context of the operation. Operations without a
+// span in their context, e.g. those called without a context, are not
+// traced. The spans are named like "sos.Get", and record the key hash and the
+// number of bytes, but not the key itself. Failed operations set the span
+// status to error; ErrNotFound is not taken for a failure.
+func Hooks(tracer trace.Tracer) sos.Hooks {
+	return sos.Hooks{
+		Start: func(ctx context.Context, info sos.OpInfo) func(sos.OpInfo) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return nil
+			}
+			_, span := tracer.Start(ctx, "sos."+info.Op,
+				trace.WithSpanKind(trace.SpanKindInternal),
+				trace.WithAttributes(attribute.String("sos.key_hash", info.KeyHash)))
+
+			return func(info sos.OpInfo) {
+				span.SetAttributes(attribute.Int64("sos.bytes", info.Bytes))
+				switch {
+				case errors.Is(info.Err, sos.ErrNotFound):
+					span.SetAttributes(attribute.Bool("sos.not_found", true))
+				case info.Err != nil:
+					span.RecordError(info.Err)
+					span.SetStatus(codes.Error, info.Err.Error())
+				}
+				span.End()
+			}
+		},
+	}
+}
@@ -0,0 +1,62 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sosotel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hweidner/sos"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Test the spans of store operations
+func TestHooks(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer("test")
+
+	s := sos.NewTemp(t, sos.WithHooks(Hooks(tracer)))
+	s.StoreString("untraced", "value")
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	s.StoreCtx(ctx, "hello", []byte("world"))
+	s.GetCtx(ctx, "missing")
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	s.StoreCtx(cancelled, "key", []byte("value"))
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("Got %d spans, expected 4", len(spans))
+	}
+	for i, name := range []string{"sos.Store", "sos.Get", "sos.Store", "request"} {
+		if spans[i].Name != name {
+			t.Errorf("Got span %s, expected %s", spans[i].Name, name)
+		}
+		if i < 3 && spans[i].Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Got span %s without parent", spans[i].Name)
+		}
+	}
+
+	attrs := attribute.NewSet(spans[0].Attributes...)
+	if v, _ := attrs.Value("sos.bytes"); v.AsInt64() != 5 {
+		t.Errorf("Got %v bytes, expected 5", v.AsInt64())
+	}
+	if v, _ := attrs.Value("sos.key_hash"); len(v.AsString()) != 64 {
+		t.Errorf("Got key hash %q, expected 64 hex digits", v.AsString())
+	}
+	if spans[1].Status.Code != codes.Unset {
+		t.Errorf("Got status %v for missing key, expected unset", spans[1].Status.Code)
+	}
+	if spans[2].Status.Code != codes.Error {
+		t.Errorf("Got status %v for failed store, expected error", spans[2].Status.Code)
+	}
+}
@@ -0,0 +1,108 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+/*
+Package sosprom exports the metrics of a simple object store to Prometheus.
+
+It is a separate module, so the sos package itself does not depend on the
+Prometheus client library.
+
+	sink := sosprom.New("myapp")
+	prometheus.MustRegister(sink)
+	store, err := sos.New(path, sos.WithMetrics(sink))
+*/
+package sosprom
+
+import (
+	"time"
+
+	"github.com/hweidner/sos"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sink is a sos.MetricsSink which records the metrics in Prometheus
+// collectors. It is a prometheus.Collector itself, and must be registered to
+// be exported.
+type Sink struct {
+	counters map[string]*prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inflight prometheus.Gauge
+}
+
+var _ sos.MetricsSink = (*Sink)(nil)
+
+// New creates a Sink. The metric names are prefixed by the namespace and
+// "sos", e.g. "myapp_sos_operations_total".
+func New(namespace string) *Sink {
+	counter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "sos",
+			Name:      name,
+			Help:      help,
+		}, []string{"op"})
+	}
+
+	return &Sink{
+		counters: map[string]*prometheus.CounterVec{
+			sos.MetricOperations: counter("operations_total", "Number of finished operations."),
+			sos.MetricErrors:     counter("errors_total", "Number of failed operations."),
+			sos.MetricNotFound:   counter("not_found_total", "Number of operations on missing keys."),
+			sos.MetricBytes:      counter("bytes_total", "Number of bytes stored or read."),
+		},
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "sos",
+			Name:      "duration_seconds",
+			Help:      "Duration of operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op"}),
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "sos",
+			Name:      "inflight",
+			Help:      "Number of running operations.",
+		}),
+	}
+}
+
+// Counter implements sos.MetricsSink. Unknown metrics are ignored.
+func (s *Sink) Counter(name, op string, delta int64) {
+	if c, ok := s.counters[name]; ok {
+		c.WithLabelValues(op).Add(float64(delta))
+	}
+}
+
+// Timer implements sos.MetricsSink. Unknown metrics are ignored.
+func (s *Sink) Timer(name, op string, d time.Duration) {
+	if name == sos.MetricDuration {
+		s.duration.WithLabelValues(op).Observe(d.Seconds())
+	}
+}
+
+// Gauge implements sos.MetricsSink. Unknown metrics are ignored.
+func (s *Sink) Gauge(name string, value float64) {
+	if name == sos.MetricInflight {
+		s.inflight.Set(value)
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (s *Sink) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range s.counters {
+		c.Describe(ch)
+	}
+	s.duration.Describe(ch)
+	s.inflight.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (s *Sink) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range s.counters {
+		c.Collect(ch)
+	}
+	s.duration.Collect(ch)
+	s.inflight.Collect(ch)
+}
@@ -0,0 +1,39 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sosprom
+
+import (
+	"testing"
+
+	"github.com/hweidner/sos"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Test the export of store metrics to Prometheus
+func TestSink(t *testing.T) {
+	sink := New("test")
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	s := sos.NewTemp(t, sos.WithMetrics(sink))
+	if err := s.StoreString("hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+	s.GetString("missing")
+
+	if n := testutil.ToFloat64(sink.counters[sos.MetricBytes].WithLabelValues("Store")); n != 5 {
+		t.Errorf("Got %v stored bytes, expected 5", n)
+	}
+	if n := testutil.ToFloat64(sink.counters[sos.MetricNotFound].WithLabelValues("Get")); n != 1 {
+		t.Errorf("Got %v missing keys, expected 1", n)
+	}
+	if n := testutil.CollectAndCount(reg, "test_sos_duration_seconds"); n != 2 {
+		t.Errorf("Got %d duration series, expected 2", n)
+	}
+}
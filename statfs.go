@@ -0,0 +1,51 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+// FreeSpace returns the number of bytes available to unprivileged users on
+// the file system which holds the object store.
+func (s *SOS) FreeSpace() (free uint64, err error) {
+	defer s.wraperr(&err, "FreeSpace", "")
+
+	if err := s.begin(); err != nil {
+		return 0, err
+	}
+	defer s.end()
+
+	fs, err := statfs(s.base)
+	if err != nil {
+		return 0, err
+	}
+	return fs.bavail * fs.bsize, nil
+}
+
+// InodeUsage returns the number of used and the total number of inodes on
+// the file system which holds the object store.
+//
+// As every object occupies one file, a store with many small objects usually
+// runs out of inodes long before it runs out of space.
+func (s *SOS) InodeUsage() (used, total uint64, err error) {
+	defer s.wraperr(&err, "InodeUsage", "")
+
+	if err := s.begin(); err != nil {
+		return 0, 0, err
+	}
+	defer s.end()
+
+	fs, err := statfs(s.base)
+	if err != nil {
+		return 0, 0, err
+	}
+	return fs.files - fs.ffree, fs.files, nil
+}
+
+// fsinfo holds the platform independent subset of the statfs(2) results.
+type fsinfo struct {
+	bsize  uint64 // block size
+	bavail uint64 // free blocks available to unprivileged users
+	files  uint64 // total inodes
+	ffree  uint64 // free inodes
+}
@@ -0,0 +1,15 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build !(linux || darwin || freebsd)
+
+package sos
+
+import "fmt"
+
+// statfs is not available on this platform.
+func statfs(path string) (fsinfo, error) {
+	return fsinfo{}, fmt.Errorf("statfs is not supported on this platform")
+}
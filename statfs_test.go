@@ -0,0 +1,35 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import "testing"
+
+// Test the file system usage reporting
+func TestStatfs(t *testing.T) {
+	s, _ := New("./._sostest")
+	defer s.Destroy()
+
+	free, err := s.FreeSpace()
+	if err != nil {
+		t.Fatalf("FreeSpace failed: %v", err)
+	}
+	if free == 0 {
+		t.Errorf("Got zero free space")
+	}
+
+	used, total, err := s.InodeUsage()
+	if err != nil {
+		t.Fatalf("InodeUsage failed: %v", err)
+	}
+	if used > total {
+		t.Errorf("Got %d used inodes, more than the total of %d", used, total)
+	}
+
+	s.Destroy()
+	if _, err := s.FreeSpace(); err == nil {
+		t.Errorf("Got no error from FreeSpace on a destroyed store")
+	}
+}
@@ -0,0 +1,25 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build linux || darwin || freebsd
+
+package sos
+
+import "syscall"
+
+// statfs queries the file system information for the given path.
+func statfs(path string) (fsinfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsinfo{}, err
+	}
+
+	return fsinfo{
+		bsize:  uint64(st.Bsize),
+		bavail: uint64(st.Bavail),
+		files:  uint64(st.Files),
+		ffree:  uint64(st.Ffree),
+	}, nil
+}
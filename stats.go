@@ -0,0 +1,148 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stats describes the size and state of a store, e.g. for monitoring its
+// growth.
+type Stats struct {
+	Objects int64            // number of objects
+	Bytes   int64            // total size of the object files
+	Shards  map[string]int64 // number of objects by the first two hex digits of the key hash, if scanned
+	Temp    TempInfo         // temporary files, see TempStats
+	LastGC  time.Time        // end of the last complete Expire run by any process, zero if none
+
+	Compression CompressionStats // compressed objects, if scanned with WithCompression
+}
+
+// CompressionStats describes the compressed objects of a store, whose plain
+// size is recorded, see WithCompression.
+type CompressionStats struct {
+	Objects    int64 // number of compressed objects
+	Bytes      int64 // total size of their object files
+	PlainBytes int64 // total size of their plain values
+}
+
+// Ratio returns the compression ratio, i.e. the plain size divided by the
+// stored size, or 0 if there are no compressed objects.
+func (c CompressionStats) Ratio() float64 {
+	if c.Bytes == 0 {
+		return 0
+	}
+	return float64(c.PlainBytes) / float64(c.Bytes)
+}
+
+// Stats returns statistics of the store. If scan is set, or the store was
+// created without WithCounters, all object files are scanned. Otherwise, the
+// number and size of the objects are taken from the counter files, which is
+// fast even for large stores, but Shards is nil.
+//
+// On a store created with WithCompression, the scan reads the header of each
+// object file as well, to sum up the plain sizes of the compressed objects.
+//
+// The shards count the objects by the first two hex digits of the key hash,
+// which name the top level shard directories (see WithShardDepth). With a
+// working hash function, the objects are spread evenly over them.
+func (s *SOS) Stats(scan bool) (stats Stats, err error) {
+	defer s.wraperr(&err, "Stats", "")
+
+	if err := s.begin(); err != nil {
+		return stats, err
+	}
+	defer s.end()
+
+	if scan || s.counts == nil {
+		stats.Shards = make(map[string]int64)
+		err = s.walk(func(rel string, fi fs.FileInfo) error {
+			stats.Objects++
+			stats.Bytes += fi.Size()
+			stats.Shards[s.relhash(rel)[:2]]++
+			if s.compression != 0 {
+				return s.statcompression(rel, fi, &stats.Compression)
+			}
+			return nil
+		})
+	} else {
+		stats.Objects, stats.Bytes, err = s.counted("Stats")
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	if stats.Temp, err = s.tempstats(); err != nil {
+		return stats, err
+	}
+	stats.LastGC, err = s.lastgc()
+	return stats, err
+}
+
+// statcompression adds the object file at the relative path rel to the
+// compression statistics, if it is compressed.
+func (s *SOS) statcompression(rel string, fi fs.FileInfo, c *CompressionStats) error {
+	fh, err := os.Open(filepath.Join(s.base, filepath.FromSlash(rel)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // deleted in the meantime
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	h, err := readheader(bufio.NewReader(fh))
+	if errors.Is(err, ErrCorrupt) {
+		return nil // see Fsck
+	}
+	if err != nil {
+		return err
+	}
+	if n, ok := plainsize(h); ok {
+		c.Objects++
+		c.Bytes += fi.Size()
+		c.PlainBytes += n
+	}
+	return nil
+}
+
+// lastgc returns the time of the last complete Expire run, or the zero time
+// if there was none.
+func (s *SOS) lastgc() (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(s.base, fileLastGC))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrCorrupt, fileLastGC)
+	}
+	return t, nil
+}
+
+// recordgc records the current time as the end of a complete Expire run.
+func (s *SOS) recordgc() error {
+	tmpname := s.tmpfilename()
+	data := s.clock.Now().UTC().Format(time.RFC3339Nano) + "\n"
+	if err := s.writefile(tmpname, []byte(data)); err != nil {
+		return err
+	}
+	err := os.Rename(tmpname, filepath.Join(s.base, fileLastGC))
+	if err != nil {
+		_ = os.Remove(tmpname)
+	}
+	return err
+}
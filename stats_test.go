@@ -0,0 +1,108 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the statistics with and without counters
+func TestStats(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithCounters(), WithClock(clock))
+
+	for i := 0; i < 20; i++ {
+		s.StoreString(fmt.Sprintf("key%d", i), "value")
+	}
+	os.WriteFile(filepath.Join(s.tmpdir(), "crashed-1234"), []byte("junk"), 0o644)
+
+	stats, err := s.Stats(false)
+	if err != nil {
+		t.Fatalf("Error getting statistics: %v", err)
+	}
+	if stats.Objects != 20 || stats.Bytes != 100 {
+		t.Errorf("Got %d objects with %d bytes, expected 20 with 100", stats.Objects, stats.Bytes)
+	}
+	if stats.Shards != nil {
+		t.Errorf("Got shards %v from counters, expected nil", stats.Shards)
+	}
+	if stats.Temp.Count != 1 || stats.Temp.Bytes != 4 {
+		t.Errorf("Got %d temporary files with %d bytes, expected 1 with 4", stats.Temp.Count, stats.Temp.Bytes)
+	}
+	if !stats.LastGC.IsZero() {
+		t.Errorf("Got last GC %v, expected none", stats.LastGC)
+	}
+
+	// a complete Expire run is recorded
+	clock.Advance(time.Hour)
+	if _, err := s.Expire(); err != nil {
+		t.Fatalf("Error expiring objects: %v", err)
+	}
+
+	stats, err = s.Stats(true)
+	if err != nil {
+		t.Fatalf("Error getting statistics: %v", err)
+	}
+	if stats.Objects != 20 || stats.Bytes != 100 {
+		t.Errorf("Got %d objects with %d bytes, expected 20 with 100", stats.Objects, stats.Bytes)
+	}
+	var sum int64
+	for shard, n := range stats.Shards {
+		if len(shard) != 2 {
+			t.Errorf("Got shard %q, expected two hex digits", shard)
+		}
+		sum += n
+	}
+	if sum != 20 {
+		t.Errorf("Got %d objects in shards, expected 20", sum)
+	}
+	if hs := s.keyhash("key0"); stats.Shards[hs[:2]] == 0 {
+		t.Errorf("Got no object in shard %s of key0", hs[:2])
+	}
+	if !stats.LastGC.Equal(clock.Now()) {
+		t.Errorf("Got last GC %v, expected %v", stats.LastGC, clock.Now())
+	}
+}
+
+// Test the compression statistics
+func TestStatsCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sos")
+	plain, _ := New(path)
+	defer plain.Close()
+	plain.StoreString("plain", "not compressed")
+
+	value := strings.Repeat("compressible ", 1000)
+	for _, opts := range [][]Option{{}, {WithDigests()}, {WithEncryption(make([]byte, 16))}} {
+		s, err := New(path, append(opts, WithCompression(CompressionGzip))...)
+		if err != nil {
+			t.Fatalf("Error opening store: %v", err)
+		}
+		s.StoreString("compressed", value)
+
+		stats, err := s.Stats(true)
+		if err != nil {
+			t.Fatalf("Error getting statistics: %v", err)
+		}
+		c := stats.Compression
+		_, filename := s.getpath("compressed")
+		fi, _ := os.Stat(filename)
+		if c.Objects != 1 || c.PlainBytes != int64(len(value)) || c.Bytes != fi.Size() {
+			t.Errorf("Got compression %+v, expected 1 object of %d bytes in %d", c, len(value), fi.Size())
+		}
+		if c.Ratio() <= 1 {
+			t.Errorf("Got compression ratio %v, expected more than 1", c.Ratio())
+		}
+		if v, err := s.GetString("compressed"); err != nil || v != value {
+			t.Errorf("Got %d bytes (%v), expected %d", len(v), err, len(value))
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,101 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// Swap exchanges the values of two keys. Both keys must exist. A Store event
+// is emitted for both keys (see WithEventSink), with the size of the object
+// files.
+//
+// On Linux, the exchange is atomic (renameat2 with RENAME_EXCHANGE), so
+// readers always see one of the two values under each key. On other
+// platforms, or on file systems which do not support the exchange (e.g.
+// NFS), it falls back to three renames. Then, one of the keys is briefly
+// missing during the swap. If a rename fails, the previous ones are undone.
+func (s *SOS) Swap(keyA, keyB string) (err error) {
+	defer s.wraperr(&err, "Swap", keyA)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	_, fileA := s.getpath(keyA)
+	_, fileB := s.getpath(keyB)
+	var sizes [2]int64
+	for i, filename := range []string{fileA, fileB} {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return ErrNotFound
+			}
+			return err
+		}
+		sizes[i] = fi.Size()
+	}
+	if fileA == fileB {
+		return nil
+	}
+
+	// both keys are locked (with counters) in the order of their hashes, so
+	// concurrent swaps of the same keys do not deadlock
+	hs := []string{s.keyhash(keyA), s.keyhash(keyB)}
+	sort.Strings(hs)
+	err = s.change(hs[0], false, func() error {
+		return s.change(hs[1], false, func() error {
+			return s.exchange(fileA, fileB)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.usage("Swap", keyA, 0)
+	s.usage("Swap", keyB, 0)
+	s.notify("Store", keyA, sizes[1])
+	s.notify("Store", keyB, sizes[0])
+	return nil
+}
+
+// exchange exchanges two object files, atomically if possible.
+func (s *SOS) exchange(fileA, fileB string) error {
+	err := exchange(fileA, fileB)
+	if !errors.Is(err, errExchangeUnsupported) {
+		return err
+	}
+
+	// fallback: move A aside, B to A, and the former A to B
+	tmpname := s.tmpfilename()
+	if err := os.Rename(fileA, tmpname); err != nil {
+		return err
+	}
+	if err := os.Rename(fileB, fileA); err != nil {
+		_ = os.Rename(tmpname, fileA)
+		return err
+	}
+	if err := os.Rename(tmpname, fileB); err != nil {
+		// undo, so the value of A is not left as a temporary file
+		_ = os.Rename(fileA, fileB)
+		_ = os.Rename(tmpname, fileA)
+		return err
+	}
+	return nil
+}
+
+// errExchangeUnsupported is returned by exchange, if the platform or the
+// file system does not support atomic exchanges.
+var errExchangeUnsupported = errors.New("atomic exchange not supported")
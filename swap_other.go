@@ -0,0 +1,13 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build !linux
+
+package sos
+
+// exchange is not supported on this platform.
+func exchange(a, b string) error {
+	return errExchangeUnsupported
+}
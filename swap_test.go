@@ -0,0 +1,56 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test exchanging the values of two keys
+func TestSwap(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("blue", "version 1")
+	s.StoreString("green", "version 2")
+
+	if err := s.Swap("blue", "green"); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if obj, _ := s.GetString("blue"); obj != "version 2" {
+		t.Errorf("Got %s for blue, expected %s", obj, "version 2")
+	}
+	if obj, _ := s.GetString("green"); obj != "version 1" {
+		t.Errorf("Got %s for green, expected %s", obj, "version 1")
+	}
+
+	if err := s.Swap("blue", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v when swapping with a missing key, expected %v", err, ErrNotFound)
+	}
+}
+
+// Test the events of Swap and Rekey
+func TestSwapEvents(t *testing.T) {
+	var events []string
+	s := NewTemp(t, WithKeyIndex(), WithEventSink(EventFunc(func(e Event) {
+		events = append(events, e.Op+" "+e.Key)
+	})))
+	s.StoreString("blue", "version 1")
+	s.StoreString("green", "version 2")
+	events = nil
+
+	s.Swap("blue", "green")
+	s.Rekey(func(key string) (string, bool) {
+		if key == "blue" {
+			return "red", true
+		}
+		return key, true
+	})
+	expected := []string{"Store blue", "Store green", "Delete blue", "Store red"}
+	if strings.Join(events, ",") != strings.Join(expected, ",") {
+		t.Errorf("Got events %v, expected %v", events, expected)
+	}
+}
@@ -0,0 +1,414 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncResolution decides how a conflict in Sync is resolved.
+type SyncResolution int
+
+const (
+	// SyncSkip leaves both stores unchanged. The conflict is reported again
+	// on the next Sync.
+	SyncSkip SyncResolution = iota
+	// SyncKeepLocal overwrites (or deletes) the remote object with the
+	// local one.
+	SyncKeepLocal
+	// SyncKeepRemote overwrites (or deletes) the local object with the
+	// remote one.
+	SyncKeepRemote
+)
+
+// SyncConflict describes an object which was changed in both stores since
+// the last Sync. A nil Local or Remote means that the object was deleted in
+// that store.
+type SyncConflict struct {
+	Hash   string      // hex encoded hash of the key
+	Local  *ObjectInfo // object in the local store, or nil
+	Remote *ObjectInfo // object in the remote store, or nil
+}
+
+// SyncReport summarizes the changes made by Sync.
+type SyncReport struct {
+	ToRemote  int // objects copied to or deleted from the remote store
+	ToLocal   int // objects copied to or deleted from the local store
+	Conflicts int // conflicts which were skipped
+}
+
+// Sync synchronizes the store with the remote store in both directions.
+// Objects which were created, changed or deleted in only one of the stores
+// since the last Sync are copied or deleted in the other store. Objects are
+// compared by size and modification time with the state of the last Sync.
+// Objects of the same size which are not known to be in sync are compared by
+// their digests if both have one (see WithDigests), or else by the contents
+// of their object files.
+//
+// Objects which were changed in both stores are conflicts. They are passed
+// to resolve, which decides which side wins. If resolve is nil, conflicts are
+// skipped and only counted in the report.
+//
+// The state of the last Sync is kept in the local store, separately for each
+// remote store. On the first Sync, objects which exist in both stores with
+// different contents are conflicts, while objects with the same contents are
+// left unchanged, even if their modification times differ. Key index entries are copied and removed
+// along with the objects like in CopyTo, while pointers are not
+// synchronized. Both stores must be compatible like in CopyTo.
+//
+// With WithParallelism, the partitions of the key space are synchronized by
+// several workers. resolve is still called by one worker at a time.
+func (s *SOS) Sync(remote *SOS, resolve func(SyncConflict) SyncResolution) (report SyncReport, err error) {
+	defer s.wraperr(&err, "Sync", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+	if err := remote.begin(); err != nil {
+		return report, err
+	}
+	defer remote.end()
+
+	if err := s.checkcompatible(remote); err != nil {
+		return report, err
+	}
+	if err := remote.checkcompatible(s); err != nil {
+		return report, err
+	}
+
+	statename := s.syncstatepath(remote)
+	state, err := readsyncstate(statename)
+	if err != nil {
+		return report, err
+	}
+	local, err := s.objects()
+	if err != nil {
+		return report, err
+	}
+	other, err := remote.objects()
+	if err != nil {
+		return report, err
+	}
+
+	// group the hashes by partition, see WithParallelism
+	parts := make(map[string][]string)
+	for hash := range local {
+		parts[s.partition(hash)] = append(parts[s.partition(hash)], hash)
+	}
+	for hash := range other {
+		if _, ok := local[hash]; !ok {
+			parts[s.partition(hash)] = append(parts[s.partition(hash)], hash)
+		}
+	}
+
+	// resolve is not called concurrently, insync holds the objects which
+	// are known to have the same contents in both stores, or an empty entry
+	// for the objects copied by this Sync
+	var mu sync.Mutex
+	insync := make(map[string]syncEntry)
+	err = s.forpartitions(func(p string) error {
+		hashes := parts[p]
+		sort.Strings(hashes)
+		for _, hash := range hashes {
+			l, r, last := local[hash], other[hash], state[hash]
+			same := sameobject(l, last.local) && sameobject(r, last.remote)
+			if !same && l != nil && r != nil && l.Size == r.Size {
+				var err error
+				if same, err = s.samecontent(remote, hash); err != nil {
+					return err
+				}
+			}
+			if same {
+				mu.Lock()
+				insync[hash] = syncEntry{local: l, remote: r}
+				mu.Unlock()
+				continue
+			}
+
+			var dir SyncResolution
+			switch lchanged, rchanged := !sameobject(l, last.local), !sameobject(r, last.remote); {
+			case lchanged && !rchanged:
+				dir = SyncKeepLocal
+			case rchanged && !lchanged:
+				dir = SyncKeepRemote
+			case resolve != nil:
+				mu.Lock()
+				dir = resolve(SyncConflict{Hash: hash, Local: l, Remote: r})
+				mu.Unlock()
+			}
+
+			var err error
+			switch dir {
+			case SyncKeepLocal:
+				err = s.syncobject(remote, hash, l)
+			case SyncKeepRemote:
+				err = remote.syncobject(s, hash, r)
+			}
+			mu.Lock()
+			switch dir {
+			case SyncKeepLocal:
+				report.ToRemote++
+			case SyncKeepRemote:
+				report.ToLocal++
+			default:
+				report.Conflicts++
+			}
+			if dir != SyncSkip && err == nil {
+				insync[hash] = syncEntry{}
+			}
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// record all objects which are in sync now
+	local, err = s.objects()
+	if err != nil {
+		return report, err
+	}
+	other, err = remote.objects()
+	if err != nil {
+		return report, err
+	}
+	state = make(map[string]syncEntry)
+	for hash, l := range local {
+		r := other[hash]
+		e, ok := insync[hash]
+		switch {
+		case ok && e.local == nil && sameobject(l, r):
+			// copied by this Sync
+			state[hash] = syncEntry{local: l, remote: r}
+		case ok && sameobject(l, e.local) && sameobject(r, e.remote):
+			state[hash] = e
+		}
+	}
+	return report, s.writesyncstate(statename, state)
+}
+
+// syncobject copies an object into the store dst, or deletes it there if
+// info is nil.
+func (s *SOS) syncobject(dst *SOS, hash string, info *ObjectInfo) error {
+	if info != nil {
+		return s.copyobject(dst, *info)
+	}
+
+	if err := dst.beginmodify(); err != nil {
+		return err
+	}
+	defer dst.endmodify()
+
+	_, filename := dst.hashpath(hash)
+	err := dst.change(hash, false, func() error {
+		return os.Remove(filename)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err == nil {
+		_, indexname := dst.indexpath(hash)
+		_ = os.Remove(indexname)
+	}
+	return err
+}
+
+// objects returns the metadata of all objects of the store, by hash.
+func (s *SOS) objects() (map[string]*ObjectInfo, error) {
+	objects := make(map[string]*ObjectInfo)
+	err := s.walk(func(rel string, fi fs.FileInfo) error {
+		info := newinfo(s.relhash(rel), fi)
+		objects[info.Hash] = &info
+		return nil
+	})
+	return objects, err
+}
+
+// samecontent reports whether an object has the same contents in the store
+// and in the remote store. The objects are compared by their digests if both
+// have one, or else by the contents of the object files. A missing object
+// is reported as different.
+func (s *SOS) samecontent(remote *SOS, hash string) (bool, error) {
+	_, lname := s.hashpath(hash)
+	lf, err := s.openfile(lname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer lf.Close()
+	_, rname := remote.hashpath(hash)
+	rf, err := remote.openfile(rname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer rf.Close()
+
+	lr, rr := bufio.NewReader(lf), bufio.NewReader(rf)
+	lh, err := readheader(lr)
+	if err != nil {
+		return false, err
+	}
+	rh, err := readheader(rr)
+	if err != nil {
+		return false, err
+	}
+	if ld, ok := headerdigest(lh); ok {
+		if rd, ok := headerdigest(rh); ok {
+			return ld == rd && samefields(lh, rh), nil
+		}
+	}
+	if (lh == nil) != (rh == nil) ||
+		lh != nil && !bytes.Equal(lh.marshal(), rh.marshal()) {
+		return false, nil
+	}
+	return samereader(lr, rr)
+}
+
+// samefields reports whether two object headers have the same parts,
+// expiry time and metadata.
+func samefields(a, b *header) bool {
+	for _, tag := range []byte{tagParts, tagExpires, tagMeta} {
+		if !bytes.Equal(a.fields[tag], b.fields[tag]) {
+			return false
+		}
+	}
+	return true
+}
+
+// samereader reports whether two readers return the same data.
+func samereader(a, b io.Reader) (bool, error) {
+	abuf, bbuf := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		an, aerr := io.ReadFull(a, abuf)
+		bn, berr := io.ReadFull(b, bbuf)
+		if !bytes.Equal(abuf[:an], bbuf[:bn]) {
+			return false, nil
+		}
+		aeof := errors.Is(aerr, io.EOF) || errors.Is(aerr, io.ErrUnexpectedEOF)
+		beof := errors.Is(berr, io.EOF) || errors.Is(berr, io.ErrUnexpectedEOF)
+		switch {
+		case aerr != nil && !aeof:
+			return false, aerr
+		case berr != nil && !beof:
+			return false, berr
+		case aeof || beof:
+			return aeof == beof, nil
+		}
+	}
+}
+
+// sameobject reports whether two objects have the same size and modification
+// time, or are both missing.
+func sameobject(a, b *ObjectInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+// syncstatepath returns the file name of the sync state with a remote store.
+func (s *SOS) syncstatepath(remote *SOS) string {
+	base, err := filepath.Abs(remote.base)
+	if err != nil {
+		base = remote.base
+	}
+	h := sha256.Sum256([]byte(base))
+	return filepath.Join(s.base, dirSync, hex.EncodeToString(h[:16]))
+}
+
+// syncEntry is the state of an object which was in sync after the last
+// Sync, in the local and in the remote store.
+type syncEntry struct {
+	local, remote *ObjectInfo
+}
+
+// readsyncstate reads a sync state file. Each line holds the hash, size and
+// modification time (in nanoseconds since the epoch) of an object in the
+// local store, followed by the size and modification time in the remote
+// store if they differ. A missing file is an empty state.
+func readsyncstate(filename string) (map[string]syncEntry, error) {
+	state := make(map[string]syncEntry)
+
+	fh, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	sc := bufio.NewScanner(fh)
+	for sc.Scan() {
+		var (
+			local, remote  ObjectInfo
+			lmtime, rmtime int64
+		)
+		fields := strings.Fields(sc.Text())
+		_, err := fmt.Sscanf(sc.Text(), "%s %d %d", &local.Hash, &local.Size, &lmtime)
+		remote.Size, rmtime = local.Size, lmtime
+		switch {
+		case err == nil && len(fields) == 5:
+			_, err = fmt.Sscanf(fields[3]+" "+fields[4], "%d %d", &remote.Size, &rmtime)
+		case len(fields) != 3:
+			err = ErrCorrupt
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: sync state %s", ErrCorrupt, filename)
+		}
+		local.ModTime = time.Unix(0, lmtime)
+		remote.Hash, remote.ModTime = local.Hash, time.Unix(0, rmtime)
+		state[local.Hash] = syncEntry{local: &local, remote: &remote}
+	}
+	return state, sc.Err()
+}
+
+// writesyncstate replaces a sync state file atomically.
+func (s *SOS) writesyncstate(filename string, state map[string]syncEntry) error {
+	var b strings.Builder
+	for hash, e := range state {
+		fmt.Fprintf(&b, "%s %d %d", hash, e.local.Size, e.local.ModTime.UnixNano())
+		if !sameobject(e.local, e.remote) {
+			fmt.Fprintf(&b, " %d %d", e.remote.Size, e.remote.ModTime.UnixNano())
+		}
+		b.WriteString("\n")
+	}
+
+	tmpname := s.tmpfilename()
+	if err := s.writefile(tmpname, []byte(b.String())); err != nil {
+		return err
+	}
+	_ = s.mkdirall(filepath.Dir(filename))
+
+	err := os.Rename(tmpname, filename)
+	if err != nil {
+		_ = os.Remove(tmpname)
+	}
+	return err
+}
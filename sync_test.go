@@ -0,0 +1,131 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// Test two-way synchronization of independently modified stores
+func TestSync(t *testing.T) {
+	a := NewTemp(t)
+	b := NewTemp(t)
+
+	a.StoreString("a", "from a")
+	b.StoreString("b", "from b")
+	a.StoreString("both", "value")
+	if _, err := a.Sync(b, nil); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if obj, _ := a.GetString("b"); obj != "from b" {
+		t.Errorf("Got %s from store a, expected %s", obj, "from b")
+	}
+	if obj, _ := b.GetString("a"); obj != "from a" {
+		t.Errorf("Got %s from store b, expected %s", obj, "from a")
+	}
+
+	// one-sided changes are propagated
+	b.Delete("a")
+	a.StoreString("b", "changed in a")
+	report, err := a.Sync(b, nil)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.ToLocal != 1 || report.ToRemote != 1 || report.Conflicts != 0 {
+		t.Errorf("Got report %+v, expected one change in each direction", report)
+	}
+	if _, err := a.GetString("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for a deleted key, expected %v", err, ErrNotFound)
+	}
+	if obj, _ := b.GetString("b"); obj != "changed in a" {
+		t.Errorf("Got %s from store b, expected %s", obj, "changed in a")
+	}
+}
+
+// Test conflict detection and resolution
+func TestSyncConflict(t *testing.T) {
+	a := NewTemp(t)
+	b := NewTemp(t)
+	a.StoreString("key", "original")
+	a.Sync(b, nil)
+
+	a.StoreString("key", "changed in a")
+	time.Sleep(10 * time.Millisecond)
+	b.StoreString("key", "changed in b")
+
+	report, err := a.Sync(b, nil)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Conflicts != 1 {
+		t.Errorf("Got %d conflicts, expected 1", report.Conflicts)
+	}
+	if obj, _ := a.GetString("key"); obj != "changed in a" {
+		t.Errorf("Got %s from store a, expected %s", obj, "changed in a")
+	}
+
+	// skipped conflicts are reported again
+	var conflict SyncConflict
+	_, err = a.Sync(b, func(c SyncConflict) SyncResolution {
+		conflict = c
+		return SyncKeepRemote
+	})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if conflict.Local == nil || conflict.Remote == nil || conflict.Hash != a.keyhash("key") {
+		t.Errorf("Got conflict %+v, expected a conflict for key", conflict)
+	}
+	if obj, _ := a.GetString("key"); obj != "changed in b" {
+		t.Errorf("Got %s from store a, expected %s", obj, "changed in b")
+	}
+}
+
+// Test that objects are compared by their contents on the first Sync
+func TestSyncSameContent(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithDigests()}} {
+		a := NewTemp(t, opts...)
+		b := NewTemp(t, opts...)
+
+		// same contents, different modification times
+		a.StoreString("same", "value")
+		time.Sleep(10 * time.Millisecond)
+		b.StoreString("same", "value")
+
+		// different contents, same size and modification time
+		a.StoreString("other", "value a")
+		b.StoreString("other", "value b")
+		mtime := time.Now().Add(-time.Hour)
+		for _, s := range []*SOS{a, b} {
+			_, filename := s.getpath("other")
+			os.Chtimes(filename, mtime, mtime)
+		}
+
+		report, err := a.Sync(b, nil)
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if report != (SyncReport{Conflicts: 1}) {
+			t.Errorf("Got report %+v, expected one conflict", report)
+		}
+
+		// the unchanged object is in sync, so a change is not a conflict
+		a.StoreString("same", "changed")
+		report, err = a.Sync(b, nil)
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if report != (SyncReport{ToRemote: 1, Conflicts: 1}) {
+			t.Errorf("Got report %+v, expected one change and one conflict", report)
+		}
+		if obj, _ := b.GetString("same"); obj != "changed" {
+			t.Errorf("Got %s from store b, expected %s", obj, "changed")
+		}
+	}
+}
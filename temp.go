@@ -0,0 +1,126 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TempInfo describes the temporary files of an object store. Temporary files
+// are created by running Store and Get operations. Files which stay around
+// for long are usually left over by crashed processes.
+type TempInfo struct {
+	Count  int           // number of temporary files
+	Bytes  int64         // total size of the temporary files
+	Oldest time.Duration // age of the oldest temporary file
+}
+
+// TempStats returns the number, total size and maximum age of the temporary
+// files of the store.
+//
+// Note that the temporary files of running Get operations are hard links to
+// objects, so their size is counted although they occupy no extra space.
+func (s *SOS) TempStats() (info TempInfo, err error) {
+	defer s.wraperr(&err, "TempStats", "")
+
+	if err := s.begin(); err != nil {
+		return info, err
+	}
+	defer s.end()
+	return s.tempstats()
+}
+
+// tempstats implements TempStats.
+func (s *SOS) tempstats() (info TempInfo, err error) {
+	entries, err := os.ReadDir(s.tmpdir())
+	if err != nil {
+		return info, err
+	}
+
+	now := s.clock.Now()
+	for _, e := range entries {
+		fi, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // finished in the meantime
+		}
+		if err != nil {
+			return info, err
+		}
+
+		info.Count++
+		info.Bytes += fi.Size()
+		if age := now.Sub(fi.ModTime()); age > info.Oldest {
+			info.Oldest = age
+		}
+	}
+
+	return info, nil
+}
+
+// CleanupTemp removes temporary files which are older than the given age and
+// do not belong to this instance of the store. Such files are usually left
+// over by processes which crashed while storing or reading a value. It
+// returns the number of removed files.
+//
+// The age must exceed the duration of the longest running operation of all
+// processes sharing the store, as the temporary files of running operations
+// of other processes cannot be told apart from left over ones. The age is
+// taken from the last status change of a file (on Linux), so the hard links
+// of running Get operations count as new, even for old objects.
+func (s *SOS) CleanupTemp(olderThan time.Duration) (n int, err error) {
+	defer s.wraperr(&err, "CleanupTemp", "")
+
+	if err := s.begin(); err != nil {
+		return 0, err
+	}
+	defer s.end()
+
+	entries, err := os.ReadDir(s.tmpdir())
+	if err != nil {
+		return 0, err
+	}
+
+	limit := s.clock.Now().Add(-olderThan)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), s.instanceID) {
+			continue // temporary file of this instance
+		}
+		fi, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // finished in the meantime
+		}
+		if err != nil {
+			return n, err
+		}
+		if fi.IsDir() || changetime(fi).After(limit) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(s.tmpdir(), e.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// WithTempCleanup removes left over temporary files which are older than
+// the given age when the store is opened, see CleanupTemp. The cleanup is
+// best effort, errors are ignored.
+func WithTempCleanup(olderThan time.Duration) Option {
+	return func(s *SOS) {
+		s.tempCleanup = olderThan
+	}
+}
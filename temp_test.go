@@ -0,0 +1,77 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test the statistics on temporary files
+func TestTempStats(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	s := NewTemp(t, WithClock(clock))
+
+	s.StoreString("hello", "world")
+	info, err := s.TempStats()
+	if err != nil {
+		t.Fatalf("TempStats failed: %v", err)
+	}
+	if info.Count != 0 {
+		t.Errorf("Got %d temporary files, expected none", info.Count)
+	}
+
+	// simulate a crashed writer
+	name := s.tmpfilename()
+	os.WriteFile(name, []byte("leftover"), 0o600)
+	os.Chtimes(name, clock.Now(), clock.Now())
+	clock.Advance(time.Hour)
+
+	info, _ = s.TempStats()
+	expected := TempInfo{Count: 1, Bytes: 8, Oldest: time.Hour}
+	if info != expected {
+		t.Errorf("Got %+v, expected %+v", info, expected)
+	}
+}
+
+// Test removing temporary files left over by other instances
+func TestCleanupTemp(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	s := NewTemp(t, WithClock(clock))
+
+	// simulate a crashed writer of another instance, and a running writer
+	// of this instance
+	other := filepath.Join(s.tmpdir(), "otherhost-0badcafe-1-00000000")
+	own := s.tmpfilename()
+	os.WriteFile(other, []byte("leftover"), 0o600)
+	os.WriteFile(own, []byte("running"), 0o600)
+
+	if n, err := s.CleanupTemp(time.Hour); err != nil || n != 0 {
+		t.Errorf("Got %d removed files and error %v for new files, expected none", n, err)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if n, err := s.CleanupTemp(time.Hour); err != nil || n != 1 {
+		t.Errorf("Got %d removed files and error %v, expected 1", n, err)
+	}
+	if _, err := os.Stat(other); err == nil {
+		t.Errorf("Left over file %s was not removed", other)
+	}
+	if _, err := os.Stat(own); err != nil {
+		t.Errorf("File %s of this instance was removed", own)
+	}
+
+	// cleanup when a store is opened
+	os.WriteFile(other, []byte("leftover"), 0o600)
+	if _, err := New(s.base, WithClock(clock), WithTempCleanup(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(other); err == nil {
+		t.Errorf("Left over file %s was not removed by New", other)
+	}
+}
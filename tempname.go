@@ -0,0 +1,64 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"strings"
+)
+
+// maxTempLabel is the maximum length of a temporary file label, so the file
+// names stay well below the file name limit of common file systems.
+const maxTempLabel = 128
+
+// TempNamer provides a label for the names of temporary files, e.g. a pod
+// name or a trace ID. This helps to find out where orphaned temporary files
+// in a shared store came from.
+//
+// The label is only a part of the name. The store always adds its instance
+// ID, a timestamp and a random number, so temporary file names stay unique,
+// whatever the label is. Slashes and NUL bytes in the label are replaced, and
+// long labels are truncated.
+type TempNamer interface {
+	TempLabel() string
+}
+
+// TempNamerFunc is a function which provides temporary file labels.
+type TempNamerFunc func() string
+
+// TempLabel calls f().
+func (f TempNamerFunc) TempLabel() string {
+	return f()
+}
+
+// WithTempNamer sets a provider of labels for the names of temporary files.
+// TempLabel is called for every temporary file, and may be called from
+// several goroutines concurrently.
+func WithTempNamer(n TempNamer) Option {
+	return func(s *SOS) {
+		s.namer = n
+	}
+}
+
+// templabel returns the sanitized label for the next temporary file name,
+// followed by a dash, or an empty string.
+func (s *SOS) templabel() string {
+	if s.namer == nil {
+		return ""
+	}
+	label := strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 {
+			return '_'
+		}
+		return r
+	}, s.namer.TempLabel())
+	if len(label) > maxTempLabel {
+		label = strings.ToValidUTF8(label[:maxTempLabel], "")
+	}
+	if label == "" {
+		return ""
+	}
+	return label + "-"
+}
@@ -0,0 +1,36 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test labels in temporary file names
+func TestWithTempNamer(t *testing.T) {
+	label := "pod/web-1"
+	s := NewTemp(t, WithTempNamer(TempNamerFunc(func() string { return label })))
+
+	name := filepath.Base(s.tmpfilename())
+	if !strings.HasPrefix(name, "pod_web-1-"+s.instanceID+"-") {
+		t.Errorf("Got temporary file name %s, expected the sanitized label and the instance ID", name)
+	}
+	if s.tmpfilename() == s.tmpfilename() {
+		t.Errorf("Got the same temporary file name twice")
+	}
+
+	label = strings.Repeat("x", 1000)
+	if name := filepath.Base(s.tmpfilename()); len(name) > 255 {
+		t.Errorf("Got temporary file name of %d bytes, expected a truncated label", len(name))
+	}
+
+	s.StoreString("key", "value")
+	if obj, _ := s.GetString("key"); obj != "value" {
+		t.Errorf("Got %s from store, expected %s", obj, "value")
+	}
+}
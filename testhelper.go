@@ -0,0 +1,28 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// NewTemp creates a new object store in a temporary directory for use in
+// tests. The store is destroyed automatically when the test and all its
+// subtests complete. Options are passed to New.
+//
+// If the store cannot be created, the test fails immediately.
+func NewTemp(t testing.TB, opts ...Option) *SOS {
+	t.Helper()
+
+	s, err := New(filepath.Join(t.TempDir(), "sos"), opts...)
+	if err != nil {
+		t.Fatalf("creating temporary store: %v", err)
+	}
+	t.Cleanup(s.Destroy)
+
+	return s
+}
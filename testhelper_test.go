@@ -0,0 +1,32 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"testing"
+)
+
+// Test the temporary store helper
+func TestNewTemp(t *testing.T) {
+	var base string
+
+	t.Run("use", func(t *testing.T) {
+		s := NewTemp(t)
+		base = s.base
+
+		if err := s.StoreString("hello", "world"); err != nil {
+			t.Fatalf("Store failed: %v", err)
+		}
+		if obj, _ := s.GetString("hello"); obj != "world" {
+			t.Errorf("Got %s from store, expected %s", obj, "world")
+		}
+	})
+
+	if _, err := os.Stat(base); !os.IsNotExist(err) {
+		t.Errorf("Temporary store %s still exists after the test", base)
+	}
+}
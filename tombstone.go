@@ -0,0 +1,139 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WithTombstones makes the store record deleted objects as tombstones, so
+// incremental exports carry the deletions (see ExportChangedSince). A
+// tombstone is an empty file in the directory .tombstones, named like the
+// object file, whose modification time is the time of the deletion. It is
+// removed when the key is stored again.
+//
+// Tombstones are kept until they are removed with PruneTombstones, e.g. by
+// the gc command of sosctl, so they should be pruned after each backup.
+func WithTombstones() Option {
+	return func(s *SOS) {
+		s.tombstones = true
+	}
+}
+
+// tombstonepath returns the directory and file name of the tombstone for a
+// given hex encoded key hash.
+func (s *SOS) tombstonepath(hs string) (dirname, filename string) {
+	return s.shardpath(s.base+"/"+dirTombstones, hs)
+}
+
+// changed records the result of a change of the object file of the key
+// hash hs, which started at the time start: on a store with tombstones, a
+// tombstone is written if the object was removed, and removed if the object
+// exists. As the start of the
+// change is recorded, an object which was stored concurrently is always
+// newer than the tombstone. The entry in the manifest of the shard is marked
+// as stale as well.
+func (s *SOS) changed(hs string, start time.Time) {
+	s.markstale(hs)
+	if !s.tombstones {
+		return
+	}
+
+	_, filename := s.hashpath(hs)
+	_, tombname := s.tombstonepath(hs)
+	if _, err := os.Stat(filename); err == nil {
+		_ = os.Remove(tombname)
+		return
+	}
+
+	fh, err := s.createfile(tombname)
+	if err != nil {
+		return
+	}
+	_ = fh.Close()
+	_ = os.Chtimes(tombname, start, start)
+}
+
+// PruneTombstones removes the tombstones of objects which were deleted
+// before the time t, e.g. the time of the oldest incremental export which
+// may still be restored. The deletions are not part of exports changed since
+// later times anyway. It returns the number of removed tombstones.
+func (s *SOS) PruneTombstones(t time.Time) (n int, err error) {
+	defer s.wraperr(&err, "PruneTombstones", "")
+
+	if err := s.begin(); err != nil {
+		return 0, err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return 0, err
+	}
+	defer s.endmodify()
+
+	tombdir := filepath.Join(s.base, dirTombstones)
+	err = filepath.WalkDir(tombdir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || !fi.ModTime().Before(t) {
+			return nil
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// applytombstone removes the object of the key hash hs, which was deleted at
+// the time deleted in another store, unless it was stored after the
+// deletion. It reports whether the object was removed.
+func (s *SOS) applytombstone(hs string, deleted time.Time) (bool, error) {
+	if err := s.beginmodify(); err != nil {
+		return false, err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockhash(hs)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	_, filename := s.hashpath(hs)
+	removed := false
+	err = s.change(hs, true, func() error {
+		fi, err := os.Stat(filename)
+		if err != nil || fi.ModTime().After(deleted) {
+			return err
+		}
+		err = os.Remove(filename)
+		removed = err == nil
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if removed {
+		_, indexname := s.indexpath(hs)
+		_ = os.Remove(indexname)
+	}
+	return removed, err
+}
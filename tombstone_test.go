@@ -0,0 +1,93 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test that incremental exports carry deletions to Restore and ImportTar
+func TestTombstones(t *testing.T) {
+	src := NewTemp(t, WithTombstones())
+	src.StoreString("deleted", "value")
+	src.StoreString("kept", "value")
+	src.StoreString("restored", "value")
+	full := new(bytes.Buffer)
+	if err := src.ExportTar(full); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+
+	since := time.Now()
+	src.Delete("deleted")
+	src.Delete("restored")
+	src.StoreString("restored", "new value")
+	src.StoreString("new", "value")
+	incr := new(bytes.Buffer)
+	if err := src.ExportChangedSince(since, incr); err != nil {
+		t.Fatalf("ExportChangedSince failed: %v", err)
+	}
+
+	dst := NewTemp(t)
+	if _, err := dst.Restore(bytes.NewReader(full.Bytes()), true); err != nil {
+		t.Fatalf("Restore of full export failed: %v", err)
+	}
+	report, err := dst.Restore(bytes.NewReader(incr.Bytes()), true)
+	if err != nil {
+		t.Fatalf("Restore of incremental export failed: %v", err)
+	}
+	if report.Restored != 2 || report.Deleted != 1 {
+		t.Errorf("Got report %+v, expected 2 restored and 1 deleted object", report)
+	}
+	for key, expected := range map[string]string{"kept": "value", "restored": "new value", "new": "value"} {
+		if v, err := dst.GetString(key); err != nil || v != expected {
+			t.Errorf("Got %q (%v) for %s, expected %q", v, err, key, expected)
+		}
+	}
+	if _, err := dst.GetString("deleted"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v for deleted key, expected %v", err, ErrNotFound)
+	}
+
+	// objects stored after the deletion are kept
+	imp := NewTemp(t)
+	imp.StoreString("deleted", "stored later")
+	ireport, err := imp.ImportTar(bytes.NewReader(incr.Bytes()), ImportSkipExisting)
+	if err != nil {
+		t.Fatalf("ImportTar failed: %v", err)
+	}
+	if ireport.Deleted != 0 {
+		t.Errorf("Got %d deleted objects, expected 0", ireport.Deleted)
+	}
+	if v, _ := imp.GetString("deleted"); v != "stored later" {
+		t.Errorf("Got %q, expected %q", v, "stored later")
+	}
+
+	// pruned tombstones are not exported
+	if n, err := src.PruneTombstones(time.Now()); err != nil || n != 1 {
+		t.Errorf("Got %d pruned tombstones (%v), expected 1", n, err)
+	}
+	incr.Reset()
+	src.ExportChangedSince(since, incr)
+	for name := range readTar(t, incr) {
+		if name[0] == '.' {
+			t.Errorf("Got %s in export after PruneTombstones", name)
+		}
+	}
+}
+
+// Test that only stores with tombstones record deleted objects
+func TestWithoutTombstones(t *testing.T) {
+	s := NewTemp(t)
+	for i := 0; i < 10; i++ {
+		s.StoreString("key", "value")
+		s.Delete("key")
+	}
+	if n, err := s.PruneTombstones(time.Now().Add(time.Hour)); err != nil || n != 0 {
+		t.Errorf("Got %d tombstones (%v), expected none", n, err)
+	}
+}
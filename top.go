@@ -0,0 +1,107 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// SortField selects the ranking of TopN.
+type SortField int
+
+const (
+	// SortBySize ranks the largest objects first.
+	SortBySize SortField = iota
+	// SortByAge ranks the objects with the oldest modification time first.
+	SortByAge
+)
+
+// TopObject is an object returned by TopN.
+type TopObject struct {
+	Key string // original key, or empty if the object is not in the key index
+	ObjectInfo
+}
+
+// TopN returns the n largest or oldest objects of the store, depending on
+// the sort field, in ranked order. The keys are filled in for objects in the
+// key index (see WithKeyIndex). All object files are scanned, so this takes
+// a while on large stores.
+//
+// The size is the size of the object file, see Stat.
+func (s *SOS) TopN(by SortField, n int) (top []TopObject, err error) {
+	defer s.wraperr(&err, "TopN", "")
+
+	if by != SortBySize && by != SortByAge {
+		return nil, fmt.Errorf("invalid sort field %d", by)
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	defer s.end()
+
+	// the heap holds the best n objects so far, with the lowest ranked one
+	// on top
+	h := &topHeap{by: by}
+	err = s.walk(func(rel string, fi fs.FileInfo) error {
+		obj := TopObject{ObjectInfo: newinfo(s.relhash(rel), fi)}
+		if h.Len() < n {
+			heap.Push(h, obj)
+		} else if h.before(obj, h.objs[0]) {
+			h.objs[0] = obj
+			heap.Fix(h, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	top = h.objs
+	sort.Slice(top, func(i, j int) bool { return h.before(top[i], top[j]) })
+	for i := range top {
+		_, filename := s.indexpath(top[i].Hash)
+		key, err := os.ReadFile(filename)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		top[i].Key = string(key)
+	}
+	return top, nil
+}
+
+// topHeap is a min-heap of objects, ordered by rank.
+type topHeap struct {
+	by   SortField
+	objs []TopObject
+}
+
+// before reports whether a ranks before b.
+func (h *topHeap) before(a, b TopObject) bool {
+	if h.by == SortByAge {
+		return a.ModTime.Before(b.ModTime)
+	}
+	return a.Size > b.Size
+}
+
+func (h *topHeap) Len() int           { return len(h.objs) }
+func (h *topHeap) Less(i, j int) bool { return h.before(h.objs[j], h.objs[i]) }
+func (h *topHeap) Swap(i, j int)      { h.objs[i], h.objs[j] = h.objs[j], h.objs[i] }
+func (h *topHeap) Push(x any)         { h.objs = append(h.objs, x.(TopObject)) }
+
+func (h *topHeap) Pop() any {
+	obj := h.objs[len(h.objs)-1]
+	h.objs = h.objs[:len(h.objs)-1]
+	return obj
+}
@@ -0,0 +1,70 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test ranking the largest and oldest objects
+func TestTopN(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock), WithKeyIndex())
+
+	// object i has size i+1, and object 0 is the newest
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := len(keys) - 1; i >= 0; i-- {
+		s.StoreString(keys[i], strings.Repeat("x", i+1))
+		clock.Advance(time.Minute)
+	}
+
+	top, err := s.TopN(SortBySize, 3)
+	if err != nil {
+		t.Fatalf("TopN failed: %v", err)
+	}
+	if got := topkeys(top); got != "e d c" {
+		t.Errorf("Got largest objects %s, expected %s", got, "e d c")
+	}
+
+	top, _ = s.TopN(SortByAge, 2)
+	if got := topkeys(top); got != "e d" {
+		t.Errorf("Got oldest objects %s, expected %s", got, "e d")
+	}
+
+	top, _ = s.TopN(SortBySize, 10)
+	if len(top) != len(keys) {
+		t.Errorf("Got %d objects, expected %d", len(top), len(keys))
+	}
+	if top[0].Size != 5 || top[0].Hash != s.keyhash("e") {
+		t.Errorf("Got object %+v, expected key e with size 5", top[0])
+	}
+
+	if _, err := s.TopN(SortField(7), 1); err == nil {
+		t.Errorf("Got no error for an invalid sort field")
+	}
+}
+
+// Test that objects outside the key index are returned without key
+func TestTopNWithoutIndex(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreString("hello", "world")
+
+	top, _ := s.TopN(SortBySize, 1)
+	if len(top) != 1 || top[0].Key != "" || top[0].Hash != s.keyhash("hello") {
+		t.Errorf("Got %+v, expected one object without key", top)
+	}
+}
+
+// topkeys returns the keys of the objects, separated by blanks.
+func topkeys(top []TopObject) string {
+	keys := make([]string, len(top))
+	for i, obj := range top {
+		keys[i] = obj.Key
+	}
+	return strings.Join(keys, " ")
+}
@@ -0,0 +1,192 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceEntry is a single operation in a trace, as written by a Recorder.
+type TraceEntry struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Op       string        `json:"op"` // "Store", "Get" or "Delete"
+	Key      string        `json:"key"`
+	Size     int64         `json:"size"`             // size of the value
+	SHA256   string        `json:"sha256,omitempty"` // checksum of the value, if recorded
+	Err      string        `json:"err,omitempty"`
+}
+
+// Recorder wraps an object store and writes a trace of all operations, as
+// JSON lines, to a writer. The trace can be re-executed against another
+// store with a Replayer, e.g. to reproduce performance issues.
+type Recorder struct {
+	s      *SOS
+	hashes bool
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder returns a recorder for the store s, which writes the trace to
+// w. If hashes is true, the SHA256 checksums of the values are recorded as
+// well. Write errors on w are ignored.
+func NewRecorder(s *SOS, w io.Writer, hashes bool) *Recorder {
+	return &Recorder{s: s, hashes: hashes, enc: json.NewEncoder(w)}
+}
+
+// Store stores a key/value pair, given as string and byte slice.
+func (r *Recorder) Store(key string, value []byte) error {
+	return r.StoreFrom(key, bytes.NewReader(value))
+}
+
+// StoreString stores a key/value pair, given as strings.
+func (r *Recorder) StoreString(key, value string) error {
+	return r.StoreFrom(key, strings.NewReader(value))
+}
+
+// StoreFrom stores a value, which is read from an io.Reader, under the given
+// key.
+func (r *Recorder) StoreFrom(key string, rd io.Reader) error {
+	e, cw, h := r.start("Store", key)
+	err := r.s.StoreFromMulti(key, rd, cw, h)
+	r.finish(e, cw, h, err)
+	return err
+}
+
+// Get fetches an object, and returns it as byte slice.
+func (r *Recorder) Get(key string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if err := r.GetTo(key, buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// GetString fetches an object, and returns it as a string.
+func (r *Recorder) GetString(key string) (string, error) {
+	var buffer strings.Builder
+	if err := r.GetTo(key, &buffer); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// GetTo fetches an object, and copies it into an io.Writer.
+func (r *Recorder) GetTo(key string, wr io.Writer) error {
+	e, cw, h := r.start("Get", key)
+	err := r.s.GetTo(key, io.MultiWriter(wr, cw, h))
+	r.finish(e, cw, h, err)
+	return err
+}
+
+// Delete removes an object.
+func (r *Recorder) Delete(key string) error {
+	e, cw, h := r.start("Delete", key)
+	err := r.s.Delete(key)
+	r.finish(e, cw, h, err)
+	return err
+}
+
+// start begins a trace entry.
+func (r *Recorder) start(op, key string) (*TraceEntry, *countWriter, hash.Hash) {
+	var h hash.Hash = nopHash{}
+	if r.hashes {
+		h = sha256.New()
+	}
+	return &TraceEntry{Start: time.Now(), Op: op, Key: key}, &countWriter{}, h
+}
+
+// finish completes a trace entry and writes it to the trace.
+func (r *Recorder) finish(e *TraceEntry, cw *countWriter, h hash.Hash, err error) {
+	e.Duration = time.Since(e.Start)
+	e.Size = cw.n
+	if r.hashes && err == nil && e.Op != "Delete" {
+		e.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	if err != nil {
+		e.Err = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(e)
+}
+
+// nopHash is a hash.Hash which does nothing, used if no hashes are recorded.
+type nopHash struct{}
+
+func (nopHash) Write(p []byte) (int, error) { return len(p), nil }
+func (nopHash) Sum(b []byte) []byte         { return b }
+func (nopHash) Reset()                      {}
+func (nopHash) Size() int                   { return 0 }
+func (nopHash) BlockSize() int              { return 1 }
+
+// Replayer re-executes a trace, as written by a Recorder, against a store.
+// Stored values are replaced by zero bytes of the recorded size, so a trace
+// does not need to contain the payload.
+type Replayer struct {
+	Store      *SOS      // store to run the operations against
+	Trace      io.Writer // optional, receives the trace of the replay
+	KeepTiming bool      // wait between operations as in the recording
+}
+
+// Run reads the trace from rd and executes the operations one after another.
+// Failing operations are recorded in the replay trace, but do not stop the
+// replay. An error is returned only if the trace cannot be read.
+func (p *Replayer) Run(rd io.Reader) error {
+	rec := NewRecorder(p.Store, io.Discard, false)
+	if p.Trace != nil {
+		rec = NewRecorder(p.Store, p.Trace, false)
+	}
+
+	var first, started time.Time
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e TraceEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("invalid trace entry: %w", err)
+		}
+
+		if p.KeepTiming {
+			if first.IsZero() {
+				first, started = e.Start, time.Now()
+			}
+			time.Sleep(time.Until(started.Add(e.Start.Sub(first))))
+		}
+
+		switch e.Op {
+		case "Store":
+			_ = rec.StoreFrom(e.Key, io.LimitReader(zeroReader{}, e.Size))
+		case "Get":
+			_ = rec.GetTo(e.Key, io.Discard)
+		case "Delete":
+			_ = rec.Delete(e.Key)
+		default:
+			return fmt.Errorf("invalid trace operation %q", e.Op)
+		}
+	}
+	return sc.Err()
+}
+
+// zeroReader is an endless source of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
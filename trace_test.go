@@ -0,0 +1,70 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// Test recording and replaying a workload
+func TestRecordReplay(t *testing.T) {
+	trace := new(bytes.Buffer)
+	rec := NewRecorder(NewTemp(t), trace, true)
+
+	rec.StoreString("a", "hello")
+	rec.StoreString("b", "world!")
+	if obj, _ := rec.GetString("a"); obj != "hello" {
+		t.Errorf("Got %s from recorder, expected %s", obj, "hello")
+	}
+	rec.Get("missing")
+	rec.Delete("a")
+
+	entries := readTrace(t, bytes.NewReader(trace.Bytes()))
+	if len(entries) != 5 {
+		t.Fatalf("Got %d trace entries, expected 5", len(entries))
+	}
+	if e := entries[2]; e.Op != "Get" || e.Size != 5 || e.SHA256 == "" {
+		t.Errorf("Got trace entry %+v, expected a Get of 5 bytes with checksum", e)
+	}
+	if entries[3].Err == "" {
+		t.Errorf("Got no error in trace entry for a missing key")
+	}
+
+	s := NewTemp(t)
+	replay := new(bytes.Buffer)
+	p := &Replayer{Store: s, Trace: replay}
+	if err := p.Run(trace); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	if obj, _ := s.Get("b"); !bytes.Equal(obj, make([]byte, 6)) {
+		t.Errorf("Got %q from replayed store, expected 6 zero bytes", obj)
+	}
+	if _, err := s.Get("a"); err == nil {
+		t.Errorf("Got object which was deleted in the replay")
+	}
+	if n := len(readTrace(t, replay)); n != 5 {
+		t.Errorf("Got %d entries in replay trace, expected 5", n)
+	}
+}
+
+// readTrace parses a trace into its entries.
+func readTrace(t *testing.T, r io.Reader) []TraceEntry {
+	var entries []TraceEntry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var e TraceEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid trace entry %q: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,247 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"maps"
+	"sync"
+)
+
+// Flag marks a transformation which was applied to a value before it was
+// written to the store. The flags are recorded in the header of each object
+// file, so objects written with different transformations can be read from
+// the same store.
+type Flag uint8
+
+const (
+	// FlagEncrypted marks an encrypted value.
+	FlagEncrypted Flag = 1 << iota
+	// FlagCompressed marks a compressed value.
+	FlagCompressed
+	// FlagUser marks a value which was transformed by a user defined hook.
+	FlagUser
+
+	// flagChunked marks an object file which holds a chunk manifest instead
+	// of the value. It is used internally, see WithChunking.
+	flagChunked Flag = 1 << 7
+)
+
+// smallValueSize is the size of the pooled buffers for writing values. Values
+// up to this size are written by a single write call.
+const smallValueSize = 64 << 10
+
+// smallBufPool holds buffers of smallValueSize bytes.
+var smallBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, smallValueSize)
+		return &buf
+	},
+}
+
+// flagOrder is the order in which transformations are undone on read. On
+// write, they are applied in reverse order.
+var flagOrder = []Flag{FlagEncrypted, FlagCompressed, FlagUser}
+
+// ReadTransform undoes a transformation while a value is read from the store.
+// It wraps the reader of the (still transformed) value.
+type ReadTransform func(r io.Reader) (io.Reader, error)
+
+// WriteTransform applies a transformation while a value is written to the
+// store. It wraps the writer of the transformed value. Closing the returned
+// writer must flush all pending data, but must not close w.
+type WriteTransform func(w io.Writer) (io.WriteCloser, error)
+
+// transform is the pair of functions registered for a flag.
+type transform struct {
+	read  ReadTransform
+	write WriteTransform
+}
+
+// WithReadTransform registers a read transformation for objects with the
+// given flag. When an object is read, the transformations are applied in the
+// order decrypt, decompress, user hook, depending on the flags in the object
+// header. Reading an object with a flag for which no transformation is
+// registered fails.
+func WithReadTransform(f Flag, t ReadTransform) Option {
+	return func(s *SOS) {
+		tr := s.transforms[f]
+		tr.read = t
+		s.transforms[f] = tr
+	}
+}
+
+// WithWriteTransform registers a write transformation for the given flag.
+// All values stored afterwards are transformed, and marked with the flag.
+// The transformations are applied in the order user hook, compress, encrypt.
+func WithWriteTransform(f Flag, t WriteTransform) Option {
+	return func(s *SOS) {
+		tr := s.transforms[f]
+		tr.write = t
+		s.transforms[f] = tr
+	}
+}
+
+// encode writes the value read from rd, including an object header if
+// required, to the object file w.
+func (s *SOS) encode(w io.Writer, rd io.Reader) error {
+	return s.encodefields(w, rd, nil)
+}
+
+// encodefields is like encode, but writes the header with the given fields,
+// if fields is not nil.
+func (s *SOS) encodefields(w io.Writer, rd io.Reader, fields map[byte][]byte) error {
+	if wa, ok := w.(io.WriterAt); ok && s.digests {
+		return s.encodedigest(w, wa, rd, fields)
+	}
+	if wa, ok := w.(io.WriterAt); ok && s.compression != 0 {
+		return s.encodesize(w, wa, rd, fields)
+	}
+	if s.chunking {
+		return s.encodechunked(w, rd, fields)
+	}
+	return s.encodevalue(w, rd, fields)
+}
+
+// encodevalue writes the value read from rd to the file w, applying the
+// write transformations. If fields is not nil, the header is written in any
+// case, with the given fields.
+func (s *SOS) encodevalue(w io.Writer, rd io.Reader, fields map[byte][]byte) error {
+	h := header{fields: fields}
+	for _, f := range flagOrder {
+		if s.transforms[f].write != nil {
+			h.flags |= f
+		}
+	}
+	if h.flags&FlagEncrypted != 0 && s.keyring != nil {
+		h.fields = maps.Clone(fields)
+		if h.fields == nil {
+			h.fields = make(map[byte][]byte)
+		}
+		h.fields[tagKeyID] = []byte(s.keyring.current)
+	}
+
+	// plain values are written as they are, unless they look like a header.
+	// The value is read into a pooled buffer first, so small values are
+	// written by a single write call.
+	if h.flags == 0 && fields == nil {
+		bp := smallBufPool.Get().(*[]byte)
+		defer smallBufPool.Put(bp)
+
+		n, err := io.ReadFull(rd, *bp)
+		complete := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !complete {
+			return err
+		}
+
+		buf := (*bp)[:n]
+		if !bytes.HasPrefix(buf, headerMagic) {
+			if _, err := w.Write(buf); err != nil || complete {
+				return err
+			}
+			_, err = io.Copy(w, rd)
+			return err
+		}
+		rd = io.MultiReader(bytes.NewReader(buf), rd)
+	}
+
+	if _, err := w.Write(h.marshal()); err != nil {
+		return err
+	}
+
+	// wrap the writers, so that the first flag in order is applied last
+	var closers []io.Closer
+	for _, f := range flagOrder {
+		if h.flags&f == 0 {
+			continue
+		}
+		wc, err := s.transforms[f].write(w)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, wc)
+		w = wc
+	}
+
+	_, err := io.Copy(w, rd)
+	for i := len(closers) - 1; i >= 0; i-- {
+		if cerr := closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// decode returns a reader for the plain value of an object file.
+func (s *SOS) decode(rd io.Reader) (io.Reader, error) {
+	h, rd, err := s.decodeheader(rd)
+	if err == nil && h != nil && h.fields[tagParts] != nil {
+		return nil, errParts
+	}
+	return rd, err
+}
+
+// decodeheader returns the header of an object file, or nil if it has none,
+// and a reader for the plain value. On a store created with
+// WithVerifyOnRead, the reader checks the value against its digest.
+func (s *SOS) decodeheader(rd io.Reader) (*header, io.Reader, error) {
+	h, rd, err := s.decodevalue(rd)
+	if err == nil && s.verifyOnRead {
+		if d, ok := headerdigest(h); ok {
+			rd = &digestReader{r: rd, want: d, hash: sha256.New()}
+		}
+	}
+	return h, rd, err
+}
+
+// decodevalue is like decodeheader, but does not verify the value.
+func (s *SOS) decodevalue(rd io.Reader) (*header, io.Reader, error) {
+	br := bufio.NewReader(rd)
+	h, err := readheader(br)
+	if err != nil || h == nil {
+		return nil, br, err
+	}
+	if s.expired(h) {
+		return nil, nil, ErrNotFound
+	}
+	if h.flags == flagChunked {
+		return h, s.chunkreader(br), nil
+	}
+
+	rest := h.flags
+	rd = br
+	for _, f := range flagOrder {
+		if h.flags&f == 0 {
+			continue
+		}
+		rest &^= f
+
+		if f == FlagEncrypted && s.keyring != nil {
+			if rd, err = s.keyring.reader(h, rd); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		t := s.transforms[f].read
+		if t == nil {
+			return nil, nil, fmt.Errorf("no read transform for object flag %#x", f)
+		}
+		rd, err = t(rd)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if rest != 0 {
+		return nil, nil, fmt.Errorf("unsupported object flags %#x", rest)
+	}
+
+	return h, rd, nil
+}
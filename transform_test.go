@@ -0,0 +1,91 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// xorReader and xorWriter implement a trivial, reversible transformation.
+type xorReader struct{ r io.Reader }
+
+func (x xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= 0x55
+	}
+	return n, err
+}
+
+type xorWriter struct{ w io.Writer }
+
+func (x xorWriter) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	for i := range p {
+		b[i] = p[i] ^ 0x55
+	}
+	return x.w.Write(b)
+}
+
+func (x xorWriter) Close() error { return nil }
+
+func xorRead(r io.Reader) (io.Reader, error)       { return xorReader{r}, nil }
+func xorWrite(w io.Writer) (io.WriteCloser, error) { return xorWriter{w}, nil }
+
+// Test reading mixed stores with and without transformations
+func TestTransform(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "sos")
+	magic := string(headerMagic) + "looks like a header"
+
+	plain, _ := New(base)
+	plain.StoreString("plain", "plain value")
+	plain.StoreString("magic", magic)
+
+	xor, _ := New(base, WithWriteTransform(FlagUser, xorWrite), WithReadTransform(FlagUser, xorRead))
+	xor.StoreString("xor", "transformed value")
+
+	expected := map[string]string{
+		"plain": "plain value",
+		"magic": magic,
+		"xor":   "transformed value",
+	}
+	for key, val := range expected {
+		obj, err := xor.GetString(key)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %v", key, err)
+		}
+		if obj != val {
+			t.Errorf("Got %q from store for key %s, expected %q", obj, key, val)
+		}
+	}
+
+	if obj, _ := plain.GetString("magic"); obj != magic {
+		t.Errorf("Got %q from store, expected %q", obj, magic)
+	}
+	if _, err := plain.GetString("xor"); err == nil {
+		t.Errorf("Got no error when reading a transformed object without read transform")
+	}
+}
+
+// Test plain values around the size of the write buffer
+func TestEncodeSizes(t *testing.T) {
+	s := NewTemp(t)
+
+	for _, size := range []int{0, 1, smallValueSize - 1, smallValueSize, smallValueSize + 1, 3 * smallValueSize} {
+		for _, prefix := range []string{"", string(headerMagic)} {
+			val := prefix + strings.Repeat("x", size)
+			if err := s.StoreString("key", val); err != nil {
+				t.Fatalf("Store of %d bytes failed: %v", len(val), err)
+			}
+			if obj, _ := s.GetString("key"); obj != val {
+				t.Errorf("Got %d bytes from store, expected %d", len(obj), len(val))
+			}
+		}
+	}
+}
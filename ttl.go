@@ -0,0 +1,403 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultReaperInterval is the default time between two sweeps of a reaper.
+const defaultReaperInterval = time.Minute
+
+// StoreWithTTL stores a key/value pair, which expires after the given time to
+// live. An expired object is treated as not found by Get, Stat, Exists and
+// List, and removed by Expire. A TTL of zero or less stores the value without
+// expiry, like Store.
+//
+// The expiry time is kept in a fixed size field in the header of the object
+// file, so it is replaced atomically with the value, and TouchTTL updates it
+// in place. A later Store of the key removes the expiry.
+func (s *SOS) StoreWithTTL(key string, value []byte, ttl time.Duration) error {
+	return s.StoreFromTTL(key, bytes.NewReader(value), ttl)
+}
+
+// StoreFromTTL is like StoreWithTTL, but reads the value from an io.Reader.
+func (s *SOS) StoreFromTTL(key string, rd io.Reader, ttl time.Duration) (err error) {
+	o := s.startop(context.Background(), "Store", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Store", key)
+
+	var fields map[byte][]byte
+	if ttl > 0 {
+		fields = map[byte][]byte{tagExpires: s.expiry(ttl)}
+	}
+	return s.store(context.Background(), o, key, rd, fields)
+}
+
+// TouchTTL updates the modification time of an object, like Touch, and sets
+// a new time to live. A TTL of zero or less removes the expiry. If the object
+// has expired already, ErrNotFound is returned.
+//
+// If the object was stored with a time to live, the expiry time is
+// overwritten in place, so the cost does not depend on the size of the
+// value. Otherwise, the object file is rewritten with the new header, but
+// the value is copied as it is, without applying the transformations again.
+// TouchTTL holds the lock of the key (see CompareAndSwap).
+func (s *SOS) TouchTTL(key string, ttl time.Duration) (err error) {
+	o := s.startop(context.Background(), "Touch", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Touch", key)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	unlock, err := s.lockkey(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	exp := make([]byte, 8) // zero, i.e. no expiry
+	if ttl > 0 {
+		exp = s.expiry(ttl)
+	}
+	hs := s.keyhash(key)
+	_, filename := s.hashpath(hs)
+	done := false
+	err = s.change(hs, true, func() error {
+		done, err = s.touchexpiry(filename, exp)
+		return err
+	})
+	if err != nil || done {
+		return err
+	}
+	return s.rewriteheader(key, true, func(h *header) {
+		delete(h.fields, tagExpires)
+		if ttl > 0 {
+			h.fields[tagExpires] = exp
+		}
+	})
+}
+
+// touchexpiry overwrites the expiry time of the object file filename in
+// place with exp, and updates its modification time. It reports false if the
+// object has no expiry field, so it must be rewritten. If the object does not
+// exist, or has expired, ErrNotFound is returned.
+func (s *SOS) touchexpiry(filename string, exp []byte) (bool, error) {
+	fh, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+
+	h, err := readheader(bufio.NewReader(fh))
+	if err != nil {
+		return false, err
+	}
+	if h != nil && s.expired(h) {
+		return false, ErrNotFound
+	}
+	if h == nil || len(h.fields[tagExpires]) != len(exp) {
+		return false, nil
+	}
+
+	if _, err := fh.WriteAt(exp, h.offset(tagExpires)); err != nil {
+		return false, err
+	}
+	if err := s.syncfile(fh); err != nil {
+		return false, err
+	}
+	now := s.clock.Now()
+	return true, os.Chtimes(filename, now, now)
+}
+
+// rewriteheader rewrites the object file of a key with a header changed by
+// update, and copies the value as it is. If the object has expired, or does
+// not exist, ErrNotFound is returned. locked tells whether the caller holds
+// the lock of the key. If the object file is replaced while it is rewritten,
+// the new file is rewritten instead.
+func (s *SOS) rewriteheader(key string, locked bool, update func(h *header)) error {
+	for {
+		err := s.rewriteonce(key, locked, update)
+		if !errors.Is(err, errReplaced) {
+			return err
+		}
+	}
+}
+
+// errReplaced is returned internally if an object file was replaced while it
+// was rewritten.
+var errReplaced = errors.New("object replaced")
+
+// rewriteonce is a single attempt of rewriteheader.
+func (s *SOS) rewriteonce(key string, locked bool, update func(h *header)) error {
+	dirname, filename := s.getpath(key)
+	fh, err := s.openfile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	br := bufio.NewReader(fh)
+	h, err := readheader(br)
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		h = &header{fields: make(map[byte][]byte)}
+	}
+	if s.expired(h) {
+		return ErrNotFound
+	}
+	update(h)
+
+	tmpname := s.tmpfilename()
+	if err := s.rewritefile(tmpname, h, br); err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	return s.change(s.keyhash(key), locked, func() error {
+		same, err := samefile(fh.File, filename)
+		if err == nil && !same {
+			err = errReplaced
+		}
+		if err != nil {
+			_ = os.Remove(tmpname)
+			return err
+		}
+		return s.commitfile(tmpname, dirname, filename)
+	})
+}
+
+// samefile reports whether the file name still refers to the opened file.
+func samefile(fh *os.File, filename string) (bool, error) {
+	fi, err := fh.Stat()
+	if err != nil {
+		return false, err
+	}
+	cur, err := os.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(fi, cur), nil
+}
+
+// rewritefile writes an object file with the given header, followed by the
+// encoded value read from rd.
+func (s *SOS) rewritefile(filename string, h *header, rd io.Reader) error {
+	wr, err := s.createfile(filename)
+	if err != nil {
+		return err
+	}
+	_, err = wr.Write(h.marshal())
+	if err == nil {
+		_, err = io.Copy(wr, rd)
+	}
+	if err == nil {
+		err = s.syncfile(wr)
+	}
+	if cerr := wr.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	return os.Chtimes(filename, now, now)
+}
+
+// Expire removes all expired objects from the store, and returns the number
+// of removed objects. All object files are scanned, see Reaper for running
+// it periodically. On a store created with WithExpiryWarning, it also emits
+// the warnings for objects which expire soon. The end of a complete run is
+// recorded, see Stats.
+func (s *SOS) Expire() (n int, err error) {
+	defer s.wraperr(&err, "Expire", "")
+
+	if err := s.begin(); err != nil {
+		return 0, err
+	}
+	defer s.end()
+
+	if s.expiring != nil {
+		s.prunewarnings()
+	}
+	err = s.walk(func(rel string, fi fs.FileInfo) error {
+		if s.expiring != nil {
+			if err := s.warnexpiry(rel, fi); err != nil {
+				return err
+			}
+		}
+		removed, err := s.expireobject(rel)
+		if removed {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, s.recordgc()
+}
+
+// expireobject removes the object file at the relative path rel, if it has
+// expired. The expiry is checked again under the lock of the key, and the
+// file is removed only if it was not replaced in the meantime, so an object
+// which is stored concurrently is neither removed nor hidden.
+func (s *SOS) expireobject(rel string) (bool, error) {
+	filename := filepath.Join(s.base, filepath.FromSlash(rel))
+	expired, err := s.fileexpired(filename)
+	if err != nil || !expired {
+		return false, err
+	}
+
+	if err := s.beginmodify(); err != nil {
+		return false, err
+	}
+	defer s.endmodify()
+
+	hs := s.relhash(rel)
+	unlock, err := s.lockhash(hs)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	var removed bool
+	err = s.change(hs, true, func() error {
+		removed, err = s.removeexpired(filename)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil // removed in the meantime
+	}
+	if err != nil || !removed {
+		return false, err // not expired, or replaced in the meantime
+	}
+
+	_, indexname := s.indexpath(hs)
+	key, _ := os.ReadFile(indexname)
+	_ = os.Remove(indexname)
+	s.notify("Expire", string(key), 0)
+	return true, nil
+}
+
+// removeexpired removes the object file filename, if it has expired, and
+// reports whether it was removed. The file is removed only if it was not
+// replaced while its expiry was read. The caller must hold the lock of the
+// key.
+func (s *SOS) removeexpired(filename string) (bool, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+
+	h, err := readheader(bufio.NewReader(fh))
+	if err != nil || h == nil || !s.expired(h) {
+		return false, err
+	}
+	if same, err := samefile(fh, filename); err != nil || !same {
+		return false, err
+	}
+	if err := os.Remove(filename); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fileexpired reports whether the object file has expired.
+func (s *SOS) fileexpired(filename string) (bool, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+
+	h, err := readheader(bufio.NewReader(fh))
+	if err != nil || h == nil {
+		return false, err
+	}
+	return s.expired(h), nil
+}
+
+// expiry returns the encoded expiry time for the given time to live.
+func (s *SOS) expiry(ttl time.Duration) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(s.clock.Now().Add(ttl).UnixNano()))
+}
+
+// expired reports whether the header holds an expiry time which has passed.
+func (s *SOS) expired(h *header) bool {
+	exp, ok := expirytime(h)
+	return ok && !s.clock.Now().Before(exp)
+}
+
+// expirytime returns the expiry time in the header, if there is one. A zero
+// expiry field, as written by TouchTTL to remove the expiry, holds none.
+func expirytime(h *header) (time.Time, bool) {
+	data := h.fields[tagExpires]
+	if len(data) != 8 || binary.BigEndian.Uint64(data) == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data))), true
+}
+
+// Reaper removes the expired objects of a store periodically.
+type Reaper struct {
+	Store    *SOS          // store to remove the expired objects from
+	Interval time.Duration // time between sweeps, default one minute
+	OnError  func(error)   // optional, receives the errors of failed sweeps
+}
+
+// Run removes the expired objects immediately, and then periodically until
+// the context is cancelled. Failed sweeps are reported to OnError, but do not
+// stop the reaper. Run returns the error of the context.
+func (r *Reaper) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultReaperInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Store.Expire(); err != nil && r.OnError != nil {
+			r.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
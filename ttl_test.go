@@ -0,0 +1,174 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that expired objects are not found, and removed by Expire
+func TestStoreWithTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var events []Event
+	s := NewTemp(t, WithClock(clock), WithKeyIndex(), WithEventSink(EventFunc(func(e Event) {
+		events = append(events, e)
+	})))
+
+	s.StoreWithTTL("short", []byte("gone soon"), time.Minute)
+	s.StoreWithTTL("long", []byte("stays"), time.Hour)
+	s.StoreString("forever", "stays")
+	s.StoreWithTTL("restored", []byte("first"), time.Minute)
+	s.StoreString("restored", "second")
+
+	if obj, _ := s.GetString("short"); obj != "gone soon" {
+		t.Errorf("Got %s from store, expected %s", obj, "gone soon")
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, err := s.GetString("short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for an expired key, expected ErrNotFound", err)
+	}
+	if obj, _ := s.GetString("long"); obj != "stays" {
+		t.Errorf("Got %s from store, expected %s", obj, "stays")
+	}
+	if obj, _ := s.GetString("restored"); obj != "second" {
+		t.Errorf("Got %s from store, expected %s", obj, "second")
+	}
+	if _, err := s.Stat("short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v from Stat of an expired key, expected ErrNotFound", err)
+	}
+	if ok, err := s.Exists("short"); ok || err != nil {
+		t.Errorf("Got %v (%v) from Exists of an expired key, expected false", ok, err)
+	}
+	if keys, _ := s.List(""); strings.Join(keys, " ") != "forever long restored" {
+		t.Errorf("Got keys %v before Expire", keys)
+	}
+
+	events = nil
+	n, err := s.Expire()
+	if err != nil || n != 1 {
+		t.Errorf("Got %d expired objects and error %v, expected 1", n, err)
+	}
+	if ok, _ := s.Exists("short"); ok {
+		t.Errorf("Expired object still exists")
+	}
+	if keys, _ := s.List(""); strings.Join(keys, " ") != "forever long restored" {
+		t.Errorf("Got keys %v after Expire", keys)
+	}
+	if len(events) != 1 || events[0].Op != "Expire" || events[0].Key != "short" {
+		t.Errorf("Got events %+v, expected an Expire of short", events)
+	}
+}
+
+// Test extending and removing the expiry of an object
+func TestTouchTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock), WithChunking())
+
+	s.StoreWithTTL("key", []byte("value"), time.Minute)
+	_, filename := s.getpath("key")
+	before, _ := os.Stat(filename)
+	clock.Advance(30 * time.Second)
+	if err := s.TouchTTL("key", time.Minute); err != nil {
+		t.Fatalf("TouchTTL failed: %v", err)
+	}
+	if after, _ := os.Stat(filename); !os.SameFile(before, after) {
+		t.Errorf("TouchTTL rewrote the object file, expected an update in place")
+	}
+	clock.Advance(45 * time.Second)
+	if obj, _ := s.GetString("key"); obj != "value" {
+		t.Errorf("Got %s from store, expected %s", obj, "value")
+	}
+	if info, _ := s.Stat("key"); !info.ModTime.Equal(clock.Now().Add(-45 * time.Second)) {
+		t.Errorf("Got modification time %v after TouchTTL", info.ModTime)
+	}
+
+	if err := s.TouchTTL("key", 0); err != nil {
+		t.Fatalf("TouchTTL failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if obj, _ := s.GetString("key"); obj != "value" {
+		t.Errorf("Got %s from store, expected %s", obj, "value")
+	}
+	if err := s.TouchTTL("key", time.Minute); err != nil {
+		t.Fatalf("TouchTTL failed: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+	if _, err := s.GetString("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for an expired key, expected ErrNotFound", err)
+	}
+	s.StoreString("plain", "value")
+	if err := s.TouchTTL("plain", time.Minute); err != nil {
+		t.Fatalf("TouchTTL failed: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+	if _, err := s.GetString("plain"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for an expired key, expected ErrNotFound", err)
+	}
+
+	s.StoreWithTTL("other", []byte("value"), time.Minute)
+	clock.Advance(time.Hour)
+	if err := s.TouchTTL("other", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for an expired key, expected ErrNotFound", err)
+	}
+	if err := s.TouchTTL("missing", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v for a missing key, expected ErrNotFound", err)
+	}
+}
+
+// Test that expired objects do not block StoreIfAbsent and WithNoOverwrite
+func TestStoreOverExpired(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewTemp(t, WithClock(clock))
+	nooverwrite, err := New(s.base, WithClock(clock), WithNoOverwrite())
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+
+	s.StoreWithTTL("absent", []byte("old"), time.Minute)
+	s.StoreWithTTL("new", []byte("old"), time.Minute)
+	if stored, err := s.StoreIfAbsent("absent", []byte("value")); stored || err != nil {
+		t.Errorf("Got %v (%v) from StoreIfAbsent of a live key, expected false", stored, err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if stored, err := s.StoreIfAbsent("absent", []byte("value")); !stored || err != nil {
+		t.Errorf("Got %v (%v) from StoreIfAbsent of an expired key, expected true", stored, err)
+	}
+	if err := nooverwrite.StoreString("new", "value"); err != nil {
+		t.Errorf("Got %v from Store of an expired key, expected no error", err)
+	}
+	if err := nooverwrite.StoreString("new", "other"); !errors.Is(err, ErrExists) {
+		t.Errorf("Got %v from Store of a live key, expected ErrExists", err)
+	}
+	for _, key := range []string{"absent", "new"} {
+		if obj, _ := s.GetString(key); obj != "value" {
+			t.Errorf("Got %s from store, expected %s", obj, "value")
+		}
+	}
+}
+
+// Test the periodic removal of expired objects
+func TestReaper(t *testing.T) {
+	s := NewTemp(t)
+	s.StoreWithTTL("key", []byte("value"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	r := &Reaper{Store: s, Interval: 5 * time.Millisecond}
+	if err := r.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v from Run, expected DeadlineExceeded", err)
+	}
+	if ok, _ := s.Exists("key"); ok {
+		t.Errorf("Expired object was not removed by the reaper")
+	}
+}
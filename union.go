@@ -0,0 +1,84 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"io"
+	"os"
+)
+
+// Union is a view on an ordered list of object stores. Objects are read from
+// the first store which holds the key. Store and Delete operations go to a
+// designated store only, which is also the first one to be read.
+//
+// This allows e.g. to overlay a read-only base dataset with local
+// modifications.
+type Union struct {
+	layers []*SOS
+}
+
+// NewUnion creates a union view. All Store and Delete operations go to the
+// store write. Get operations try write first, and then the read stores in
+// the given order.
+func NewUnion(write *SOS, read ...*SOS) *Union {
+	return &Union{
+		layers: append([]*SOS{write}, read...),
+	}
+}
+
+// Store stores a key/value pair, given as string and byte slice, in the
+// writable store.
+func (u *Union) Store(key string, value []byte) error {
+	return u.layers[0].Store(key, value)
+}
+
+// StoreString stores a key/value pair, given as strings, in the writable
+// store.
+func (u *Union) StoreString(key, value string) error {
+	return u.layers[0].StoreString(key, value)
+}
+
+// StoreFrom stores a value, which is read from an io.Reader, under the given
+// key in the writable store.
+func (u *Union) StoreFrom(key string, rd io.Reader) error {
+	return u.layers[0].StoreFrom(key, rd)
+}
+
+// Get fetches an object from the first store which holds the key, and
+// returns it as byte slice.
+func (u *Union) Get(key string) ([]byte, error) {
+	return u.find(key).Get(key)
+}
+
+// GetString fetches an object from the first store which holds the key, and
+// returns it as a string.
+func (u *Union) GetString(key string) (string, error) {
+	return u.find(key).GetString(key)
+}
+
+// GetTo fetches an object from the first store which holds the key, and
+// copies it into an io.Writer.
+func (u *Union) GetTo(key string, wr io.Writer) error {
+	return u.find(key).GetTo(key, wr)
+}
+
+// Delete removes an object from the writable store. Note that an object with
+// the same key in one of the read stores becomes visible afterwards.
+func (u *Union) Delete(key string) error {
+	return u.layers[0].Delete(key)
+}
+
+// find returns the first store which holds the key. If no store holds it,
+// the writable store is returned, so the error is reported from there.
+func (u *Union) find(key string) *SOS {
+	for _, s := range u.layers {
+		_, filename := s.getpath(key)
+		if _, err := os.Stat(filename); err == nil {
+			return s
+		}
+	}
+	return u.layers[0]
+}
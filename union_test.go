@@ -0,0 +1,39 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import "testing"
+
+// Test the union view on several stores
+func TestUnion(t *testing.T) {
+	local := NewTemp(t)
+	base := NewTemp(t)
+
+	base.StoreString("a", "base a")
+	base.StoreString("b", "base b")
+	local.StoreString("b", "local b")
+
+	u := NewUnion(local, base)
+	u.StoreString("c", "local c")
+
+	expected := map[string]string{"a": "base a", "b": "local b", "c": "local c"}
+	for key, val := range expected {
+		if obj, _ := u.GetString(key); obj != val {
+			t.Errorf("Got %s from union for key %s, expected %s", obj, key, val)
+		}
+	}
+	if obj, _ := base.GetString("c"); obj != "" {
+		t.Errorf("Store on union modified the read store")
+	}
+
+	u.Delete("b")
+	if obj, _ := u.GetString("b"); obj != "base b" {
+		t.Errorf("Got %s from union after delete, expected %s", obj, "base b")
+	}
+	if _, err := u.Get("missing"); err == nil {
+		t.Errorf("Got no error for a missing key")
+	}
+}
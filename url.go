@@ -0,0 +1,142 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+)
+
+// URLOption configures a StoreFromURL operation.
+type URLOption func(*urlConfig)
+
+// urlConfig holds the settings of a StoreFromURL operation.
+type urlConfig struct {
+	client  *http.Client
+	maxSize int64
+	sha256  []byte
+	err     error
+}
+
+// WithHTTPClient sets the HTTP client used to fetch the remote resource. By
+// default, http.DefaultClient is used.
+func WithHTTPClient(c *http.Client) URLOption {
+	return func(cfg *urlConfig) {
+		cfg.client = c
+	}
+}
+
+// WithMaxSize limits the size of the remote resource to n bytes. Larger
+// resources are rejected and not stored.
+func WithMaxSize(n int64) URLOption {
+	return func(cfg *urlConfig) {
+		cfg.maxSize = n
+	}
+}
+
+// WithSHA256 sets the expected SHA256 checksum of the remote resource, in hex
+// encoding. If the fetched content does not match, it is not stored.
+func WithSHA256(sum string) URLOption {
+	return func(cfg *urlConfig) {
+		cfg.sha256, cfg.err = hex.DecodeString(sum)
+		if cfg.err == nil && len(cfg.sha256) != sha256.Size {
+			cfg.err = fmt.Errorf("invalid SHA256 checksum %q", sum)
+		}
+	}
+}
+
+// StoreFromURL fetches a remote resource by HTTP GET and streams it into the
+// object store under the given key.
+//
+// The value is written to a temporary file first, and only moved to its final
+// position after the size limit and checksum (if configured) have been
+// checked. The download can be aborted by cancelling the context.
+func (s *SOS) StoreFromURL(ctx context.Context, key, url string, opts ...URLOption) (err error) {
+	o := s.startop(ctx, "Store", key)
+	defer s.observe(o, &err)
+	defer s.wraperr(&err, "Store", key)
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	if s.keyIndex {
+		if err := s.writeindex(key); err != nil {
+			return err
+		}
+	}
+
+	cfg := urlConfig{client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.err != nil {
+		return cfg.err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cfg.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	if cfg.maxSize > 0 && resp.ContentLength > cfg.maxSize {
+		return fmt.Errorf("fetching %s: size %d exceeds limit of %d bytes",
+			url, resp.ContentLength, cfg.maxSize)
+	}
+
+	// read at most one byte more than allowed, to detect oversized content
+	var rd io.Reader = resp.Body
+	var lr *io.LimitedReader
+	if cfg.maxSize > 0 {
+		lr = &io.LimitedReader{R: rd, N: cfg.maxSize + 1}
+		rd = lr
+	}
+
+	var h hash.Hash
+	if cfg.sha256 != nil {
+		h = sha256.New()
+		rd = io.TeeReader(rd, h)
+	}
+
+	tmpname, n, err := s.writetmp(rd)
+	if err != nil {
+		return err
+	}
+
+	if lr != nil && lr.N == 0 {
+		_ = os.Remove(tmpname)
+		return fmt.Errorf("fetching %s: size exceeds limit of %d bytes", url, cfg.maxSize)
+	}
+	if h != nil && !bytes.Equal(h.Sum(nil), cfg.sha256) {
+		_ = os.Remove(tmpname)
+		return fmt.Errorf("%w: fetching %s: checksum mismatch", ErrCorrupt, url)
+	}
+
+	err = s.commit(key, tmpname)
+	if err == nil {
+		o.info.Bytes = n
+		s.usage("Store", key, n)
+		s.notify("Store", key, n)
+	}
+	return err
+}
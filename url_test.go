@@ -0,0 +1,63 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test storing objects fetched by HTTP
+func TestStoreFromURL(t *testing.T) {
+	s, _ := New("./._sostest")
+	defer s.Destroy()
+
+	val := "hello world"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/obj" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, val)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte(val))
+
+	err := s.StoreFromURL(ctx, "k1", srv.URL+"/obj", WithSHA256(hex.EncodeToString(sum[:])))
+	if err != nil {
+		t.Fatalf("StoreFromURL failed: %v", err)
+	}
+	if got, _ := s.GetString("k1"); got != val {
+		t.Errorf("Got %s from store, expected %s", got, val)
+	}
+
+	if err := s.StoreFromURL(ctx, "k2", srv.URL+"/missing"); err == nil {
+		t.Errorf("Got no error for a missing resource")
+	}
+
+	if err := s.StoreFromURL(ctx, "k3", srv.URL+"/obj", WithMaxSize(5)); err == nil {
+		t.Errorf("Got no error for an oversized resource")
+	}
+
+	bad := sha256.Sum256([]byte("other"))
+	err = s.StoreFromURL(ctx, "k4", srv.URL+"/obj", WithSHA256(hex.EncodeToString(bad[:])))
+	if err == nil {
+		t.Errorf("Got no error for a checksum mismatch")
+	}
+
+	for _, k := range []string{"k2", "k3", "k4"} {
+		if obj, _ := s.Get(k); obj != nil {
+			t.Errorf("Got value for key %s which should not have been stored", k)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Usage records a single successful operation on the object store, e.g. for
+// billing or rate limiting.
+type Usage struct {
+	Time   time.Time `json:"time"`
+	Tenant string    `json:"tenant,omitempty"`
+	Op     string    `json:"op"`
+	Key    string    `json:"key"`
+	Bytes  int64     `json:"bytes"` // size of the value stored or read
+}
+
+// UsageSink receives usage records. Record is called synchronously by the
+// operation, and may be called from several goroutines concurrently.
+type UsageSink interface {
+	Record(u Usage)
+}
+
+// UsageFunc is a function which receives usage records.
+type UsageFunc func(u Usage)
+
+// Record calls f(u).
+func (f UsageFunc) Record(u Usage) {
+	f(u)
+}
+
+// UsageChan is a channel which receives usage records. Sending blocks the
+// operation if the channel is full, so it should be buffered and drained
+// quickly.
+type UsageChan chan<- Usage
+
+// Record sends u to the channel.
+func (c UsageChan) Record(u Usage) {
+	c <- u
+}
+
+// usageWriter writes usage records as JSON lines.
+type usageWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewUsageWriter returns a usage sink which writes the records to w as JSON
+// objects, one per line. Write errors are ignored.
+func NewUsageWriter(w io.Writer) UsageSink {
+	return &usageWriter{enc: json.NewEncoder(w)}
+}
+
+// Record writes u to the underlying writer.
+func (w *usageWriter) Record(u Usage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.enc.Encode(u)
+}
+
+// WithUsageSink sets a sink which receives a usage record for each successful
+// Store, Get and Delete operation.
+func WithUsageSink(sink UsageSink) Option {
+	return func(s *SOS) {
+		s.usages = sink
+	}
+}
+
+// WithTenant sets the tenant name which is recorded in the usage records of
+// the store.
+func WithTenant(name string) Option {
+	return func(s *SOS) {
+		s.tenant = name
+	}
+}
+
+// usage emits a usage record, if a sink is configured.
+func (s *SOS) usage(op, key string, n int64) {
+	if s.metrics != nil && n > 0 {
+		s.metrics.Counter(MetricBytes, op, n)
+	}
+	if s.usages == nil {
+		return
+	}
+	s.usages.Record(Usage{
+		Time:   s.clock.Now(),
+		Tenant: s.tenant,
+		Op:     op,
+		Key:    key,
+		Bytes:  n,
+	})
+}
+
+// countReader counts the bytes read through it.
+type countReader struct {
+	r   io.Reader
+	n   int64
+	err error // first read error, except io.EOF
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
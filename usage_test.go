@@ -0,0 +1,60 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// Test the usage records of store operations
+func TestUsage(t *testing.T) {
+	ch := make(chan Usage, 10)
+	s := NewTemp(t, WithUsageSink(UsageChan(ch)), WithTenant("acme"))
+
+	s.StoreString("hello", "world")
+	s.GetString("hello")
+	s.GetString("missing")
+	s.Delete("hello")
+	close(ch)
+
+	expected := []Usage{
+		{Tenant: "acme", Op: "Store", Key: "hello", Bytes: 5},
+		{Tenant: "acme", Op: "Get", Key: "hello", Bytes: 5},
+		{Tenant: "acme", Op: "Delete", Key: "hello", Bytes: 0},
+	}
+	i := 0
+	for u := range ch {
+		if i >= len(expected) {
+			t.Fatalf("Got unexpected usage record %+v", u)
+		}
+		u.Time = expected[i].Time
+		if u != expected[i] {
+			t.Errorf("Got usage record %+v, expected %+v", u, expected[i])
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("Got %d usage records, expected %d", i, len(expected))
+	}
+}
+
+// Test writing usage records as JSON lines
+func TestUsageWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	s := NewTemp(t, WithUsageSink(NewUsageWriter(buf)))
+
+	s.StoreString("hello", "world")
+
+	var u Usage
+	if err := json.Unmarshal(buf.Bytes(), &u); err != nil {
+		t.Fatalf("Invalid usage record %q: %v", buf.String(), err)
+	}
+	if u.Op != "Store" || u.Key != "hello" || u.Bytes != 5 {
+		t.Errorf("Got usage record %+v, expected a Store of 5 bytes", u)
+	}
+}
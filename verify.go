@@ -0,0 +1,329 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VerifyReport summarizes the result of a Verify operation.
+type VerifyReport struct {
+	Shards  int      // shard directories with objects
+	Scanned int      // shard directories whose objects were read
+	Objects int      // objects which were read
+	Chunks  int      // chunks of the objects which were read
+	Corrupt []string // object files whose content changed without a store, and bad chunks
+}
+
+// Verify checks the object files against the checksum manifests of their
+// shard directories. The manifests are kept in the directory .manifests. They
+// are written by Verify. Each Store and Delete afterwards marks the entry of
+// the object as stale, without reading the object, so the next Verify scans
+// the shard again.
+//
+// For each shard directory, the names, sizes and modification times of the
+// object files are compared with the manifest first. Only shards which
+// changed since the last verification are scanned, i.e. all their object
+// files are read and checksummed. If full is true, all shards are scanned.
+// An object file whose checksum differs from the manifest, although its size
+// and modification time did not change, was corrupted (e.g. by bit rot or an
+// external tool), and is reported in the result.
+//
+// So, the first verification of a store, and a full verification, read all
+// objects, while routine verifications only read the shards with objects
+// stored since.
+//
+// The chunks which the read objects refer to (see WithChunking) are read
+// and checked against their hash. Missing and corrupt chunks are reported
+// in the result, by their path below the base directory.
+func (s *SOS) Verify(full bool) (report VerifyReport, err error) {
+	defer s.wraperr(&err, "Verify", "")
+
+	if err := s.begin(); err != nil {
+		return report, err
+	}
+	defer s.end()
+
+	shards, dirs, err := s.shardlistings()
+	if err != nil {
+		return report, err
+	}
+	chunks := make(map[string]bool)
+	for _, dir := range dirs {
+		if err := s.verifyshard(dir, shards[dir], full, chunks, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, s.verifychunks(chunks, &report)
+}
+
+// verifychunks checks the given chunks against their hash, and reports
+// the missing and corrupt ones.
+func (s *SOS) verifychunks(chunks map[string]bool, report *VerifyReport) error {
+	sums := make([]string, 0, len(chunks))
+	for sum := range chunks {
+		sums = append(sums, sum)
+	}
+	sort.Strings(sums)
+	for _, sum := range sums {
+		_, filename := s.chunkpath(sum)
+		err := s.checkchunk(filename, sum)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrCorrupt) {
+			report.Corrupt = append(report.Corrupt, chunkname(sum))
+		} else if err != nil {
+			return err
+		}
+		report.Chunks++
+	}
+	return nil
+}
+
+// shardlistings returns the object files grouped by shard directory, and the
+// sorted shard directories.
+func (s *SOS) shardlistings() (map[string][]manifestEntry, []string, error) {
+	shards := make(map[string][]manifestEntry)
+	err := s.walk(func(rel string, fi fs.FileInfo) error {
+		dir, name := path.Split(rel)
+		shards[dir] = append(shards[dir], manifestEntry{
+			name:  name,
+			size:  fi.Size(),
+			mtime: fi.ModTime().UnixNano(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dirs := make([]string, 0, len(shards))
+	for dir := range shards {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return shards, dirs, nil
+}
+
+// verifyshard verifies the object files of a shard directory against its
+// manifest, and writes the updated manifest. The chunks of the objects which
+// were read are added to chunks.
+func (s *SOS) verifyshard(dir string, entries []manifestEntry, full bool, chunks map[string]bool, report *VerifyReport) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	report.Shards++
+
+	filename := s.manifestpath(dir)
+	stored, err := readshardmanifest(filename)
+	if err != nil {
+		return err
+	}
+	if !full && stored != nil && samelisting(stored, entries) {
+		return nil
+	}
+
+	report.Scanned++
+	for i := range entries {
+		e := &entries[i]
+		objname := filepath.Join(s.base, filepath.FromSlash(dir+e.name))
+		sum, fi, err := filesum(objname)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // deleted in the meantime
+		}
+		if err != nil {
+			return err
+		}
+		// the object may have been replaced since the walk
+		e.size, e.mtime, e.sum = fi.Size(), fi.ModTime().UnixNano(), sum
+		report.Objects++
+		if err := s.chunkrefs(objname, chunks); err != nil && !errors.Is(err, ErrCorrupt) {
+			return err
+		}
+
+		old, ok := stored[e.name]
+		if ok && old.size == e.size && old.mtime == e.mtime && old.sum != e.sum {
+			// keep the original checksum, so the object is reported
+			// until it is stored again
+			report.Corrupt = append(report.Corrupt, dir+e.name)
+			e.sum = old.sum
+		}
+	}
+
+	return s.writeshardmanifest(dir, stored, entries)
+}
+
+// manifestEntry describes an object file in a shard manifest.
+type manifestEntry struct {
+	name  string
+	size  int64
+	mtime int64
+	sum   string
+}
+
+// manifestpath returns the file name of the manifest of the shard directory
+// dir, which is given as a slash separated relative path with a trailing
+// slash, or empty for the base directory.
+func (s *SOS) manifestpath(dir string) string {
+	return filepath.Join(s.base, dirManifests, "shard-"+strings.ReplaceAll(dir, "/", ""))
+}
+
+// samelisting reports whether the manifest describes exactly the given
+// object files, by name, size and modification time.
+func samelisting(stored map[string]manifestEntry, entries []manifestEntry) bool {
+	if len(stored) != len(entries) {
+		return false
+	}
+	for _, e := range entries {
+		old, ok := stored[e.name]
+		if !ok || old.size != e.size || old.mtime != e.mtime {
+			return false
+		}
+	}
+	return true
+}
+
+// staleSum is the checksum of a manifest entry which was marked as stale.
+const staleSum = "-"
+
+// readshardmanifest reads a shard manifest. If it does not exist, nil is
+// returned. Entries which were marked as stale have the checksum staleSum,
+// and the number of marks as size.
+func readshardmanifest(filename string) (map[string]manifestEntry, error) {
+	fh, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	entries := make(map[string]manifestEntry)
+	br := bufio.NewReader(fh)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: shard manifest %s", ErrCorrupt, filename)
+		}
+		var e manifestEntry
+		if _, err := fmt.Sscanf(line, "%s %d %d %s\n", &e.name, &e.size, &e.mtime, &e.sum); err != nil {
+			return nil, fmt.Errorf("%w: shard manifest %s", ErrCorrupt, filename)
+		}
+		if e.sum == staleSum {
+			e.size = 1
+			if old := entries[e.name]; old.sum == staleSum {
+				e.size += old.size
+			}
+		}
+		entries[e.name] = e
+	}
+}
+
+// manifestlock returns the lock which serializes the updates of the manifest
+// of the shard directory dir.
+func (s *SOS) manifestlock(dir string) *sync.Mutex {
+	mu, _ := s.manifestMu.LoadOrStore(dir, new(sync.Mutex))
+	return mu.(*sync.Mutex)
+}
+
+// markstale marks the entry of the object of the key hash hs in the manifest
+// of its shard as stale, after a change of the object file. A line is
+// appended to the manifest, so neither the object nor the manifest is read.
+// Shards without manifest are left alone, as they are scanned by the next
+// Verify anyway. Failures are ignored, as an outdated entry does not match
+// the object file in most cases either.
+func (s *SOS) markstale(hs string) {
+	_, objname := s.hashpath(hs)
+	dir, name := path.Split(strings.TrimPrefix(objname, s.base+"/"))
+	filename := s.manifestpath(dir)
+
+	mu := s.manifestlock(dir)
+	mu.Lock()
+	defer mu.Unlock()
+
+	fh, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+	_, _ = fmt.Fprintf(fh, "%s 0 0 %s\n", name, staleSum)
+}
+
+// writeshardmanifest replaces the manifest of the shard directory dir
+// atomically. stored is the manifest which was read before the objects.
+// Objects which were deleted while reading are left out, and so are the
+// objects which were marked as stale since, so they are scanned again by the
+// next Verify.
+func (s *SOS) writeshardmanifest(dir string, stored map[string]manifestEntry, entries []manifestEntry) error {
+	if err := s.beginmodify(); err != nil {
+		return err
+	}
+	defer s.endmodify()
+
+	filename := s.manifestpath(dir)
+	mu := s.manifestlock(dir)
+	mu.Lock()
+	defer mu.Unlock()
+
+	current, err := readshardmanifest(filename)
+	if err != nil && !errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	for _, e := range entries {
+		if e.sum != "" && !newlystale(stored[e.name], current[e.name]) {
+			fmt.Fprintf(buf, "%s %d %d %s\n", e.name, e.size, e.mtime, e.sum)
+		}
+	}
+
+	tmpname := s.tmpfilename()
+	if err := s.writefile(tmpname, buf.Bytes()); err != nil {
+		return err
+	}
+	return s.commitfile(tmpname, filepath.Dir(filename), filename)
+}
+
+// newlystale reports whether the manifest entry cur was marked as stale
+// since the entry old was read.
+func newlystale(old, cur manifestEntry) bool {
+	if cur.sum != staleSum {
+		return false
+	}
+	return old.sum != staleSum || cur.size > old.size
+}
+
+// filesum returns the hex encoded SHA-256 checksum and the metadata of a
+// file.
+func filesum(filename string) (string, fs.FileInfo, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return "", nil, err
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), fi, nil
+}
@@ -0,0 +1,75 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test that only changed shards are scanned, and corruption is detected
+func TestVerify(t *testing.T) {
+	s := NewTemp(t, WithShardDepth(1))
+	for _, key := range []string{"a", "b", "c", "d"} {
+		s.StoreString(key, "value of "+key)
+	}
+
+	report, err := s.Verify(false)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if report.Shards != 4 || report.Scanned != 4 || report.Objects != 4 || report.Corrupt != nil {
+		t.Errorf("Got report %+v for the first verification, expected 4 scanned shards", report)
+	}
+
+	report, _ = s.Verify(false)
+	if report.Scanned != 0 || report.Objects != 0 {
+		t.Errorf("Got report %+v for an unchanged store, expected no scanned shard", report)
+	}
+
+	// Store marks the manifest entry as stale, so only its shard is scanned
+	s.StoreString("a", "new value")
+	s.Delete("c")
+	report, _ = s.Verify(false)
+	if report.Shards != 3 || report.Scanned != 1 || report.Objects != 1 || report.Corrupt != nil {
+		t.Errorf("Got report %+v after Store and Delete, expected 1 scanned shard", report)
+	}
+	report, _ = s.Verify(false)
+	if report.Scanned != 0 {
+		t.Errorf("Got report %+v after a verification, expected no scanned shard", report)
+	}
+
+	// changes by other means are scanned
+	_, filename := s.getpath("d")
+	os.WriteFile(filename, []byte("value of D"), 0o600)
+	report, _ = s.Verify(false)
+	if report.Scanned != 1 || report.Objects != 1 || report.Corrupt != nil {
+		t.Errorf("Got report %+v after an external change, expected 1 scanned shard", report)
+	}
+
+	// corrupt an object, keeping its size and modification time
+	_, filename = s.getpath("b")
+	fi, _ := os.Stat(filename)
+	os.WriteFile(filename, []byte("VALUE OF B"), 0o600)
+	os.Chtimes(filename, fi.ModTime(), fi.ModTime())
+
+	report, _ = s.Verify(false)
+	if report.Scanned != 0 {
+		t.Errorf("Got report %+v, expected the corruption to be unnoticed by a routine verification", report)
+	}
+
+	report, _ = s.Verify(true)
+	rel, _ := filepath.Rel(s.base, filename)
+	if report.Scanned != 3 || len(report.Corrupt) != 1 || report.Corrupt[0] != filepath.ToSlash(rel) {
+		t.Errorf("Got report %+v, expected the corrupt object %s", report, rel)
+	}
+
+	report, _ = s.Verify(true)
+	if len(report.Corrupt) != 1 {
+		t.Errorf("Got report %+v, expected the corrupt object to be reported again", report)
+	}
+}
@@ -0,0 +1,103 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// walk calls fn for every object file in the store. The relative path passed
+// to fn is the location of the object file below the base directory, in
+// slash separated form (e.g. "e3/b0/c44298fc...").
+//
+// Internal directories like .tmp (see reservedDirs), and files which are not
+// at a valid object location, are skipped. Objects which disappear while
+// walking are silently ignored.
+func (s *SOS) walk(fn func(rel string, fi fs.FileInfo) error) error {
+	return s.walkdir(s.base, fn)
+}
+
+// walkpartition is like walk, but only walks the objects of the partition p,
+// see partitions.
+func (s *SOS) walkpartition(p string, fn func(rel string, fi fs.FileInfo) error) error {
+	if p == "" {
+		return s.walk(fn)
+	}
+	err := s.walkdir(filepath.Join(s.base, p), fn)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // no objects in the partition
+	}
+	return err
+}
+
+// walkdir implements walk for the directory root, which is the base
+// directory or a top level shard directory.
+func (s *SOS) walkdir(root string, fn func(rel string, fi fs.FileInfo) error) error {
+	return filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name != root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		rel, _ := filepath.Rel(s.base, name)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if isreserved(d.Name()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !s.isobjectpath(rel) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		return fn(rel, fi)
+	})
+}
+
+// isobjectpath reports whether the slash separated relative path rel is a
+// valid object file location below the base directory.
+func (s *SOS) isobjectpath(rel string) bool {
+	if path.Clean(rel) != rel || !strings.HasSuffix(rel, s.suffix) {
+		return false
+	}
+	parts := strings.Split(strings.TrimSuffix(rel, s.suffix), "/")
+	if len(parts) != s.shardDepth+1 {
+		return false
+	}
+	for i, p := range parts {
+		n := 2
+		if i == s.shardDepth {
+			n = s.hashlen() - 2*s.shardDepth
+		}
+		if len(p) != n || strings.Trim(p, "0123456789abcdef") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// relhash returns the hex encoded key hash of the object file at the
+// relative path rel, as passed by walk.
+func (s *SOS) relhash(rel string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(rel, s.suffix), "/", "")
+}
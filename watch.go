@@ -0,0 +1,243 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultWatchInterval is the interval of polling watchers.
+const defaultWatchInterval = time.Second
+
+// watchBuffer is the number of events which are buffered for a watcher.
+const watchBuffer = 256
+
+// WithWatchPolling makes Watch poll the store every d, instead of using the
+// change notifications of the operating system. Polling is used anyway on
+// other systems than Linux, on network file systems like NFS, where changes
+// by other hosts are not notified, and when the notifications are not
+// available, e.g. if the limit of inotify watches is reached. Those watchers
+// poll every second by default, or every d if it was set.
+func WithWatchPolling(d time.Duration) Option {
+	return func(s *SOS) {
+		s.watchPoll = d
+	}
+}
+
+// Watch reports changes of the objects whose key starts with prefix, by
+// this and by other processes sharing the directory. It sends an event to
+// the returned channel for each object which is created ("Create"), changed
+// ("Update") or deleted ("Delete"), with the key and the size of the object
+// file. The watcher stops when the cancel function is called, or when the
+// store is closed, and then closes the channel.
+//
+// As the keys are known only from the key index, only objects stored with
+// WithKeyIndex or WithCollisionCheck are watched. Changes which happen in
+// quick succession may be reported as one event. The events are buffered;
+// if the receiver does not keep up, the watcher waits and may merge further
+// changes.
+//
+// On Linux, Watch uses inotify, with one watch per shard directory, see
+// WithWatchPolling.
+func (s *SOS) Watch(prefix string) (<-chan Event, context.CancelFunc) {
+	// the watcher runs with its own context, which is cancelled by the
+	// caller or when the store is closed, and stops the notifications
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-s.closing():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	w := &watcher{
+		s:      s,
+		prefix: prefix,
+		events: make(chan Event, watchBuffer),
+		ctx:    ctx,
+	}
+
+	// the notifications are set up before the first scan, so no change is
+	// missed in between
+	var changes <-chan string
+	if s.watchPoll <= 0 && !isnetworkfs(s.base) {
+		changes, _ = w.notify()
+	}
+	interval := s.watchPoll
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	known, err := w.scan()
+	if err != nil {
+		cancel()
+		close(w.events)
+		return w.events, cancel
+	}
+	w.known = known
+
+	go func() {
+		defer cancel() // stops the notifications
+		defer close(w.events)
+		if changes != nil {
+			w.runnotify(changes, interval)
+		} else {
+			w.runpoll(interval)
+		}
+	}()
+	return w.events, cancel
+}
+
+// watcher tracks the watched objects of a store.
+type watcher struct {
+	s      *SOS
+	prefix string
+	events chan Event
+	ctx    context.Context
+	known  map[string]watched // objects by key hash
+}
+
+// watched is the state of a watched object.
+type watched struct {
+	key   string
+	size  int64
+	mtime time.Time
+}
+
+// runpoll compares the objects with a new scan every interval.
+func (w *watcher) runpoll(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-t.C:
+		}
+		if !w.update() {
+			return
+		}
+	}
+}
+
+// runnotify checks the objects whose key hashes are received from changes.
+// An empty hash means that notifications were lost, so all objects are
+// scanned. If the notifications fail, the watcher falls back to polling
+// every interval.
+func (w *watcher) runnotify(changes <-chan string, interval time.Duration) {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case hs, ok := <-changes:
+			if !ok {
+				w.runpoll(interval)
+				return
+			}
+			if hs == "" {
+				ok = w.update()
+			} else {
+				ok = w.check(hs)
+			}
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// update scans the objects and emits the differences to the known objects.
+// It reports whether the watcher continues.
+func (w *watcher) update() bool {
+	objects, err := w.scan()
+	if err != nil {
+		return false
+	}
+	for hs, o := range w.known {
+		if _, ok := objects[hs]; !ok {
+			if !w.emit("Delete", o) {
+				return false
+			}
+		}
+	}
+	for hs, o := range objects {
+		old, ok := w.known[hs]
+		switch {
+		case !ok:
+			if !w.emit("Create", o) {
+				return false
+			}
+		case old.size != o.size || !old.mtime.Equal(o.mtime):
+			if !w.emit("Update", o) {
+				return false
+			}
+		}
+	}
+	w.known = objects
+	return true
+}
+
+// check emits the change of a single object, after a notification. The key
+// of a new object is read from the key index.
+func (w *watcher) check(hs string) bool {
+	old, ok := w.known[hs]
+	_, filename := w.s.hashpath(hs)
+	fi, err := os.Stat(filename)
+	if err != nil {
+		if ok && errors.Is(err, fs.ErrNotExist) {
+			delete(w.known, hs)
+			return w.emit("Delete", old)
+		}
+		return true
+	}
+
+	o := watched{key: old.key, size: fi.Size(), mtime: fi.ModTime()}
+	if !ok {
+		_, indexname := w.s.indexpath(hs)
+		key, err := os.ReadFile(indexname)
+		if err != nil || !strings.HasPrefix(string(key), w.prefix) {
+			return true // not indexed (yet), or not watched
+		}
+		o.key = string(key)
+	}
+	w.known[hs] = o
+	switch {
+	case !ok:
+		return w.emit("Create", o)
+	case old.size != o.size || !old.mtime.Equal(o.mtime):
+		return w.emit("Update", o)
+	}
+	return true
+}
+
+// scan returns the watched objects in the key index.
+func (w *watcher) scan() (map[string]watched, error) {
+	objects := make(map[string]watched)
+	err := w.s.Iterate(w.prefix, func(key string, info ObjectInfo) error {
+		objects[info.Hash] = watched{key: key, size: info.Size, mtime: info.ModTime}
+		return nil
+	})
+	return objects, err
+}
+
+// emit sends an event, unless the watcher was cancelled. It reports whether
+// the watcher continues.
+func (w *watcher) emit(op string, o watched) bool {
+	e := Event{Time: o.mtime, Op: op, Key: o.key, Bytes: o.size}
+	if op == "Delete" {
+		e.Time, e.Bytes = w.s.clock.Now(), 0
+	}
+	select {
+	case w.events <- e:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,196 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build linux
+
+package sos
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects the notifications of the watched directories.
+const inotifyMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_CLOSE_WRITE |
+	unix.IN_ATTRIB | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_ONLYDIR
+
+// isnetworkfs reports whether path is on a network file system, where
+// inotify does not notice the changes by other hosts.
+func isnetworkfs(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	switch uint32(st.Type) {
+	case unix.NFS_SUPER_MAGIC, unix.SMB_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC, unix.CIFS_SUPER_MAGIC:
+		return true
+	}
+	return false
+}
+
+// inotify watches the shard directories of the objects and of the key index.
+type inotify struct {
+	s    *SOS
+	fd   int              // for adding watches, as fh.Fd would make fh blocking
+	fh   *os.File         // for reading notifications, through the runtime poller
+	dirs map[int32]string // relative paths by watch descriptor
+}
+
+// notify starts watching the store with inotify. It sends the hashes of the
+// changed objects to the returned channel, and an empty hash if
+// notifications were lost. The channel is closed when the watcher is
+// cancelled or the notifications fail, e.g. when a new shard directory can
+// not be watched.
+func (w *watcher) notify() (<-chan string, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotify{s: w.s, fd: fd, fh: os.NewFile(uintptr(fd), "inotify"), dirs: make(map[int32]string)}
+	if _, err := n.addtree("."); err != nil {
+		n.fh.Close()
+		return nil, err
+	}
+
+	changes := make(chan string)
+	go func() {
+		<-w.ctx.Done()
+		n.fh.Close() // stops the reader
+	}()
+	go func() {
+		defer close(changes)
+		send := func(hs string) bool {
+			select {
+			case changes <- hs:
+				return true
+			case <-w.ctx.Done():
+				return false
+			}
+		}
+		buf := make([]byte, 64*1024)
+		for {
+			size, err := n.fh.Read(buf)
+			if err != nil {
+				return
+			}
+			hashes, err := n.parse(buf[:size])
+			for _, hs := range hashes {
+				if !send(hs) {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// parse handles the notifications in buf, and returns the hashes of the
+// changed objects.
+func (n *inotify) parse(buf []byte) ([]string, error) {
+	var hashes []string
+	for len(buf) >= unix.SizeofInotifyEvent {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := unix.SizeofInotifyEvent + int(ev.Len)
+		if end > len(buf) {
+			break
+		}
+		name := string(bytes.TrimRight(buf[unix.SizeofInotifyEvent:end], "\x00"))
+		buf = buf[end:]
+
+		dir, ok := n.dirs[ev.Wd]
+		switch {
+		case ev.Mask&unix.IN_Q_OVERFLOW != 0:
+			hashes = append(hashes, "")
+		case ev.Mask&unix.IN_IGNORED != 0:
+			delete(n.dirs, ev.Wd) // removed directory
+		case !ok:
+		case ev.Mask&unix.IN_ISDIR != 0:
+			if ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				// objects may be created before the watch
+				found, err := n.addtree(filepath.Join(dir, name))
+				hashes = append(hashes, found...)
+				if err != nil {
+					return hashes, err
+				}
+			}
+		default:
+			if hs, ok := n.hash(filepath.Join(dir, name)); ok {
+				hashes = append(hashes, hs)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// addtree watches the directory rel (relative to the base directory) and
+// its shard directories, and returns the hashes of the objects in them.
+func (n *inotify) addtree(rel string) ([]string, error) {
+	var hashes []string
+	root := filepath.Join(n.s.base, rel)
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name != root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		r, _ := filepath.Rel(n.s.base, name)
+		r = filepath.ToSlash(r)
+		if !d.IsDir() {
+			if hs, ok := n.hash(r); ok {
+				hashes = append(hashes, hs)
+			}
+			return nil
+		}
+		if !n.watchdir(r) {
+			return fs.SkipDir
+		}
+		wd, err := unix.InotifyAddWatch(n.fd, name, inotifyMask)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			return err // e.g. ENOSPC at the limit of watches
+		}
+		n.dirs[int32(wd)] = r
+		return nil
+	})
+	return hashes, err
+}
+
+// watchdir reports whether the directory rel is the base directory, the key
+// index or one of their shard directories.
+func (n *inotify) watchdir(rel string) bool {
+	if rel == "." {
+		return true
+	}
+	parts := strings.Split(rel, "/")
+	if parts[0] == dirIndex {
+		parts = parts[1:]
+	} else if isreserved(parts[0]) {
+		return false
+	}
+	return len(parts) <= n.s.shardDepth
+}
+
+// hash returns the hash of the object, or of the index entry, at rel.
+func (n *inotify) hash(rel string) (string, bool) {
+	if r, ok := strings.CutPrefix(rel, dirIndex+"/"); ok {
+		rel = r + n.s.suffix
+	}
+	if !n.s.isobjectpath(rel) {
+		return "", false
+	}
+	return n.s.relhash(rel), true
+}
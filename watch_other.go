@@ -0,0 +1,24 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build !linux
+
+package sos
+
+import "errors"
+
+// errNoNotify is returned on systems without change notifications.
+var errNoNotify = errors.New("change notifications not supported")
+
+// isnetworkfs reports no network file systems on this platform, as the
+// watchers poll anyway.
+func isnetworkfs(path string) bool {
+	return false
+}
+
+// notify is not supported on this platform, so the watchers poll.
+func (w *watcher) notify() (<-chan string, error) {
+	return nil, errNoNotify
+}
@@ -0,0 +1,115 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test watching changes by another process, with notifications and polling
+func TestWatch(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"notify": {WithKeyIndex()},
+		"poll":   {WithKeyIndex(), WithWatchPolling(10 * time.Millisecond)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewTemp(t, opts...)
+			s.StoreString("a/old", "value")
+			other, err := New(s.base, WithKeyIndex())
+			if err != nil {
+				t.Fatalf("Error opening store: %v", err)
+			}
+
+			events, cancel := s.Watch("a/")
+			defer cancel()
+
+			other.StoreString("b/ignored", "value")
+			other.StoreString("a/new", "value")
+			expectEvent(t, events, "Create", "a/new", 5)
+			other.StoreString("a/new", "new value")
+			expectEvent(t, events, "Update", "a/new", 9)
+			other.Delete("a/old")
+			expectEvent(t, events, "Delete", "a/old", 0)
+
+			// the channel is closed after cancel
+			cancel()
+			for range events {
+			}
+		})
+	}
+}
+
+// Test that the watcher stops when the store is closed, and releases the
+// notifications
+func TestWatchClose(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"notify": {WithKeyIndex()},
+		"poll":   {WithKeyIndex(), WithWatchPolling(10 * time.Millisecond)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewTemp(t, opts...)
+			before := inotifyfds()
+			events, cancel := s.Watch("")
+			defer cancel()
+
+			s.Close()
+			select {
+			case _, ok := <-events:
+				if ok {
+					t.Errorf("Got event after Close, expected closed channel")
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("Watcher did not stop after Close")
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for inotifyfds() > before && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if n := inotifyfds(); n > before {
+				t.Errorf("Got %d inotify descriptors after Close, expected %d", n, before)
+			}
+
+			events, _ = s.Watch("")
+			if _, ok := <-events; ok {
+				t.Errorf("Got event from closed store, expected closed channel")
+			}
+		})
+	}
+}
+
+// inotifyfds returns the number of open inotify descriptors of the process,
+// or 0 if they can not be listed.
+func inotifyfds() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, e := range entries {
+		link, _ := os.Readlink(filepath.Join("/proc/self/fd", e.Name()))
+		if strings.Contains(link, "inotify") {
+			n++
+		}
+	}
+	return n
+}
+
+// expectEvent waits for the next event and compares it.
+func expectEvent(t *testing.T, events <-chan Event, op, key string, n int64) {
+	t.Helper()
+	select {
+	case e := <-events:
+		if e.Op != op || e.Key != key || e.Bytes != n {
+			t.Errorf("Got event %s %q (%d bytes), expected %s %q (%d bytes)", e.Op, e.Key, e.Bytes, op, key, n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Got no event, expected %s %q", op, key)
+	}
+}
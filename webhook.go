@@ -0,0 +1,128 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultWebhookBackoff is the default wait before the first retry of a
+// failed delivery.
+const defaultWebhookBackoff = time.Second
+
+// Webhook is an EventSink which posts the events as JSON objects to a URL.
+// The events are queued and delivered in the background by Run, like with
+// EventQueue. It is also an EventPublisher, which delivers events
+// synchronously.
+//
+// If a secret is set, each request carries the header X-Sos-Signature with
+// the hex encoded HMAC-SHA256 of the request body, as "sha256=<hex>". The
+// header X-Sos-Event holds the operation of the event.
+//
+// Failed deliveries (network errors, status 429 and 5xx) are retried with
+// exponential backoff.
+type Webhook struct {
+	URL     string             // receiver of the events
+	Secret  []byte             // optional key for request signatures
+	Client  *http.Client       // optional, default http.DefaultClient
+	Retries int                // number of retries of a failed delivery
+	Backoff time.Duration      // wait before the first retry, default one second
+	OnError func(Event, error) // optional, receives undeliverable events
+
+	once  sync.Once
+	queue *EventQueue
+}
+
+// events returns the queue of the webhook.
+func (w *Webhook) events() *EventQueue {
+	w.once.Do(func() {
+		w.queue = &EventQueue{Publisher: w, OnError: w.OnError}
+	})
+	return w.queue
+}
+
+// Notify queues the event for delivery. It implements EventSink.
+func (w *Webhook) Notify(e Event) {
+	w.events().Notify(e)
+}
+
+// Run delivers the queued events until the context is cancelled, see
+// EventQueue.Run.
+func (w *Webhook) Run(ctx context.Context) error {
+	return w.events().Run(ctx)
+}
+
+// Publish delivers a single event synchronously, including the retries. It
+// implements EventPublisher.
+func (w *Webhook) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = defaultWebhookBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, e.Op, body)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// post sends the request once, and reports whether a failure is worth a
+// retry.
+func (w *Webhook) post(ctx context.Context, op string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sos-Event", op)
+	if w.Secret != nil {
+		mac := hmac.New(sha256.New, w.Secret)
+		mac.Write(body)
+		req.Header.Set("X-Sos-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook %s returned %s", w.URL, resp.Status)
+}
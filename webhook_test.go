@@ -0,0 +1,105 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test delivering events to a webhook, with signature and retry
+func TestWebhook(t *testing.T) {
+	secret := []byte("secret")
+	received := make(chan Event, 1)
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if sig := r.Header.Get("X-Sos-Signature"); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("Got invalid signature %q", sig)
+		}
+		if op := r.Header.Get("X-Sos-Event"); op != "Store" {
+			t.Errorf("Got event header %q, expected %q", op, "Store")
+		}
+
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("Invalid event %q: %v", body, err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hook := &Webhook{
+		URL:     srv.URL,
+		Secret:  secret,
+		Retries: 2,
+		Backoff: time.Millisecond,
+		OnError: func(e Event, err error) {
+			// the response to the last attempt may be cut off by cancel
+			if ctx.Err() == nil {
+				t.Errorf("Delivery of %+v failed: %v", e, err)
+			}
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		hook.Run(ctx)
+		close(done)
+	}()
+
+	s := NewTemp(t, WithEventSink(hook))
+	s.StoreString("hello", "world")
+
+	select {
+	case e := <-received:
+		if e.Op != "Store" || e.Key != "hello" || e.Bytes != 5 {
+			t.Errorf("Got event %+v, expected a Store of hello", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Got no event from webhook")
+	}
+	cancel()
+	<-done
+
+	if attempts != 2 {
+		t.Errorf("Got %d delivery attempts, expected 2", attempts)
+	}
+}
+
+// Test that client errors are not retried
+func TestWebhookClientError(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	hook := &Webhook{URL: srv.URL, Retries: 3, Backoff: time.Millisecond}
+	if err := hook.Publish(context.Background(), Event{Op: "Delete", Key: "x"}); err == nil {
+		t.Errorf("Got no error for a rejected event")
+	}
+	if attempts != 1 {
+		t.Errorf("Got %d delivery attempts, expected 1", attempts)
+	}
+}
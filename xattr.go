@@ -0,0 +1,52 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"archive/tar"
+	"strings"
+)
+
+// paxXattr is the prefix of PAX records which hold extended attributes, as
+// used by GNU tar and star.
+const paxXattr = "SCHILY.xattr."
+
+// paxxattrs returns the extended attributes of a file as PAX records.
+func paxxattrs(filename string) (map[string]string, error) {
+	attrs, err := getxattrs(filename)
+	if err != nil || len(attrs) == 0 {
+		return nil, err
+	}
+	records := make(map[string]string, len(attrs))
+	for name, value := range attrs {
+		records[paxXattr+name] = string(value)
+	}
+	return records, nil
+}
+
+// copyxattrs copies the extended attributes of a file to another file.
+func copyxattrs(src, dst string) error {
+	attrs, err := getxattrs(src)
+	if err != nil || len(attrs) == 0 {
+		return err
+	}
+	return setxattrs(dst, attrs)
+}
+
+// setpaxxattrs sets the extended attributes found in the PAX records of a
+// tar header on a file.
+func setpaxxattrs(filename string, hdr *tar.Header) error {
+	attrs := make(map[string][]byte)
+	for key, value := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(key, paxXattr); ok {
+			attrs[name] = []byte(value)
+		}
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return setxattrs(filename, attrs)
+}
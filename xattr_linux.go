@@ -0,0 +1,73 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build linux
+
+package sos
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// getxattrs returns the extended attributes of a file, including security
+// contexts like security.selinux. On file systems without extended
+// attributes, it returns no attributes and no error.
+func getxattrs(filename string) (map[string][]byte, error) {
+	size, err := unix.Listxattr(filename, nil)
+	if err != nil || size == 0 {
+		return nil, xattrerr("listxattr", filename, err)
+	}
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(filename, buf)
+	if err != nil {
+		return nil, xattrerr("listxattr", filename, err)
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		size, err := unix.Getxattr(filename, name, nil)
+		if err == nil {
+			value := make([]byte, size)
+			size, err = unix.Getxattr(filename, name, value)
+			attrs[name] = value[:size]
+		}
+		if errors.Is(err, unix.ENODATA) {
+			// removed in the meantime
+			delete(attrs, name)
+			continue
+		}
+		if err != nil {
+			return nil, xattrerr("getxattr", filename, err)
+		}
+	}
+	return attrs, nil
+}
+
+// setxattrs sets extended attributes of a file. On file systems without
+// extended attributes, the attributes are dropped silently.
+func setxattrs(filename string, attrs map[string][]byte) error {
+	for name, value := range attrs {
+		if err := unix.Setxattr(filename, name, value, 0); err != nil {
+			return xattrerr("setxattr", filename, err)
+		}
+	}
+	return nil
+}
+
+// xattrerr maps an error from an extended attribute system call. Missing
+// support for extended attributes is not an error.
+func xattrerr(op, filename string, err error) error {
+	if err == nil || errors.Is(err, unix.ENOTSUP) {
+		return nil
+	}
+	return &os.PathError{Op: op, Path: filename, Err: err}
+}
@@ -0,0 +1,18 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+//go:build !linux
+
+package sos
+
+// getxattrs returns no extended attributes on this platform.
+func getxattrs(filename string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// setxattrs drops extended attributes on this platform.
+func setxattrs(filename string, attrs map[string][]byte) error {
+	return nil
+}
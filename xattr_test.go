@@ -0,0 +1,53 @@
+// (c) 2020-2021 by Harald Weidner
+//
+// This library is released under the Mozilla License, version 2 (MPLv2).
+// See the LICENSE file for details.
+
+package sos
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Test that extended attributes survive export/import and copying
+func TestXattrs(t *testing.T) {
+	src := NewTemp(t)
+	src.StoreString("key", "value")
+	_, filename := src.getpath("key")
+
+	attrs := map[string][]byte{"user.sos.test": []byte("label\x00")}
+	if err := setxattrs(filename, attrs); err != nil {
+		t.Fatalf("Setting extended attributes failed: %v", err)
+	}
+	if got, _ := getxattrs(filename); len(got) == 0 {
+		t.Skip("extended attributes not supported")
+	}
+
+	check := func(s *SOS, how string) {
+		_, filename := s.getpath("key")
+		got, err := getxattrs(filename)
+		if err != nil {
+			t.Fatalf("Reading extended attributes failed: %v", err)
+		}
+		if !bytes.Equal(got["user.sos.test"], attrs["user.sos.test"]) {
+			t.Errorf("Got attribute %q after %s, expected %q", got["user.sos.test"], how, attrs["user.sos.test"])
+		}
+	}
+
+	export := new(bytes.Buffer)
+	if err := src.ExportTar(export); err != nil {
+		t.Fatalf("ExportTar failed: %v", err)
+	}
+	imported := NewTemp(t)
+	if _, err := imported.ImportTar(export, ImportOverwrite); err != nil {
+		t.Fatalf("ImportTar failed: %v", err)
+	}
+	check(imported, "import")
+
+	copied := NewTemp(t)
+	if err := src.CopyTo(copied, nil); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	check(copied, "copy")
+}